@@ -0,0 +1,124 @@
+// Package main - a per-user activity feed, filled from the event bus
+package main
+
+import (
+	"context"  // Event handlers get the publisher's context
+	"net/http" // For the feed handler
+	"slices"   // For listing newest first
+	"sync"     // For the mutex; events arrive from many requests at once
+	"time"     // For the event time
+)
+
+// The feed answers "what happened to this account?" - created, updated,
+// logged in, password changed. Handlers don't write to it: the activity log
+// subscribes to the same domain events as the welcome mail (see events.go),
+// so every code path that changes a user (JSON API, HTML form, settings)
+// shows up without remembering to call it. In Express this would be an
+// emitter.on(...) listener per event instead of a line in every route.
+
+// activityPerUser is how many entries are kept per user; older ones are dropped
+const activityPerUser = 200
+
+// activityEvents are the events that appear in a user's feed
+var activityEvents = []string{eventUserCreated, eventUserUpdated, eventUserLoggedIn, eventPasswordChanged}
+
+// activityEntry is one line in the feed
+type activityEntry struct {
+	Type    string    `json:"type"` // The event name, e.g. "user.updated"
+	At      time.Time `json:"at"`
+	Changed []string  `json:"changed,omitempty"` // Fields an update changed
+}
+
+// activityKey identifies a user across tenants - IDs alone repeat per tenant
+type activityKey struct {
+	tenantID string
+	userID   int
+}
+
+// activityLog stores the feed of every user, oldest first
+type activityLog struct {
+	mu      sync.Mutex
+	entries map[activityKey][]activityEntry
+}
+
+// newActivityLog creates an empty log
+func newActivityLog() *activityLog {
+	return &activityLog{entries: make(map[activityKey][]activityEntry)}
+}
+
+// subscribe records every activity event and forgets deleted users, so a
+// later user who gets the same ID starts with an empty feed
+func (l *activityLog) subscribe(bus *eventBus) {
+	for _, name := range activityEvents {
+		bus.subscribe(name, func(ctx context.Context, payload any) {
+			l.recordEvent(name, payload)
+		})
+	}
+	forget := func(ctx context.Context, payload any) {
+		if u, ok := payload.(User); ok {
+			l.forget(u.TenantID, u.ID)
+		}
+	}
+	bus.subscribe(eventUserDeleted, forget)
+	bus.subscribe(eventUserErased, forget) // The feed is personal data too
+}
+
+// recordEvent turns a published payload into an entry
+// A type switch is the multi-branch form of payload.(User): each case gets
+// v as that type
+func (l *activityLog) recordEvent(name string, payload any) {
+	switch v := payload.(type) {
+	case User:
+		l.record(v.TenantID, v.ID, activityEntry{Type: name, At: time.Now().UTC()})
+	case userChange:
+		l.record(v.After.TenantID, v.After.ID, activityEntry{Type: name, At: v.After.UpdatedAt, Changed: v.changedFields()})
+	}
+}
+
+// record appends e to a user's feed, dropping the oldest entry when it's full
+func (l *activityLog) record(tenantID string, userID int, e activityEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := activityKey{tenantID, userID}
+	entries := append(l.entries[key], e)
+	if len(entries) > activityPerUser {
+		entries = slices.Delete(entries, 0, len(entries)-activityPerUser)
+	}
+	l.entries[key] = entries
+}
+
+// list returns a copy of a user's feed, newest first
+func (l *activityLog) list(tenantID string, userID int) []activityEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Appending to []activityEntry{} copies, and keeps an empty feed [] instead of null
+	entries := append([]activityEntry{}, l.entries[activityKey{tenantID, userID}]...)
+	slices.Reverse(entries)
+	return entries
+}
+
+// forget removes a user's feed
+func (l *activityLog) forget(tenantID string, userID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, activityKey{tenantID, userID})
+}
+
+// getUserActivityHandler returns a user's feed, newest first, paginated (GET /users/{id}/activity)
+func (a *api) getUserActivityHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r) // 400 / 404 handled there (see htmx.go)
+	if !ok {
+		return
+	}
+	p, err := parsePage(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	entries := a.activity.list(u.TenantID, u.ID)
+	loc := locationFromContext(r.Context()) // Stored in UTC, shown in the caller's zone (see timezone.go)
+	for i := range entries {
+		entries[i].At = entries[i].At.In(loc)
+	}
+	respondPage(w, r, entries, p)
+}
@@ -3,110 +3,364 @@ package main
 
 // Import statements - bringing in external packages we need
 import (
-	"encoding/json" // For JSON encoding/decoding (marshal/unmarshal)
-	"errors"        // For creating custom error messages
-	"net/http"      // For HTTP server functionality
+	"cmp"      // For three-way comparisons in the sort keys
+	"context"  // For the context of published events
+	"fmt"      // For the welcome email body
+	"log/slog" // For the injected logger type
+	"net/http" // For HTTP server functionality
+	"runtime"  // For the default worker count
+	"strings"  // For case-insensitive name sorting
+	"time"     // For the process start time
 )
 
-// api struct holds configuration for our API server
+// api struct holds the dependencies of our HTTP handlers
 // In Go, we use structs instead of classes for data organization
+// Every field is set by NewAPI - handlers never reach for package-level state
 type api struct {
-	addr string // Server address (e.g., ":8080")
+	addr        string                     // Server address (e.g., ":8080")
+	users       UserService                // Users, behind an interface (see service.go)
+	posts       *Repository[Post]          // Posts (see posts.go)
+	tags        *Repository[Tag]           // Tags (see posts.go)
+	logger      *slog.Logger               // Where handlers log (see logging.go)
+	mailer      Mailer                     // Outgoing email (see mailer.go)
+	blobs       *blobStore                 // Uploaded binary data (see binary.go)
+	procs       procsReport                // How GOMAXPROCS was chosen at startup (see procs.go)
+	templates   map[string]pageSet         // Parsed HTML pages and partials per locale (see web.go)
+	messages    *catalog                   // Translations for the negotiated locale (see i18n.go)
+	jobs        *workerPool                // Background workers for image processing (see jobs.go)
+	avatarSize  int                        // Thumbnail edge length in pixels (-avatar-size)
+	tenants     *tenantStore               // Registered tenants (see tenant.go)
+	flags       *featureFlags              // Feature flags (see featureflags.go)
+	started     time.Time                  // Process start, for uptime in GET /admin/stats
+	health      *healthChecker             // Backend status for GET /readyz (see health.go)
+	weather     *weatherService            // Third-party weather lookups (see weather.go)
+	maintenance *maintenanceMode           // Maintenance mode toggle (see maintenance.go)
+	requestLog  *ringBuffer[requestRecord] // The last requests for GET /admin/requests; nil when off (see requestlog.go)
+	dumps       *ringBuffer[requestDump]   // Recorded requests for GET /admin/debug/requests; nil when off (see debugdump.go)
+	activity    *activityLog               // Per-user activity feeds, filled from events (see activity.go)
+	operations  *operationStore            // Async exports/imports polled via GET /operations/{id} (see operations.go)
+	purger      *purger                    // Removes soft-deleted users after the retention period (see purge.go)
+	signer      *urlSigner                 // Signs expiring download links (see signedurl.go)
+	tokens      *jwtIssuer                 // Issues and verifies login tokens (see jwt.go)
+	refresh     *refreshStore              // Refresh tokens, rotated on use (see refreshtoken.go)
+	oidc        *oidcLogin                 // "Log in with <provider>"; nil when -oidc-issuer is unset (see oidclogin.go)
+	captcha     *loginGuard                // CAPTCHA after repeated failed logins; nil when -captcha is unset (see captcha.go)
+	dashboard   *dashboardHub              // Live metrics for GET /admin/dashboard (see dashboard.go)
+	store       storeInfo                  // Backend of the UserStore, reported by GET /admin/stats
+	config      *runtimeConfig             // Effective startup configuration for GET /admin/config (see config.go)
 }
 
-// Package-level variable to store our users in memory
-// []User means "slice of User" - like an array but more flexible
-// var declares a variable at package level (accessible throughout the package)
-var users = []User{}
+// apiConfig is what NewAPI needs besides its core dependencies: settings from
+// flags/env and the components main() builds at startup (templates, secrets-
+// backed health checks, the outbound weather client)
+type apiConfig struct {
+	Addr        string
+	AvatarSize  int
+	Workers     int // Image workers; 0 = one per CPU
+	Procs       procsReport
+	Templates   map[string]pageSet
+	Messages    *catalog
+	Tenants     *tenantStore
+	Blobs       *blobStore // Uploaded files, in memory or in a directory (see binary.go)
+	Posts       *Repository[Post]
+	Tags        *Repository[Tag]
+	Flags       *featureFlags
+	Health      *healthChecker
+	Weather     *weatherService
+	Maintenance *maintenanceMode
+	Retention   time.Duration // How long soft-deleted users are kept (-retention)
+	Dumps       *ringBuffer[requestDump]
+	RequestLog  *ringBuffer[requestRecord]
+	Signer      *urlSigner     // Signs and verifies shared links (see signedurl.go)
+	Tokens      *jwtIssuer     // Signs and verifies login tokens (see jwt.go)
+	OIDC        *oidcLogin     // OpenID Connect login; nil = off (see oidclogin.go)
+	Captcha     *loginGuard    // Brute-force protection for logins; nil = off (see captcha.go)
+	Store       storeInfo      // Which UserStore main() picked (see stats.go)
+	Runtime     *runtimeConfig // Filled in by main() while it wires the server (see config.go)
+}
+
+// NewAPI is the constructor: every dependency comes in as a parameter, so
+// main() is the only place where concrete types are chosen ("composition
+// root") and a test can pass a stub UserService, a discarding logger or a
+// fake Mailer. This is plain constructor injection - what NestJS/InversifyJS do
+// with decorators and Go's wire/fx generate or resolve at runtime, written by hand
+func NewAPI(cfg apiConfig, users UserService, logger *slog.Logger, mailer Mailer, bus *eventBus) *api {
+	workers := cfg.Workers
+	if workers <= 0 {
+		// One worker per CPU: image work is CPU-bound, more workers would only wait for a core
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	a := &api{
+		addr:        cfg.Addr,
+		users:       users,
+		posts:       cfg.Posts,
+		tags:        cfg.Tags,
+		logger:      logger,
+		mailer:      mailer,
+		blobs:       cfg.Blobs,
+		procs:       cfg.Procs,
+		templates:   cfg.Templates,
+		messages:    cfg.Messages,
+		jobs:        newWorkerPool(workers, 64, logger),
+		avatarSize:  cfg.AvatarSize,
+		tenants:     cfg.Tenants,
+		flags:       cfg.Flags,
+		started:     time.Now(),
+		health:      cfg.Health,
+		weather:     cfg.Weather,
+		maintenance: cfg.Maintenance,
+		dumps:       cfg.Dumps,
+		requestLog:  cfg.RequestLog,
+		activity:    newActivityLog(),
+		operations:  newOperationStore(),
+		purger:      newPurger(users, cfg.Retention, logger),
+		signer:      cfg.Signer,
+		tokens:      cfg.Tokens,
+		refresh:     newRefreshStore(),
+		oidc:        cfg.OIDC,
+		captcha:     cfg.Captcha,
+		dashboard:   newDashboardHub(bus),
+		store:       cfg.Store,
+		config:      cfg.Runtime,
+	}
+
+	// Reactions to domain events are wired here, next to the dependencies they use
+	bus.subscribe(eventUserCreated, a.sendWelcomeMail)
+	a.activity.subscribe(bus)
+	a.refresh.subscribe(bus)
+	return a
+}
+
+// sendWelcomeMail greets a new user (subscribed to user.created)
+func (a *api) sendWelcomeMail(ctx context.Context, payload any) {
+	// A type assertion gets the concrete value back out of an any
+	// The ", ok" form returns false instead of panicking on a mismatch
+	u, ok := payload.(User)
+	if !ok {
+		return
+	}
+	err := a.mailer.Send(ctx, mailMessage{
+		To:      u.Email,
+		Subject: "Welcome!",
+		Body:    fmt.Sprintf("Hi %s, your account was created.", u.Name),
+	})
+	if err != nil {
+		a.logger.ErrorContext(ctx, "welcome mail failed", "to", u.Email, "err", err)
+	}
+}
+
+// userSortKeys are the keys GET /users accepts in ?sort= (see sort.go)
+// Names are compared case-insensitively, so "ada" sorts next to "Ada"
+var userSortKeys = sortKeys[User]{
+	"id":         {Column: "id", Compare: func(a, b User) int { return cmp.Compare(a.ID, b.ID) }},
+	"name":       {Column: "name", Compare: func(a, b User) int { return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) }},
+	"email":      {Column: "email", Compare: func(a, b User) int { return cmp.Compare(a.Email, b.Email) }},
+	"created_at": {Column: "created_at", Compare: func(a, b User) int { return a.CreatedAt.Compare(b.CreatedAt) }},
+	"updated_at": {Column: "updated_at", Compare: func(a, b User) int { return a.UpdatedAt.Compare(b.UpdatedAt) }},
+}
+
+// userListSpec is everything GET /users accepts besides ?fields=: filters,
+// sort keys and the default order (see query.go)
+var userListSpec = listSpec[User]{
+	Filters: filterFields[User]{
+		"id":         intField("id", func(u User) int { return u.ID }),
+		"name":       stringField("name", func(u User) string { return u.Name }),
+		"email":      normalizedField("email", func(u User) string { return u.Email }, normalizeEmail),
+		"created_at": timeField("created_at", func(u User) time.Time { return u.CreatedAt }),
+		"updated_at": timeField("updated_at", func(u User) time.Time { return u.UpdatedAt }),
+	},
+	Sort:        userSortKeys,
+	DefaultSort: "id",
+	ID:          func(u User) int { return u.ID },
+}
 
 // Method definition: (receiver) functionName(parameters) returnType
 // (a *api) is the receiver - this function "belongs to" the api struct
 // *api means "pointer to api" - allows us to modify the original struct
 func (a *api) getUsersHandler(w http.ResponseWriter, r *http.Request) {
-	// Set HTTP response header to indicate we're returning JSON
-	// w.Header() returns a map-like structure for HTTP headers
-	w.Header().Set("Content-Type", "application/json")
-
-	// json.NewEncoder(w) creates a JSON encoder that writes directly to the response
-	// .Encode(users) converts our users slice to JSON and writes it to the response
-	// This is more efficient than json.Marshal() for HTTP responses
-	err := json.NewEncoder(w).Encode(users)
+	// Filters, ?sort= and ?page=/?per_page= in one go, checked against
+	// userListSpec (see query.go); "id" breaks ties
+	q, err := parseListQuery(r, userListSpec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Only the users of the tenant resolved by the tenant middleware (see tenant.go)
+	// The store runs the query: the in-memory one applies it to a slice, a
+	// SQL store turns it into WHERE / ORDER BY / LIMIT, so only this page is loaded
+	users, meta, err := a.users.Query(r.Context(), tenantFromContext(r.Context()), q)
+	// Presenting a page is wasted if the client already hung up (see cancel.go)
+	if a.clientGone(r) {
+		w.WriteHeader(statusClientClosedRequest) // Nobody reads it; the access log shows 499
+		return
+	}
 	if err != nil {
-		// http.Error sends an HTTP error response with the specified message and status code
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return // Exit the function early if there's an error
+		a.respondError(w, r, err) // Logged as a 500
+		return
 	}
+	setLinkHeader(w, r, meta)
 
-	// Set HTTP status code to 200 OK
-	// Note: when using json.NewEncoder(w).Encode(), this should come after encoding
-	w.WriteHeader(http.StatusOK)
+	// The presenter (see presenter.go) turns stored users into the public
+	// response shape: local timestamps, avatar URLs, links, ?fields= selection
+	// Only the users on this page are presented
+	respondPresented(w, r, http.StatusOK, userFields, pageBody{Data: presentUsers(r, users), Meta: meta})
+}
+
+// getUserHandler returns one user (GET /users/{id}) - the "self" link of every user
+// Express: app.get('/users/:id', (req, res) => { const id = Number(req.params.id); ... })
+func (a *api) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	// r.PathValue returns the {id} segment of the matched pattern as a string
+	// (Go 1.22+); pathInt parses it, or fails with a 400 (see params.go).
+	// userIDFromPath also takes a UUID in its place (see ids.go)
+	id, err := a.userIDFromPath(r)
+	if err != nil {
+		a.respondError(w, r, err) // 400 {"error":{"code":"invalid_path_param",...}}
+		return
+	}
+
+	u, err := a.users.Get(r.Context(), tenantFromContext(r.Context()), id)
+	if err != nil {
+		// errUserNotFound: 404 {"error":{"code":"not_found","message":"user not found"}} (see errors.go)
+		a.respondError(w, r, err)
+		return
+	}
+	respondPresented(w, r, http.StatusOK, userFields, presentUser(r, u))
+}
+
+// newUserRequest is the body of POST /users: the user's fields plus an
+// optional password, which User itself never reads from JSON (json:"-")
+// Embedding promotes User's fields, so {"name":..., "email":..., "password":...} fills both
+type newUserRequest struct {
+	User
+	Password string `json:"password"`
 }
 
 // Handler for creating new users via POST requests
 func (a *api) createUserHandler(w http.ResponseWriter, r *http.Request) {
-	// var payload User declares a variable of type User with zero values
-	// Zero values: int=0, string="", bool=false, pointers=nil
-	var payload User
-
-	// json.NewDecoder(r.Body) creates a decoder that reads from the request body
-	// .Decode(&payload) parses JSON and fills our payload struct
-	// &payload gives the memory address of payload (required for modification)
-	err := json.NewDecoder(r.Body).Decode(&payload)
+	// decode[newUserRequest] parses the JSON body into a newUserRequest (see jsonio.go)
+	// [newUserRequest] is a type argument - it tells the generic function what to decode into
+	payload, err := decode[newUserRequest](r)
 	if err != nil {
-		// Return 400 Bad Request if JSON is malformed
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		// 400 Bad Request for malformed JSON, 413 for oversized bodies
+		writeError(w, err)
 		return
 	}
 
 	// Create a new User struct using struct literal syntax
 	// User{field: value, field: value} creates and initializes a struct
+	// The ID is assigned by the store, so we only copy the client's fields
 	u := User{
-		ID:    len(users) + 1, // Simple ID generation
-		Name:  payload.Name,   // Copy name from the request
-		Email: payload.Email,  // Copy email from the request
+		Name:     payload.Name,                   // Copy name from the request
+		Email:    payload.Email,                  // Copy email from the request
+		Password: payload.Password,               // Optional; hashed by the service, never stored as is
+		TenantID: tenantFromContext(r.Context()), // Never trust a tenant from the body
 	}
 
 	// Call our validation function
-	// Functions can return multiple values - here we only care about the error
-	err = insertUser(u)
+	// Functions can return multiple values - the stored user (with its ID) and an error
+	created, err := a.users.Create(r.Context(), u)
 	if err != nil {
-		// Return 400 Bad Request if validation fails
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		// 400 if validation fails, 409 for a taken email, in the client's
+		// language; errors.go maps each error to its status
+		a.respondError(w, r, err)
 		return
 	}
 
-	// Set HTTP status code to 201 Created (indicates successful creation)
-	w.WriteHeader(http.StatusCreated)
+	// 201 Created with a Location header pointing at the new resource,
+	// and the presented user as the body so the client learns its ID
+	body := presentUser(r, created)
+	w.Header().Set("Location", body.Links["self"].Href)
+	respondPresented(w, r, http.StatusCreated, userFields, body)
 }
 
-// insertUser validates and adds a user to our in-memory storage
-// Returns an error if validation fails, nil if successful
-// This demonstrates Go's error handling pattern: return error as last value
-func insertUser(u User) error {
-	// Validation: check required fields
-	// In Go, empty string is "", not null/undefined like in JavaScript
-	if u.Email == "" {
-		// errors.New() creates a new error with the given message
-		return errors.New("email is required")
+// updateUserHandler replaces a user's name and email (PUT /users/{id})
+// Express: app.put('/users/:id', ...) with req.params.id; Go 1.22 patterns
+// put the method and the {id} wildcard in the route, r.PathValue reads it
+func (a *api) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r) // 400 for a non-numeric id, 404 if missing (see htmx.go)
+	if !ok {
+		return
 	}
-	if u.Name == "" {
-		return errors.New("name is required")
+	payload, err := decode[User](r)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	// Check for duplicate emails
-	// for range loops over slices, arrays, maps, channels, strings
-	// _ discards the index, user gets each User in the slice
-	for _, user := range users {
-		if user.Email == u.Email {
-			return errors.New("email already exists")
-		}
+	// PUT replaces the client-editable fields; ID, tenant, timestamps,
+	// avatar and settings stay as stored
+	u.Name = payload.Name
+	u.Email = payload.Email
+	updated, err := a.users.Update(r.Context(), u)
+	if err != nil {
+		// 404 if deleted between the lookup and the update, 400/409 as for create
+		a.respondError(w, r, err)
+		return
+	}
+	respondPresented(w, r, http.StatusOK, userFields, presentUser(r, updated))
+}
+
+// userPatch is the body of PATCH /users/{id}: only the fields sent change
+// A plain string can't tell {"name":""} from {} - both decode to "" - the Go
+// side of JavaScript's undefined vs "". A *string can: nil when the field is
+// missing, a pointer to "" when it was sent empty (which then fails validation
+// like any empty name). settingsPatch (settings.go) uses the same technique.
+// JSON null decodes to nil as well, so {"name":null} leaves the name alone;
+// to give null a meaning of its own, decode into map[string]json.RawMessage
+// and check which keys are there and what they hold
+type userPatch struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+// patchUserHandler changes some of a user's fields and keeps the rest (PATCH /users/{id})
+// Express: app.patch('/users/:id', ...) with Object.assign(user, req.body)
+//
+//	curl -X PATCH -H "Authorization: Bearer $TOKEN" -d '{"name":"Ada K"}' localhost:8080/users/1   # email unchanged
+func (a *api) patchUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r) // 400 for a malformed id, 404 if missing (see htmx.go)
+	if !ok {
+		return
+	}
+	patch, err := decode[userPatch](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if patch.Name == nil && patch.Email == nil {
+		// Nothing to change: answer with the user as stored, updated_at untouched
+		respondPresented(w, r, http.StatusOK, userFields, presentUser(r, u))
+		return
 	}
 
-	// append() adds elements to a slice and returns a new slice
-	// In Go, slices can grow dynamically (unlike arrays which have fixed size)
-	users = append(users, u)
+	// Dereference only what was sent - *patch.Name reads the string the pointer points to
+	if patch.Name != nil {
+		u.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		u.Email = *patch.Email
+	}
+	updated, err := a.users.Update(r.Context(), u)
+	if err != nil {
+		// The same 404/409/422 as PUT; an empty name sent on purpose is a 422
+		a.respondError(w, r, err)
+		return
+	}
+	respondPresented(w, r, http.StatusOK, userFields, presentUser(r, updated))
+}
 
-	// Return nil (no error) to indicate success
-	// nil is Go's equivalent to null/undefined for pointers, slices, maps, channels, interfaces
-	return nil
+// deleteUserHandler removes a user (DELETE /users/{id})
+// 204 No Content: the deletion worked and there is nothing to send back
+func (a *api) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := a.users.Delete(r.Context(), u.TenantID, u.ID); err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,122 @@
+// Package main - embedded static assets with cache-busting hashed filenames
+package main
+
+import (
+	"embed"    // go:embed bundles static/ into the binary
+	"io/fs"    // For the filesystem interfaces http.FileServerFS works with
+	"net/http" // For the file server and headers
+	"path"     // For splitting file names into base and extension
+	"strings"  // For building and recognising hashed names
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For content hashes in asset names
+)
+
+// staticFS holds every file under static/ at compile time, so the binary
+// is fully self-contained - no "public" folder to copy next to it
+// (Express: app.use(express.static('public')) needs the folder at runtime)
+//
+//go:embed static
+var staticFS embed.FS
+
+// assetManifest maps logical names ("app.css") to hashed names ("app.1a2b3c4d5e.css")
+// and back. Hashed URLs change whenever the file content changes, so
+// browsers can cache them forever - the same trick webpack's [contenthash] does
+type assetManifest struct {
+	hashed  map[string]string // "app.css" → "app.1a2b3c4d5e.css"
+	logical map[string]string // "app.1a2b3c4d5e.css" → "app.css"
+	etags   map[string]string // "app.css" → content hash, used as the ETag
+	files   fs.FS             // static/ with the "static" prefix stripped
+}
+
+// newAssetManifest hashes every embedded static file
+func newAssetManifest() (*assetManifest, error) {
+	// fs.Sub makes "static/app.css" available as just "app.css"
+	files, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &assetManifest{
+		hashed:  make(map[string]string),
+		logical: make(map[string]string),
+		etags:   make(map[string]string),
+		files:   files,
+	}
+
+	// fs.WalkDir visits every file and directory, like a recursive readdir
+	err = fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+
+		// "img/logo.svg" → "img/logo.<hash>.svg"
+		hash := cryptoutil.SHA256Hex(data)[:10] // 10 hex chars is plenty to detect changes
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hash + ext
+		m.hashed[name] = hashedName
+		m.logical[hashedName] = name
+		m.etags[name] = `"` + hash + `"`
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// url returns the public, cache-busted URL for a logical asset name
+// Used from templates as {{asset "app.css"}}
+func (m *assetManifest) url(name string) string {
+	if hashed, ok := m.hashed[name]; ok {
+		return "/static/" + hashed
+	}
+	// Unknown assets fall back to the plain name (served without long caching)
+	return "/static/" + name
+}
+
+// Open implements fs.FS, resolving hashed names to the real embedded file
+// This lets http.FileServerFS serve "app.1a2b3c4d5e.css" from "app.css"
+func (m *assetManifest) Open(name string) (fs.File, error) {
+	if logical, ok := m.logical[name]; ok {
+		name = logical
+	}
+	return m.files.Open(name)
+}
+
+// handler serves the embedded assets under /static/ with caching headers
+func (m *assetManifest) handler() http.Handler {
+	// http.FileServerFS (Go 1.22+) serves any fs.FS and sets Content-Type
+	// from the file extension; StripPrefix removes "/static/" first
+	files := http.StripPrefix("/static/", http.FileServerFS(m))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/static/")
+
+		// Don't expose directory listings
+		if name == "" || strings.HasSuffix(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		logical, hashed := m.logical[name]
+		if hashed {
+			// Hashed URL: the content can never change, so cache for a year
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			// Plain URL: allow caching but make browsers revalidate every time
+			w.Header().Set("Cache-Control", "no-cache")
+			logical = name
+		}
+
+		// embed.FS files have no modification time, so give FileServer an
+		// ETag instead - it then answers If-None-Match with 304 Not Modified
+		if etag, ok := m.etags[logical]; ok {
+			w.Header().Set("ETag", etag)
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,64 @@
+// Package main - authentication behind an interface, and the admin middleware
+package main
+
+import (
+	"crypto/subtle" // Constant-time comparison of the admin token
+	"errors"        // For the authentication errors
+	"net/http"      // For the request being checked
+	"strings"       // For parsing the Authorization header
+)
+
+// Authentication errors, mapped to status codes by requireAdmin
+var (
+	errAuthDisabled = errors.New("admin API disabled: configure the admin_token secret (e.g. ADMIN_TOKEN)")
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// Authenticator decides who is calling: it returns the caller's identity
+// ("principal"), or an error when the request carries no valid credentials
+// requireAdmin and the rate limiter only know this one method, so the bearer
+// token below could be swapped for JWTs, mTLS or - in a test - a stub that
+// always says yes (Passport strategies play the same role in Express)
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal string, err error)
+}
+
+// bearerToken accepts "Authorization: Bearer <token>"
+// token is a func so a rotated secret (see secrets.go) applies without a restart
+type bearerToken struct {
+	token func() string
+}
+
+// Authenticate implements Authenticator; the only principal is "admin"
+// When no token is configured the admin API is switched off entirely
+func (b bearerToken) Authenticate(r *http.Request) (string, error) {
+	token := b.token() // Read the current value once per request
+	if token == "" {
+		return "", errAuthDisabled
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	// ConstantTimeCompare avoids leaking how many characters matched
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return "", errUnauthorized
+	}
+	return "admin", nil
+}
+
+// requireAdmin only lets requests through that auth accepts
+func requireAdmin(auth Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := auth.Authenticate(r)
+			switch {
+			case errors.Is(err, errAuthDisabled):
+				writeJSONError(w, http.StatusForbidden, err.Error())
+				return
+			case err != nil:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeJSONError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
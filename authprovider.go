@@ -0,0 +1,459 @@
+// Package main - pluggable authentication: providers, the principal they produce, and requireAuth
+package main
+
+import (
+	"context"       // For the principal on the request
+	"crypto/subtle" // Constant-time API key comparison
+	"errors"        // For errNoCredentials
+	"fmt"           // For configuration errors and WWW-Authenticate
+	"html"          // For the message in HTML refusals
+	"log/slog"      // For the audit records of impersonated requests
+	"net/http"      // For requests and middleware
+	"net/url"       // For the session's Origin check
+	"slices"        // For sorting the known provider names
+	"strings"       // For headers and the provider list
+	"time"          // For token expiry
+)
+
+// A request can prove who sent it in several ways: a JWT in the
+// Authorization header (jwt.go), the same token in a session cookie, an API
+// key, a TLS client certificate, or the admin token. Each way is an
+// AuthProvider, and all of them produce the same Principal - so requireAuth,
+// the {id} ownership check and GET /me never ask which one it was. It's
+// Passport's model: passport.authenticate(['jwt', 'session', 'headerapikey']),
+// strategies tried in order, req.user at the end.
+//
+// The providers and their order come from -auth-providers:
+//
+//	-auth-providers=admin_token,jwt,session,api_key,mtls   (default)
+//	-auth-providers=mtls,api_key                           (machine clients only)
+
+// Kinds of principal; what each may do is decided by its role (see roles.go)
+const (
+	principalUser    = "user"    // A person with an account; on /users/{id} routes only their own, unless an admin
+	principalService = "service" // A machine client (API key, client certificate)
+	principalAdmin   = "admin"   // The admin token
+)
+
+// Principal is whoever made the request, whichever provider proved it
+type Principal struct {
+	Kind         string   `json:"kind"`                   // principalUser, principalService or principalAdmin
+	Subject      string   `json:"subject"`                // User ID, API key name, certificate CN, "admin"
+	Scheme       string   `json:"scheme"`                 // The provider that authenticated it ("jwt", "mtls", ...)
+	Role         string   `json:"role"`                   // roleUser, roleAdmin or roleService; checked by requireRole
+	Scopes       []string `json:"scopes"`                 // What this credential may be used for; checked by requireScope
+	TenantID     string   `json:"tenant,omitempty"`       // Users only: the tenant their account is in
+	Session      string   `json:"session,omitempty"`      // Users only: the login the token belongs to (see sessions.go)
+	Impersonator string   `json:"impersonator,omitempty"` // Users only: the ID of the admin acting as this user (see impersonate.go)
+	User         *User    `json:"-"`                      // Users only: loaded fresh on every request
+}
+
+// key identifies the principal across requests and providers: "user:9",
+// "service:billing", "admin:admin" - for things only their starter may see (see operations.go)
+func (p Principal) key() string {
+	return p.Kind + ":" + p.Subject
+}
+
+// errNoCredentials means a request carries nothing this provider understands,
+// so the chain moves on; every other error means "credentials present but
+// wrong" and rejects the request - a bad token must not fall through to a
+// weaker scheme
+var errNoCredentials = errors.New("no credentials")
+
+// AuthProvider authenticates requests with one scheme
+type AuthProvider interface {
+	Name() string                                    // As listed in -auth-providers
+	Authenticate(r *http.Request) (Principal, error) // errNoCredentials if the request has none of ours
+}
+
+// authChain tries its providers in order; the first that recognizes the
+// request's credentials decides
+type authChain []AuthProvider
+
+// authProviderNames are the names -auth-providers accepts, checked at startup
+// before the providers exist (see configcheck.go); main() maps each to its provider
+var authProviderNames = []string{"admin_token", "jwt", "session", "api_key", "mtls"}
+
+// newAuthChain picks providers from available by name, in the given order
+// An unknown name is a startup error, not a silently missing scheme
+func newAuthChain(names []string, available map[string]AuthProvider) (authChain, error) {
+	var chain authChain
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p, ok := available[name]
+		if !ok {
+			known := make([]string, 0, len(available))
+			for k := range available {
+				known = append(known, k)
+			}
+			slices.Sort(known)
+			return nil, fmt.Errorf("unknown auth provider %q (known: %s)", name, strings.Join(known, ", "))
+		}
+		chain = append(chain, p)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no auth providers configured")
+	}
+	return chain, nil
+}
+
+// authenticate asks each provider in turn
+func (c authChain) authenticate(r *http.Request) (Principal, error) {
+	for _, p := range c {
+		principal, err := p.Authenticate(r)
+		if errors.Is(err, errNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return Principal{}, fmt.Errorf("%s: %w", p.Name(), err)
+		}
+		return principal, nil
+	}
+	return Principal{}, errNoCredentials
+}
+
+// names lists the providers in order, for error messages and GET /admin/config
+func (c authChain) names() []string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// principalKey is the context key for the authenticated principal (see ctxvalue.go)
+var principalKey = newCtxKey[Principal]("principal")
+
+// withPrincipal returns a copy of ctx carrying p; requireAuth calls it
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return principalKey.with(ctx, p)
+}
+
+// principalFromContext returns the principal identify or requireAuth put on the request
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	return principalKey.from(ctx)
+}
+
+// userFromContext returns the user whose credentials authenticated the request
+// ok is false for services, the admin token and outside requireAuth - so
+// a handler behind requireAuth gets the caller like req.user in Passport,
+// without loading them a second time
+func userFromContext(ctx context.Context) (*User, bool) {
+	p, ok := principalFromContext(ctx)
+	if !ok || p.User == nil {
+		return nil, false
+	}
+	return p.User, true
+}
+
+// identify puts the Principal in the context when one of chain's providers
+// authenticates the request, and lets every request through either way -
+// passport.authenticate(..., { session: false }) with a callback that never
+// fails. Public routes run it so per-caller limits like the API key quota
+// (see quota.go) see who is asking; requireAuth then reuses the principal,
+// and answers for missing or bad credentials itself
+func identify(chain authChain) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if principal, err := chain.authenticate(r); err == nil {
+				r = r.WithContext(withPrincipal(r.Context(), principal))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAuth only lets requests through that one of chain's providers
+// authenticates, and puts the Principal in the context
+// A principal identify already found is used as it is, so the credentials
+// are checked once per request
+// On routes with an {id}, a user may only act on their own account, guests
+// on none; services and the admin token may act on any (see mayAccessAccount)
+func requireAuth(chain authChain) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := principalFromContext(r.Context())
+			var err error
+			if !ok {
+				principal, err = chain.authenticate(r)
+			}
+			if errors.Is(err, errNoCredentials) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="users"`)
+				refuse(w, r, http.StatusUnauthorized, "log in first: send Authorization: Bearer <token> (see POST /auth/login)")
+				return
+			}
+			if err != nil {
+				// RFC 6750: for a bad token, say why
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="users", error="invalid_token", error_description=%q`, err.Error()))
+				refuse(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+			// r.PathValue works here: route middleware runs after the mux matched the pattern
+			// A malformed {id} passes here and gets its 400 from the handler
+			// {id} may be a number or a UUID (see ids.go); either must be the caller's
+			if raw := r.PathValue("id"); raw != "" && !mayAccessAccount(principal, raw) {
+				if _, err := pathInt(r, "id"); err == nil || isUUID(raw) {
+					refuse(w, r, http.StatusForbidden, "you can only access your own account")
+					return
+				}
+			}
+			ctx := withPrincipal(r.Context(), principal)
+			if principal.Impersonator != "" {
+				// One audit record per request an admin makes as someone else (see impersonate.go)
+				slog.InfoContext(ctx, "audit: impersonated request", "method", r.Method, "path", r.URL.Path, "user_id", principal.User.ID)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// mayAccessAccount reports whether p may act on the account {id} = raw
+// Default deny: the admin token, services and admin users may act on any
+// account, a user only on their own, and every other kind - guests, or one
+// added later - on none
+func mayAccessAccount(p Principal, raw string) bool {
+	switch {
+	case p.Kind == principalAdmin, p.Kind == principalService:
+		return true
+	case p.Kind == principalUser && p.User != nil:
+		return p.Role == roleAdmin || refersTo(raw, *p.User)
+	}
+	return false
+}
+
+// refuse answers a request requireAuth turned away: JSON for the API, and
+// for the HTML pages (see web.go, htmx.go) the message in the form's error
+// slot - htmx swaps 401 and 403 in like a 422 (see templates/layout.html) -
+// or a bare page for a form posted without htmx
+func refuse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	switch {
+	case isHTMX(r):
+		w.Header().Set("HX-Retarget", "#form-error")
+		w.Header().Set("HX-Reswap", "outerHTML")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `<p id="form-error" role="alert">%s</p>`, html.EscapeString(message))
+	case strings.HasPrefix(r.URL.Path, "/ui/"):
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<!doctype html>\n<title>%s</title>\n<p>%s</p>\n<p><a href=\"/ui/users\">Back to the users</a></p>\n",
+			http.StatusText(status), html.EscapeString(message))
+	default:
+		writeJSONError(w, status, message)
+	}
+}
+
+// meResponse is the body of GET /me
+type meResponse struct {
+	Principal
+	User *userResponse `json:"user,omitempty"` // For user principals
+}
+
+// meHandler tells callers who the server thinks they are (GET /me)
+// The same answer whichever provider authenticated the request
+//
+//	curl -H "Authorization: Bearer $TOKEN" localhost:8080/me
+//	{"kind":"user","subject":"9","scheme":"jwt","tenant":"default","user":{"id":9,...}}
+func (a *api) meHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+	body := meResponse{Principal: p}
+	if u, ok := userFromContext(r.Context()); ok {
+		presented := presentUser(r, *u)
+		body.User = &presented
+	}
+	respondJSON(w, http.StatusOK, body)
+}
+
+// adminTokenProvider accepts the admin token (see auth.go)
+// A Bearer token that isn't the admin token is left to the jwt provider
+type adminTokenProvider struct {
+	auth Authenticator
+}
+
+// Name implements AuthProvider
+func (adminTokenProvider) Name() string { return "admin_token" }
+
+// Authenticate implements AuthProvider
+func (p adminTokenProvider) Authenticate(r *http.Request) (Principal, error) {
+	subject, err := p.auth.Authenticate(r)
+	if err != nil {
+		return Principal{}, errNoCredentials
+	}
+	return Principal{Kind: principalAdmin, Subject: subject, Scheme: p.Name(), Role: roleAdmin, Scopes: effectiveScopes(roleAdmin, nil)}, nil
+}
+
+// userTokens verifies login tokens and loads their user; the jwt and session
+// providers differ only in where the token comes from
+type userTokens struct {
+	tokens   *jwtIssuer
+	users    UserService
+	sessions *refreshStore // Where sessions are kept (see sessions.go)
+}
+
+// principal turns a token into a user principal
+// The token's tenant must be the request's, and the user must still exist,
+// so deleting a user ends their tokens at once; so does revoking the token's session
+func (t userTokens) principal(r *http.Request, token, scheme string) (Principal, error) {
+	claims, err := t.tokens.verify(token, time.Now())
+	if err != nil {
+		return Principal{}, err
+	}
+	tenant := tenantFromContext(r.Context())
+	if claims.Tenant != tenant {
+		return Principal{}, errors.New("token belongs to another tenant")
+	}
+	if claims.isGuest() {
+		return guestPrincipal(claims, scheme), nil // No user to load (see guest.go)
+	}
+	id, err := claims.userID()
+	if err != nil {
+		return Principal{}, errTokenMalformed
+	}
+	u, err := t.users.Get(r.Context(), tenant, id)
+	if err != nil {
+		return Principal{}, errors.New("user no longer exists")
+	}
+	// Tokens from before sessions have no sid; they run out within tokenTTL
+	if claims.Session != "" && !t.sessions.touch(claims.Session, tenant, id, r, time.Now()) {
+		return Principal{}, errors.New("session was revoked")
+	}
+	var impersonator string
+	if claims.Actor != nil {
+		// An admin who was removed or demoted stops acting as anyone at once
+		if err := t.checkImpersonator(r.Context(), tenant, claims.Actor.Subject); err != nil {
+			return Principal{}, err
+		}
+		impersonator = claims.Actor.Subject
+	}
+	role := roleOf(u)
+	return Principal{
+		Kind: principalUser, Subject: claims.Subject, Scheme: scheme, TenantID: tenant, User: &u, Session: claims.Session,
+		Impersonator: impersonator,
+		// The role as it is now, and the token's scopes as far as that role still allows them
+		Role: role, Scopes: effectiveScopes(role, parseScopes(claims.Scope)),
+	}, nil
+}
+
+// jwtProvider accepts "Authorization: Bearer <token>" from POST /auth/login
+type jwtProvider struct {
+	userTokens
+}
+
+// Name implements AuthProvider
+func (jwtProvider) Name() string { return "jwt" }
+
+// Authenticate implements AuthProvider
+func (p jwtProvider) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Principal{}, errNoCredentials
+	}
+	return p.principal(r, token, p.Name())
+}
+
+// sessionCookie holds a login token for browsers (POST /auth/session)
+const sessionCookie = "session"
+
+// sessionProvider accepts the login token from the session cookie
+// The cookie is the same signed token as the jwt provider's, so there's no
+// server-side session store (express-session keeps one; this is closer to
+// cookie-session). Browsers send cookies on their own - also with forms
+// posted from other sites - so unsafe methods must come from our origin
+type sessionProvider struct {
+	userTokens
+}
+
+// Name implements AuthProvider
+func (sessionProvider) Name() string { return "session" }
+
+// Authenticate implements AuthProvider
+func (p sessionProvider) Authenticate(r *http.Request) (Principal, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return Principal{}, errNoCredentials
+	}
+	// SameSite=Strict keeps the cookie off cross-site requests in current
+	// browsers; checking Origin covers the rest (CSRF)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				return Principal{}, errors.New("cross-site request with a session cookie")
+			}
+		}
+	}
+	return p.principal(r, c.Value, p.Name())
+}
+
+// setSessionCookie stores a login token in the session cookie
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,                    // Not readable from document.cookie, so XSS can't steal it
+		Secure:   r.TLS != nil,            // HTTPS only, when we're serving HTTPS
+		SameSite: http.SameSiteStrictMode, // Not sent with requests started by other sites
+	})
+}
+
+// apiKeyProvider accepts "X-API-Key: <key>" for machine clients
+// keys returns name → key, read from the api_keys secret on every call, so
+// adding or revoking a key is a secret rotation, not a restart
+type apiKeyProvider struct {
+	keys func() map[string]apiKey
+}
+
+// apiKey is one entry of the api_keys secret
+type apiKey struct {
+	key    string
+	scopes []string // nil: every scope a service can hold
+}
+
+// Name implements AuthProvider
+func (apiKeyProvider) Name() string { return "api_key" }
+
+// Authenticate implements AuthProvider
+func (p apiKeyProvider) Authenticate(r *http.Request) (Principal, error) {
+	given := r.Header.Get("X-API-Key")
+	if given == "" {
+		return Principal{}, errNoCredentials
+	}
+	// Compare against every key in constant time, without stopping early
+	match, scopes := "", []string(nil)
+	for name, k := range p.keys() {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(k.key)) == 1 {
+			match, scopes = name, k.scopes
+		}
+	}
+	if match == "" {
+		return Principal{}, errors.New("unknown API key")
+	}
+	return Principal{Kind: principalService, Subject: match, Scheme: p.Name(), Role: roleService, Scopes: effectiveScopes(roleService, scopes)}, nil
+}
+
+// parseAPIKeys reads the api_keys secret: "crm=k3y...,reports[users:read]=s3cr3t..."
+// Scopes in brackets limit a key (see scopes.go); without them it gets all
+// a service can hold. Entries without a name or key are skipped
+func parseAPIKeys(value string) map[string]apiKey {
+	keys := make(map[string]apiKey)
+	for entry := range strings.SplitSeq(value, ",") {
+		name, key, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || key == "" {
+			continue
+		}
+		k := apiKey{key: key}
+		if base, scopes, ok := strings.Cut(name, "["); ok && strings.HasSuffix(scopes, "]") {
+			name, k.scopes = base, parseScopes(strings.TrimSuffix(scopes, "]"))
+		}
+		keys[name] = k
+	}
+	return keys
+}
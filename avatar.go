@@ -0,0 +1,180 @@
+// Package main - avatar uploads: decode, strip metadata, resize and re-encode
+package main
+
+import (
+	"bytes"       // For encoding into memory before storing
+	"errors"      // For processing errors
+	"image"       // Generic image types and image.Decode
+	"image/color" // For building resized pixels
+	"image/draw"  // For flattening transparency before JPEG encoding
+	"image/jpeg"  // JPEG encoder (and decoder, registered on import)
+	"io"          // For reading the upload
+	"net/http"    // For handler types and status codes
+
+	// Blank imports register more decoders with image.Decode,
+	// the same way database drivers register themselves
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Node usually reaches for sharp (libvips) here. Go's standard library can
+// decode PNG/JPEG/GIF and encode PNG/JPEG, which covers avatars; WebP output
+// would need a cgo library, so avatars are always re-encoded as JPEG.
+//
+// Re-encoding is also the simplest way to strip EXIF: image.Decode only keeps
+// pixels, so GPS coordinates and camera details in the upload never reach
+// the stored files.
+
+// Limits checked before decoding - a 100KB PNG can claim to be 50000x50000
+// pixels and decompress into gigabytes (a "decompression bomb")
+const (
+	maxAvatarPixels = 40_000_000 // ~40 megapixels; _ separators are only for readability
+	avatarQuality   = 85         // JPEG quality for stored files
+)
+
+// errImageTooLarge is returned for images whose dimensions exceed maxAvatarPixels
+var errImageTooLarge = errors.New("image dimensions are too large")
+
+// avatarResult holds the blobs produced for one upload
+type avatarResult struct {
+	original  *blob // Full-size, re-encoded without metadata
+	thumbnail *blob // Square, size x size
+}
+
+// processAvatar decodes an uploaded image and stores a clean original and a thumbnail
+func processAvatar(blobs *blobStore, data []byte, size int) (avatarResult, error) {
+	// DecodeConfig reads only the header, so the size check is cheap
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return avatarResult{}, err // image.ErrFormat for anything that isn't PNG/JPEG/GIF
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return avatarResult{}, errImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return avatarResult{}, err
+	}
+
+	original, err := encodeJPEG(img)
+	if err != nil {
+		return avatarResult{}, err
+	}
+	thumb, err := encodeJPEG(resizeSquare(img, size))
+	if err != nil {
+		return avatarResult{}, err
+	}
+
+	var result avatarResult
+	if result.original, err = blobs.put("image/jpeg", "avatar.jpg", original); err != nil {
+		return avatarResult{}, err
+	}
+	if result.thumbnail, err = blobs.put("image/jpeg", "avatar-thumb.jpg", thumb); err != nil {
+		blobs.delete(result.original.ID) // Not half an avatar
+		return avatarResult{}, err
+	}
+	return result, nil
+}
+
+// encodeJPEG encodes an image as JPEG in memory
+func encodeJPEG(img image.Image) ([]byte, error) {
+	// JPEG has no alpha channel - flatten onto white so transparent PNGs don't turn black
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: avatarQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeSquare center-crops img to a square and scales it to size x size
+// Each output pixel is the average of the source pixels it covers (a box
+// filter) - slower than nearest-neighbour but without the jagged edges
+func resizeSquare(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy()) // min/max are built in since Go 1.21
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	out := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		// The source rows/columns that map onto this output pixel
+		sy0, sy1 := y0+y*side/size, y0+(y+1)*side/size
+		sy1 = max(sy1, sy0+1) // Upscaling: always cover at least one source pixel
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x0+x*side/size, x0+(x+1)*side/size
+			sx1 = max(sx1, sx0+1)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					// RGBA() returns 16-bit premultiplied channels as uint32
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n),
+			})
+		}
+	}
+	return out
+}
+
+// uploadAvatarHandler replaces a user's avatar (PUT /users/{id}/avatar)
+// The body is the raw image, like POST /binary:
+// curl -X PUT --data-binary @me.png localhost:8080/users/1/avatar
+func (a *api) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBlobSize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	// Reject non-images before spending a worker on them (see uploads.go)
+	_, err = sniffUpload(data, r.Header.Get("Content-Type"), r.URL.Query().Get("filename"), avatarTypes)
+	var typeErr *uploadTypeError
+	if errors.As(err, &typeErr) {
+		writeUploadTypeError(w, typeErr)
+		return
+	}
+
+	// Decoding and resizing are CPU-bound, so they run on the worker pool
+	// (see jobs.go); the handler waits for the result
+	var result avatarResult
+	procErr := errors.New("avatar processing failed") // Stays set if the job panics
+	err = a.jobs.do(r.Context(), func() {
+		result, procErr = processAvatar(a.blobs, data, a.avatarSize)
+	})
+	switch {
+	case errors.Is(err, errQueueFull):
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		return // The client went away (context cancelled) - nobody to answer
+	case procErr != nil:
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid image: "+procErr.Error())
+		return
+	}
+
+	u.AvatarID = result.original.ID
+	u.AvatarThumbID = result.thumbnail.ID
+	updated, err := a.users.Update(r.Context(), u)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+
+	respondPresented(w, r, http.StatusOK, userFields, presentUser(r, updated))
+}
@@ -0,0 +1,244 @@
+// Package main - binary upload/download handlers backed by an in-memory (or on-disk) blob store
+package main
+
+import (
+	"bytes"         // For reading stored blobs back as a stream
+	"encoding/json" // For the metadata files of an on-disk store
+	"errors"        // For errors.As on upload validation errors
+	"fmt"           // For wrapping file errors
+	"io"            // For streaming request/response bodies with io.Copy
+	"net/http"      // For HTTP handler types and status codes
+	"os"            // For the on-disk store's files
+	"path/filepath" // For building their paths
+	"strconv"       // For converting IDs and sizes to strings
+	"strings"       // For finding metadata files
+	"sync"          // For the mutex protecting the blob map
+	"time"          // For the upload timestamp
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For blob IDs and checksums
+)
+
+// maxBlobSize caps a single upload so one request cannot exhaust memory
+// Express equivalent: express.raw({ limit: '10mb' })
+const maxBlobSize = 10 << 20 // 10 MiB (<< is a bit shift: 10 * 2^20)
+
+// blob is a stored chunk of binary data plus its metadata
+type blob struct {
+	ID          string    `json:"id"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`             // Checksum clients can use to verify the download
+	Filename    string    `json:"filename,omitempty"` // Suggested name for downloads (see files.go)
+	CreatedAt   time.Time `json:"created_at"`         // Upload time (UTC), used as Last-Modified
+	data        []byte    // lowercase field = unexported, never included in JSON
+	private     bool      // Only downloadable through a signed URL (see signedurl.go)
+}
+
+// blobStore keeps uploaded binary data in memory
+// Handlers run concurrently (one goroutine per request), so the map is
+// guarded by a mutex - Node's single thread hides this problem from you
+type blobStore struct {
+	mu    sync.RWMutex     // RWMutex allows many readers or one writer at a time
+	blobs map[string]*blob // ID → blob
+	dir   string           // Where blobs are written through to; "" = memory only
+}
+
+// newBlobStore creates an empty blob store
+// Go has no constructors - a newX function returning a pointer is the convention
+func newBlobStore() *blobStore {
+	return &blobStore{blobs: make(map[string]*blob)}
+}
+
+// blobFile is what an on-disk store writes next to each blob's bytes: <id>.json
+// blob's own JSON leaves out private, which a restart must not forget
+type blobFile struct {
+	blob
+	Private bool `json:"private"`
+}
+
+// openBlobDir creates a blob store that keeps every blob as two files in
+// dir: <id> with the bytes, <id>.json with the metadata. Blobs are still
+// served from memory; the files are read back at startup, so uploads
+// survive a restart - multer's diskStorage instead of memoryStorage
+func openBlobDir(dir string) (*blobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("blob directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("blob directory: %w", err)
+	}
+	s := newBlobStore()
+	s.dir = dir
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		meta, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("blob %s: %w", id, err)
+		}
+		var f blobFile
+		if err := json.Unmarshal(meta, &f); err != nil {
+			return nil, fmt.Errorf("blob %s: %w", id, err)
+		}
+		if f.data, err = os.ReadFile(filepath.Join(dir, id)); err != nil {
+			return nil, fmt.Errorf("blob %s: %w", id, err)
+		}
+		b := f.blob
+		b.private = f.Private
+		s.blobs[b.ID] = &b
+	}
+	return s, nil
+}
+
+// put stores data and returns the blob metadata
+// filename is optional and only used to name downloads
+func (s *blobStore) put(contentType, filename string, data []byte) (*blob, error) {
+	return s.add(contentType, filename, data, false)
+}
+
+// putPrivate stores data that the plain download routes don't serve,
+// e.g. an export of every user - hand out a signed URL instead
+func (s *blobStore) putPrivate(contentType, filename string, data []byte) (*blob, error) {
+	return s.add(contentType, filename, data, true)
+}
+
+// add stores a new blob under a random ID
+// Only an on-disk store can fail: a full disk, a directory that went away
+func (s *blobStore) add(contentType, filename string, data []byte, private bool) (*blob, error) {
+	s.mu.Lock()         // Exclusive lock for writing
+	defer s.mu.Unlock() // defer runs when the function returns - like a finally block
+
+	// Random IDs can't be enumerated the way 1, 2, 3... can (see cryptoutil/)
+	b := &blob{
+		ID:          cryptoutil.RandomToken(16),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      cryptoutil.SHA256Hex(data),
+		Filename:    filename,
+		CreatedAt:   time.Now().UTC(),
+		data:        data,
+		private:     private,
+	}
+	if err := s.write(b); err != nil {
+		return nil, err
+	}
+	s.blobs[b.ID] = b
+	return b, nil
+}
+
+// write saves b to an on-disk store: the bytes first, so a metadata file
+// never points at bytes that aren't there
+func (s *blobStore) write(b *blob) error {
+	if s.dir == "" {
+		return nil
+	}
+	meta, err := json.Marshal(blobFile{*b, b.private})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, b.ID), b.data, 0o600); err != nil {
+		return fmt.Errorf("write blob: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, b.ID+".json"), meta, 0o600); err != nil {
+		return fmt.Errorf("write blob: %w", err)
+	}
+	return nil
+}
+
+// get looks up a blob by ID; ok is false when it doesn't exist
+func (s *blobStore) get(id string) (*blob, bool) {
+	s.mu.RLock() // Shared lock - many readers can hold it at once
+	defer s.mu.RUnlock()
+
+	b, ok := s.blobs[id]
+	return b, ok
+}
+
+// delete removes a blob; it reports whether it existed
+func (s *blobStore) delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.blobs[id]
+	delete(s.blobs, id) // The built-in delete; the method name doesn't shadow it
+	if ok && s.dir != "" {
+		// The metadata first: without it, startup ignores the bytes
+		os.Remove(filepath.Join(s.dir, id+".json"))
+		os.Remove(filepath.Join(s.dir, id))
+	}
+	return ok
+}
+
+// count returns the number of stored blobs
+func (s *blobStore) count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.blobs) // len on a map is O(1)
+}
+
+// uploadBinaryHandler accepts a raw binary request body (not multipart)
+// curl -X POST --data-binary @photo.png -H "Content-Type: image/png" "localhost:8080/binary?filename=photo.png"
+func (a *api) uploadBinaryHandler(w http.ResponseWriter, r *http.Request) {
+	// http.MaxBytesReader stops reading after maxBlobSize and makes Read return an error
+	body := http.MaxBytesReader(w, r.Body, maxBlobSize)
+
+	// io.Copy streams the body in chunks (32 KiB by default) into the buffer,
+	// the Go equivalent of piping req into a writable stream
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, body); err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	// ?filename= names the file for GET /files/{id}/download; it is stored as
+	// sent and sanitized when the download header is built (see downloadName)
+	filename := r.URL.Query().Get("filename")
+
+	// Store the sniffed type, not the client's Content-Type (see uploads.go)
+	contentType, err := sniffUpload(buf.Bytes(), r.Header.Get("Content-Type"), filename, uploadTypes)
+	// errors.As is like `err instanceof UploadTypeError` plus a cast
+	var typeErr *uploadTypeError
+	if errors.As(err, &typeErr) {
+		writeUploadTypeError(w, typeErr)
+		return
+	}
+
+	b, err := a.blobs.put(contentType, filename, buf.Bytes())
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+
+	// Respond with the metadata so the client knows the new ID
+	respondJSON(w, http.StatusCreated, b)
+}
+
+// downloadBinaryHandler streams a stored blob back to the client
+// This is the minimal version; GET /files/{id}/download (files.go) adds
+// Range requests, conditional GETs and Content-Disposition
+// pathToken reads the {id} wildcard - like req.params.id in Express - and
+// answers 400 for anything that can't be a blob ID (see params.go)
+func (a *api) downloadBinaryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathToken(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	b, ok := a.blobs.get(id)
+	if !ok || b.private {
+		writeJSONError(w, http.StatusNotFound, "blob not found")
+		return
+	}
+
+	// Headers must be set before the first write to the body
+	w.Header().Set("Content-Type", b.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(b.Size, 10))
+	// The content hash makes a strong ETag - it only changes if the bytes do
+	w.Header().Set("ETag", `"`+b.SHA256+`"`)
+
+	// bytes.NewReader wraps the slice in an io.Reader so we can stream it
+	// with io.Copy instead of building another copy in memory
+	io.Copy(w, bytes.NewReader(b.data))
+}
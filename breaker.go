@@ -0,0 +1,225 @@
+// Package main - a circuit breaker for outbound calls, with expvar metrics
+package main
+
+import (
+	"errors"   // For the open-circuit error
+	"expvar"   // Standard-library metrics, served as JSON on /debug/vars
+	"fmt"      // For wrapping errors with the host
+	"net/http" // For the RoundTripper wrapper
+	"sync"     // For the mutex protecting breaker state
+	"time"     // For the open period
+)
+
+// Without a breaker, every request that needs a dead downstream waits for its
+// full timeout: 100 requests/s x 5s timeouts = 500 goroutines and sockets
+// stuck at once. A breaker notices the failure rate, "opens" and fails calls
+// immediately for a while, then lets a probe through ("half-open") to see if
+// the downstream is back - what opossum does in Node.
+//
+//	closed    ──(failure rate ≥ threshold)──► open
+//	open      ──(OpenFor elapsed)───────────► half-open
+//	half-open ──(probe succeeds)────────────► closed
+//	half-open ──(probe fails)───────────────► open
+
+// errCircuitOpen is returned instead of calling a downstream that is known to be failing
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// breakerState is one of the three breaker states
+// Declaring a named int type plus constants is Go's version of an enum
+type breakerState int
+
+const (
+	stateClosed   breakerState = iota // iota counts up from 0 within a const block
+	stateOpen                         // 1
+	stateHalfOpen                     // 2
+)
+
+// String makes states print as words in logs and metrics (fmt calls it automatically)
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerConfig tunes when a breaker trips and how it recovers
+type breakerConfig struct {
+	Window      int           // Number of recent calls the failure rate is computed over
+	MinRequests int           // Don't trip on 1 failure out of 1 call
+	FailureRate float64       // 0.5 = trip when half of the recent calls failed
+	OpenFor     time.Duration // How long to fail fast before probing again
+	Probes      int           // Concurrent trial calls allowed while half-open
+}
+
+// defaultBreakerConfig suits most HTTP dependencies
+var defaultBreakerConfig = breakerConfig{
+	Window:      20,
+	MinRequests: 10,
+	FailureRate: 0.5,
+	OpenFor:     30 * time.Second,
+	Probes:      1,
+}
+
+// breakerMetrics holds one expvar map per breaker under "circuit_breakers"
+// expvar.NewMap registers it globally, like prom-client's default registry
+var breakerMetrics = expvar.NewMap("circuit_breakers")
+
+// circuitBreaker tracks the outcomes of recent calls to one downstream
+type circuitBreaker struct {
+	name string
+	cfg  breakerConfig
+
+	mu       sync.Mutex
+	state    breakerState
+	outcomes []bool // Ring buffer of the last Window results, true = failure
+	next     int    // Ring buffer write position
+	count    int    // How many slots hold a result
+	openedAt time.Time
+	inFlight int // Probes currently running while half-open
+
+	// Metrics, readable at GET /debug/vars
+	stateVar                              expvar.String
+	calls, failures, rejected, tripsTotal expvar.Int
+}
+
+// newCircuitBreaker creates a closed breaker and publishes its metrics
+func newCircuitBreaker(name string, cfg breakerConfig) *circuitBreaker {
+	b := &circuitBreaker{name: name, cfg: cfg, outcomes: make([]bool, cfg.Window)}
+	b.stateVar.Set(stateClosed.String())
+
+	m := new(expvar.Map).Init()
+	m.Set("state", &b.stateVar)
+	m.Set("calls", &b.calls)
+	m.Set("failures", &b.failures)
+	m.Set("rejected", &b.rejected)
+	m.Set("trips", &b.tripsTotal)
+	breakerMetrics.Set(name, m)
+	return b
+}
+
+// allow reports whether a call may go ahead, moving open → half-open once OpenFor has passed
+// probe is true when the call is a half-open trial; pass it back to record
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateOpen && time.Since(b.openedAt) >= b.cfg.OpenFor {
+		b.setState(stateHalfOpen)
+	}
+	switch {
+	case b.state == stateOpen,
+		b.state == stateHalfOpen && b.inFlight >= b.cfg.Probes:
+		b.rejected.Add(1)
+		return false, errCircuitOpen
+	case b.state == stateHalfOpen:
+		b.inFlight++
+		probe = true
+	}
+	b.calls.Add(1)
+	return probe, nil
+}
+
+// record stores the outcome of a call that allow() let through
+func (b *circuitBreaker) record(probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if failed {
+		b.failures.Add(1)
+	}
+
+	// A probe decides on its own: one success closes, one failure re-opens
+	if probe {
+		b.inFlight--
+		if failed {
+			b.trip()
+		} else {
+			b.reset()
+		}
+		return
+	}
+	if b.state != stateClosed {
+		return // A slow call that started before the breaker opened
+	}
+
+	b.outcomes[b.next] = failed
+	b.next = (b.next + 1) % len(b.outcomes)
+	b.count = min(b.count+1, len(b.outcomes))
+
+	if b.count < b.cfg.MinRequests {
+		return
+	}
+	failures := 0
+	for _, f := range b.outcomes[:b.count] {
+		if f {
+			failures++
+		}
+	}
+	if float64(failures)/float64(b.count) >= b.cfg.FailureRate {
+		b.trip()
+	}
+}
+
+// trip opens the breaker (caller holds the lock)
+func (b *circuitBreaker) trip() {
+	b.openedAt = time.Now()
+	b.tripsTotal.Add(1)
+	b.setState(stateOpen)
+}
+
+// reset closes the breaker and forgets old outcomes (caller holds the lock)
+func (b *circuitBreaker) reset() {
+	clear(b.outcomes) // clear() zeroes a slice in place (Go 1.21+)
+	b.next, b.count = 0, 0
+	b.setState(stateClosed)
+}
+
+// setState changes state and updates the metric (caller holds the lock)
+func (b *circuitBreaker) setState(s breakerState) {
+	b.state = s
+	b.stateVar.Set(s.String())
+}
+
+// breakerTransport is an http.RoundTripper with one breaker per downstream host
+// RoundTripper is the interface behind http.Client - wrapping it (like an
+// axios interceptor) protects every client built on it without touching call sites
+type breakerTransport struct {
+	next http.RoundTripper
+	cfg  breakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// newBreakerTransport wraps next (usually http.DefaultTransport)
+func newBreakerTransport(next http.RoundTripper, cfg breakerConfig) *breakerTransport {
+	return &breakerTransport{next: next, cfg: cfg, breakers: map[string]*circuitBreaker{}}
+}
+
+// breaker returns the breaker for a host, creating it on first use
+func (t *breakerTransport) breaker(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = newCircuitBreaker(host, t.cfg)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+// RoundTrip implements http.RoundTripper
+// Network errors and 5xx responses count as failures; 4xx are the caller's problem
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	probe, err := b.allow()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL.Host, err)
+	}
+	resp, err := t.next.RoundTrip(req)
+	b.record(probe, err != nil || resp.StatusCode >= 500)
+	return resp, err
+}
@@ -0,0 +1,74 @@
+// Package main - Node's Buffer API mapped to Go's []byte and friends
+package main
+
+import (
+	"bytes"           // bytes.Buffer - a growable byte buffer (like Buffer.concat on the fly)
+	"encoding/base64" // Buffer.from(str, 'base64') / buf.toString('base64')
+	"encoding/binary" // buf.readUInt32BE() / buf.writeUInt16LE() equivalents
+	"encoding/hex"    // Buffer.from(str, 'hex') / buf.toString('hex')
+	"fmt"             // For printing example output
+	"io"              // For the io.Writer the examples print to
+)
+
+// Node.js → Go cheat sheet for binary data
+//
+//	Buffer.from('hi')              → []byte("hi")
+//	Buffer.alloc(8)                → make([]byte, 8)
+//	buf.toString()                 → string(b)
+//	buf.length                     → len(b)
+//	buf.slice(0, 2)                → b[0:2]   (shares memory, just like Node)
+//	Buffer.concat([a, b])          → append(a, b...) or bytes.Buffer
+//	buf.equals(other)              → bytes.Equal(a, b)
+//	buf.indexOf('x')               → bytes.IndexByte(b, 'x')
+//	buf.toString('base64')         → base64.StdEncoding.EncodeToString(b)
+//	buf.toString('hex')            → hex.EncodeToString(b)
+//	buf.readUInt32BE(0)            → binary.BigEndian.Uint32(b[0:])
+//	buf.writeUInt16LE(v, 0)        → binary.LittleEndian.PutUint16(b[0:], v)
+
+// init() registers the "buffer" example with the -example flag runner
+func init() {
+	registerExample("buffer", bufferExamples)
+}
+
+// bufferExamples prints each Buffer operation next to its Go equivalent
+func bufferExamples(w io.Writer) {
+	// A string converts to []byte (a copy is made - Go strings are immutable)
+	b := []byte("hello")
+	fmt.Fprintln(w, "[]byte:", b, "len:", len(b))
+
+	// Slicing shares the underlying array, exactly like buf.slice() in Node
+	head := b[:2]
+	head[0] = 'H'
+	fmt.Fprintln(w, "shared slice:", string(b)) // Hello
+
+	// Use copy() (or bytes.Clone) when you need an independent copy (Buffer.from(buf))
+	clone := bytes.Clone(b)
+	clone[0] = 'J'
+	fmt.Fprintln(w, "clone:", string(clone), "original:", string(b))
+
+	// bytes.Buffer grows as you write - handy for building binary payloads
+	var buf bytes.Buffer
+	buf.WriteString("GO")
+	buf.WriteByte(0x01)
+	buf.Write([]byte{0xCA, 0xFE})
+	fmt.Fprintln(w, "bytes.Buffer:", buf.Bytes())
+
+	// Encodings: base64 and hex
+	enc := base64.StdEncoding.EncodeToString(b)
+	fmt.Fprintln(w, "base64:", enc)
+	dec, err := base64.StdEncoding.DecodeString(enc)
+	fmt.Fprintln(w, "base64 decoded:", string(dec), err)
+	fmt.Fprintln(w, "hex:", hex.EncodeToString(b))
+
+	// Fixed-size integers: encoding/binary chooses the byte order explicitly
+	header := make([]byte, 6)
+	binary.BigEndian.PutUint32(header[0:], 0xDEADBEEF)
+	binary.LittleEndian.PutUint16(header[4:], 513)
+	fmt.Fprintln(w, "binary header:", hex.EncodeToString(header))
+	fmt.Fprintln(w, "readUInt32BE:", binary.BigEndian.Uint32(header[0:]))
+	fmt.Fprintln(w, "readUInt16LE:", binary.LittleEndian.Uint16(header[4:]))
+
+	// Comparing and searching
+	fmt.Fprintln(w, "bytes.Equal:", bytes.Equal([]byte("a"), []byte("a")))
+	fmt.Fprintln(w, "bytes.Index:", bytes.Index(b, []byte("llo")))
+}
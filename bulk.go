@@ -0,0 +1,160 @@
+// Package main - bulk upsert by email, for syncing users from another system
+package main
+
+import (
+	"errors"   // For spotting a quota error
+	"fmt"      // For the size limit message
+	"net/http" // For the handler and per-item status codes
+	"time"     // For the If-Unmodified-Since guard
+)
+
+// A CRM or HR system that owns the user list wants to push "here are the
+// users as I know them" without first asking which exist. PUT /users/bulk
+// matches each item by email: missing users are created, present ones
+// updated. Every item gets its own result, so one bad row doesn't fail the
+// other 999 (the same idea as Elasticsearch's _bulk or MongoDB's
+// bulkWrite({ordered: false})).
+//
+// The guard protects edits made here from being overwritten by a stale
+// sync: an item is only applied if the user hasn't changed since the time
+// the sender last saw - per item (if_unmodified_since) or for the whole
+// batch (the If-Unmodified-Since header).
+
+// maxBulkItems caps one request; bigger syncs send several
+const maxBulkItems = 1000
+
+// bulkUserItem is one element of the request array
+type bulkUserItem struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// The updated_at the sender last saw; newer changes here win (412 for this item)
+	IfUnmodifiedSince time.Time `json:"if_unmodified_since,omitzero"`
+}
+
+// Results of one item - the word next to the status code in bulkUserResult
+const (
+	bulkCreated   = "created"
+	bulkUpdated   = "updated"
+	bulkUnchanged = "unchanged"  // Already as sent; nothing written, no event published
+	bulkConflict  = "conflict"   // Modified since the guard's time
+	bulkInvalid   = "invalid"    // Failed validation or a rule like unique emails (4xx)
+	bulkOverQuota = "over_quota" // The tenant has no room for another user (see quota.go)
+	bulkFailed    = "failed"     // The store failed (5xx); sending the item again may work
+)
+
+// bulkUserResult reports what happened to one item, in request order
+type bulkUserResult struct {
+	Index  int    `json:"index"`
+	Email  string `json:"email"`
+	Status int    `json:"status"` // What the single request would have answered: 201, 200, 412, or the error's (see describeError)
+	Result string `json:"result"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkUsersResponse is the body of PUT /users/bulk
+type bulkUsersResponse struct {
+	Results []bulkUserResult `json:"results"`
+	Counts  map[string]int   `json:"counts"` // Items per result, e.g. {"created": 3, "updated": 1}
+}
+
+// bulkUpsertUsersHandler creates or updates users by email (PUT /users/bulk)
+// curl -X PUT -d '[{"name":"Ada","email":"ada@example.com"}]' localhost:8080/users/bulk
+// The response is 200 even when items fail - look at each result's status
+func (a *api) bulkUpsertUsersHandler(w http.ResponseWriter, r *http.Request) {
+	items, err := decode[[]bulkUserItem](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(items) > maxBulkItems {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d items per request", maxBulkItems))
+		return
+	}
+
+	// RFC 9110: an invalid date means the header is ignored, not a 400
+	var batchSince time.Time
+	if v := r.Header.Get("If-Unmodified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			batchSince = t
+		}
+	}
+
+	ctx := r.Context()
+	tenantID := tenantFromContext(ctx)
+	// One pass over the tenant's users instead of a lookup per item
+	// Updated as we go, so a later item with the same email sees the earlier one
+	byEmail := make(map[string]User)
+	for _, u := range a.users.List(ctx, tenantID) {
+		byEmail[u.Email] = u
+	}
+
+	resp := bulkUsersResponse{Results: make([]bulkUserResult, 0, len(items)), Counts: map[string]int{}}
+	for i, item := range items {
+		res := bulkUserResult{Index: i, Email: item.Email}
+		existing, found := byEmail[normalizeEmail(item.Email)] // Stored emails are normalized (see store.go)
+		switch {
+		case !found:
+			created, err := a.users.Create(ctx, User{Name: item.Name, Email: item.Email, TenantID: tenantID})
+			if err != nil {
+				a.bulkItemError(r, &res, err)
+				break // Leaves the switch, not the loop
+			}
+			byEmail[created.Email] = created
+			res.Status, res.Result, res.ID = http.StatusCreated, bulkCreated, created.ID
+
+		case modifiedSince(existing, item.IfUnmodifiedSince, batchSince):
+			res.Status, res.Result, res.ID = http.StatusPreconditionFailed, bulkConflict, existing.ID
+			res.Error = "modified since " + existing.UpdatedAt.Format(time.RFC3339Nano)
+
+		case existing.Name == item.Name:
+			res.Status, res.Result, res.ID = http.StatusOK, bulkUnchanged, existing.ID
+
+		default:
+			existing.Name = item.Name
+			updated, err := a.users.Update(ctx, existing)
+			if err != nil {
+				a.bulkItemError(r, &res, err)
+				break
+			}
+			byEmail[updated.Email] = updated
+			res.Status, res.Result, res.ID = http.StatusOK, bulkUpdated, updated.ID
+		}
+		resp.Results = append(resp.Results, res)
+		resp.Counts[res.Result]++
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// bulkItemError fills in the result of an item Create or Update refused
+// The status is the one the single request would have answered; only the
+// item's own mistakes are invalid, and a store that is down is failed
+func (a *api) bulkItemError(r *http.Request, res *bulkUserResult, err error) {
+	status, _, _ := describeError(err)
+	var quota *quotaError
+	switch {
+	case errors.As(err, &quota):
+		res.Result = bulkOverQuota
+	case status >= http.StatusInternalServerError:
+		res.Result = bulkFailed
+		if status == http.StatusInternalServerError { // Details only go to the log, as in respondError
+			a.logger.ErrorContext(r.Context(), "bulk item failed", "index", res.Index, "err", err)
+		}
+	default:
+		res.Result = bulkInvalid
+	}
+	res.Status, res.Error = status, a.errorText(r, err)
+}
+
+// modifiedSince reports whether u changed after the guard's time; the
+// item's own time wins over the batch header, and no time means no guard
+// HTTP dates have whole seconds, so the header is compared at that precision
+func modifiedSince(u User, itemSince, batchSince time.Time) bool {
+	switch {
+	case !itemSince.IsZero():
+		return u.UpdatedAt.After(itemSince)
+	case !batchSince.IsZero():
+		return u.UpdatedAt.Truncate(time.Second).After(batchSince)
+	}
+	return false
+}
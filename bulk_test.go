@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"           // For a cancelled request's error
+	"fmt"               // For wrapping errors like the stores do
+	"log/slog"          // The api logs 500s; the test doesn't need to see them
+	"net/http"          // For the status codes
+	"net/http/httptest" // For the request the messages are translated for
+	"testing"           // Go's built-in test runner: go test ./... instead of Jest
+)
+
+// TestBulkItemError checks that a refused item gets the status a single
+// request would: only the item's own mistakes are "invalid", and a store
+// that fails doesn't blame the item
+func TestBulkItemError(t *testing.T) {
+	a := &api{messages: &catalog{}, logger: slog.New(slog.DiscardHandler)}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantResult string
+	}{
+		{"validation", validationError{{Field: "email", format: "%s must be a valid email address"}}, http.StatusUnprocessableEntity, bulkInvalid},
+		{"taken email", errDuplicateEmail, http.StatusConflict, bulkInvalid},
+		{"plan limit", &quotaError{Name: "users", Limit: 5, Used: 5}, http.StatusPaymentRequired, bulkOverQuota},
+		{"store unavailable", fmt.Errorf("sqlite: %w", errStoreUnavailable), http.StatusServiceUnavailable, bulkFailed},
+		{"cancelled", context.Canceled, http.StatusInternalServerError, bulkFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := bulkUserResult{Index: 0, Email: "ada@example.com"}
+			a.bulkItemError(httptest.NewRequest(http.MethodPut, "/users/bulk", nil), &res, tt.err)
+			if res.Status != tt.wantStatus || res.Result != tt.wantResult {
+				t.Errorf("got %d %q, want %d %q", res.Status, res.Result, tt.wantStatus, tt.wantResult)
+			}
+		})
+	}
+}
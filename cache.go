@@ -0,0 +1,60 @@
+// Package main - a small generic in-memory cache with expiry
+package main
+
+import (
+	"sync" // For the mutex protecting the entries
+	"time" // For expiry times
+)
+
+// ttlCache is a map whose entries expire after ttl, like node-cache or an
+// lru-cache with maxAge. K and V are type parameters: ttlCache[string, forecast]
+// only accepts string keys and forecast values - no casts when reading
+type ttlCache[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[K]cacheEntry[V]
+}
+
+// cacheEntry is a value plus the moment it stops being valid
+type cacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// newTTLCache creates an empty cache
+func newTTLCache[K comparable, V any](ttl time.Duration) *ttlCache[K, V] {
+	return &ttlCache[K, V]{ttl: ttl, entries: make(map[K]cacheEntry[V])}
+}
+
+// get returns a value that hasn't expired yet
+func (c *ttlCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		var zero V // The zero value of any type parameter
+		return zero, false
+	}
+	return e.value, true
+}
+
+// delete removes a value, e.g. one a write has made wrong
+func (c *ttlCache[K, V]) delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key) // The built-in delete; methods and built-ins don't clash
+}
+
+// set stores a value and sweeps expired entries so the map can't grow forever
+func (c *ttlCache[K, V]) set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k) // Deleting while ranging over a map is allowed in Go
+		}
+	}
+	c.entries[key] = cacheEntry[V]{value: value, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,45 @@
+// Package main - stop working for clients that have hung up
+package main
+
+import (
+	"cmp"      // For the route name fallback
+	"context"  // For context.Canceled
+	"errors"   // For errors.Is
+	"expvar"   // For the canceled-request counter
+	"net/http" // For the request
+)
+
+// When a client closes the connection (a closed tab, a curl ^C, a proxy
+// timeout), net/http cancels the request's context: r.Context().Done() is
+// closed and r.Context().Err() returns context.Canceled. Nothing stops the
+// handler by itself - it is just a goroutine - so without a check it would
+// finish the query, build the response and write it into a dead socket.
+// In Express you'd listen for req.on('close'); in Go the context carries it
+// into every call that accepts one, database queries included (QueryContext).
+//
+// Long-running handlers check between steps and return early. The access log
+// then shows 499, nginx's "Client Closed Request" - no client ever sees it.
+
+// statusClientClosedRequest is nginx's non-standard status for a request the
+// client abandoned; http.StatusText doesn't know it
+const statusClientClosedRequest = 499
+
+// canceledRequests counts abandoned requests per route, on /debug/vars
+// {"canceled_requests": {"GET /users": 3, "GET /users/{id}/data-export": 1}}
+var canceledRequests = expvar.NewMap("canceled_requests")
+
+// clientGone reports whether the client of r has disconnected, and counts
+// and logs it when it has
+// A timeout (context.DeadlineExceeded) doesn't count: the client is still
+// waiting for an answer. Coalesced requests (see coalesce.go) run on a context
+// that ignores one client leaving, so the others still get their response
+func (a *api) clientGone(r *http.Request) bool {
+	if !errors.Is(r.Context().Err(), context.Canceled) {
+		return false
+	}
+	// r.Pattern is the route that matched ("GET /users/{id}"), so IDs don't
+	// turn into thousands of counters
+	canceledRequests.Add(cmp.Or(r.Pattern, "unmatched"), 1)
+	a.logger.InfoContext(r.Context(), "client disconnected, aborting", "method", r.Method, "path", r.URL.Path)
+	return true
+}
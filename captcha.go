@@ -0,0 +1,207 @@
+// Package main - brute-force protection for logins: a CAPTCHA after repeated failures from an IP
+package main
+
+import (
+	"context"  // Verifying a challenge is an outbound call
+	"errors"   // For errChallengeFailed
+	"fmt"      // For configuration and provider errors
+	"net/http" // For the challenge responses
+	"net/url"  // For the siteverify form
+	"strings"  // For the provider's error codes
+	"sync"     // Failures are counted by concurrent requests
+	"time"     // For the failure window
+)
+
+// Rate limits (express_middleware.go) stop floods, but a patient attacker
+// guessing one password a second stays under them. After -captcha-after
+// failed logins from one IP within loginFailureWindow, POST /auth/login and
+// POST /auth/session want a solved CAPTCHA as well:
+//
+//	POST /auth/login {"email":...,"password":"guess6"}
+//	→ 401 {"error":{"code":"captcha_required",...},"captcha":{"provider":"turnstile","site_key":"0x4AAA..."}}
+//	POST /auth/login {"email":...,"password":"guess6","captcha_token":"<from the widget>"}
+//	→ 401 {"error":{"code":"invalid_credentials",...}}   the password is checked again
+//
+// The check runs before the password is looked at, so a bot can't keep
+// guessing without paying for a challenge each time. In Express this is
+// express-brute or rate-limiter-flexible's "consecutive fails by IP",
+// followed by a call to the provider's siteverify endpoint.
+//
+// The provider sits behind the Challenger interface, like Mailer: hCaptcha
+// and Cloudflare Turnstile share the same siteverify API, and the noop
+// challenger accepts any answer, so the flow can be tried without an account.
+
+// Challenger verifies a client's answer to a CAPTCHA
+type Challenger interface {
+	// Verify checks the token the widget gave the client; remoteIP is
+	// optional and lets the provider check the token was solved there
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+// errChallengeFailed is returned for a wrong, expired or reused answer
+var errChallengeFailed = errors.New("captcha challenge failed")
+
+// Providers for -captcha
+const (
+	captchaNoop      = "noop"      // Accepts any answer; for development
+	captchaHCaptcha  = "hcaptcha"  // hcaptcha.com
+	captchaTurnstile = "turnstile" // Cloudflare Turnstile
+)
+
+// siteverifyURLs are the verification endpoints of the real providers
+var siteverifyURLs = map[string]string{
+	captchaHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	captchaTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// loginFailureWindow is how long failed logins from an IP are remembered
+const loginFailureWindow = 15 * time.Minute
+
+// newChallenger creates the Challenger for provider
+// secret returns the captcha_secret secret, read on every call so rotations apply
+func newChallenger(provider string, secret func() string, client *httpClient) (Challenger, error) {
+	if provider == captchaNoop {
+		return noopChallenger{}, nil
+	}
+	endpoint, ok := siteverifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown -captcha %q: want %s, %s or %s", provider, captchaNoop, captchaHCaptcha, captchaTurnstile)
+	}
+	return &siteverifyChallenger{url: endpoint, secret: secret, client: client}, nil
+}
+
+// noopChallenger accepts every answer
+// The client still has to send one, so the UI's challenge step can be built
+// and tried locally; never use it in production
+type noopChallenger struct{}
+
+// Verify implements Challenger
+func (noopChallenger) Verify(context.Context, string, string) error {
+	return nil
+}
+
+// siteverifyChallenger checks answers with the provider's siteverify endpoint
+type siteverifyChallenger struct {
+	url    string
+	secret func() string
+	client *httpClient
+}
+
+// siteverifyResponse is the provider's answer; both providers send more
+// fields (hostname, challenge_ts), these are the ones we need
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify implements Challenger
+func (c *siteverifyChallenger) Verify(ctx context.Context, response, remoteIP string) error {
+	form := url.Values{"secret": {c.secret()}, "response": {response}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	res, err := postFormJSON[siteverifyResponse](ctx, c.client, c.url, form)
+	if err != nil {
+		return fmt.Errorf("captcha siteverify: %w", err)
+	}
+	if !res.Success {
+		return fmt.Errorf("%w: %s", errChallengeFailed, strings.Join(res.ErrorCodes, ", "))
+	}
+	return nil
+}
+
+// captchaInfo tells clients which widget to show
+type captchaInfo struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key,omitempty"` // Public; the widget needs it
+}
+
+// challengeResponse is the body of a 401 asking for a CAPTCHA
+type challengeResponse struct {
+	errorBody             // "captcha_required" or "captcha_failed"
+	Captcha   captchaInfo `json:"captcha"`
+}
+
+// loginGuard counts failed logins per IP and asks for a CAPTCHA past a threshold
+type loginGuard struct {
+	challenger Challenger
+	info       captchaInfo
+	after      int // Failures before a challenge is needed
+
+	mu       sync.Mutex
+	failures map[string]*rateWindow // By client IP; the same windows as rateLimit
+}
+
+// newLoginGuard creates a guard that wants a challenge after after failures
+func newLoginGuard(challenger Challenger, provider, siteKey string, after int) *loginGuard {
+	return &loginGuard{
+		challenger: challenger,
+		info:       captchaInfo{Provider: provider, SiteKey: siteKey},
+		after:      after,
+		failures:   make(map[string]*rateWindow),
+	}
+}
+
+// required reports whether logins from ip need a solved challenge
+func (g *loginGuard) required(ip string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	win, ok := g.failures[ip]
+	return ok && now.Before(win.reset) && win.count >= g.after
+}
+
+// failed records a failed login from ip
+// A successful login doesn't clear the count: an attacker with an account of
+// their own could otherwise reset it between guesses
+func (g *loginGuard) failed(ip string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	win, ok := g.failures[ip]
+	if !ok || !now.Before(win.reset) {
+		win = &rateWindow{reset: now.Add(loginFailureWindow)}
+		g.failures[ip] = win
+	}
+	win.count++
+	// Drop expired windows occasionally so the map doesn't grow forever
+	if len(g.failures) > 10_000 {
+		for k, w := range g.failures {
+			if !now.Before(w.reset) {
+				delete(g.failures, k)
+			}
+		}
+	}
+}
+
+// checkChallenge runs before the password check of a login; false means the
+// response is written. Logins need no answer until their IP has failed too often
+func (a *api) checkChallenge(w http.ResponseWriter, r *http.Request, response string) bool {
+	ip := clientIP(r)
+	if a.captcha == nil || !a.captcha.required(ip, time.Now()) {
+		return true
+	}
+	if response == "" {
+		respondJSON(w, http.StatusUnauthorized, challengeResponse{newErrorBody("captcha_required", a.t(r, "captcha required")), a.captcha.info})
+		return false
+	}
+	err := a.captcha.challenger.Verify(r.Context(), response, ip)
+	switch {
+	case errors.Is(err, errChallengeFailed):
+		a.logger.WarnContext(r.Context(), "auth: captcha failed", "ip", ip, "err", err)
+		respondJSON(w, http.StatusUnauthorized, challengeResponse{newErrorBody("captcha_failed", a.t(r, errChallengeFailed.Error())), a.captcha.info})
+		return false
+	case err != nil:
+		// Fail closed: letting logins through while the provider is down is
+		// exactly what an attacker would wait for
+		a.logger.ErrorContext(r.Context(), "auth: captcha verification unavailable", "err", err)
+		writeJSONError(w, http.StatusServiceUnavailable, "captcha verification unavailable, try again later")
+		return false
+	}
+	return true
+}
+
+// loginFailed counts a failed login towards the CAPTCHA threshold
+func (a *api) loginFailed(r *http.Request) {
+	if a.captcha != nil {
+		a.captcha.failed(clientIP(r), time.Now())
+	}
+}
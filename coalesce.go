@@ -0,0 +1,173 @@
+// Package main - request coalescing: identical concurrent GETs share one handler run
+package main
+
+import (
+	"bytes"    // For buffering the shared response
+	"cmp"      // For cmp.Or
+	"context"  // For detaching the shared run from one client's connection
+	"errors"   // For the leader-failed error
+	"net/http" // For the middleware and headers
+	"slices"   // For copying header values
+	"strings"  // For building the key
+	"sync"     // For the in-flight map
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For hashing credentials into the coalescing key
+)
+
+// When a dashboard with 50 open tabs refreshes GET /admin/stats at once, the
+// handler computes the same answer 50 times. Coalescing lets the first
+// request (the "leader") run the handler while the others with the same key
+// wait and receive a copy of its response - golang.org/x/sync/singleflight,
+// applied to HTTP. Node has no built-in equivalent; the usual pattern is
+// caching the pending Promise in a Map.
+//
+// Unlike a cache nothing is kept afterwards: the next request after the
+// leader finishes runs the handler again.
+
+// errFlightFailed is what waiters get when the leader panicked
+var errFlightFailed = errors.New("shared call did not complete")
+
+// flightGroup runs one call per key at a time; concurrent callers with the
+// same key wait for that call and share its result
+type flightGroup[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*flightCall[V]
+}
+
+// flightCall is one in-progress (or just finished) call
+type flightCall[V any] struct {
+	done chan struct{} // Closed when val and err are set
+	val  V
+	err  error
+}
+
+// newFlightGroup creates an empty group
+func newFlightGroup[K comparable, V any]() *flightGroup[K, V] {
+	return &flightGroup[K, V]{calls: make(map[K]*flightCall[V])}
+}
+
+// do runs fn once for all concurrent callers with the same key
+// shared is true for the callers that got someone else's result; a waiter
+// whose ctx ends stops waiting (the leader carries on for the others)
+func (g *flightGroup[K, V]) do(ctx context.Context, key K, fn func() (V, error)) (v V, shared bool, err error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.val, true, call.err
+		case <-ctx.Done():
+			return v, true, ctx.Err()
+		}
+	}
+	call := &flightCall[V]{done: make(chan struct{}), err: errFlightFailed}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// Deferred, so waiters are released (with errFlightFailed) even if fn panics
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn()
+	return call.val, false, call.err
+}
+
+// bufferedResponse is a handler's response held in memory so it can be
+// replayed to every waiting client
+type bufferedResponse struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+// Header, Write and WriteHeader make bufferedResponse an http.ResponseWriter
+func (b *bufferedResponse) Header() http.Header { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+// writeTo replays the response on w
+// Only the headers the handler set are copied: what outer middleware already
+// put on w (rate limit counters, Vary, security headers) stays per client
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = slices.Clone(values) // Each client gets its own slice
+	}
+	w.WriteHeader(cmp.Or(b.status, http.StatusOK)) // A handler that wrote nothing means 200
+	w.Write(b.body.Bytes())
+}
+
+// coalesceKey decides which requests count as identical: same URL, and the
+// same values for everything the response depends on besides the URL -
+// tenant, language, time zone, Accept and credentials
+// Credentials are hashed, not stored, and requests from different callers
+// never share a response
+func coalesceKey(r *http.Request) string {
+	ctx := r.Context()
+	return strings.Join([]string{
+		r.Method,
+		r.URL.RequestURI(),
+		tenantFromContext(ctx),
+		localeFromContext(ctx),
+		locationFromContext(ctx).String(),
+		r.Header.Get("Accept"),
+		cryptoutil.SHA256Hex([]byte(r.Header.Get("Authorization") + "\x00" + r.Header.Get("Cookie"))),
+	}, "\x00")
+}
+
+// coalesce shares one handler run between identical concurrent GET/HEAD
+// requests (see coalesceKey); other methods always run the handler
+// Use it only on read-only endpoints whose response is the same for every
+// caller with the same key - route it with withCoalescing() (see router.go)
+// Requests with Cache-Control: no-cache, and callers who just wrote
+// something, run the handler on their own (see consistency.go)
+func coalesce(writes *writeTracker) Middleware {
+	flights := newFlightGroup[string, *bufferedResponse]()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if wantsFresh(r) || writes.wroteRecently(r) {
+				// A run that started before their write could return the old data
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			resp, shared, err := flights.do(r.Context(), coalesceKey(r), func() (*bufferedResponse, error) {
+				// The leader's client may hang up while others are waiting, so the
+				// shared run ignores its cancellation - but keeps the route's deadline
+				ctx := context.WithoutCancel(r.Context())
+				if deadline, ok := r.Context().Deadline(); ok {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithDeadline(ctx, deadline)
+					defer cancel()
+				}
+				buf := &bufferedResponse{header: http.Header{}}
+				next.ServeHTTP(buf, r.WithContext(ctx))
+				return buf, nil
+			})
+			if err != nil {
+				// This client gave up waiting, or the leader panicked
+				writeJSONError(w, http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+				return
+			}
+			if shared {
+				w.Header().Set("X-Coalesced", "true") // Handy when checking that it works
+			}
+			resp.writeTo(w)
+		})
+	}
+}
@@ -0,0 +1,375 @@
+// Package main - response compression negotiated from Accept-Encoding
+package main
+
+import (
+	"bytes"          // For the example's sample payload
+	"compress/flate" // For the deflate codec
+	"compress/gzip"  // For the gzip codec
+	"fmt"            // For error messages and example output
+	"io"             // For the encoder interface
+	"mime"           // For reading the media type out of Content-Type
+	"net/http"       // For the middleware and headers
+	"slices"         // For the example's sorted output
+	"strconv"        // For q-values
+	"strings"        // For parsing header lists
+	"sync"           // For pooling encoders
+	"time"           // For timing the codecs in the example
+
+	"github.com/andybalholm/brotli"      // Brotli in pure Go, like Node's zlib.createBrotliCompress
+	"github.com/klauspost/compress/zstd" // zstd in pure Go (Node 22.15+ has zlib.createZstdCompress)
+)
+
+// npm: compression → app.use(compression())
+// Go has gzip and deflate in the standard library; Brotli and zstd come from
+// github.com/andybalholm/brotli and github.com/klauspost/compress/zstd. All
+// four are entries in the codec table below - negotiation, pooling and the
+// middleware work the same for every entry. The compression package only
+// does gzip and deflate; shrink-ray-current adds br and zstd.
+
+// init() registers the "compression" example
+func init() {
+	registerExample("compression", compressionExamples)
+}
+
+// minCompressSize is the smallest body worth compressing; below ~1 KB the
+// header overhead and CPU time buy almost nothing (compression's threshold option)
+const minCompressSize = 1024
+
+// encoder is what gzip.Writer, flate.Writer, brotli.Writer and zstd.Encoder
+// have in common: Reset lets a pooled encoder be reused for the next
+// response instead of allocating (a gzip.Writer holds several hundred KB of
+// tables, a Brotli or zstd one a few MB)
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+// codec is one Content-Encoding the server can produce
+type codec struct {
+	name string
+	pool sync.Pool // Reusable encoders; sync.Pool drops idle ones on GC
+}
+
+// newCodec creates a codec whose pool builds encoders with newEncoder
+func newCodec(name string, newEncoder func() encoder) *codec {
+	return &codec{name: name, pool: sync.Pool{New: func() any { return newEncoder() }}}
+}
+
+// codecs are the encodings this build supports, by Content-Encoding token
+var codecs = map[string]func() *codec{
+	"gzip": func() *codec {
+		return newCodec("gzip", func() encoder {
+			w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression) // Only fails for invalid levels
+			return w
+		})
+	},
+	"deflate": func() *codec {
+		return newCodec("deflate", func() encoder {
+			w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+			return w
+		})
+	},
+	// Level 5: above it Brotli gets slow quickly, which only pays off for
+	// files compressed once at build time (see BenchmarkCodecs)
+	"br": func() *codec {
+		return newCodec("br", func() encoder {
+			return brotli.NewWriterLevel(io.Discard, brotliLevel)
+		})
+	},
+	// One goroutine per encoder (the default starts one per CPU, for big
+	// files), and at most an 8 MB window: browsers refuse bigger ones
+	// for Content-Encoding: zstd (RFC 8878)
+	"zstd": func() *codec {
+		return newCodec("zstd", func() encoder {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), // Only fails for invalid options
+				zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(zstdMaxWindow))
+			return w
+		})
+	},
+}
+
+// brotliLevel is the quality Brotli encodes responses with (0-11)
+const brotliLevel = 5
+
+// zstdMaxWindow is the largest window browsers decode for Content-Encoding: zstd
+const zstdMaxWindow = 8 << 20
+
+// codecNames lists the codecs in codecs, for error messages
+const codecNames = "zstd, br, gzip, deflate"
+
+// parseCodecs reads the -compression flag: a comma-separated list in server
+// preference order ("zstd,br,gzip,deflate"), or "off"
+func parseCodecs(list string) ([]*codec, error) {
+	if list == "off" || list == "" {
+		return nil, nil
+	}
+	var out []*codec
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		build, ok := codecs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown compression %q (available: %s)", name, codecNames)
+		}
+		out = append(out, build())
+	}
+	return out, nil
+}
+
+// negotiateEncoding picks a codec for an Accept-Encoding header
+// The client's q-values decide first; on a tie the server's order wins, so
+// "gzip, deflate" with -compression=deflate,gzip gets deflate:
+//
+//	Accept-Encoding: gzip;q=0.5, deflate     → deflate (client prefers it)
+//	Accept-Encoding: gzip, deflate           → first in the server's list
+//	Accept-Encoding: *;q=0, identity         → nil (send it uncompressed)
+func negotiateEncoding(accept string, available []*codec) *codec {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if name != "" {
+			weights[strings.ToLower(name)] = q
+		}
+	}
+
+	var best *codec
+	bestQ := 0.0
+	for _, c := range available {
+		q, ok := weights[c.name]
+		if !ok {
+			q = weights["*"] // Missing from the header: the wildcard decides (0 when absent)
+		}
+		if q > bestQ { // Strictly greater, so earlier (preferred) codecs win ties
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether a Content-Type is worth compressing; images,
+// video and archives are already compressed and would only get bigger
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compress encodes responses with the best codec the client accepts
+// Small bodies, already-compressed types, partial content and responses that
+// set their own Content-Encoding are sent as they are
+func compress(available []*codec) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(available) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Caches must keep compressed and uncompressed copies apart
+			w.Header().Add("Vary", "Accept-Encoding")
+			c := negotiateEncoding(r.Header.Get("Accept-Encoding"), available)
+			if c == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, codec: c, status: http.StatusOK}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter buffers the first minCompressSize bytes, then decides
+// whether to compress - the size and Content-Type are only known once the
+// handler starts writing
+type compressWriter struct {
+	http.ResponseWriter
+	codec   *codec
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder // nil when the response goes out uncompressed
+}
+
+// WriteHeader is delayed until decide, which may still change the headers
+func (cw *compressWriter) WriteHeader(code int) {
+	if !cw.decided {
+		cw.status = code
+	}
+}
+
+// Write buffers until the body is big enough to be worth compressing
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < minCompressSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide sets the headers, sends the status and writes out the buffer
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf)) // What net/http would sniff anyway
+	}
+	ok := len(cw.buf) >= minCompressSize &&
+		h.Get("Content-Encoding") == "" &&
+		cw.status == http.StatusOK && // Not 206 (byte ranges of the original), 204, 304, ...
+		compressible(h.Get("Content-Type"))
+	if ok {
+		h.Set("Content-Encoding", cw.codec.name)
+		h.Del("Content-Length") // The compressed length isn't known up front
+		// The compressed bytes differ from the original, so a strong ETag
+		// would be wrong; a weak one still works for If-None-Match
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = cw.codec.pool.Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what has been compressed so far (http.Flusher, for streaming responses)
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// close finishes the stream and returns the encoder to the pool
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.enc != nil {
+		cw.enc.Close() // Writes the codec's trailer (gzip's CRC, zstd's end of frame)
+		cw.enc.Reset(io.Discard)
+		cw.codec.pool.Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressionExamples compares size and CPU time of the available codecs
+// and levels on a typical JSON list response - the trade-off the
+// -compression flag is about
+func compressionExamples(w io.Writer) {
+	var sample bytes.Buffer
+	for i := range 2000 {
+		fmt.Fprintf(&sample, `{"id":%d,"name":"User %d","email":"user%d@example.com","created_at":"2024-03-31T12:00:00Z"},`, i, i, i)
+	}
+	payload := sample.Bytes()
+	fmt.Fprintf(w, "payload: %d bytes of JSON\n", len(payload))
+
+	type result struct {
+		name string
+		size int
+		took time.Duration
+	}
+	run := func(name string, newEnc func(io.Writer) io.WriteCloser) result {
+		const rounds = 20
+		var out bytes.Buffer
+		start := time.Now()
+		for range rounds {
+			out.Reset()
+			enc := newEnc(&out)
+			enc.Write(payload)
+			enc.Close()
+		}
+		return result{name, out.Len(), time.Since(start) / rounds}
+	}
+
+	var results []result
+	levels := []struct {
+		name  string
+		level int
+	}{{"gzip BestSpeed", gzip.BestSpeed}, {"gzip Default", gzip.DefaultCompression}, {"gzip Best", gzip.BestCompression}}
+	for _, l := range levels {
+		level := l.level
+		results = append(results, run(l.name, func(out io.Writer) io.WriteCloser {
+			enc, _ := gzip.NewWriterLevel(out, level)
+			return enc
+		}))
+	}
+	results = append(results, run("deflate Default", func(out io.Writer) io.WriteCloser {
+		enc, _ := flate.NewWriter(out, flate.DefaultCompression)
+		return enc
+	}))
+	for _, level := range []int{1, brotliLevel, brotli.BestCompression} {
+		results = append(results, run(fmt.Sprintf("br %d", level), func(out io.Writer) io.WriteCloser {
+			return brotli.NewWriterLevel(out, level)
+		}))
+	}
+	zstdLevels := []zstd.EncoderLevel{zstd.SpeedFastest, zstd.SpeedDefault, zstd.SpeedBestCompression}
+	for _, level := range zstdLevels {
+		results = append(results, run("zstd "+level.String(), func(out io.Writer) io.WriteCloser {
+			enc, _ := zstd.NewWriter(out, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+			return enc
+		}))
+	}
+
+	// Smallest first: Brotli and zstd usually land well below gzip, zstd at
+	// about gzip's CPU cost, Brotli's top levels at many times it
+	slices.SortFunc(results, func(a, b result) int { return a.size - b.size })
+	for _, res := range results {
+		ratio := float64(res.size) / float64(len(payload)) * 100
+		fmt.Fprintf(w, "  %-18s %7d bytes (%4.1f%%) %10v per response\n", res.name, res.size, ratio, res.took.Round(time.Microsecond))
+	}
+
+	fmt.Fprintln(w, "negotiation with -compression=zstd,br,gzip,deflate:")
+	available, _ := parseCodecs("zstd,br,gzip,deflate")
+	for _, accept := range []string{"gzip, deflate, br, zstd", "gzip, deflate, br", "gzip;q=0.5, deflate", "br;q=0.8, gzip", "*"} {
+		name := "identity"
+		if c := negotiateEncoding(accept, available); c != nil {
+			name = c.name
+		}
+		fmt.Fprintf(w, "  %-24q → %s\n", accept, name)
+	}
+	_, err := parseCodecs("lz4,gzip")
+	fmt.Fprintln(w, "error:", err)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"             // For the sample payload and decoded bodies
+	"compress/flate"    // For decoding deflate
+	"compress/gzip"     // For decoding gzip
+	"fmt"               // For the sample payload
+	"io"                // For reading decoded bodies
+	"net/http"          // For the test handler
+	"net/http/httptest" // Go's supertest: a fake ResponseWriter and requests
+	"testing"           // Go's built-in test runner and benchmarks
+
+	"github.com/andybalholm/brotli"      // For decoding br
+	"github.com/klauspost/compress/zstd" // For decoding zstd
+)
+
+// sampleJSON is a list response like GET /users?per_page=100 sends
+func sampleJSON(users int) []byte {
+	var b bytes.Buffer
+	b.WriteString("[")
+	for i := range users {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"id":%d,"name":"User %d","email":"user%d@example.com","role":"user","created_at":"2024-03-31T12:%02d:00Z"}`, i, i, i, i%60)
+	}
+	b.WriteString("]")
+	return b.Bytes()
+}
+
+// decoders read each Content-Encoding back, the way a browser would
+var decoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"deflate": func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+	"br":      func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	"zstd": func(r io.Reader) (io.Reader, error) {
+		d, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(zstdMaxWindow)) // What browsers accept
+		return d, err
+	},
+}
+
+// TestCompressCodecs sends the same response through the middleware with
+// each codec - twice, so the second response gets a pooled encoder that
+// was Reset - and checks that it decodes to what the handler wrote
+func TestCompressCodecs(t *testing.T) {
+	body := sampleJSON(500)
+	available, err := parseCodecs("zstd,br,gzip,deflate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := compress(available)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	for name, decode := range decoders {
+		for round := range 2 {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Accept-Encoding", name)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got := rec.Header().Get("Content-Encoding"); got != name {
+				t.Fatalf("%s: Content-Encoding = %q", name, got)
+			}
+			r, err := decode(rec.Body)
+			if err != nil {
+				t.Fatalf("%s round %d: %v", name, round, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, body) {
+				t.Errorf("%s round %d: decoded %d bytes (err %v), want the %d sent", name, round, len(got), err, len(body))
+			}
+		}
+	}
+}
+
+// TestParseCodecsUnknown checks that a typo fails at startup, not per request
+func TestParseCodecsUnknown(t *testing.T) {
+	if _, err := parseCodecs("zstd,lz4"); err == nil {
+		t.Error("parseCodecs accepted lz4")
+	}
+}
+
+// BenchmarkCodecs compresses a 100-user list response with each codec's
+// pooled encoder, as the middleware does, and reports the compressed size
+// next to the time - the trade-off -compression is about:
+//
+//	go test -run '^$' -bench Codecs -benchmem
+//
+// ns/op is the CPU cost per response, compressed-bytes the size on the wire and
+// ratio the share of the original; Jest has no built-in equivalent, this is
+// what benchmark.js is for in Node
+func BenchmarkCodecs(b *testing.B) {
+	body := sampleJSON(100)
+	for _, name := range []string{"gzip", "deflate", "br", "zstd"} {
+		c := codecs[name]()
+		b.Run(name, func(b *testing.B) {
+			var out bytes.Buffer
+			b.SetBytes(int64(len(body))) // MB/s of input
+			for b.Loop() {
+				out.Reset()
+				enc := c.pool.Get().(encoder)
+				enc.Reset(&out)
+				enc.Write(body)
+				enc.Close()
+				enc.Reset(io.Discard)
+				c.pool.Put(enc)
+			}
+			b.ReportMetric(float64(out.Len()), "compressed-bytes")
+			b.ReportMetric(float64(out.Len())/float64(len(body)), "ratio")
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Package main - GET /admin/config: what this instance is actually running with
+package main
+
+import (
+	"flag"     // For walking the command-line flags
+	"net/http" // For the handler
+	"net/url"  // For redacting passwords in URLs
+	"slices"   // For sorting secret names
+	"strings"  // For matching sensitive flag names
+	"time"     // For route defaults
+)
+
+// "Why does this instance behave differently?" usually comes down to a flag,
+// an environment variable or a feature flag nobody remembers setting. Flags
+// and env vars are read once in main(), scattered over a dozen lines, so
+// main() collects the effective values in a runtimeConfig and
+// GET /admin/config shows them together with the state that can change at
+// runtime (feature flags, maintenance mode). Like dumping the resolved
+// config object of node-config or convict, minus the secrets.
+
+// redacted replaces sensitive values in the output
+const redacted = "[redacted]"
+
+// sensitiveFlagWords mark flags whose values are never shown, as the last
+// word of the name: -tls-key is hidden, -api-key-daily-quota (a number) isn't
+var sensitiveFlagWords = []string{"token", "secret", "password", "key"}
+
+// routeDefaults are the limits every route gets unless it overrides them (see router.go)
+type routeDefaults struct {
+	Timeout    string `json:"timeout"`
+	MaxBody    int64  `json:"max_body"`
+	RateLimit  int    `json:"rate_limit"`
+	RateWindow string `json:"rate_window"`
+}
+
+// newRouteDefaults describes o for the config output
+func newRouteDefaults(o routeOptions) routeDefaults {
+	return routeDefaults{Timeout: o.Timeout.String(), MaxBody: o.MaxBody, RateLimit: o.RateLimit, RateWindow: o.RateWindow.String()}
+}
+
+// runtimeConfig is the startup configuration main() resolved
+// main() fills it while wiring the server; it is only read once serving starts
+type runtimeConfig struct {
+	Flags           map[string]string // Every command-line flag with its effective value (env defaults included), redacted
+	SecretsProvider string            // SECRETS_PROVIDER
+	EnvFile         string            // The .env file read at startup, "" if none (see envconfig.go)
+	ConfigFile      string            // The config file read at startup, "" if none (see configfile.go)
+	SecretNames     []string          // Secrets the server reads; only whether each is set is shown
+	Middleware      []string          // Global middleware, outermost first
+	RouteDefaults   routeDefaults
+	Resilience      resilienceConfig // -degraded-reads, -stale-for (see resilience.go)
+	secrets         *secretCache     // For checking which secrets are set
+}
+
+// effectiveFlags returns every flag's value after flag.Parse(), with
+// sensitive values redacted
+// flag.VisitAll includes flags left at their default - the defaults are
+// often where an environment variable came in (os.Getenv in the default)
+func effectiveFlags() map[string]string {
+	out := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		out[f.Name] = redactValue(f.Name, f.Value.String())
+	})
+	return out
+}
+
+// redactValue hides a flag's value if its name sounds secret, and the
+// password of a URL like postgres://app:secret@db/app in any flag
+func redactValue(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	for _, word := range sensitiveFlagWords {
+		if strings.HasSuffix(name, word) {
+			return redacted
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted() // postgres://app:xxxxx@db/app
+	}
+	return value
+}
+
+// configResponse is the body of GET /admin/config
+type configResponse struct {
+	Flags         map[string]string   `json:"flags"`
+	EnvFile       string              `json:"env_file,omitempty"`
+	ConfigFile    string              `json:"config_file,omitempty"`
+	Secrets       configSecrets       `json:"secrets"`
+	FeatureFlags  map[string]flagRule `json:"feature_flags"` // Current rules, including runtime changes
+	Store         storeInfo           `json:"store"`
+	Maintenance   maintenanceState    `json:"maintenance"`
+	Middleware    []string            `json:"middleware"` // Outermost first: the order a request passes through them
+	RouteDefaults routeDefaults       `json:"route_defaults"`
+	Resilience    resilienceConfig    `json:"resilience"`
+	Procs         procsReport         `json:"procs"`
+	StartedAt     time.Time           `json:"started_at"`
+}
+
+// configSecrets shows where secrets come from and which are set - never a value
+type configSecrets struct {
+	Provider   string          `json:"provider"`
+	Configured map[string]bool `json:"configured"`
+}
+
+// configHandler returns the effective configuration (GET /admin/config)
+// curl -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/admin/config
+func (a *api) configHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := a.config
+	resp := configResponse{
+		Flags:         cfg.Flags,
+		EnvFile:       cfg.EnvFile,
+		ConfigFile:    cfg.ConfigFile,
+		Secrets:       configSecrets{Provider: cfg.SecretsProvider, Configured: map[string]bool{}},
+		FeatureFlags:  a.flags.snapshot(),
+		Store:         a.store,
+		Maintenance:   a.maintenance.current(),
+		Middleware:    cfg.Middleware,
+		RouteDefaults: cfg.RouteDefaults,
+		Resilience:    cfg.Resilience,
+		Procs:         a.procs,
+		StartedAt:     a.started.UTC(),
+	}
+	for _, name := range slices.Sorted(slices.Values(cfg.SecretNames)) {
+		resp.Secrets.Configured[name] = cfg.secrets.current(name) != ""
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
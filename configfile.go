@@ -0,0 +1,228 @@
+// Package main - config.yaml / config.json: server, database and logging settings in a file, below the environment
+package main
+
+import (
+	"bufio"         // For reading YAML line by line
+	"bytes"         // For decoding the merged JSON
+	"encoding/json" // config.json, and the common ground both formats are decoded through
+	"errors"        // For a missing file
+	"fmt"           // For line numbers in errors
+	"io/fs"         // For fs.ErrNotExist
+	"os"            // For reading the file
+	"path/filepath" // For the extension
+	"strconv"       // For YAML scalars
+	"strings"       // For parsing YAML lines
+)
+
+// Flags and variables are flat: LOG_LEVEL, DATABASE_URL. A config file can
+// group them, and is easier to review in a pull request than a deploy's
+// environment. The file is the lowest layer above the defaults:
+//
+//	defaults  <  config file  <  environment (.env included)  <  flags
+//
+// so the file holds what's shared and the environment what differs - the
+// precedence of node-config's default.json < production.json <
+// custom-environment-variables. For example:
+//
+//	# config.yaml
+//	server:
+//	  addr: ":9000"
+//	database:
+//	  url: postgres://app@db.internal/app   # DATABASE_URL still wins
+//	logging:
+//	  level: debug
+//	  format: text
+//
+// config.yaml, config.yml or config.json in the working directory is read
+// if it exists; CONFIG_FILE names another (and then it must exist). It
+// can't be a flag: the file supplies the flags' defaults, so it is read
+// before flags are declared.
+//
+// Both formats decode into the same nested structs. JSON goes straight in;
+// YAML is parsed into maps first and re-encoded as JSON, so both get the
+// same struct tags and the same "unknown field" errors for typos. The
+// standard library has no YAML package, and a dependency for five keys isn't
+// worth it, so parseYAML reads the subset a settings file needs - nested
+// mappings of scalars. Anything more (lists, anchors, multi-line strings) is
+// an error; gopkg.in/yaml.v3 is the package to add for that.
+
+// fileConfig is the config file's shape; every field is optional
+type fileConfig struct {
+	Server struct {
+		Addr string `json:"addr"` // → -addr
+	} `json:"server"`
+	Database struct {
+		Path string `json:"path"` // SQLite file → -db
+		URL  string `json:"url"`  // PostgreSQL URL → -database-url
+	} `json:"database"`
+	Logging struct {
+		Level  string `json:"level"`  // → -log-level
+		Format string `json:"format"` // → -log-format
+	} `json:"logging"`
+}
+
+// configFileNames are looked for in the working directory, in this order
+var configFileNames = []string{"config.yaml", "config.yml", "config.json"}
+
+// loadConfigFile reads CONFIG_FILE, or the first of configFileNames that
+// exists, and returns its path ("" when there is none)
+func loadConfigFile() (fileConfig, string, error) {
+	var cfg fileConfig
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return cfg, path, decodeConfigFile(path, &cfg)
+	}
+	for _, path := range configFileNames {
+		err := decodeConfigFile(path, &cfg)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return cfg, path, err
+	}
+	return cfg, "", nil
+}
+
+// decodeConfigFile decodes a .json, .yaml or .yml file into cfg
+func decodeConfigFile(path string, cfg *fileConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+	case ".yaml", ".yml":
+		tree, err := parseYAML(data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(tree); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown config format %q: want .yaml, .yml or .json", ext)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields() // "levle: debug" is a mistake, not a setting to ignore
+	if err := dec.Decode(cfg); err != nil {
+		// Decoding is how the file is read, whatever its format: "json:" would confuse a YAML user
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// yamlLevel is a mapping being filled and the indentation of its keys
+type yamlLevel struct {
+	indent int
+	m      map[string]any
+}
+
+// parseYAML parses nested mappings of scalars:
+//
+//	key: value        # a scalar: string, number, true/false or null
+//	parent:           # a mapping: the keys below it are indented further
+//	  child: "quoted # not a comment"
+func parseYAML(data []byte) (map[string]any, error) {
+	root := map[string]any{}
+	stack := []yamlLevel{{indent: -1, m: root}}
+	pending, pendingIndent := "", 0 // A "key:" without a value waits for the next line to say whether it has children
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(stripYAMLComment(sc.Text()), " ")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || content == "---" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+		}
+		indent := len(line) - len(content)
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			return nil, fmt.Errorf("line %d: lists aren't supported in config files", n)
+		}
+		key, value, ok := strings.Cut(content, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			return nil, fmt.Errorf("line %d: want key: value", n)
+		}
+		key, value = strings.Trim(strings.TrimSpace(key), `"'`), strings.TrimSpace(value)
+
+		if pending != "" {
+			// Indented further: its children, at that indentation. Otherwise
+			// "key:" had nothing under it and stays null, as in YAML
+			if indent > pendingIndent {
+				child := map[string]any{}
+				stack[len(stack)-1].m[pending] = child
+				stack = append(stack, yamlLevel{indent: indent, m: child})
+			}
+			pending = ""
+		}
+		for indent < stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		level := stack[len(stack)-1]
+		if indent != max(level.indent, 0) {
+			return nil, fmt.Errorf("line %d: indentation doesn't match any key above", n)
+		}
+		if _, dup := level.m[key]; dup {
+			return nil, fmt.Errorf("line %d: %q given twice", n, key)
+		}
+		if value == "" {
+			pending, pendingIndent = key, indent
+			level.m[key] = nil
+			continue
+		}
+		scalar, err := yamlScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		level.m[key] = scalar
+	}
+	return root, sc.Err()
+}
+
+// stripYAMLComment drops a # comment: at the start of the line or after a
+// space, and not inside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar converts a value the way YAML does for the types settings use
+func yamlScalar(v string) (any, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		s, err := strconv.Unquote(v) // Double quotes have JSON-like escapes
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", v)
+		}
+		return s, nil
+	case strings.HasPrefix(v, "'"):
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", v)
+		}
+		return strings.ReplaceAll(v[1:len(v)-1], "''", "'"), nil // '' is a quote inside single quotes
+	case strings.ContainsAny(v[:1], "[{&*|>!"):
+		return nil, fmt.Errorf("%q: only plain and quoted scalars are supported", v)
+	case v == "true" || v == "false":
+		return v == "true", nil
+	case v == "null" || v == "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f, nil
+	}
+	return v, nil
+}
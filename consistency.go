@@ -0,0 +1,102 @@
+// Package main - read-your-writes: callers see their own changes, not a shared older answer
+package main
+
+import (
+	"net/http" // For the middleware and headers
+	"strings"  // For parsing Cache-Control
+	"sync"     // For the mutex; writes are recorded from many requests at once
+	"time"     // For write times
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For hashing credentials into the caller key
+)
+
+// Sharing reads trades freshness for load: a coalesced GET /users (see
+// coalesce.go) may have started just before the caller's own PUT landed, and
+// a cached weather report is up to weatherCacheTTL old. For other people's
+// changes that's fine - for your own it looks like the save didn't work.
+//
+// Two ways around it, both per request:
+//
+//   - Cache-Control: no-cache (or max-age=0) on the request asks for a fresh
+//     answer explicitly - what a browser's hard reload sends
+//   - Automatically: after a caller's successful write, their reads skip the
+//     shared results for readYourWritesWindow (the "session" is the caller's
+//     credentials plus IP, like the coalescing key)
+
+// readYourWritesWindow is how long after a write a caller's reads bypass
+// sharing; it only has to outlast a route timeout (a shared run can't be older)
+const readYourWritesWindow = 30 * time.Second
+
+// wantsFresh reports whether the request asks not to be served from a cache
+func wantsFresh(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "max-age=0":
+			return true
+		}
+	}
+	return r.Header.Get("Pragma") == "no-cache" // HTTP/1.0 clients
+}
+
+// writeTracker remembers when each caller last changed something
+type writeTracker struct {
+	mu     sync.Mutex
+	last   map[string]time.Time // callerKey → time of the last successful write
+	pruned time.Time            // When old entries were last dropped
+}
+
+// newWriteTracker creates an empty tracker
+func newWriteTracker() *writeTracker {
+	return &writeTracker{last: make(map[string]time.Time)}
+}
+
+// callerKey identifies the caller: hashed credentials (never stored as-is)
+// plus the client IP, so anonymous callers are told apart too
+func callerKey(r *http.Request) string {
+	return clientIP(r) + "\x00" + cryptoutil.SHA256Hex([]byte(r.Header.Get("Authorization")+"\x00"+r.Header.Get("Cookie")))
+}
+
+// record notes a write by the caller of r
+// Entries too old to matter are dropped at most once per window, like the
+// rate limiter's occasional sweep - not by walking the whole map on every write
+func (t *writeTracker) record(r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.pruned) > readYourWritesWindow {
+		for key, at := range t.last {
+			if now.Sub(at) > readYourWritesWindow {
+				delete(t.last, key)
+			}
+		}
+		t.pruned = now
+	}
+	t.last[callerKey(r)] = now
+}
+
+// wroteRecently reports whether the caller of r wrote within readYourWritesWindow
+func (t *writeTracker) wroteRecently(r *http.Request) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.last[callerKey(r)]
+	return ok && time.Since(at) <= readYourWritesWindow
+}
+
+// trackWrites records every successful non-GET request in t
+// Failed writes changed nothing, so they don't count
+func trackWrites(t *writeTracker) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := newStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+			if rec.status < http.StatusBadRequest {
+				t.record(r)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Package cryptoutil maps Node's crypto module to Go's crypto/* packages
+//
+//	crypto.createHash('sha256').update(d).digest('hex')  → cryptoutil.SHA256Hex(d)
+//	crypto.createHmac('sha256', k).update(m).digest()    → cryptoutil.HMACSign(k, m)
+//	crypto.timingSafeEqual(a, b)                         → hmac.Equal(a, b)
+//	crypto.randomBytes(32).toString('base64url')         → cryptoutil.RandomToken(32)
+//
+// Unlike the rest of the server it's a package of its own, so anything in
+// the module can import it - the Go version of a small internal npm
+// package. Exported names start with a capital letter; that's Go's only
+// "module.exports".
+package cryptoutil
+
+import (
+	"crypto/hmac"     // crypto.createHmac() equivalent
+	"crypto/rand"     // crypto.randomBytes() - cryptographically secure randomness
+	"crypto/sha256"   // crypto.createHash('sha256') equivalent
+	"encoding/base64" // URL-safe token encoding
+	"encoding/hex"    // Hex digests like hash.digest('hex')
+)
+
+// SHA256Hex returns the hex-encoded SHA-256 digest of data
+func SHA256Hex(data []byte) string {
+	sum := sha256.Sum256(data) // Sum256 returns a fixed-size [32]byte array
+	return hex.EncodeToString(sum[:])
+}
+
+// HMACSign returns the HMAC-SHA256 of msg using key, hex-encoded
+func HMACSign(key, msg []byte) string {
+	mac := hmac.New(sha256.New, key) // Like crypto.createHmac('sha256', key)
+	mac.Write(msg)                   // hash.Hash writes never return an error
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACVerify checks a hex-encoded HMAC-SHA256 signature in constant time
+// Never compare signatures with == : it leaks timing information
+func HMACVerify(key, msg []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return hmac.Equal(got, mac.Sum(nil)) // Like crypto.timingSafeEqual
+}
+
+// RandomToken returns n random bytes encoded as URL-safe base64 without padding
+// Suitable for IDs, API keys and reset tokens that must be unguessable
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read never returns an error on supported platforms
+	// (it panics internally if the OS random source is broken)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,64 @@
+// Package main - request-scoped values: typed context keys and the helpers built on them
+package main
+
+import "context" // For context.WithValue and ctx.Value
+
+// Middleware hands values to the handlers behind it through the request's
+// context - the tenant, the locale, the request ID, the authenticated user.
+// In Express you'd hang them on req (req.user = user) or res.locals; Go's
+// http.Request has no such bag, and r.WithContext(ctx) is the way instead.
+//
+// context.WithValue takes any key and any value, which is where it goes wrong:
+//
+//	ctx = context.WithValue(ctx, "user", u)  // staticcheck warns: a built-in type as key
+//	u := ctx.Value("user").(User)            // panics if it's a *User, or missing
+//
+//   - A string (or int) key collides: any other package that also picks
+//     "user" reads or overwrites ours, and nothing tells either of them.
+//   - ctx.Value returns any, so every reader needs a type assertion, and one
+//     without ", ok" panics the request when the value is absent.
+//   - Readers scattered over the code each repeat the key and the type.
+//
+// The fix is a key only this package can name, used by one pair of helpers:
+//
+//	var tenantKey = newCtxKey[string]("tenant")
+//	func withTenant(ctx context.Context, id string) context.Context { return tenantKey.with(ctx, id) }
+//	func tenantFromContext(ctx context.Context) string { ... tenantKey.from(ctx) ... }
+//
+// ctxKey[T] is a pointer to a struct of this package: no other package can
+// create one, and every newCtxKey call makes a distinct key even for the
+// same T. The type parameter ties the key to its value's type, so from
+// returns a T - the assertion is written once, here.
+//
+// What belongs in a context: values that describe the request and cross API
+// boundaries (who, which tenant, which trace). Not optional parameters,
+// not dependencies like the store - those go in function arguments or the
+// api struct, where the compiler can see them. And values only flow inward:
+// the access log wraps requireAuth, so it never sees the user requireAuth
+// adds - a context is copied on the way in, never returned.
+
+// ctxKey is a context key for values of type T
+type ctxKey[T any] struct {
+	name string // For debugging: printing a context shows it
+}
+
+// newCtxKey creates a key; declare one per value, as a package-level var
+func newCtxKey[T any](name string) *ctxKey[T] {
+	return &ctxKey[T]{name: name}
+}
+
+// with returns a copy of ctx carrying v
+func (k *ctxKey[T]) with(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k, v)
+}
+
+// from returns the value stored under k; ok is false when there is none
+func (k *ctxKey[T]) from(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+// String names the key in fmt output, e.g. when a context is printed
+func (k *ctxKey[T]) String() string {
+	return "ctxKey(" + k.name + ")"
+}
@@ -0,0 +1,118 @@
+// Package main - ?cursor=: opaque keyset cursors for paging while items are being added
+package main
+
+import (
+	"encoding/base64" // Cursors are URL-safe base64, like cryptoutil.RandomToken
+	"fmt"             // For the Link header
+	"net/http"        // For the request and status codes
+	"strconv"         // The cursor's payload is an ID
+	"strings"         // For joining the Link header entries
+)
+
+// ?page=3 means "skip 40 items". If someone creates a user while a client is
+// on page 2, every later item moves one place along and page 3 repeats the
+// last item of page 2; a delete skips one instead. A cursor says where the
+// last page ended rather than how far in it was:
+//
+//	GET /users?limit=2
+//	→ {"data":[{"id":1,...},{"id":2,...}],"meta":{...,"next_cursor":"Mg"}}
+//	GET /users?limit=2&cursor=Mg
+//	→ the users after id 2, however many were added or removed before them
+//
+// That's keyset pagination, what Stripe's starting_after and GraphQL's
+// Relay connections do. The cursor is base64url of the last ID - opaque to
+// clients, who only pass it back, so its format may change. It only works
+// while the order is by id (?sort=id, the default, or ?sort=-id): the
+// condition is a plain "id > ?" (or "<"), which a store runs as SQL
+// (cursorCond) and which the primary key index answers without counting rows.
+//
+// Every list that can be paged this way has next_cursor in its meta when
+// another page follows, whichever way the current page was asked for. The
+// filters stay in the URL with the cursor; meta.total still counts every match.
+
+// encodeCursor returns the cursor that continues after id
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// decodeCursor returns the ID a cursor points past
+func decodeCursor(cursor string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.Atoi(string(b))
+	return id, err == nil && id > 0
+}
+
+// parseCursor reads ?cursor= into q.Page, after the sort and page were parsed
+// Every way the cursor can't be honoured is a 400, not a silent first page
+func parseCursor[T any](r *http.Request, spec listSpec[T], q *listQuery) error {
+	query := r.URL.Query()
+	if !query.Has("cursor") {
+		return nil
+	}
+	switch {
+	case spec.ID == nil:
+		return badQuery("this list can't be paged with a cursor")
+	case query.Has("page") || query.Has("offset"):
+		return badQuery("cursor can't be combined with page or offset")
+	case !cursorSortable(q.Sort):
+		return badQuery("cursor paging needs ?sort=id or ?sort=-id")
+	}
+	id, ok := decodeCursor(query.Get("cursor"))
+	if !ok {
+		return badQuery("invalid cursor: pass back a next_cursor unchanged")
+	}
+	q.Page.After, q.Page.byCursor = id, true
+	return nil
+}
+
+// cursorSortable reports whether a sort is by id alone, the only order a cursor can resume
+func cursorSortable(fields []sortField) bool {
+	return len(fields) == 1 && fields[0].Key == tiebreakerKey
+}
+
+// pastCursor reports whether item comes after the cursor in q's order
+func (s listSpec[T]) pastCursor(item T, q listQuery) bool {
+	if q.Sort[0].Desc {
+		return s.ID(item) < q.Page.After
+	}
+	return s.ID(item) > q.Page.After
+}
+
+// cursorCond is pastCursor for SQL stores: "id > ?", or "id < ?" for ?sort=-id
+func (s listSpec[T]) cursorCond(q listQuery) (sqlCond, bool) {
+	if !q.Page.byCursor {
+		return sqlCond{}, false
+	}
+	op := " > ?"
+	if q.Sort[0].Desc {
+		op = " < ?"
+	}
+	return sqlCond{s.Sort[tiebreakerKey].Column + op, q.Page.After}, true
+}
+
+// nextCursor is the cursor for the page after page, or "" when there is none
+// more says whether any item follows page; the store knows, the page doesn't
+func (s listSpec[T]) nextCursor(page []T, more bool, q listQuery) string {
+	if s.ID == nil || !more || len(page) == 0 || !cursorSortable(q.Sort) {
+		return ""
+	}
+	return encodeCursor(s.ID(page[len(page)-1]))
+}
+
+// setCursorLinkHeader is setLinkHeader for ?cursor=: first and next only,
+// since a cursor can't tell how far back the previous page started
+func setCursorLinkHeader(w http.ResponseWriter, r *http.Request, meta pageMeta) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	query.Del("cursor")
+	base := apiBaseURL(r).withPath(segments...).withQueries(query) // ?limit= or ?per_page= stays as the client sent it
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, base)}
+	if meta.NextCursor != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, base.withQuery("cursor", meta.NextCursor)))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
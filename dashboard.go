@@ -0,0 +1,361 @@
+// Package main - a live admin dashboard: request rate, errors and requests pushed over a WebSocket
+package main
+
+import (
+	"context"       // For the request event and the hub's lifetime
+	"encoding/json" // Messages are JSON text frames
+	"expvar"        // For reading the store and panic metrics
+	"net/http"      // For the middleware and handlers
+	"net/url"       // For checking the Origin header
+	"runtime"       // For the goroutine count
+	"strings"       // For skipping the dashboard's own socket
+	"sync"          // For the hub's client set
+	"time"          // For per-second buckets and the ticker
+)
+
+// GET /admin/dashboard is a server-rendered page like /admin/requests/view,
+// but it doesn't need refreshing: static/dashboard.js opens a WebSocket to
+// /admin/dashboard/live and the server pushes two kinds of messages:
+//
+//	{"type":"metrics","metrics":{"requests_per_second":4.2,"client_errors":3,...}}  every second
+//	{"type":"request","request":{"method":"GET","path":"/users","status":200,...}}   every request
+//
+// The pieces already existed; the dashboard connects them. publishRequests
+// puts every finished request on the event bus (events.go), the hub counts
+// them per second and forwards them, and each snapshot adds numbers from the
+// metrics the rest of the server keeps (expvar, runtime). In Node this is a
+// socket.io server with io.emit('metrics', ...) on a setInterval.
+//
+// Browsers can't send an Authorization header when opening a WebSocket, so
+// the page - which needs the admin token - embeds a signed link to the
+// socket (see signedurl.go) instead.
+
+// Dashboard limits
+const (
+	dashboardWindow  = 60              // Seconds of history in the request rate chart
+	dashboardRateAvg = 10              // The rate shown is the average over this many seconds
+	dashboardBacklog = 64              // Messages queued per browser before new ones are dropped
+	dashboardLinkTTL = 12 * time.Hour  // How long the socket link in the page works
+	dashboardTick    = 1 * time.Second // How often metrics are pushed
+)
+
+// requestEvent is the payload of request.completed
+// Only the path, never the query: signed links and ?token= would end up on screen
+type requestEvent struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+}
+
+// publishRequests publishes a request.completed event after every request
+// The socket itself is left out: it "completes" when the browser leaves
+func publishRequests(bus *eventBus) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/admin/dashboard/live") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			rec := newStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+			bus.publish(r.Context(), eventRequestCompleted, requestEvent{
+				Time:      start.UTC(),
+				RequestID: requestIDFromContext(r.Context()),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    rec.status,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			})
+		})
+	}
+}
+
+// trafficCounts are requests and errors, in total or for one second
+type trafficCounts struct {
+	Requests     int64 `json:"requests"`
+	ClientErrors int64 `json:"client_errors"` // 4xx
+	ServerErrors int64 `json:"server_errors"` // 5xx
+}
+
+// add counts one response with the given status
+func (c *trafficCounts) add(status int) {
+	c.Requests++
+	switch {
+	case status >= 500:
+		c.ServerErrors++
+	case status >= 400:
+		c.ClientErrors++
+	}
+}
+
+// trafficSecond is one bucket of the ring in dashboardHub
+type trafficSecond struct {
+	unix int64 // Which second the bucket currently holds
+	trafficCounts
+}
+
+// dashboardMetrics is what a metrics message carries
+type dashboardMetrics struct {
+	trafficCounts                           // Totals since startup
+	RequestsPerSecond float64               `json:"requests_per_second"`
+	Series            []trafficCounts       `json:"series"` // The last dashboardWindow seconds, oldest first
+	Goroutines        int                   `json:"goroutines"`
+	PanicsRecovered   int64                 `json:"panics_recovered"` // From expvar (see express_middleware.go)
+	Store             map[string]storeCalls `json:"store"`            // From the instrumented store, if enabled (see storemetrics.go)
+	Viewers           int                   `json:"viewers"`
+}
+
+// storeCalls is one UserStore method's numbers on the dashboard
+type storeCalls struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+}
+
+// dashboardMessage is one JSON text frame
+type dashboardMessage struct {
+	Type    string            `json:"type"` // "metrics" or "request"
+	Metrics *dashboardMetrics `json:"metrics,omitempty"`
+	Request *requestEvent     `json:"request,omitempty"`
+}
+
+// dashboardClient is one open dashboard
+// The handler goroutine drains send; the hub never blocks on a slow browser
+type dashboardClient struct {
+	send chan []byte
+}
+
+// dashboardHub counts requests and fans messages out to every open dashboard
+type dashboardHub struct {
+	mu      sync.Mutex
+	clients map[*dashboardClient]struct{}
+	seconds [dashboardWindow]trafficSecond // Ring buffer indexed by unix second
+	totals  trafficCounts
+	closed  bool           // Set on shutdown; no new clients after that
+	active  sync.WaitGroup // Open sockets, so close can wait for their goodbyes
+}
+
+// newDashboardHub creates a hub and subscribes it to request events
+func newDashboardHub(bus *eventBus) *dashboardHub {
+	h := &dashboardHub{clients: make(map[*dashboardClient]struct{})}
+	bus.subscribe(eventRequestCompleted, h.record)
+	return h
+}
+
+// record counts a finished request and forwards it (subscribed to request.completed)
+// It runs inside the request (publish is synchronous), so it only takes the lock briefly
+func (h *dashboardHub) record(ctx context.Context, payload any) {
+	ev, ok := payload.(requestEvent)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	sec := ev.Time.Unix()
+	bucket := &h.seconds[sec%dashboardWindow]
+	if bucket.unix != sec { // The bucket still holds a second from a minute ago
+		*bucket = trafficSecond{unix: sec}
+	}
+	bucket.add(ev.Status)
+	h.totals.add(ev.Status)
+	viewers := len(h.clients)
+	h.mu.Unlock()
+
+	if viewers > 0 {
+		h.broadcast(dashboardMessage{Type: "request", Request: &ev})
+	}
+}
+
+// snapshot computes a metrics message at now
+func (h *dashboardHub) snapshot(now time.Time) dashboardMetrics {
+	h.mu.Lock()
+	m := dashboardMetrics{trafficCounts: h.totals, Viewers: len(h.clients)}
+	current := now.Unix()
+	m.Series = make([]trafficCounts, dashboardWindow)
+	var recent int64
+	for i := range dashboardWindow {
+		sec := current - dashboardWindow + 1 + int64(i) // Oldest first, ending with the current second
+		if b := h.seconds[sec%dashboardWindow]; b.unix == sec {
+			m.Series[i] = b.trafficCounts
+			// The current second is still filling up, so the average uses the ones before it
+			if sec < current && sec >= current-dashboardRateAvg {
+				recent += b.Requests
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	m.RequestsPerSecond = float64(recent) / dashboardRateAvg
+	m.Goroutines = runtime.NumGoroutine()
+	m.PanicsRecovered = panicsRecovered.Value()
+	m.Store = make(map[string]storeCalls)
+	// storeMetrics is empty until instrumentStore ran; expvar.Map.Do walks it under its own lock
+	storeMetrics.Do(func(kv expvar.KeyValue) {
+		method, ok := kv.Value.(*expvar.Map)
+		if !ok {
+			return
+		}
+		calls, _ := method.Get("calls").(*expvar.Int)
+		errs, _ := method.Get("errors").(*expvar.Int)
+		if calls != nil && errs != nil {
+			m.Store[kv.Key] = storeCalls{Calls: calls.Value(), Errors: errs.Value()}
+		}
+	})
+	return m
+}
+
+// broadcast queues msg for every client; a full queue drops the message for
+// that client rather than slowing down the request that published it
+func (h *dashboardHub) broadcast(msg dashboardMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c.send <- data:
+		default: // The browser is behind; the next metrics message catches it up
+		}
+	}
+}
+
+// join registers a new dashboard; ok is false once the server is shutting down
+func (h *dashboardHub) join() (c *dashboardClient, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, false
+	}
+	c = &dashboardClient{send: make(chan []byte, dashboardBacklog)}
+	h.clients[c] = struct{}{}
+	h.active.Add(1)
+	return c, true
+}
+
+// leave unregisters c when its socket is done; after close the hub has
+// already removed it
+func (h *dashboardHub) leave(c *dashboardClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	h.active.Done()
+}
+
+// close closes every client's queue, so the handlers say goodbye (1001),
+// and waits until they have - each write is bounded by wsWriteTimeout
+// Hijacked connections are invisible to http.Server.Shutdown, so main()
+// calls this after serve() returns (see shutdown.go)
+func (h *dashboardHub) close() {
+	h.mu.Lock()
+	h.closed = true
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	h.mu.Unlock()
+	h.active.Wait()
+}
+
+// run pushes metrics every dashboardTick until ctx ends
+func (h *dashboardHub) run(ctx context.Context) {
+	ticker := time.NewTicker(dashboardTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.mu.Lock()
+			viewers := len(h.clients)
+			h.mu.Unlock()
+			if viewers > 0 {
+				m := h.snapshot(now)
+				h.broadcast(dashboardMessage{Type: "metrics", Metrics: &m})
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dashboardPage is the data for templates/pages/dashboard.html
+type dashboardPage struct {
+	LiveURL string // Signed link to the WebSocket, valid for dashboardLinkTTL
+	Window  int
+}
+
+// dashboardPageHandler renders the dashboard (GET /admin/dashboard)
+func (a *api) dashboardPageHandler(w http.ResponseWriter, r *http.Request) {
+	expires := time.Now().Add(dashboardLinkTTL)
+	a.render(w, r, http.StatusOK, "dashboard", dashboardPage{
+		LiveURL: a.signer.sign(apiBaseURL(r), expires, "admin", "dashboard", "live"),
+		Window:  dashboardWindow,
+	})
+}
+
+// dashboardSocketHandler streams dashboard messages over a WebSocket (GET /admin/dashboard/live)
+// Only reachable through requireSignature; the link comes from the page
+//
+//	websocat "ws://localhost:8080/admin/dashboard/live?expires=...&signature=..."
+func (a *api) dashboardSocketHandler(w http.ResponseWriter, r *http.Request) {
+	// Browsers send Origin with every WebSocket; another site's page must not
+	// open one with a link it got hold of (cross-site WebSocket hijacking)
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			writeJSONError(w, http.StatusForbidden, "cross-origin WebSocket not allowed")
+			return
+		}
+	}
+	conn, err := acceptWebSocket(w, r)
+	if err != nil {
+		a.logger.WarnContext(r.Context(), "dashboard socket not opened", "err", err)
+		return
+	}
+	client, ok := a.dashboard.join()
+	if !ok {
+		conn.close(wsCloseGoingAway, "server shutting down")
+		return
+	}
+	defer a.dashboard.leave(client)
+
+	// The browser sends nothing but pongs and a close frame; readLoop answers
+	// those in its own goroutine and reports when the connection ends
+	gone := make(chan error, 1)
+	go func() { gone <- conn.readLoop() }()
+
+	// A first snapshot right away, so the page isn't empty for a second
+	m := a.dashboard.snapshot(time.Now())
+	first, _ := json.Marshal(dashboardMessage{Type: "metrics", Metrics: &m})
+	if err := conn.writeText(first); err != nil {
+		conn.close(wsCloseNormal, "")
+		return
+	}
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg, ok := <-client.send:
+			if !ok { // The hub closed the queue: shutdown
+				conn.close(wsCloseGoingAway, "server shutting down")
+				return
+			}
+			if err := conn.writeText(msg); err != nil {
+				conn.close(wsCloseNormal, "")
+				return
+			}
+		case <-ping.C:
+			if err := conn.ping(); err != nil {
+				conn.close(wsCloseNormal, "")
+				return
+			}
+		case <-gone:
+			conn.close(wsCloseNormal, "")
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package main - outbound calls end before the request that made them
+package main
+
+import (
+	"context"  // For deriving shorter deadlines
+	"fmt"      // For wrapping it with the host
+	"io"       // For the response body wrapper
+	"net/http" // For the transport
+	"time"     // For the margin
+)
+
+// Every route has a deadline (timeout middleware, router.go), and the
+// request's context carries it into every call the handler makes: an HTTP
+// call with NewRequestWithContext, a query with QueryContext. A call that
+// runs right up to that deadline still loses, though - when it returns
+// there's no time left to write the error response, and the client gets a
+// cut-off connection instead of a 504. So outbound calls get the request's
+// deadline minus a margin:
+//
+//	request deadline:   |--------------------------------------| 30s
+//	outbound calls:     |-----------------------------------|    30s - 250ms
+//
+// Node has no equivalent built in; you'd pass AbortSignal.timeout(remaining - margin)
+// to every fetch by hand.
+
+// deadlineMargin is the time kept back for answering after an outbound call times out
+const deadlineMargin = 250 * time.Millisecond
+
+// errNoTimeLeft means the request's deadline is closer than deadlineMargin:
+// the call isn't even started, and not retried (see isRetryable)
+// It wraps context.DeadlineExceeded, so errors.Is checks for timeouts still match
+var errNoTimeLeft = fmt.Errorf("no time left before the request deadline: %w", context.DeadlineExceeded)
+
+// withDeadlineMargin returns a context that ends margin before ctx's deadline
+// With less than margin left it is already expired, so the call fails at once
+// instead of starting work it can't finish. Without a deadline on ctx it only
+// adds a cancel func; the caller must call it
+func withDeadlineMargin(ctx context.Context, margin time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-margin))
+}
+
+// trimDeadline makes every HTTP call through next end margin before the
+// caller's deadline, and skips calls that couldn't finish in time
+// Wraps a transport like propagateRequestID does (see requestid.go)
+func trimDeadline(next http.RoundTripper, margin time.Duration) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx, cancel := withDeadlineMargin(req.Context(), margin)
+		if ctx.Err() != nil && req.Context().Err() == nil {
+			cancel()
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Host, errNoTimeLeft)
+		}
+		resp, err := next.RoundTrip(req.WithContext(ctx)) // WithContext copies, the caller's request is untouched
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		// The body is read after RoundTrip returns, so the context has to live
+		// until the caller closes it - cancelling now would cut off the body
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	})
+}
+
+// cancelOnClose releases a context when the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body, then cancels the context
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"  // For the parent contexts
+	"errors"   // For errors.Is on the context errors
+	"net/http" // For trimDeadline's requests
+	"testing"  // Go's built-in test runner: go test ./... instead of Jest
+	"time"     // For deadlines and margins
+)
+
+// TestWithDeadlineMargin covers the three kinds of parent: one without a
+// deadline, one with time to spare, and one with less time left than the margin
+func TestWithDeadlineMargin(t *testing.T) {
+	t.Run("no deadline", func(t *testing.T) { // Like Jest's it() inside a describe()
+		ctx, cancel := withDeadlineMargin(context.Background(), time.Second)
+		defer cancel()
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("got a deadline from a parent without one")
+		}
+		if ctx.Err() != nil {
+			t.Errorf("err = %v, want a live context", ctx.Err())
+		}
+	})
+
+	t.Run("deadline later than the margin", func(t *testing.T) {
+		parent, cancelParent := context.WithTimeout(context.Background(), time.Hour)
+		defer cancelParent()
+		ctx, cancel := withDeadlineMargin(parent, time.Second)
+		defer cancel()
+		want, _ := parent.Deadline()
+		got, ok := ctx.Deadline()
+		if !ok || !got.Equal(want.Add(-time.Second)) {
+			t.Errorf("deadline = %v, want %v", got, want.Add(-time.Second))
+		}
+		if ctx.Err() != nil {
+			t.Errorf("err = %v, want a live context", ctx.Err())
+		}
+	})
+
+	t.Run("deadline closer than the margin", func(t *testing.T) {
+		parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelParent()
+		ctx, cancel := withDeadlineMargin(parent, time.Second)
+		defer cancel()
+		// Already over: the call fails at once, while the parent still has time
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			t.Errorf("err = %v, want context.DeadlineExceeded", ctx.Err())
+		}
+		if parent.Err() != nil {
+			t.Errorf("parent err = %v, want a live context", parent.Err())
+		}
+	})
+}
+
+// TestWithDeadlineMarginCancel checks that cancelling the parent - a client
+// hanging up - ends the derived context too, with or without a deadline
+func TestWithDeadlineMarginCancel(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Hour} {
+		var parent context.Context
+		var cancelParent context.CancelFunc
+		if timeout > 0 {
+			parent, cancelParent = context.WithTimeout(context.Background(), timeout)
+		} else {
+			parent, cancelParent = context.WithCancel(context.Background())
+		}
+		ctx, cancel := withDeadlineMargin(parent, time.Second)
+		cancelParent()
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				t.Errorf("timeout %v: err = %v, want context.Canceled", timeout, ctx.Err())
+			}
+		case <-time.After(time.Second):
+			t.Errorf("timeout %v: cancelling the parent didn't end the context", timeout)
+		}
+		cancel()
+	}
+}
+
+// TestTrimDeadlineNoTimeLeft checks that a call that can't finish in time
+// isn't made at all
+func TestTrimDeadlineNoTimeLeft(t *testing.T) {
+	called := false
+	rt := trimDeadline(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		called = true
+		return nil, errors.New("unreachable")
+	}), time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://api.example.com/", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, errNoTimeLeft) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want errNoTimeLeft", err)
+	}
+	if called {
+		t.Error("the call was made anyway")
+	}
+}
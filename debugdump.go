@@ -0,0 +1,194 @@
+// Package main - opt-in request/response dumps for debugging
+package main
+
+import (
+	"fmt"      // For parsing the flag and formatting log output
+	"io"       // For wrapping the request body
+	"log/slog" // For the log destination
+	"maps"     // For sorting header names
+	"net/http" // For the middleware and admin handler
+	"slices"   // For sorting header names
+	"strings"  // For path checks
+	"time"     // For timestamps and durations
+)
+
+// In Express you'd reach for DEBUG=express:* or a morgan format with
+// req.body; neither shows the response body. debugDump records both sides of
+// every request - headers and the first dumpBodyLimit bytes of each body -
+// and writes them to the logger, into a ring buffer behind
+// GET /admin/debug/requests, or both. Off by default: bodies contain
+// personal data, so only turn it on while chasing a bug.
+
+// dumpBodyLimit caps how much of each body is kept
+const dumpBodyLimit = 4 << 10 // 4 KiB
+
+// dumpRingSize is how many requests GET /admin/debug/requests keeps
+const dumpRingSize = 100
+
+// redactedHeaders never appear in a dump; they carry credentials
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// dumpMode is where dumps go (-debug-dump flag)
+type dumpMode string
+
+const (
+	dumpOff  dumpMode = "off"
+	dumpLog  dumpMode = "log"  // Written to the logger
+	dumpRing dumpMode = "ring" // Kept for GET /admin/debug/requests
+	dumpBoth dumpMode = "both"
+)
+
+// parseDumpMode checks the -debug-dump flag value
+func parseDumpMode(s string) (dumpMode, error) {
+	switch m := dumpMode(s); m {
+	case dumpOff, dumpLog, dumpRing, dumpBoth:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown debug dump mode %q (want off, log, ring or both)", s)
+}
+
+// requestDump is one recorded exchange
+type requestDump struct {
+	Time            time.Time   `json:"time"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Status          int         `json:"status"`
+	Duration        string      `json:"duration"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+}
+
+// debugDump records requests and responses according to mode
+// dumps may be nil when mode doesn't include the ring buffer
+func debugDump(mode dumpMode, dumps *ringBuffer[requestDump], logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		if mode == dumpOff {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Reading the dump endpoint would otherwise fill the buffer with itself
+			if strings.HasPrefix(r.URL.Path, "/admin/debug/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			// Capture bodies as the handler reads and writes them instead of
+			// buffering them up front - uploads and downloads keep streaming
+			reqBody := &capturingReader{ReadCloser: r.Body, limit: dumpBodyLimit}
+			r.Body = reqBody
+			rec := &capturingWriter{statusRecorder: newStatusRecorder(w), limit: dumpBodyLimit}
+
+			next.ServeHTTP(rec, r)
+
+			dump := requestDump{
+				Time:            start.UTC(),
+				Method:          r.Method,
+				URL:             r.URL.RequestURI(),
+				Status:          rec.status,
+				Duration:        time.Since(start).Round(time.Microsecond).String(),
+				RequestHeaders:  redactHeaders(r.Header),
+				RequestBody:     dumpBody(r.Header.Get("Content-Type"), reqBody.buf, reqBody.total),
+				ResponseHeaders: redactHeaders(rec.Header()),
+				ResponseBody:    dumpBody(rec.Header().Get("Content-Type"), rec.buf, rec.bytes),
+			}
+			if mode == dumpLog || mode == dumpBoth {
+				logger.InfoContext(r.Context(), "request dump", "dump", formatDump(dump))
+			}
+			if dumps != nil && (mode == dumpRing || mode == dumpBoth) {
+				dumps.add(dump)
+			}
+		})
+	}
+}
+
+// capturingReader keeps the first limit bytes read from a request body
+type capturingReader struct {
+	io.ReadCloser
+	limit int
+	buf   []byte
+	total int
+}
+
+// Read passes through and copies what fits into buf
+func (c *capturingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.total += n
+	if room := c.limit - len(c.buf); room > 0 {
+		c.buf = append(c.buf, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+// capturingWriter keeps the first limit bytes of the response body
+type capturingWriter struct {
+	*statusRecorder // Status, byte count and Unwrap come from statusRecorder
+	limit           int
+	buf             []byte
+}
+
+// Write passes through and copies what fits into buf
+func (c *capturingWriter) Write(p []byte) (int, error) {
+	if room := c.limit - len(c.buf); room > 0 {
+		c.buf = append(c.buf, p[:min(len(p), room)]...)
+	}
+	return c.statusRecorder.Write(p)
+}
+
+// redactHeaders copies h with credential headers masked
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, "[REDACTED]")
+		}
+	}
+	return out
+}
+
+// dumpBody renders a captured body: text as it is, binary as a size note
+func dumpBody(contentType string, captured []byte, total int) string {
+	if total == 0 {
+		return ""
+	}
+	// compressible (compress.go) already knows which types are text
+	if !compressible(contentType) && !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return fmt.Sprintf("[%d bytes of %s]", total, contentType)
+	}
+	if total > len(captured) {
+		return fmt.Sprintf("%s... [%d more bytes]", captured, total-len(captured))
+	}
+	return string(captured)
+}
+
+// formatDump lays out a dump like a raw HTTP exchange for the log
+func formatDump(d requestDump) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "debug dump %s %s → %d in %s\n", d.Method, d.URL, d.Status, d.Duration)
+	writeHeaders := func(prefix string, h http.Header) {
+		// Sorted, because map order changes between runs
+		for _, name := range slices.Sorted(maps.Keys(h)) {
+			fmt.Fprintf(&b, "%s %s: %s\n", prefix, name, strings.Join(h[name], ", "))
+		}
+	}
+	writeHeaders(">", d.RequestHeaders)
+	if d.RequestBody != "" {
+		fmt.Fprintf(&b, ">\n> %s\n", d.RequestBody)
+	}
+	writeHeaders("<", d.ResponseHeaders)
+	if d.ResponseBody != "" {
+		fmt.Fprintf(&b, "<\n< %s\n", strings.TrimSpace(d.ResponseBody))
+	}
+	return b.String()
+}
+
+// listDumpsHandler returns the recorded requests, newest first (GET /admin/debug/requests)
+func (a *api) listDumpsHandler(w http.ResponseWriter, r *http.Request) {
+	if a.dumps == nil {
+		writeJSONError(w, http.StatusNotFound, "debug dumps are off (start with -debug-dump=ring)")
+		return
+	}
+	respondJSON(w, http.StatusOK, a.dumps.list())
+}
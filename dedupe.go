@@ -0,0 +1,112 @@
+// Package main - reject accidental double submissions of the same request
+package main
+
+import (
+	"bytes"    // For putting the read body back
+	"fmt"      // For the 409 message
+	"io"       // For reading the body
+	"net/http" // For the middleware
+	"sync"     // For the mutex; submissions arrive concurrently
+	"time"     // For the window
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For hashing the request into the dedupe key
+)
+
+// A double-click on "Save", a form posted twice, a mobile client retrying a
+// request whose response it never got: the same POST arrives twice and two
+// users get created. An Idempotency-Key header is the clean fix, but it
+// needs clients that send one. For those that don't, the route remembers a
+// hash of each submission - caller, tenant, method, URL and the exact body
+// bytes - and answers an identical one within the window with 409 Conflict.
+// Anything that differs, even in whitespace, is a new submission.
+//
+// Requests that carry an Idempotency-Key are let through: the client has
+// taken charge of retries itself.
+
+// submission is one remembered request
+type submission struct {
+	at      time.Time
+	pending bool // Still being handled; an identical request now is a double-click
+}
+
+// submissionGuard remembers recent submissions by their hash
+type submissionGuard struct {
+	mu   sync.Mutex
+	seen map[string]submission
+}
+
+// newSubmissionGuard creates an empty guard
+func newSubmissionGuard() *submissionGuard {
+	return &submissionGuard{seen: make(map[string]submission)}
+}
+
+// claim records key as pending unless an identical submission is pending or
+// succeeded within window; it returns when that one arrived otherwise
+func (g *submissionGuard) claim(key string, window time.Duration) (earlier time.Time, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for k, s := range g.seen {
+		if !s.pending && now.Sub(s.at) > window {
+			delete(g.seen, k)
+		}
+	}
+	if s, found := g.seen[key]; found {
+		return s.at, false
+	}
+	g.seen[key] = submission{at: now, pending: true}
+	return time.Time{}, true
+}
+
+// finish settles a claimed submission: kept for the window when it
+// succeeded, forgotten when it failed - a rejected submission changed
+// nothing, so sending it again must be possible
+func (g *submissionGuard) finish(key string, succeeded bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !succeeded {
+		delete(g.seen, key)
+		return
+	}
+	g.seen[key] = submission{at: time.Now()} // The window starts when the first one is done
+}
+
+// rejectDuplicates answers byte-identical repeats of a request within window
+// with 409 Conflict (see withDuplicateWindow in router.go)
+// It sits inside bodyLimit, so reading the whole body is bounded
+func rejectDuplicates(g *submissionGuard, window time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Idempotency-Key") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, translateDecodeError(err)) // 413 past the body limit, like decode
+				return
+			}
+			// The handler still needs the body: put the bytes back as a fresh reader
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// callerKey hashes credentials and adds the IP (see consistency.go);
+			// the body is hashed too, so the map never holds request data
+			key := cryptoutil.SHA256Hex([]byte(callerKey(r) + "\x00" + tenantFromContext(r.Context()) + "\x00" +
+				r.Method + " " + r.URL.RequestURI() + "\x00" + cryptoutil.SHA256Hex(body)))
+			earlier, ok := g.claim(key, window)
+			if !ok {
+				writeJSONErrorCode(w, http.StatusConflict, "duplicate_submission", fmt.Sprintf(
+					"duplicate submission: an identical request was sent %v ago; send an Idempotency-Key header to retry on purpose",
+					time.Since(earlier).Round(time.Millisecond)))
+				return
+			}
+
+			rec := newStatusRecorder(w)
+			succeeded := false
+			// In a defer, so a panicking handler doesn't leave the key pending forever
+			defer func() { g.finish(key, succeeded) }()
+			next.ServeHTTP(rec, r)
+			succeeded = rec.status < http.StatusBadRequest
+		})
+	}
+}
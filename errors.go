@@ -0,0 +1,226 @@
+// Package main - error responses: one JSON shape for every failure, sentinel errors mapped to statuses
+package main
+
+import (
+	"errors"   // errors.Is and errors.As for the status mapping
+	"net/http" // For status codes
+	"strings"  // For codes derived from status texts
+)
+
+// Every failure answers with the same body and Content-Type:
+//
+//	HTTP/1.1 404 Not Found
+//	Content-Type: application/json
+//
+//	{"error": {"code": "not_found", "message": "user not found"}}
+//
+// code is for programs: stable, English, snake_case - switch on it. message
+// is for people and may be translated (Accept-Language, see i18n.go).
+// http.Error answers text/plain, so a client doing
+// fetch(...).then(r => r.json()) used to get a SyntaxError for half the
+// failures; it isn't used anywhere any more.
+//
+// In Express this is the error-handling middleware at the end of the chain:
+//
+//	app.use((err, req, res, next) => res.status(err.status ?? 500).json({ error: { code: err.code, message: err.message } }))
+//
+// Go has no "throw to the end of the chain", so handlers call writeError (or
+// a.respondError, which translates) with the error they got. Which status a
+// domain error gets is decided once, in errorStatuses, by errors.Is - the
+// store and service layers return sentinel errors and never think about HTTP.
+
+// errorDetail is the inside of every error response
+type errorDetail struct {
+	Code    string `json:"code"`    // "not_found", "duplicate_email", ...
+	Message string `json:"message"` // For people; may be translated
+}
+
+// errorBody is every error response: {"error": {"code": ..., "message": ...}}
+// Responses with more to say embed it and add fields (see scopes.go, captcha.go)
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+// newErrorBody builds an errorBody
+func newErrorBody(code, message string) errorBody {
+	return errorBody{Error: errorDetail{Code: code, Message: message}}
+}
+
+// writeJSONError answers {"error": {"code": ..., "message": ...}} with status
+// The code is derived from the status: 404 → "not_found", 429 → "too_many_requests"
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSONErrorCode(w, status, statusCode(status), message)
+}
+
+// writeJSONErrorCode is writeJSONError with a code of its own, for failures
+// a client should tell apart from others with the same status
+func writeJSONErrorCode(w http.ResponseWriter, status int, code, message string) {
+	respondJSON(w, status, newErrorBody(code, message))
+}
+
+// statusCode derives an error code from a status: "Not Found" → "not_found"
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// errorStatuses maps sentinel errors to the status and code they answer with
+// Checked in order with errors.Is, so wrapped errors (errUserNotFound wraps
+// errNotFound, "invalid scope: x" wraps errInvalidScope) match too
+var errorStatuses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{errNotFound, http.StatusNotFound, "not_found"},
+	{errDuplicateEmail, http.StatusConflict, "duplicate_email"},
+	{errInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{errWrongPassword, http.StatusForbidden, "wrong_password"},
+	{errPasswordLength, http.StatusBadRequest, "invalid_password"},
+	{errInvalidRole, http.StatusBadRequest, "invalid_role"},
+	{errInvalidScope, http.StatusBadRequest, "invalid_scope"},
+	{errUnknownField, http.StatusBadRequest, "unknown_field"},
+	{errRefreshInvalid, http.StatusUnauthorized, "invalid_refresh_token"},
+	{errQueueFull, http.StatusServiceUnavailable, "queue_full"},
+	{errStoreUnavailable, http.StatusServiceUnavailable, "store_unavailable"},
+	{errImageTooLarge, http.StatusRequestEntityTooLarge, "image_too_large"},
+	{errImpersonating, http.StatusForbidden, "impersonating"},
+}
+
+// validationBody is a 422: the fields that failed and why (see validate.go)
+type validationBody struct {
+	errorBody
+	Fields map[string]string `json:"fields"` // By JSON field name
+}
+
+// describeError returns the status, code and message err answers with
+// *requestError (bad JSON, see jsonio.go) keeps its status; validationError
+// is 422; *quotaError is 402 or 429 (see quota.go); sentinel errors get theirs from errorStatuses; anything else is a
+// 500 whose details stay in the server - the client only sees "internal server error"
+func describeError(err error) (status int, code, message string) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Status, statusCode(reqErr.Status), reqErr.Message
+	}
+	var invalid validationError
+	if errors.As(err, &invalid) {
+		return http.StatusUnprocessableEntity, "validation_failed", invalid.Error()
+	}
+	var param *paramError
+	if errors.As(err, &param) {
+		return http.StatusBadRequest, "invalid_path_param", param.Error()
+	}
+	var quota *quotaError
+	if errors.As(err, &quota) {
+		return quota.status(), "quota_exceeded", quota.Error()
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			return e.status, e.code, err.Error()
+		}
+	}
+	return http.StatusInternalServerError, statusCode(http.StatusInternalServerError), "internal server error"
+}
+
+// writeError answers with the status, code and message describeError picks for err
+func writeError(w http.ResponseWriter, err error) {
+	writeErrorText(w, err, english)
+}
+
+// respondError is writeError for handlers: the message is translated, and
+// a 500 is logged with the request ID, since the client never sees why
+func (a *api) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	status, _, _ := describeError(err)
+	if status == http.StatusInternalServerError {
+		a.logger.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+	}
+	writeErrorText(w, err, a.translator(r))
+}
+
+// formattedError is an error whose message has arguments, so its text
+// can't be a catalog key as it is: validationError, *paramError, *quotaError
+type formattedError interface {
+	error
+	text(t translator) string // The message with each part translated
+}
+
+// writeErrorText answers err with its message formatted by t
+// A validationError also lists its fields, each message formatted on its own;
+// a *quotaError adds the quota that ran out
+func writeErrorText(w http.ResponseWriter, err error, t translator) {
+	status, code, _ := describeError(err)
+	var invalid validationError
+	if errors.As(err, &invalid) {
+		respondJSON(w, status, validationBody{newErrorBody(code, invalid.text(t)), invalid.fields(t)})
+		return
+	}
+	var quota *quotaError
+	if errors.As(err, &quota) {
+		respondJSON(w, status, quotaBody{newErrorBody(code, quota.text(t)), quota})
+		return
+	}
+	writeJSONErrorCode(w, status, code, errorMessage(err, t))
+}
+
+// errorMessage is the message describeError picks for err, formatted by t
+func errorMessage(err error, t translator) string {
+	_, _, message := describeError(err)
+	var formatted formattedError
+	if message == err.Error() && errors.As(err, &formatted) {
+		return formatted.text(t)
+	}
+	return t(message)
+}
+
+// errorText is err's message in the client's language, for responses that
+// aren't errorBody - HTML fragments, SCIM errors, per-item bulk results
+// Messages double as catalog keys; formatted errors translate part by part
+func (a *api) errorText(r *http.Request, err error) string {
+	return errorMessage(err, a.translator(r))
+}
+
+// jsonMuxErrors answers the router's own 404 and 405 in JSON
+// http.ServeMux writes "404 page not found" as text/plain for a path no
+// route matches - Express's default finalhandler sends HTML. Requests
+// without a route get a writer that swaps the mux's text for the JSON error
+func jsonMuxErrors(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := mux.Handler(r); pattern == "" {
+				w = &muxErrorWriter{ResponseWriter: w}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// muxErrorWriter replaces an error response's text body with writeJSONError
+// The headers set before WriteHeader stay, such as the Allow of a 405
+type muxErrorWriter struct {
+	http.ResponseWriter
+	status int // 0 until WriteHeader
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *muxErrorWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if status < 400 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// http.Error has set Content-Type: text/plain already; respondJSON replaces it
+	writeJSONError(w.ResponseWriter, status, strings.ToLower(http.StatusText(status)))
+}
+
+// Write implements http.ResponseWriter; the text of an error is dropped
+func (w *muxErrorWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status >= 400 {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
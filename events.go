@@ -0,0 +1,90 @@
+// Package main - an in-process event bus for reacting to domain events
+package main
+
+import (
+	"context" // Handlers get the publisher's context
+	"sync"    // For the mutex protecting the subscriptions
+)
+
+// Event names - constants instead of string literals so a typo is a compile error
+const (
+	eventUserCreated = "user.created" // Payload: User
+	eventUserUpdated = "user.updated" // Payload: userChange
+	eventUserDeleted = "user.deleted" // Payload: User (as it was before deletion)
+	eventUserErased  = "user.erased"  // Payload: User (as it was before erasure, see gdpr.go)
+
+	// Published for every finished HTTP request, not a domain event but the
+	// same bus; the live dashboard listens (see dashboard.go)
+	eventRequestCompleted = "request.completed" // Payload: requestEvent
+
+	// Published by userService.Authenticate and ChangePassword (see service.go)
+	eventUserLoggedIn    = "user.logged_in"        // Payload: User
+	eventPasswordChanged = "user.password_changed" // Payload: User
+)
+
+// userChange is the payload of user.updated: the user before and after, so
+// subscribers can tell what changed without loading anything themselves
+type userChange struct {
+	Before User
+	After  User
+}
+
+// changedFields lists the JSON names of the fields that differ
+func (c userChange) changedFields() []string {
+	var changed []string
+	if c.Before.Name != c.After.Name {
+		changed = append(changed, "name")
+	}
+	if c.Before.Email != c.After.Email {
+		changed = append(changed, "email")
+	}
+	if c.Before.Role != c.After.Role {
+		changed = append(changed, "role")
+	}
+	if c.Before.AvatarID != c.After.AvatarID {
+		changed = append(changed, "avatar")
+	}
+	// Compare the effective settings: setting a value to its default changes nothing
+	if defaultSettings.apply(c.Before.Settings) != defaultSettings.apply(c.After.Settings) {
+		changed = append(changed, "settings")
+	}
+	return changed
+}
+
+// eventHandler reacts to one published event
+type eventHandler func(ctx context.Context, payload any)
+
+// eventBus is Node's EventEmitter for the whole application:
+// bus.subscribe("user.created", fn) ~ emitter.on('user.created', fn)
+// bus.publish(ctx, "user.created", u) ~ emitter.emit('user.created', u)
+// Publishers don't know who listens, so creating a user doesn't need to know
+// that a welcome email (or an audit log, or a webhook) follows
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]eventHandler
+}
+
+// newEventBus creates a bus without subscribers
+func newEventBus() *eventBus {
+	return &eventBus{handlers: map[string][]eventHandler{}}
+}
+
+// subscribe registers fn for every future event with this name
+func (b *eventBus) subscribe(name string, fn eventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], fn)
+}
+
+// publish calls every handler of name, in subscription order
+// Like emit(), this is synchronous: handlers run before publish returns, so
+// slow work belongs in a goroutine or a job queue inside the handler
+func (b *eventBus) publish(ctx context.Context, name string, payload any) {
+	b.mu.RLock()
+	handlers := b.handlers[name] // Copy the slice header; subscribe only appends
+	b.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(ctx, payload)
+	}
+}
@@ -0,0 +1,43 @@
+// Package main - the cheat-sheet examples live in the same package as the server
+package main
+
+import (
+	"fmt"     // For formatted output (like console.log with template strings)
+	"io"      // For the io.Writer interface - anything we can write bytes to
+	"sort"    // For sorting the example names before printing them
+	"strings" // For joining the example names into one line
+)
+
+// examples maps an example name to a function that prints a small demo
+// Each examples file registers itself from an init() function (see registerExample)
+// Run one from the command line with: go run . -example=path
+// This is the Go version of a package.json "scripts" entry like "npm run example:path"
+var examples = map[string]func(w io.Writer){}
+
+// registerExample adds a demo to the examples map
+// init() functions run automatically before main(), so every file can
+// register its own examples without main.go knowing about them
+func registerExample(name string, fn func(w io.Writer)) {
+	examples[name] = fn
+}
+
+// runExample looks up an example by name and runs it, writing output to w
+// It returns an error listing the available names when the name is unknown
+func runExample(w io.Writer, name string) error {
+	// Comma-ok idiom: ok is false when the key is missing from the map
+	fn, ok := examples[name]
+	if !ok {
+		// Collect and sort the keys - Go maps have no guaranteed iteration order
+		names := make([]string, 0, len(examples))
+		for n := range examples {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		// fmt.Errorf builds an error with a formatted message
+		return fmt.Errorf("unknown example %q (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	fn(w)
+	return nil
+}
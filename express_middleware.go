@@ -0,0 +1,456 @@
+// Package main - the most common Express middlewares rewritten for net/http
+package main
+
+import (
+	"bytes"          // For putting a peeked-at body back
+	"context"        // For storing parsed cookies and deadlines on the request
+	"expvar"         // For counting recovered panics
+	"fmt"            // For configuration errors
+	"io"             // For reading the start of a form body
+	"log/slog"       // For logging recovered panics
+	"mime"           // For the form's Content-Type and boundary
+	"mime/multipart" // For finding _method in a multipart form
+	"net/http"       // For handlers, cookies and status codes
+	"net/url"        // For validating CORS origins and parsing form bodies
+	"runtime/debug"  // For the stack trace of a recovered panic
+	"slices"         // For checking overridable methods
+	"strconv"        // For the Retry-After header value
+	"strings"        // For parsing signed cookie values
+	"sync"           // For the rate limiter's shared counters
+	"time"           // For latency and rate limit windows
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For signing cookies
+)
+
+// bodyLimit caps the size of request bodies
+// npm: body-parser → app.use(express.json({ limit: '1mb' }))
+// Go:  decoding still happens in the handler; this only bounds how much can be read.
+// Reads past the limit fail with *http.MaxBytesError, which handlers turn into an error response.
+// A Content-Length over the limit is 413 right away, like body-parser's
+// check of the header: no handler needs to read a body it would refuse
+func bodyLimit(maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeError(w, &requestError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("request body larger than %d bytes", maxBytes)})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeout gives each request a deadline
+// npm: connect-timeout → app.use(timeout('30s'))
+// The deadline goes into the request context, so everything that honours ctx
+// (outbound HTTP calls, the worker pool, retries) gives up in time; the write
+// deadline cuts off a handler that ignores ctx and keeps writing
+// Both connection deadlines replace the server's -read-timeout and
+// -write-timeout for this route (see serverlimits.go)
+func timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			// ResponseController reaches the connection through wrappers (see statusRecorder.Unwrap)
+			// The error only says the writer doesn't support deadlines, and then ctx alone has to do
+			rc := http.NewResponseController(w)
+			_ = rc.SetWriteDeadline(time.Now().Add(d))
+			// Only while there's a body to read: without one the server is
+			// already watching the connection for the client hanging up
+			if r.Body != nil && r.Body != http.NoBody {
+				_ = rc.SetReadDeadline(time.Now().Add(d))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// accessLog writes one record per request with method, path, status, size and latency
+// npm: morgan → app.use(morgan('tiny')), or pino-http with structured logs
+func accessLog(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newStatusRecorder(w) // Capture the status the handler sends
+
+			next.ServeHTTP(rec, r)
+
+			// What morgan's "tiny" format has, as fields; the request ID comes from
+			// the context (see logging.go). Like pino-http, the level follows the
+			// status, so LOG_LEVEL=warn keeps only the failures:
+			// {"level":"INFO","msg":"request","ip":"203.0.113.7","method":"GET","path":"/users","status":200,...}
+			level := slog.LevelInfo
+			switch {
+			case rec.status >= 500:
+				level = slog.LevelError
+			case rec.status >= 400:
+				level = slog.LevelWarn
+			}
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("ip", clientIP(r)),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Int("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// securityHeaders sets conservative security-related response headers
+// npm: helmet → app.use(helmet())
+func securityHeaders() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff") // Don't guess MIME types
+			h.Set("X-Frame-Options", "DENY")           // No embedding in iframes
+			h.Set("Referrer-Policy", "no-referrer")    // Don't leak URLs to other sites
+			h.Set("Cross-Origin-Opener-Policy", "same-origin")
+			// Scripts may also come from unpkg.com, where the UI loads htmx
+			h.Set("Content-Security-Policy", "default-src 'self'; script-src 'self' https://unpkg.com")
+
+			// HSTS only makes sense when the request actually came over HTTPS
+			if r.TLS != nil {
+				h.Set("Strict-Transport-Security", "max-age=15552000; includeSubDomains")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// panicsRecovered counts handler panics, on /debug/vars - it should stay at 0
+var panicsRecovered = expvar.NewInt("panics_recovered")
+
+// panicBody is the 500 a panicking handler answers with
+// The request ID lets a client's bug report be matched to the stack trace in the log
+type panicBody struct {
+	errorBody
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// recoverPanics turns a panic in a handler into a JSON 500 and a logged stack trace
+// Express: a throw inside a route ends up in the error-handling middleware,
+// app.use((err, req, res, next) => res.status(500).json({ error: ... }))
+// Go: net/http recovers panics too, but it only logs them and drops the
+// connection - the client sees "empty reply", the access log nothing.
+// recoverPanics sits inside accessLog, so the 500 is logged with the request ID
+func recoverPanics(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newStatusRecorder(w) // To know whether the response has started
+			// defer + recover() is Go's catch: it runs while the panic unwinds the stack
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err) // Deliberate abort (e.g. by a reverse proxy): let net/http handle it
+				}
+				panicsRecovered.Add(1)
+				// debug.Stack() is the stack of this goroutine, panic site included
+				logger.ErrorContext(r.Context(), "panic", "method", r.Method, "path", r.URL.Path, "panic", err, "stack", string(debug.Stack()))
+				if rec.wrote {
+					// Too late for a 500: the client already has a status line and part
+					// of a body. Aborting the connection at least shows it the response
+					// is broken, instead of ending a truncated body as if it were complete
+					panic(http.ErrAbortHandler)
+				}
+				respondJSON(w, http.StatusInternalServerError, panicBody{
+					// Never the panic value: it may contain internals
+					errorBody: newErrorBody("internal_server_error", "internal server error"),
+					RequestID: requestIDFromContext(r.Context()),
+				})
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// corsExposedHeaders are the response headers browser code may read besides
+// the basic ones (Content-Type, Cache-Control, ...)
+const corsExposedHeaders = "X-Request-ID, Link, Location, ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset"
+
+// parseCORSOrigins reads the -cors-origins flag: comma-separated origins
+// ("https://app.example.com,http://localhost:5173") or "*"; empty allows none
+// An origin is scheme://host[:port] exactly as browsers send it - a trailing
+// slash or a path would never match, so it is rejected at startup
+func parseCORSOrigins(list string) ([]string, error) {
+	var out []string
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if s != "*" {
+			u, err := url.Parse(s)
+			if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+				return nil, fmt.Errorf("CORS origin %q: want scheme://host[:port] or *", s)
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// cors lets browser apps on other origins call the API
+// npm: cors → app.use(cors({ origin: ['https://app.example.com'] }))
+// origins are exact matches like "https://app.example.com"; "*" allows any
+// origin. Preflight requests (OPTIONS with Access-Control-Request-Method)
+// are answered here with 204 - the mux has no OPTIONS routes
+func cors(origins []string) Middleware {
+	anyOrigin := slices.Contains(origins, "*")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			// The answer depends on Origin, so caches must keep one copy per origin
+			h.Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!anyOrigin && !slices.Contains(origins, origin)) {
+				next.ServeHTTP(w, r) // Same-origin or not allowed: no CORS headers, the browser blocks the response
+				return
+			}
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+				// Echo the requested headers (Authorization, X-Tenant-ID, ...), like cors does by default
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				h.Set("Access-Control-Max-Age", "600") // Browsers may skip the preflight for 10 minutes
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// overridableMethods are the methods a POST may turn into; GET/HEAD are left
+// out on purpose, so a link or prefetch can never become a write
+var overridableMethods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// methodOverridePeek is how much of a form body methodOverride reads looking
+// for _method; a form that puts it further down isn't overridden
+const methodOverridePeek = 64 << 10
+
+// methodOverride lets clients behind proxies that only pass GET and POST send
+// PUT/PATCH/DELETE as a POST with X-HTTP-Method-Override: DELETE, or as an
+// HTML form with a hidden _method field
+// npm: method-override → app.use(methodOverride('X-HTTP-Method-Override')); app.use(methodOverride('_method'))
+// Only POST requests are rewritten, before routing, so the mux sees the real method
+func methodOverride() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			method := r.Header.Get("X-HTTP-Method-Override")
+			if method == "" {
+				method = formMethod(r)
+			}
+			method = strings.ToUpper(method)
+			if slices.Contains(overridableMethods, method) {
+				// WithContext returns a shallow copy, so the access log still sees the POST
+				r = r.WithContext(r.Context())
+				r.Method = method
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// formMethod returns the _method field of an HTML form body, or ""
+// Only urlencoded and multipart bodies are looked at - a JSON body is never
+// a form, whatever it contains. The start of the body is read and then put
+// back in front of the rest, so the handler reads the whole body as sent,
+// with its own size limit; method-override in Express needs body-parser
+// to have consumed the body first
+func formMethod(r *http.Request) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data") {
+		return ""
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, methodOverridePeek))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	if mediaType == "application/x-www-form-urlencoded" {
+		// A field cut off at the end of head is just not found
+		values, _ := url.ParseQuery(string(head))
+		return values.Get("_method")
+	}
+	// Browsers send fields in form order; stop at the first file or the end of head
+	mr := multipart.NewReader(bytes.NewReader(head), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil || part.FileName() != "" {
+			return ""
+		}
+		if part.FormName() == "_method" {
+			value, _ := io.ReadAll(io.LimitReader(part, 16))
+			return string(value)
+		}
+	}
+}
+
+// readCloser reads from one reader and closes another, here the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cookiesKey is the context key for parsed cookies
+// Only this package can name it, so it can't collide (see ctxvalue.go)
+var cookiesKey = newCtxKey[map[string]string]("cookies")
+
+// cookieParser parses cookies into a map on the request context, verifying
+// signed cookies ("s:<value>.<signature>") with secret
+// npm: cookie-parser → app.use(cookieParser(secret)); req.cookies / req.signedCookies
+// Go note: r.Cookie(name) already parses cookies, so this is only needed for signing
+func cookieParser(secret []byte) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookies := make(map[string]string)
+			for _, c := range r.Cookies() {
+				value, ok := c.Value, true
+				if strings.HasPrefix(value, "s:") {
+					value, ok = unsignCookie(secret, value)
+				}
+				// Tampered signed cookies are dropped, like req.signedCookies
+				if ok {
+					cookies[c.Name] = value
+				}
+			}
+			// with returns a new context (context.WithValue); r.WithContext a new request
+			ctx := cookiesKey.with(r.Context(), cookies)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// cookiesFromContext returns the cookies parsed by cookieParser (req.cookies)
+func cookiesFromContext(ctx context.Context) map[string]string {
+	// nil when cookieParser didn't run; reading a nil map is fine
+	cookies, _ := cookiesKey.from(ctx)
+	return cookies
+}
+
+// setSignedCookie sets a cookie whose value is signed with HMAC-SHA256
+// Express: res.cookie(name, value, { signed: true, httpOnly: true })
+func setSignedCookie(w http.ResponseWriter, secret []byte, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "s:" + value + "." + cryptoutil.HMACSign(secret, []byte(value)),
+		Path:     "/",
+		HttpOnly: true,                 // Not readable from document.cookie
+		SameSite: http.SameSiteLaxMode, // Basic CSRF protection
+	})
+}
+
+// unsignCookie verifies a "s:<value>.<signature>" cookie value
+func unsignCookie(secret []byte, signed string) (string, bool) {
+	raw := strings.TrimPrefix(signed, "s:")
+	// LastIndex because the value itself may contain dots
+	dot := strings.LastIndex(raw, ".")
+	if dot < 0 {
+		return "", false
+	}
+	value, sig := raw[:dot], raw[dot+1:]
+	if !cryptoutil.HMACVerify(secret, []byte(value), sig) {
+		return "", false
+	}
+	return value, true
+}
+
+// rateWindow counts requests from one client in the current window
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+// rateLimit allows at most limit requests per client in each window; key
+// decides who "a client" is (see rateLimitKey)
+// npm: express-rate-limit → app.use(rateLimit({ windowMs: 60_000, max: 100, keyGenerator }))
+//
+// Every response carries the quota, in the headers GitHub and most APIs use:
+//
+//	X-RateLimit-Limit: 100        requests allowed per window
+//	X-RateLimit-Remaining: 57     requests left in this window
+//	X-RateLimit-Reset: 1711845060 Unix time (seconds) when the window starts over
+//
+// plus Retry-After (seconds) on 429, so clients can back off without guessing
+func rateLimit(limit int, window time.Duration, key func(*http.Request) string) Middleware {
+	// These variables are captured by the closure below and shared by
+	// every request, so they need a mutex (requests run in parallel)
+	var mu sync.Mutex
+	clients := make(map[string]*rateWindow)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			now := time.Now()
+
+			mu.Lock()
+			win, ok := clients[k]
+			if !ok || now.After(win.reset) {
+				// First request or the window expired: start a fresh window
+				win = &rateWindow{reset: now.Add(window)}
+				clients[k] = win
+			}
+			win.count++
+			over := win.count > limit
+			remaining := max(limit-win.count, 0)
+			reset := win.reset
+
+			// Drop expired windows occasionally so the map doesn't grow forever
+			if len(clients) > 10_000 {
+				for k, cw := range clients {
+					if now.After(cw.reset) {
+						delete(clients, k)
+					}
+				}
+			}
+			mu.Unlock()
+
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			// Round up so clients never retry a fraction of a second too early
+			h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Add(time.Second-1).Unix(), 10))
+
+			if over {
+				secs := int(reset.Sub(now).Seconds()) + 1
+				h.Set("Retry-After", strconv.Itoa(secs))
+				writeJSONError(w, http.StatusTooManyRequests, "too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies clients for rateLimit: authenticated callers by
+// their identity, so one user gets one quota from any number of IPs (and
+// several users behind one office NAT don't share a quota); everyone else by IP
+// Only credentials auth accepts count - a made-up token falls back to the IP,
+// otherwise sending random tokens would be a way around the limit
+func rateLimitKey(auth Authenticator) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if r.Header.Get("Authorization") != "" {
+			if principal, err := auth.Authenticate(r); err == nil {
+				return "principal:" + principal
+			}
+		}
+		return "ip:" + clientIP(r)
+	}
+}
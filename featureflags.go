@@ -0,0 +1,178 @@
+// Package main - feature flags with static defaults, runtime toggles and percentage rollouts
+package main
+
+import (
+	"errors"   // For validation errors
+	"hash/fnv" // Fast, stable hash for rollout bucketing
+	"net/http" // For handlers and middleware
+	"slices"   // For slices.Contains on allowlists
+	"strconv"  // For parsing "25%" rollouts
+	"strings"  // For parsing the FEATURE_FLAGS env var
+	"sync"     // For the mutex protecting flag state
+)
+
+// Flag names used in the code - constants catch typos at compile time,
+// where string literals scattered around would fail silently
+const (
+	flagUIInlineEdit = "ui_inline_edit" // htmx inline edit/delete on /ui/users
+)
+
+// defaultFlags is the static source of truth shipped with the binary
+// FEATURE_FLAGS can override it at startup and the admin API at runtime
+var defaultFlags = map[string]flagRule{
+	flagUIInlineEdit: {Enabled: true, Percentage: 100},
+}
+
+// flagRule describes who sees a feature
+// Evaluation order: allowlisted keys always get it, otherwise the flag must be
+// enabled and the key must fall inside the rollout percentage
+type flagRule struct {
+	Enabled    bool     `json:"enabled"`         // Master switch
+	Percentage int      `json:"percentage"`      // 0-100: share of keys that get the feature
+	Allow      []string `json:"allow,omitempty"` // Keys (users, tenants) that always get it
+}
+
+// featureFlags holds the current rules and evaluates them
+// Like the LaunchDarkly/Unleash SDKs in Node, minus the remote service
+type featureFlags struct {
+	mu    sync.RWMutex
+	rules map[string]flagRule
+}
+
+// newFeatureFlags starts from defaultFlags and applies a static override spec
+// spec format: "name=on,other=off,rollout=25%" (usually from FEATURE_FLAGS)
+func newFeatureFlags(spec string) (*featureFlags, error) {
+	rules := make(map[string]flagRule, len(defaultFlags))
+	for name, rule := range defaultFlags {
+		rules[name] = rule
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, errors.New("FEATURE_FLAGS entries must look like name=on|off|NN%")
+		}
+		rule, err := parseFlagValue(value)
+		if err != nil {
+			return nil, errors.New("flag " + name + ": " + err.Error())
+		}
+		rule.Allow = rules[name].Allow // Keep any allowlist from the defaults
+		rules[name] = rule
+	}
+	return &featureFlags{rules: rules}, nil
+}
+
+// parseFlagValue turns "on", "off" or "25%" into a rule
+func parseFlagValue(value string) (flagRule, error) {
+	switch value {
+	case "on", "true":
+		return flagRule{Enabled: true, Percentage: 100}, nil
+	case "off", "false":
+		return flagRule{Enabled: false}, nil
+	}
+
+	pct, ok := strings.CutSuffix(value, "%")
+	if !ok {
+		return flagRule{}, errors.New("expected on, off or a percentage like 25%")
+	}
+	n, err := strconv.Atoi(pct)
+	if err != nil || n < 0 || n > 100 {
+		return flagRule{}, errors.New("percentage must be between 0% and 100%")
+	}
+	return flagRule{Enabled: true, Percentage: n}, nil
+}
+
+// isEnabled evaluates a flag for a key (a user ID, tenant ID, ...)
+// Unknown flags are off, so removing a flag from config is always safe
+func (f *featureFlags) isEnabled(name, key string) bool {
+	f.mu.RLock()
+	rule, ok := f.rules[name]
+	f.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	if slices.Contains(rule.Allow, key) {
+		return true
+	}
+	if !rule.Enabled {
+		return false
+	}
+	return rolloutBucket(name, key) < rule.Percentage
+}
+
+// rolloutBucket maps a flag+key pair to a stable number in [0, 100)
+// The same key always lands in the same bucket, so a user doesn't flip
+// between old and new behavior on every request; hashing the flag name too
+// means the same 10% of users aren't the guinea pigs for every feature
+func rolloutBucket(name, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + key))
+	return int(h.Sum32() % 100)
+}
+
+// set replaces the rule for a flag at runtime
+func (f *featureFlags) set(name string, rule flagRule) error {
+	if rule.Percentage < 0 || rule.Percentage > 100 {
+		return errors.New("percentage must be between 0 and 100")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules[name] = rule
+	return nil
+}
+
+// snapshot returns a copy of all rules, safe to encode without holding the lock
+func (f *featureFlags) snapshot() map[string]flagRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make(map[string]flagRule, len(f.rules))
+	for name, rule := range f.rules {
+		out[name] = rule
+	}
+	return out
+}
+
+// flagKey is the rollout key for a request
+// Flags currently roll out per tenant, so everyone in a tenant sees the same UI
+func flagKey(r *http.Request) string {
+	return tenantFromContext(r.Context())
+}
+
+// requireFlag hides a route (404) unless the flag is on for this request
+// Express equivalent: app.use('/beta', (req, res, next) => flags.on('x', req) ? next() : res.sendStatus(404))
+func requireFlag(flags *featureFlags, name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !flags.isEnabled(name, flagKey(r)) {
+				writeJSONError(w, http.StatusNotFound, "not found") // What the mux answers for no route
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// listFlagsHandler returns every flag rule (GET /admin/flags)
+func (a *api) listFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, a.flags.snapshot())
+}
+
+// setFlagHandler toggles or re-targets a flag at runtime (PUT /admin/flags/{name})
+// curl -X PUT -d '{"enabled":true,"percentage":25}' .../admin/flags/ui_inline_edit
+func (a *api) setFlagHandler(w http.ResponseWriter, r *http.Request) {
+	rule, err := decode[flagRule](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := a.flags.set(r.PathValue("name"), rule); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, rule)
+}
@@ -0,0 +1,86 @@
+// Package main - file downloads with Range support, built on http.ServeContent
+package main
+
+import (
+	"bytes"    // bytes.Reader implements io.ReadSeeker, which ServeContent needs
+	"mime"     // For building Content-Disposition and guessing extensions
+	"net/http" // For ServeContent and handler types
+	"path"     // For stripping directories from client-supplied file names
+	"strings"  // For cleaning file names
+)
+
+// Express: res.download(path, 'report.pdf') does three things - sets
+// Content-Disposition, streams the file and handles Range/conditional
+// requests through the `send` package. In Go, http.ServeContent does the last
+// two for any io.ReadSeeker (a file, a bytes.Reader, ...):
+//
+//   - Range: bytes=0-1023      → 206 Partial Content (resumable downloads, video seeking)
+//   - multiple ranges          → 206 with a multipart/byteranges body
+//   - Range past the end       → 416 Range Not Satisfiable
+//   - If-None-Match / If-Modified-Since → 304 Not Modified
+//   - If-Range: "<etag>"       → the range only if the file hasn't changed, else the whole file
+//   - HEAD                     → headers only
+//
+// All we add is the ETag and Content-Disposition.
+
+// downloadFileHandler serves a stored blob as a file download
+// (GET /files/{id}/download, add ?inline=1 to display it in the browser instead)
+// curl -C - -o photo.png localhost:8080/files/<id>/download   ← resumes a partial download
+func (a *api) downloadFileHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathToken(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	b, ok := a.blobs.get(id)
+	if !ok || b.private { // A private blob looks missing; only its signed URL serves it (see signedurl.go)
+		writeJSONError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	serveFile(w, r, b)
+}
+
+// serveFile sends b with Range, conditional GET and Content-Disposition support
+// Shared by the plain and the signed download routes
+func serveFile(w http.ResponseWriter, r *http.Request, b *blob) {
+	// ServeContent reads the ETag header we set to answer If-None-Match and If-Range
+	w.Header().Set("ETag", `"`+b.SHA256+`"`)
+	// Setting Content-Type stops ServeContent from sniffing it from the name/bytes
+	w.Header().Set("Content-Type", b.ContentType)
+
+	disposition := "attachment" // "Save as..." dialog
+	if r.URL.Query().Get("inline") == "1" {
+		disposition = "inline" // Let the browser display it
+	}
+	// mime.FormatMediaType quotes the name and switches to the RFC 2231
+	// filename*=utf-8''... form for non-ASCII names, so "résumé.pdf" survives
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+		"filename": downloadName(b),
+	}))
+
+	// ServeContent handles Range, HEAD, 304s, Content-Length and Accept-Ranges
+	// The modtime feeds Last-Modified / If-Modified-Since
+	http.ServeContent(w, r, downloadName(b), b.CreatedAt, bytes.NewReader(b.data))
+}
+
+// downloadName picks the file name offered to the client
+// Client-supplied names are reduced to their last path element and stripped of
+// quotes and control characters; without one, the ID plus an extension is used
+func downloadName(b *blob) string {
+	name := path.Base(strings.ReplaceAll(b.Filename, `\`, "/")) // "../../etc/passwd" → "passwd"
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1 // Returning -1 drops the rune
+		}
+		return r
+	}, name)
+	if name != "" && name != "." && name != "/" {
+		return name
+	}
+
+	// ExtensionsByType("image/png") → [".png"]
+	if exts, err := mime.ExtensionsByType(b.ContentType); err == nil && len(exts) > 0 {
+		return b.ID + exts[0]
+	}
+	return b.ID + ".bin"
+}
@@ -0,0 +1,170 @@
+// Package main - GDPR-style data export (right of access) and erasure (right to be forgotten)
+package main
+
+import (
+	"archive/zip"   // For the export archive
+	"encoding/json" // For the JSON files inside it
+	"fmt"           // For file names and the attachment header
+	"io"            // For the archive entry writers
+	"net/http"      // For the handlers
+	"time"          // For timestamps
+)
+
+// Two requests every service holding personal data has to answer:
+//
+//   - "Send me everything you have about me" (GDPR art. 15/20):
+//     GET /users/{id}/data-export returns a zip of JSON files plus the
+//     uploaded files, in a format another service could import
+//   - "Delete me" (art. 17): DELETE /users/{id}/erase removes the user and
+//     everything that belongs to them right away, instead of the soft delete
+//     of DELETE /users/{id} (see purge.go)
+//
+// Both walk every place user data lives - the user record, posts, avatar
+// blobs, the activity feed - so a new store has to be added here too.
+
+// exportProfile is user.json in the archive: the stored user plus the
+// fields the API normally hides or computes
+type exportProfile struct {
+	User                  // Embedded: its JSON fields appear at the top level
+	Settings userSettings `json:"settings"` // Effective settings, defaults filled in
+	Tenant   string       `json:"tenant"`
+}
+
+// exportManifest is manifest.json: what the archive contains and when it was made
+type exportManifest struct {
+	UserID      int       `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// dataExportHandler sends a zip of everything stored about a user (GET /users/{id}/data-export)
+// curl -OJ -H "Authorization: Bearer $TOKEN" localhost:8080/users/1/data-export saves user-1-export.zip
+func (a *api) dataExportHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r) // 400 / 404 handled there (see htmx.go)
+	if !ok {
+		return
+	}
+
+	posts := []Post{} // [] rather than null in posts.json
+	for p := range a.posts.All() {
+		if p.TenantID == u.TenantID && p.AuthorID == u.ID {
+			posts = append(posts, p)
+		}
+	}
+	if a.clientGone(r) { // Nothing sent yet (see cancel.go)
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	jsonFiles := []struct {
+		name string
+		v    any
+	}{
+		{"user.json", exportProfile{User: u, Settings: defaultSettings.apply(u.Settings), Tenant: u.TenantID}},
+		{"posts.json", posts},
+		{"activity.json", a.activity.list(u.TenantID, u.ID)},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, u.ID))
+	w.Header().Set("Cache-Control", "no-store") // Personal data: no copies in shared caches
+
+	// The zip is streamed straight into the response - archiver's
+	// archive.pipe(res) in Node. An error halfway can't change the status
+	// anymore; the client gets a truncated, unreadable zip instead
+	zw := zip.NewWriter(w)
+	defer zw.Close() // Writes the central directory; without it the zip is invalid
+	manifest := exportManifest{UserID: u.ID, GeneratedAt: time.Now().UTC()}
+	// zw.Create would leave the modification time at zero (shown as 1980)
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	}
+
+	// Between files: a client that hung up gets nothing more, so stop compressing
+	// (the status is already sent, the access log shows 200 and the bytes written)
+	for _, f := range jsonFiles {
+		if a.clientGone(r) {
+			return
+		}
+		fw, err := create(f.name)
+		if err != nil {
+			a.logger.ErrorContext(r.Context(), "data export failed", "user_id", u.ID, "err", err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ") // Meant to be read by people too
+		enc.Encode(f.v)
+		manifest.Files = append(manifest.Files, f.name)
+	}
+	// The uploaded files themselves, not just links to them
+	for _, id := range []string{u.AvatarID, u.AvatarThumbID} {
+		b, ok := a.blobs.get(id)
+		if !ok {
+			continue
+		}
+		if a.clientGone(r) {
+			return
+		}
+		name := "files/" + downloadName(b) // Sanitized name (see files.go)
+		fw, err := create(name)
+		if err != nil {
+			a.logger.ErrorContext(r.Context(), "data export failed", "user_id", u.ID, "err", err)
+			return
+		}
+		fw.Write(b.data)
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	fw, err := create("manifest.json")
+	if err != nil {
+		return
+	}
+	json.NewEncoder(fw).Encode(manifest)
+}
+
+// erasureReport is what DELETE /users/{id}/erase removed
+type erasureReport struct {
+	UserID       int       `json:"user_id"`
+	PostsDeleted int       `json:"posts_deleted"`
+	FilesDeleted int       `json:"files_deleted"`
+	ErasedAt     time.Time `json:"erased_at"`
+}
+
+// eraseUserHandler permanently removes a user and their data (DELETE /users/{id}/erase)
+// Safeguard: nothing happens unless ?confirm= repeats the user's email -
+// a retried request, a wrong ID or a stray click can't erase anyone
+//
+//	curl -X DELETE 'localhost:8080/users/1/erase?confirm=ada@example.com'
+func (a *api) eraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("confirm") != u.Email {
+		// 428 Precondition Required: the request is fine, but needs a safeguard it didn't have
+		writeJSONError(w, http.StatusPreconditionRequired, "confirm the erasure by repeating the user's email in ?confirm=")
+		return
+	}
+
+	// The user goes first: if that fails nothing else has been touched
+	// Erase publishes user.erased, which clears the activity feed (see activity.go)
+	erased, err := a.users.Erase(r.Context(), u.TenantID, u.ID)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	report := erasureReport{UserID: erased.ID, ErasedAt: time.Now().UTC()}
+	report.PostsDeleted = a.posts.DeleteFunc(func(p Post) bool {
+		return p.TenantID == erased.TenantID && p.AuthorID == erased.ID
+	})
+	for _, id := range []string{erased.AvatarID, erased.AvatarThumbID} {
+		if id != "" && a.blobs.delete(id) {
+			report.FilesDeleted++
+		}
+	}
+
+	// The audit trail proves the erasure happened without keeping what was
+	// erased: IDs and counts, no name, no email
+	a.logger.InfoContext(r.Context(), "audit: erased user",
+		"user_id", erased.ID, "user_tenant", erased.TenantID, "posts", report.PostsDeleted, "files", report.FilesDeleted)
+	respondJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"          // For the requests and status codes
+	"net/http/httptest" // Go's supertest: a fake ResponseWriter and requests
+	"strconv"           // For the subject, a user ID as a string
+	"strings"           // For reading the bearer token
+	"testing"           // Go's built-in test runner: go test ./... instead of Jest
+)
+
+// testTokens is an AuthProvider for tests: "Bearer <name>" is that user,
+// "Bearer guest" a guest token (see guest.go)
+// The real chain needs signing keys and a store; requireAuth only needs a Principal
+type testTokens map[string]User
+
+// Name implements AuthProvider
+func (testTokens) Name() string { return "test" }
+
+// Authenticate implements AuthProvider
+func (t testTokens) Authenticate(r *http.Request) (Principal, error) {
+	name, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Principal{}, errNoCredentials
+	}
+	if name == "guest" {
+		return guestPrincipal(jwtClaims{Subject: guestSubjectPrefix + "1", Tenant: "acme"}, "jwt"), nil
+	}
+	u, ok := t[name]
+	if !ok {
+		return Principal{}, errTokenSignature
+	}
+	return Principal{Kind: principalUser, Subject: strconv.Itoa(u.ID), TenantID: u.TenantID, User: &u, Role: roleOf(u)}, nil
+}
+
+// TestDataExportOwnership checks that the export is registered like main.go
+// does it, on signedIn: nobody's without a token or with a guest token,
+// only your own with a user's, anyone's as an admin. The handler is a stand-in; only who gets to it matters
+func TestDataExportOwnership(t *testing.T) {
+	tokens := testTokens{
+		"ada":   {ID: 1, TenantID: "acme", Role: roleUser},
+		"grace": {ID: 2, TenantID: "acme", Role: roleUser},
+		"root":  {ID: 3, TenantID: "acme", Role: roleAdmin},
+	}
+	mux := http.NewServeMux()
+	signedIn := newRouteGroup(mux, routeOptions{}, nil).group("", requireAuth(authChain{tokens}))
+	signedIn.handleFunc("GET /users/{id}/data-export", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"another user's token", "grace", http.StatusForbidden},
+		{"guest token", "guest", http.StatusForbidden},
+		{"own token", "ada", http.StatusOK},
+		{"admin", "root", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { // Like Jest's it() inside a describe()
+			req := httptest.NewRequest(http.MethodGet, "/users/1/data-export", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package main - guest tokens: anonymous, read-only, short-lived and tightly throttled
+package main
+
+import (
+	"net/http" // For the handler and the middleware
+	"strings"  // For the guest subject prefix
+	"time"     // For the token lifetime
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For random guest subjects
+)
+
+// A demo frontend wants to call the API before anyone has signed up.
+// Letting it in anonymously means every visitor is the same "anonymous",
+// throttled by IP at best. A guest token gives each visitor an identity
+// without an account:
+//
+//	POST /auth/guest
+//	→ {"token":"eyJ...","expires_in":1800,"scope":"users:read","guest_id":"guest:Xb3k..."}
+//
+// With -guest-access on, requests carrying a guest token are:
+//
+//   - read-only: anything but GET, HEAD and OPTIONS is 403 guest_read_only,
+//     on every route - public ones included - and the token only holds
+//     users:read, so requireScope turns it away from writes as well
+//   - throttled per guest: -guest-rate-limit requests a minute, on top of the
+//     route's own quota
+//   - attributable: what handlers log for them carries guest_id (logging.go),
+//     and each token's issue is logged with the IP and User-Agent
+//
+// The tokens are login-token JWTs (jwt.go) whose subject starts with
+// "guest:"; there is no user behind them and nothing is stored. Minting a
+// fresh identity is how a bot would shake off the per-guest limit, so
+// POST /auth/guest has a small quota of its own per IP. In Express this is
+// an "anonymous" passport strategy plus express-rate-limit keyed by req.user.id.
+
+// roleGuest is the role of guest tokens; it can't be given to a user
+const roleGuest = "guest"
+
+// principalGuest is the kind of a guest token's principal
+const principalGuest = "guest"
+
+// guestSubjectPrefix marks a token subject as a guest, not a user ID
+const guestSubjectPrefix = "guest:"
+
+// guestTTL is how long a guest token is valid; the frontend asks for another
+const guestTTL = 30 * time.Minute
+
+// guestResponse is the body of POST /auth/guest
+type guestResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresIn int       `json:"expires_in"` // Seconds
+	ExpiresAt time.Time `json:"expires_at"`
+	Scope     string    `json:"scope"`
+	GuestID   string    `json:"guest_id"` // The subject, for support and logs
+}
+
+// guestTokenHandler issues an anonymous read-only token (POST /auth/guest)
+//
+//	curl -X POST localhost:8080/auth/guest
+func (a *api) guestTokenHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	scopes := effectiveScopes(roleGuest, nil)
+	claims := jwtClaims{
+		Subject: guestSubjectPrefix + cryptoutil.RandomToken(12),
+		Tenant:  tenantFromContext(r.Context()),
+		Scope:   strings.Join(scopes, " "),
+	}
+	token, expires := a.tokens.sign(claims, now, guestTTL)
+	ua, ip := deviceOf(r)
+	a.logger.InfoContext(r.Context(), "auth: guest token issued", "guest_id", claims.Subject, "ip", ip, "user_agent", ua)
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, guestResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresIn: int(guestTTL.Seconds()),
+		ExpiresAt: expires.UTC(),
+		Scope:     claims.Scope,
+		GuestID:   claims.Subject,
+	})
+}
+
+// isGuest reports whether a token's claims are a guest's
+func (c jwtClaims) isGuest() bool {
+	return strings.HasPrefix(c.Subject, guestSubjectPrefix)
+}
+
+// guestPrincipal is the principal of a guest token
+func guestPrincipal(c jwtClaims, scheme string) Principal {
+	return Principal{
+		Kind: principalGuest, Subject: c.Subject, Scheme: scheme, Role: roleGuest, TenantID: c.Tenant,
+		Scopes: effectiveScopes(roleGuest, parseScopes(c.Scope)),
+	}
+}
+
+// guestAccess enforces what guest tokens may do on every route
+// Requests with any other credentials, or none, pass untouched; a guest
+// token that doesn't verify is left to requireAuth, like any bad token
+func guestAccess(tokens *jwtIssuer, limit int, window time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		// The same limiter as every other quota, keyed by the guest instead of the IP
+		limited := rateLimit(limit, window, func(r *http.Request) string {
+			p, _ := principalFromContext(r.Context())
+			return p.Subject
+		})(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims, err := tokens.verify(token, time.Now())
+			if err != nil || !claims.isGuest() || claims.Tenant != tenantFromContext(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				writeJSONErrorCode(w, http.StatusForbidden, "guest_read_only", "guest tokens are read-only: sign up to make changes")
+				return
+			}
+			// The principal rides along on public routes too, so handler logs name the guest
+			limited.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), guestPrincipal(claims, "jwt"))))
+		})
+	}
+}
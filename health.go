@@ -0,0 +1,212 @@
+// Package main - startup retries, dependency monitoring and liveness/readiness probes
+package main
+
+import (
+	"context"  // For deadlines on connection attempts and checks
+	"log/slog" // For logging outages and recoveries
+	"net/http" // For the probe handlers
+	"sync"     // For the mutex protecting check results
+	"time"     // For backoff delays and timestamps
+)
+
+// In docker-compose the app container often starts before its database or
+// Vault is accepting connections. Crashing and relying on `restart: always` works,
+// but is noisy; the usual Node answer is a retry loop around the first
+// connect. connectWithRetry is that loop, and healthChecker keeps watching
+// each backend afterwards so the process can report "degraded" instead of
+// dying when a backend goes away at runtime.
+//
+// Probes run in the background, never in a request: /readyz answers from the
+// last results, so a load balancer polling it every second costs nothing and
+// a hanging database can't make the probe itself time out. Every change of a
+// backend, and of the overall status, is logged once with its reason:
+//
+//	{"level":"ERROR","msg":"backend unavailable, running degraded","backend":"user_store","err":"sqlite: schema is at version 4, this build needs 5"}
+//	{"level":"WARN","msg":"readiness changed","from":"ready","to":"degraded","backend":"user_store","reason":"sqlite: schema is at version 4, ..."}
+
+// connectWithRetry calls connect until it succeeds or ctx expires, with
+// exponential backoff from 250ms up to 5s between attempts (see retry.go) -
+// backing off keeps a restarting backend from being hammered by every client at once
+func connectWithRetry(ctx context.Context, name string, connect func(ctx context.Context) error) error {
+	failures := 0
+	err := retryDo(ctx, retryPolicy{
+		BaseDelay: 250 * time.Millisecond,
+		MaxDelay:  5 * time.Second,
+		// At startup every error is worth retrying until the deadline
+		Retryable: func(error) bool { return true },
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			failures = attempt
+			slog.Warn("connect failed, retrying", "backend", name, "attempt", attempt, "err", err, "retry_in", delay.Round(time.Millisecond))
+		},
+	}, connect)
+	if err == nil && failures > 0 {
+		slog.Info("connected", "backend", name, "attempts", failures+1)
+	}
+	return err
+}
+
+// checkFunc pings one backend; nil means healthy
+type checkFunc func(ctx context.Context) error
+
+// checkResult is the last known state of one backend
+type checkResult struct {
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	Since    time.Time `json:"since"`               // When it entered this state
+	Checked  time.Time `json:"checked_at,omitzero"` // The latest probe; zero until the first
+	Failures int       `json:"failures,omitempty"`  // Probes failed in a row
+}
+
+// healthChecker re-checks registered backends in the background
+// Handlers never call backends themselves, so a probe request is always fast
+type healthChecker struct {
+	mu      sync.RWMutex
+	checks  map[string]checkFunc
+	results map[string]checkResult
+	status  string // "ready" or "degraded" as last logged
+}
+
+// newHealthChecker creates a checker with no backends
+func newHealthChecker() *healthChecker {
+	return &healthChecker{checks: map[string]checkFunc{}, results: map[string]checkResult{}, status: "ready"}
+}
+
+// register adds a backend; it counts as healthy until the first check says otherwise
+// (registration happens after connectWithRetry succeeded)
+func (h *healthChecker) register(name string, check checkFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+	h.results[name] = checkResult{OK: true, Since: time.Now().UTC()}
+}
+
+// checkAll runs every check once and records state changes
+func (h *healthChecker) checkAll(ctx context.Context) {
+	h.mu.RLock()
+	checks := make(map[string]checkFunc, len(h.checks))
+	for name, fn := range h.checks {
+		checks[name] = fn
+	}
+	h.mu.RUnlock() // Don't hold the lock while talking to the network
+
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := check(ctx)
+		cancel()
+		h.record(name, err)
+	}
+}
+
+// record stores a check outcome, logging outages and recoveries once each
+func (h *healthChecker) record(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now().UTC()
+	prev := h.results[name]
+	ok := err == nil
+	if prev.OK == ok {
+		prev.Checked = now
+		if !ok {
+			prev.Error = err.Error() // Keep the latest reason
+			prev.Failures++
+		}
+		h.results[name] = prev
+		return
+	}
+
+	next := checkResult{OK: ok, Since: now, Checked: now}
+	if ok {
+		slog.Info("backend reconnected", "backend", name, "down_for", now.Sub(prev.Since).Round(time.Second), "failed_checks", prev.Failures)
+	} else {
+		next.Error, next.Failures = err.Error(), 1
+		slog.Error("backend unavailable, running degraded", "backend", name, "err", err)
+	}
+	h.results[name] = next
+	h.logStatusChange(name, next.Error)
+}
+
+// logStatusChange logs when the overall status flips, naming the backend
+// that flipped it; alerts can key on this one line instead of per-backend ones
+// The caller holds h.mu
+func (h *healthChecker) logStatusChange(backend, reason string) {
+	status := "ready"
+	for _, r := range h.results {
+		if !r.OK {
+			status = "degraded"
+		}
+	}
+	if status == h.status {
+		return // Another backend is still down, or was already
+	}
+	if status == "degraded" {
+		slog.Warn("readiness changed", "from", h.status, "to", status, "backend", backend, "reason", reason)
+	} else {
+		slog.Info("readiness changed", "from", h.status, "to", status, "backend", backend)
+	}
+	h.status = status
+}
+
+// watch checks right away, then every interval until ctx is cancelled
+// The first round fills in checked_at, so /readyz never reports a backend
+// that was merely assumed healthy for a whole interval
+func (h *healthChecker) watch(ctx context.Context, interval time.Duration) {
+	h.checkAll(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.checkAll(ctx)
+		}
+	}
+}
+
+// healthy reports whether a backend passed its latest check; unknown backends count as healthy
+func (h *healthChecker) healthy(name string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r, ok := h.results[name]
+	return !ok || r.OK
+}
+
+// readiness returns "ready" or "degraded" plus a copy of every result
+func (h *healthChecker) readiness() (string, map[string]checkResult) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status := "ready"
+	out := make(map[string]checkResult, len(h.results))
+	for name, r := range h.results {
+		out[name] = r
+		if !r.OK {
+			status = "degraded"
+		}
+	}
+	return status, out
+}
+
+// healthzHandler is the liveness probe (GET /healthz): the process is up and serving
+// Kubernetes restarts the pod when this fails, so it never looks at backends -
+// a database outage shouldn't trigger a restart loop
+func (a *api) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler is the readiness probe (GET /readyz): 503 while any backend is down
+// or maintenance mode is on, so load balancers stop sending traffic until it's over
+func (a *api) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	status, checks := a.health.readiness()
+	if a.maintenance.current().Enabled {
+		status = "maintenance"
+	}
+
+	code := http.StatusOK
+	if status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	respondJSON(w, code, map[string]any{
+		"status": status,
+		"checks": checks, // encoding/json sorts map keys, so the output is stable
+	})
+}
@@ -0,0 +1,133 @@
+// Package main - htmx endpoints returning HTML fragments instead of JSON
+package main
+
+import (
+	"bytes"    // Render fragments into a buffer before writing
+	"net/http" // For handler types and status codes
+)
+
+// Hypermedia-style development in one paragraph:
+// with React you'd fetch JSON and re-render on the client. With htmx the
+// server returns ready-made HTML and attributes like hx-get/hx-target say
+// where to put it. The server stays the single source of truth, and the
+// "frontend" is just templates/partials/*.html.
+
+// userEditRow is the data for templates/partials/user_edit_row.html
+type userEditRow struct {
+	User  User
+	Error string
+}
+
+// isHTMX reports whether the request was sent by htmx (it adds HX-Request: true)
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// renderFragment executes a single partial (no layout) and writes it
+func (a *api) renderFragment(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := a.templatesFor(r).fragments.ExecuteTemplate(&buf, name, data); err != nil {
+		a.logger.ErrorContext(r.Context(), "render fragment failed", "fragment", name, "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "template error")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// createUserFragment answers an htmx create: the new row on success,
+// or the error message swapped into the form on failure
+func (a *api) createUserFragment(w http.ResponseWriter, r *http.Request, u User, err error) {
+	if err != nil {
+		// HX-Retarget/HX-Reswap override the hx-target/hx-swap on the form,
+		// so the error replaces the message slot instead of landing in the table
+		w.Header().Set("HX-Retarget", "#form-error")
+		w.Header().Set("HX-Reswap", "outerHTML")
+		a.renderFragment(w, r, http.StatusUnprocessableEntity, "form_error", a.errorText(r, err))
+		return
+	}
+	a.renderFragment(w, r, http.StatusOK, "user_created", a.userRows(r, []User{u})[0])
+}
+
+// userFromPath parses {id} and looks up the user, writing an error response
+// when either step fails; ok tells the caller whether to continue
+// {id} may be the number or, with -user-ids=uuid, the UUID (see ids.go)
+func (a *api) userFromPath(w http.ResponseWriter, r *http.Request) (User, bool) {
+	raw := r.PathValue("id")
+	// Users changing their own account were loaded by requireAuth a moment
+	// ago; the copy (*u) keeps the handler's edits off the principal
+	if u, ok := userFromContext(r.Context()); ok && refersTo(raw, *u) {
+		return *u, true
+	}
+	var u User
+	var err error
+	if isUUID(raw) {
+		u, err = a.users.GetByUUID(r.Context(), tenantFromContext(r.Context()), raw)
+	} else {
+		var id int
+		if id, err = pathInt(r, "id"); err == nil {
+			u, err = a.users.Get(r.Context(), tenantFromContext(r.Context()), id)
+		}
+	}
+	if err != nil {
+		a.respondError(w, r, err)
+		return User{}, false
+	}
+	return u, true
+}
+
+// userRowFragmentHandler returns the read-only row (GET /ui/users/{id}/row)
+// Used by the Cancel button to leave edit mode
+func (a *api) userRowFragmentHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	// These endpoints are only routed while ui_inline_edit is on (see main.go)
+	a.renderFragment(w, r, http.StatusOK, "user_row", userRow{User: localUser(r, u), InlineEdit: true})
+}
+
+// userEditFragmentHandler returns the inline edit form (GET /ui/users/{id}/edit)
+func (a *api) userEditFragmentHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	a.renderFragment(w, r, http.StatusOK, "user_edit_row", userEditRow{User: localUser(r, u)})
+}
+
+// updateUserFragmentHandler saves the inline edit (PUT /ui/users/{id})
+// and swaps the row back to read-only mode
+func (a *api) updateUserFragmentHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// htmx sends form-encoded fields even for PUT; r.FormValue reads them
+	u.Name = r.FormValue("name")
+	u.Email = r.FormValue("email")
+
+	updated, err := a.users.Update(r.Context(), u)
+	if err != nil {
+		// Keep the edit form open, showing what the user typed and why it failed
+		a.renderFragment(w, r, http.StatusUnprocessableEntity, "user_edit_row", userEditRow{User: localUser(r, u), Error: a.errorText(r, err)})
+		return
+	}
+	a.renderFragment(w, r, http.StatusOK, "user_row", userRow{User: localUser(r, updated), InlineEdit: true})
+}
+
+// deleteUserFragmentHandler removes a user (DELETE /ui/users/{id})
+// An empty 200 response swapped with outerHTML removes the row from the page
+func (a *api) deleteUserFragmentHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := a.users.Delete(r.Context(), u.TenantID, u.ID); err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,54 @@
+// Package main - -http3: the same handler over QUIC, next to the HTTPS listener
+package main
+
+import (
+	"net/http" // For the handler and the TCP server it mirrors
+
+	"github.com/quic-go/quic-go/http3" // HTTP/3 on quic-go's QUIC stack
+)
+
+// HTTP/3 runs over QUIC, on UDP instead of TCP: no head-of-line blocking
+// between requests, a faster handshake (TLS 1.3 is built in) and connections
+// that survive a phone switching from Wi-Fi to mobile. Go's standard library
+// has no QUIC stack, and neither has Node's core, so it comes from quic-go.
+//
+// Browsers never start with HTTP/3. They connect over TCP, see
+//
+//	Alt-Svc: h3=":8443"; ma=2592000
+//
+// on a response and use QUIC on the same port from then on, falling back to
+// TCP if UDP is blocked. So -http3 needs HTTPS (-tls-cert): the QUIC
+// listener shares the certificate, the port (UDP instead of TCP) and the
+// handler, middleware and all; only the transport differs.
+//
+//	go run . -tls-cert cert.pem -tls-key key.pem -http3
+//	curl --http3-only -k https://localhost:8080/healthz
+//
+// Client certificates (see mtls.go) work the same over QUIC. The WebSocket
+// routes don't: they take the TCP connection over (see websocket.go), and
+// browsers open WebSockets over HTTP/1.1 anyway.
+
+// newHTTP3Server returns an HTTP/3 server for srv's address, handler, TLS
+// configuration and the limits that apply to QUIC (see serverlimits.go)
+// The read and write timeouts have no QUIC counterpart; the routes' own
+// timeouts still apply, since they are middleware
+func newHTTP3Server(srv *http.Server) *http3.Server {
+	return &http3.Server{
+		Addr:           srv.Addr,
+		Handler:        srv.Handler,
+		TLSConfig:      http3.ConfigureTLSConfig(srv.TLSConfig.Clone()), // ALPN "h3" and TLS 1.3
+		MaxHeaderBytes: srv.MaxHeaderBytes,
+		IdleTimeout:    srv.IdleTimeout,
+	}
+}
+
+// advertiseHTTP3 adds Alt-Svc to responses sent over TCP, so the client
+// tries h3 next time; responses over QUIC don't need it
+func advertiseHTTP3(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			h3.SetQUICHeaders(w.Header()) // Fails only before the UDP listener is up; then there's nothing to advertise
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,109 @@
+// Package main - a small JSON HTTP client for calling other APIs from this one
+package main
+
+import (
+	"cmp"           // For the default method in errors
+	"context"       // Every outbound call takes the caller's context
+	"encoding/json" // For decoding responses into typed structs
+	"errors"        // For the status error type
+	"fmt"           // For error messages
+	"io"            // For draining error bodies
+	"net/http"      // For the underlying client
+	"net/url"       // For form bodies
+	"strings"       // For the form body reader
+	"time"          // For the per-attempt timeout
+)
+
+// Node: const res = await fetch(url, { signal }); if (!res.ok) throw ...; return res.json()
+// Go needs a few more lines for the same thing, so they live here once:
+// context deadline, status check, typed decoding, retries (retry.go) and the
+// circuit breaker (breaker.go, via the transport).
+
+// httpClient wraps http.Client with JSON helpers
+type httpClient struct {
+	client *http.Client
+	retry  retryPolicy
+}
+
+// newHTTPClient builds a client on top of transport (normally the breaker transport)
+// timeout applies to each attempt; the caller's context bounds the whole call
+func newHTTPClient(transport http.RoundTripper, timeout time.Duration) *httpClient {
+	policy := defaultRetryPolicy
+	policy.Retryable = func(err error) bool {
+		// 4xx won't change on retry; 5xx and network errors might
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) {
+			return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+		}
+		return isRetryable(err)
+	}
+	return &httpClient{
+		client: &http.Client{Transport: transport, Timeout: timeout},
+		retry:  policy,
+	}
+}
+
+// httpStatusError is returned for non-2xx responses
+type httpStatusError struct {
+	Method     string // "" for GET
+	URL        string
+	StatusCode int
+}
+
+// Error implements the error interface
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d", cmp.Or(e.Method, http.MethodGet), e.URL, e.StatusCode)
+}
+
+// getJSON fetches url and decodes the JSON body into a T
+// A generic function: getJSON[forecast](ctx, c, url) returns a forecast,
+// like fetch(url).then(r => r.json() as Forecast) but checked at compile time
+func getJSON[T any](ctx context.Context, c *httpClient, url string) (T, error) {
+	var out T
+	err := retryDo(ctx, c.retry, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			io.Copy(io.Discard, resp.Body) // Drain so the connection can be reused
+			return &httpStatusError{URL: url, StatusCode: resp.StatusCode}
+		}
+		return json.NewDecoder(resp.Body).Decode(&out)
+	})
+	return out, err
+}
+
+// postFormJSON posts form as application/x-www-form-urlencoded and decodes
+// the JSON answer, like fetch(url, { method: 'POST', body: new URLSearchParams(form) })
+// Not retried: unlike a GET, the first attempt may have had an effect (an
+// OAuth code, for instance, works only once)
+func postFormJSON[T any](ctx context.Context, c *httpClient, url string, form url.Values) (T, error) {
+	var out T
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return out, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return out, &httpStatusError{Method: http.MethodPost, URL: url, StatusCode: resp.StatusCode}
+	}
+	return out, json.NewDecoder(resp.Body).Decode(&out)
+}
@@ -0,0 +1,153 @@
+// Package main - Accept-Language negotiation and embedded message catalogs
+package main
+
+import (
+	"context"       // For carrying the chosen locale through the request
+	"embed"         // go:embed bundles locales/*.json into the binary
+	"encoding/json" // Catalogs are plain JSON objects
+	"fmt"           // For messages with placeholders like %d
+	"io/fs"         // For listing the embedded catalog files
+	"net/http"      // For the middleware
+	"path"          // For turning "locales/de.json" into "de"
+	"sort"          // For ordering Accept-Language entries by quality
+	"strconv"       // For parsing q=0.8 weights
+	"strings"       // For splitting the header
+)
+
+// Messages use the gettext convention: the English text *is* the key
+// ({{t "Users"}}, t(r, "user not found")), so English needs no catalog
+// and a missing translation falls back to readable English. Each
+// locales/<lang>.json maps English → translated text, like i18next's
+// resources minus the nesting.
+
+// defaultLocale is the source language of every message in the code
+const defaultLocale = "en"
+
+// localeFS holds the translation catalogs at compile time
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalog holds every translation, keyed by locale then English message
+type catalog struct {
+	messages map[string]map[string]string
+}
+
+// loadCatalog reads locales/*.json; the file name is the locale ("de.json" → "de")
+func loadCatalog() (*catalog, error) {
+	c := &catalog{messages: map[string]map[string]string{defaultLocale: {}}}
+	files, err := fs.Glob(localeFS, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := localeFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		c.messages[strings.TrimSuffix(path.Base(file), ".json")] = msgs
+	}
+	return c, nil
+}
+
+// locales lists the supported locales, sorted
+func (c *catalog) locales() []string {
+	out := make([]string, 0, len(c.messages))
+	for l := range c.messages {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// translate looks a message up for a locale, falling back to the English key
+// Extra args are formatted into the message with fmt.Sprintf
+func (c *catalog) translate(locale, msg string, args ...any) string {
+	if s, ok := c.messages[locale][msg]; ok {
+		msg = s
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// negotiate picks the best supported locale for an Accept-Language header
+// "de-CH,de;q=0.9,en;q=0.8" → "de" when there's a de catalog but no de-CH one
+// Express has req.acceptsLanguages('de', 'en') for the same job
+func (c *catalog) negotiate(header string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if tag != "" && q > 0 { // q=0 means "not acceptable"
+			candidates = append(candidates, candidate{strings.ToLower(tag), q})
+		}
+	}
+	// SliceStable keeps header order for equal weights, which is what the RFC asks
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, cand := range candidates {
+		if _, ok := c.messages[cand.tag]; ok {
+			return cand.tag
+		}
+		// "de-at" isn't in the catalog, but its base language "de" may be
+		if base, _, ok := strings.Cut(cand.tag, "-"); ok {
+			if _, ok := c.messages[base]; ok {
+				return base
+			}
+		}
+	}
+	return defaultLocale
+}
+
+// localeKey is the context key for the negotiated locale
+var localeKey = newCtxKey[string]("locale")
+
+// localeFromContext returns the request's locale, or English outside the middleware
+func localeFromContext(ctx context.Context) string {
+	if l, ok := localeKey.from(ctx); ok {
+		return l
+	}
+	return defaultLocale
+}
+
+// localize negotiates the locale once per request and stores it in the context
+// ?lang=de overrides the header, which makes trying translations in a browser easy
+func localize(c *catalog) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale := c.negotiate(r.Header.Get("Accept-Language"))
+			if lang := r.URL.Query().Get("lang"); lang != "" {
+				locale = c.negotiate(lang)
+			}
+			// Vary tells caches that the response differs per Accept-Language
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Set("Content-Language", locale)
+			next.ServeHTTP(w, r.WithContext(localeKey.with(r.Context(), locale)))
+		})
+	}
+}
+
+// t translates a message into the request's locale (for handlers and errors)
+func (a *api) t(r *http.Request, msg string, args ...any) string {
+	return a.messages.translate(localeFromContext(r.Context()), msg, args...)
+}
+
+// translator returns a.t for r, for code that formats messages without the request (see validate.go)
+func (a *api) translator(r *http.Request) translator {
+	return func(msg string, args ...any) string { return a.t(r, msg, args...) }
+}
@@ -0,0 +1,225 @@
+// Package main - user IDs: a counter that never repeats, optionally with a UUID next to it, or snowflakes (-user-ids)
+package main
+
+import (
+	"crypto/rand"  // UUIDs need unpredictable bits
+	"encoding/hex" // For the UUID's text form
+	"fmt"          // For the snowflake example and errors
+	"io"           // For the example's writer
+	"net/http"     // For reading {id} from the path
+	"strconv"      // For comparing numeric IDs
+	"sync"         // For the snowflake generator's state
+	"time"         // Snowflakes start with a timestamp
+)
+
+// IDs used to be len(users)+1: erase user 3 of 3 and the next user is 3
+// again, and two concurrent inserts could both read the same length. Every
+// store now counts instead - Repository with an atomic counter (see
+// repository.go), SQL with AUTOINCREMENT or an identity column - so an ID,
+// once handed out, never comes back.
+//
+// A counter is short and sorts by age, but it tells anyone who signs up
+// how many users there are, and lets them try /users/1, /users/2, ... With
+// -user-ids=uuid every new user also gets a random UUID, what
+// crypto.randomUUID() returns in Node:
+//
+//	{"id": 42, "uuid": "3f1c9a4e-8b2d-4c6f-9e0a-7d5b1c2e4f60", ...}
+//
+// Both work wherever a user ID goes in a URL (GET /users/42 and
+// GET /users/3f1c9a4e-...), so the numbers can be kept out of links handed to
+// clients while joins, sorting and cursors (see cursor.go) stay on the integer.
+// Users created before the switch keep only their number.
+//
+// A counter needs one place that counts. Two instances with in-memory
+// stores, or a database per region, each count 1, 2, 3 - and a user moved
+// or merged from one to the other collides. -user-ids=snowflake makes the
+// number itself collision-free: each instance builds IDs from the time, its
+// own -node-id and a sequence, like Twitter's snowflakes or Discord's IDs:
+//
+//	| 41 bits: ms since 2025-01-01 | 5 bits: node | 7 bits: sequence |
+//	  → 150228172800128  (still sorted by creation time)
+//
+// That's 53 bits, not Twitter's 63: the largest integer a JavaScript number
+// holds exactly is 2^53-1, and a 63-bit ID in JSON turns into a different
+// number in JSON.parse - which is why Twitter's API also sends id_str. So
+// it's 32 nodes, 128 IDs per millisecond each, until 2094.
+
+// idScheme is how new users are identified, set by -user-ids
+type idScheme string
+
+const (
+	idsInt       idScheme = "int"       // A counter: 1, 2, 3, ...
+	idsUUID      idScheme = "uuid"      // The counter plus a random UUID (version 4)
+	idsSnowflake idScheme = "snowflake" // Time + node + sequence instead of the counter
+)
+
+// idSchemes are the values -user-ids accepts (see configcheck.go)
+var idSchemes = []string{string(idsInt), string(idsUUID), string(idsSnowflake)}
+
+// idStrategy gives a new user the IDs the store doesn't make itself
+// A store counts when the strategy leaves ID at 0, and keeps the ID otherwise
+type idStrategy interface {
+	assign(u *User)
+}
+
+// newIDStrategy returns the strategy for scheme; node is -node-id, which
+// only snowflakes use (checked in configcheck.go)
+func newIDStrategy(scheme idScheme, node int) idStrategy {
+	switch scheme {
+	case idsUUID:
+		return uuidIDs{}
+	case idsSnowflake:
+		return newSnowflakeIDs(node, time.Now)
+	}
+	return counterIDs{}
+}
+
+// counterIDs leaves the ID to the store's counter
+// IDs and UUIDs sent by the client are dropped: they're as much the store's to pick
+type counterIDs struct{}
+
+// assign implements idStrategy
+func (counterIDs) assign(u *User) {
+	u.ID, u.UUID = 0, ""
+}
+
+// uuidIDs adds a random UUID next to the counter
+type uuidIDs struct{}
+
+// assign implements idStrategy
+func (uuidIDs) assign(u *User) {
+	u.ID, u.UUID = 0, newUUID()
+}
+
+// Snowflake layout: the bit widths add up to 53 (see above)
+const (
+	snowflakeNodeBits = 5
+	snowflakeSeqBits  = 7
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1 // 31
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1  // 127
+)
+
+// snowflakeEpoch is time zero for snowflakes; a recent one leaves more years in 41 bits
+var snowflakeEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// snowflakeIDs makes IDs from the time, a node ID and a sequence
+// One mutex per instance is enough: uniqueness across instances comes from the node bits
+type snowflakeIDs struct {
+	mu     sync.Mutex
+	node   int64
+	lastMS int64 // The millisecond of the last ID
+	seq    int64 // IDs handed out within lastMS
+	now    func() time.Time
+}
+
+// newSnowflakeIDs creates a generator for node (0 to snowflakeMaxNode)
+// now is the clock, a parameter so the example can show a clock going back
+func newSnowflakeIDs(node int, now func() time.Time) *snowflakeIDs {
+	return &snowflakeIDs{node: int64(node), now: now, lastMS: -1}
+}
+
+// assign implements idStrategy
+func (g *snowflakeIDs) assign(u *User) {
+	u.ID, u.UUID = g.next(), ""
+}
+
+// next returns a new ID, greater than every ID this generator returned before
+// A clock that goes back (NTP stepping it) doesn't go back with it: the
+// generator stays on its last millisecond, and when that millisecond's
+// sequence is used up it moves on to the next one - IDs run a little ahead
+// of the clock rather than repeat
+func (g *snowflakeIDs) next() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ms := max(g.now().Sub(snowflakeEpoch).Milliseconds(), g.lastMS)
+	if ms == g.lastMS {
+		g.seq++
+		if g.seq > snowflakeMaxSeq {
+			ms, g.seq = ms+1, 0 // 128 IDs this millisecond: borrow the next one
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMS = ms
+	return int(ms<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq)
+}
+
+// snowflakeParts splits an ID into its time, node and sequence
+func snowflakeParts(id int) (at time.Time, node, seq int) {
+	ms := int64(id) >> (snowflakeNodeBits + snowflakeSeqBits)
+	return snowflakeEpoch.Add(time.Duration(ms) * time.Millisecond), id >> snowflakeSeqBits & snowflakeMaxNode, id & snowflakeMaxSeq
+}
+
+// init() registers the "snowflake" example
+func init() {
+	registerExample("snowflake", snowflakeExamples)
+}
+
+// snowflakeExamples makes IDs on two nodes, and on one whose clock goes back
+func snowflakeExamples(w io.Writer) {
+	clock := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	eu, us := newSnowflakeIDs(1, now), newSnowflakeIDs(17, now)
+
+	show := func(label string, id int) {
+		at, node, seq := snowflakeParts(id)
+		fmt.Fprintf(w, "%-22s %17d  %s  node %2d  seq %d\n", label, id, at.Format(time.RFC3339Nano), node, seq)
+	}
+	show("eu, 12:00:00.000", eu.next())
+	show("eu, same millisecond", eu.next())
+	show("us, same millisecond", us.next()) // Another node: no collision, no coordination
+	clock = clock.Add(time.Millisecond)
+	show("eu, 1ms later", eu.next())
+	clock = clock.Add(-time.Second) // NTP steps the clock back a second
+	show("eu, clock 1s back", eu.next())
+	last, _, _ := snowflakeParts(1<<53 - 1)
+	fmt.Fprintf(w, "\nthe largest ID is 2^53-1 = %d, JavaScript's Number.MAX_SAFE_INTEGER, reached on %s\n", 1<<53-1, last.Format(time.DateOnly))
+}
+
+// newUUID returns a random (version 4) UUID: 122 random bits in the usual
+// 8-4-4-4-12 hex form, like crypto.randomUUID()
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])               // Never fails on supported platforms (see cryptoutil.RandomToken)
+	b[6] = b[6]&0x0f | 0x40       // Version 4
+	b[8] = b[8]&0x3f | 0x80       // The RFC 9562 variant
+	h := hex.EncodeToString(b[:]) // 32 hex digits
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// isUUID reports whether s has the 8-4-4-4-12 form of lowercase hex digits
+// newUUID produces; uppercase is rejected so each user has one URL
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// refersTo reports whether a path's {id} names u, by number or by UUID
+func refersTo(raw string, u User) bool {
+	return raw == strconv.Itoa(u.ID) || (u.UUID != "" && raw == u.UUID)
+}
+
+// userIDFromPath returns the number of the user {id} names: the number
+// itself, or the user with that UUID. A malformed {id} is pathInt's 400
+func (a *api) userIDFromPath(r *http.Request) (int, error) {
+	raw := r.PathValue("id")
+	if !isUUID(raw) {
+		return pathInt(r, "id")
+	}
+	u, err := a.users.GetByUUID(r.Context(), tenantFromContext(r.Context()), raw)
+	return u.ID, err
+}
@@ -0,0 +1,154 @@
+// Package main - impersonation: admins act as a user for a few minutes, with their own identity kept
+package main
+
+import (
+	"context"  // For loading the admin
+	"errors"   // For the impersonator checks
+	"net/http" // For the handlers
+	"strconv"  // For the admin's ID
+	"strings"  // For the reason and the scope claim
+	"time"     // For the token lifetime
+)
+
+// "The page looks broken for me" is easier to debug as that user. An admin
+// asks for a token that acts as them:
+//
+//	POST /admin/impersonate/9 {"reason":"ticket 4521: settings page empty"}
+//	→ 201 {"token":"eyJ...","expires_at":"...","impersonator":"1","user":{"id":9,...}}
+//
+// The token is user 9's - their role, their scopes, their /users/9 - but its
+// "act" claim (RFC 8693's actor) names the admin, and so does everything it
+// leaves behind: GET /me says "impersonator":"1", each of its requests
+// writes an "audit: impersonated request" record, every log line it causes
+// carries impersonated_by (logging.go), and user 9's GET /me/sessions shows
+// whose session it is. Like the rest of the audit trail,
+// the records name the admin, not the user they acted as.
+//
+// The token has no refresh token and expires after impersonationTTL. Ending
+// earlier is explicit:
+//
+//	DELETE /me/impersonation   (with the impersonation token) → 204
+//
+// Admins can't impersonate other admins - one admin's actions would be
+// recorded as another's - and a token acting as someone can't change their
+// password. In Express this is usually a "login as" route that
+// sets req.session.userId and stashes the admin's ID in the session beside it.
+
+// impersonationTTL is how long an impersonation token is valid
+// Shorter than a login token: it's for one support case, not a working day
+const impersonationTTL = 10 * time.Minute
+
+// errImpersonating refuses what a token acting as someone mustn't do
+var errImpersonating = errors.New("not allowed while impersonating")
+
+// impersonateRequest is the body of POST /admin/impersonate/{id}
+type impersonateRequest struct {
+	Reason string `json:"reason"` // Why; required, and kept in the audit record
+}
+
+// impersonateResponse is the body of POST /admin/impersonate/{id}
+type impersonateResponse struct {
+	Token        string       `json:"token"`
+	TokenType    string       `json:"token_type"`
+	ExpiresIn    int          `json:"expires_in"` // Seconds
+	ExpiresAt    time.Time    `json:"expires_at"`
+	Scope        string       `json:"scope"`
+	Impersonator string       `json:"impersonator"` // The admin's user ID, as in the token's "act" claim
+	User         userResponse `json:"user"`         // Who the token acts as
+}
+
+// startImpersonationHandler issues a token acting as another user (POST /admin/impersonate/{id})
+//
+//	curl -X POST -H "Authorization: Bearer $ADMIN_LOGIN" localhost:8080/admin/impersonate/9 \
+//	  -d '{"reason":"ticket 4521"}'
+func (a *api) startImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := userFromContext(r.Context())
+	if !ok {
+		// The admin token and API keys name no person for the audit trail
+		writeJSONError(w, http.StatusForbidden, "impersonation needs an admin's own login")
+		return
+	}
+	payload, err := decode[impersonateRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	payload.Reason = strings.TrimSpace(payload.Reason)
+	if payload.Reason == "" {
+		writeJSONErrorCode(w, http.StatusBadRequest, "reason_required", a.t(r, "reason is required"))
+		return
+	}
+	target, ok := a.userFromPath(w, r) // 400 / 404 handled there (see htmx.go)
+	if !ok {
+		return
+	}
+	switch {
+	case target.ID == admin.ID:
+		writeJSONError(w, http.StatusBadRequest, a.t(r, "you can't impersonate yourself"))
+		return
+	case roleOf(target) == roleAdmin:
+		writeJSONError(w, http.StatusForbidden, a.t(r, "admins can't be impersonated"))
+		return
+	}
+
+	now := time.Now()
+	actor := strconv.Itoa(admin.ID)
+	sid := a.refresh.startSession(target, r, now.Add(impersonationTTL), now)
+	a.refresh.markImpersonated(sid, actor)
+	scopes := effectiveScopes(roleOf(target), nil)
+	claims := userClaims(target, sid, scopes)
+	claims.Actor = &jwtActor{Subject: actor}
+	token, expires := a.tokens.sign(claims, now, impersonationTTL)
+	a.logger.InfoContext(r.Context(), "audit: impersonation started",
+		"admin_id", actor, "user_id", target.ID, "session", sid, "reason", payload.Reason, "expires_at", expires)
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusCreated, impersonateResponse{
+		Token:        token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(impersonationTTL.Seconds()),
+		ExpiresAt:    expires.UTC(),
+		Scope:        strings.Join(scopes, " "),
+		Impersonator: actor,
+		User:         presentUser(r, target),
+	})
+}
+
+// endImpersonationHandler ends the impersonation the token belongs to (DELETE /me/impersonation)
+// The token stops working at once; the admin's own login is untouched
+//
+//	curl -X DELETE -H "Authorization: Bearer $IMPERSONATION_TOKEN" localhost:8080/me/impersonation
+func (a *api) endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := principalFromContext(r.Context())
+	if p.Impersonator == "" {
+		writeJSONErrorCode(w, http.StatusBadRequest, "not_impersonating", a.t(r, "this token isn't impersonating anyone"))
+		return
+	}
+	if err := a.refresh.endSession(p.TenantID, p.User.ID, p.Session); err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	a.logger.InfoContext(r.Context(), "audit: impersonation ended", "admin_id", p.Impersonator, "user_id", p.User.ID, "session", p.Session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkImpersonator makes sure the admin behind an impersonation token still is one
+func (t userTokens) checkImpersonator(ctx context.Context, tenantID, subject string) error {
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return errTokenMalformed
+	}
+	admin, err := t.users.Get(ctx, tenantID, id)
+	if err != nil || roleOf(admin) != roleAdmin {
+		return errors.New("impersonating admin is no longer an admin")
+	}
+	return nil
+}
+
+// markImpersonated records which admin a session acts for
+func (s *refreshStore) markImpersonated(id, actor string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok {
+		sess.impersonator = actor
+	}
+}
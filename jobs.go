@@ -0,0 +1,88 @@
+// Package main - a fixed-size worker pool for CPU-heavy background jobs
+package main
+
+import (
+	"context"       // For giving up on a queued job when the request goes away
+	"errors"        // For the queue-full error
+	"log/slog"      // For the logger that reports panics inside jobs
+	"runtime/debug" // For the stack of a panicking job
+)
+
+// Why a pool? Each request already runs in its own goroutine, so resizing an
+// image inline would "work" - but 200 concurrent uploads would then decode
+// 200 images at once and blow up memory. A pool caps the number of jobs
+// running at the same time, like a piscina/worker_threads pool in Node, and
+// the bounded queue pushes back (503) instead of growing without limit.
+
+// errQueueFull is returned by submit when every worker is busy and the queue is full
+var errQueueFull = errors.New("job queue is full, try again later")
+
+// workerPool runs submitted funcs on a fixed number of goroutines
+type workerPool struct {
+	jobs   chan job // Buffered channel = the queue
+	logger *slog.Logger
+}
+
+// job is one queued func with the context of the request that queued it,
+// so a panic is logged with that request's ID (see requestid.go)
+type job struct {
+	ctx context.Context
+	fn  func()
+}
+
+// newWorkerPool starts workers goroutines reading from a queue of queueSize jobs
+func newWorkerPool(workers, queueSize int, logger *slog.Logger) *workerPool {
+	p := &workerPool{jobs: make(chan job, queueSize), logger: logger}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// work runs jobs until the channel is closed
+func (p *workerPool) work() {
+	// range over a channel receives until close() - like for await over a stream
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+// run executes one job, recovering from panics so one bad image can't kill a worker
+func (p *workerPool) run(j job) {
+	defer func() {
+		if err := recover(); err != nil {
+			p.logger.ErrorContext(j.ctx, "job panicked", "panic", err, "stack", string(debug.Stack()))
+		}
+	}()
+	j.fn()
+}
+
+// submit queues fn without blocking; it fails fast when the queue is full
+// ctx is only used for logging - a job outlives the request that queued it
+func (p *workerPool) submit(ctx context.Context, fn func()) error {
+	// select with a default case is a non-blocking send
+	select {
+	case p.jobs <- job{ctx: ctx, fn: fn}:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// do queues fn and waits for it to finish, or for ctx to be cancelled
+// (the client hung up); the job still runs, its result is just discarded
+func (p *workerPool) do(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	if err := p.submit(ctx, func() {
+		defer close(done) // Closing a channel wakes every receiver
+		fn()
+	}); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
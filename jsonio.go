@@ -0,0 +1,89 @@
+// Package main - typed helpers for reading and writing JSON bodies
+package main
+
+import (
+	"encoding/json" // For decoding and encoding
+	"errors"        // For recognising decoder errors
+	"fmt"           // For readable error messages
+	"io"            // For io.EOF (empty body)
+	"net/http"      // For the request, response writer and status codes
+)
+
+// Every handler used to repeat the same lines:
+//
+//	w.Header().Set("Content-Type", "application/json")
+//	w.WriteHeader(status)
+//	json.NewEncoder(w).Encode(v)
+//
+// and on the way in passed raw decoder errors ("invalid character '}' looking
+// for beginning of object key string") straight to the client. decode and
+// respondJSON do both once - the Go version of express.json() + res.json().
+
+// maxJSONBody caps request bodies read by decode (1 MiB, express.json()'s
+// default is 100kb)
+const maxJSONBody = 1 << 20
+
+// requestError is a client error with the status code it should produce
+type requestError struct {
+	Status  int
+	Message string
+}
+
+// Error implements the error interface
+func (e *requestError) Error() string { return e.Message }
+
+// decode reads the request body as JSON into a new T
+// The type parameter picks the target type at the call site:
+//
+//	payload, err := decode[User](r) // ~ const payload: User = req.body
+//
+// Errors are *requestError values with a 4xx status and a message meant for
+// the client; pass them to writeError
+func decode[T any](r *http.Request) (T, error) {
+	var v T
+	// MaxBytesReader stops reading after the limit instead of buffering a
+	// huge body; a nil ResponseWriter is fine when we report the error ourselves
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxJSONBody))
+	if err := dec.Decode(&v); err != nil {
+		return v, translateDecodeError(err)
+	}
+	// A second value after the first ("{...}{...}") is a client bug, not extra data to ignore
+	if dec.More() {
+		return v, &requestError{Status: http.StatusBadRequest, Message: "request body must contain a single JSON value"}
+	}
+	return v, nil
+}
+
+// translateDecodeError turns encoding/json errors into messages a client can act on
+func translateDecodeError(err error) error {
+	// errors.As finds an error of a given type in the chain - like
+	// `err instanceof SyntaxError` in JS, but it also looks through wrapped errors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &requestError{Status: http.StatusBadRequest, Message: "request body is empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &requestError{Status: http.StatusBadRequest, Message: "request body is truncated JSON"}
+	case errors.As(err, &syntaxErr):
+		return &requestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("malformed JSON at byte %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		return &requestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("field %q must be a %s", typeErr.Field, typeErr.Type)}
+	case errors.As(err, &tooLarge):
+		return &requestError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit)}
+	default:
+		return &requestError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+}
+
+// respondJSON writes v as JSON with the given status - res.status(status).json(v)
+// The type parameter documents and checks the body type at the call site
+// (respondJSON[weatherReport](...)) and is inferred when left out
+func respondJSON[T any](w http.ResponseWriter, status int, v T) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// Once the status line is sent an encoding error can't become a 500 anymore;
+	// the client sees a truncated body, which is all that's left to do
+	json.NewEncoder(w).Encode(v)
+}
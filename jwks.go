@@ -0,0 +1,312 @@
+// Package main - JWT signing keys: several at once, rotated on a schedule, published as a JWKS
+package main
+
+import (
+	"context"         // For the rotation loop
+	"crypto"          // For the hash identifier of RS256
+	"crypto/ed25519"  // EdDSA keys
+	"crypto/hmac"     // HS256 signatures
+	"crypto/rand"     // For generating keys
+	"crypto/rsa"      // RS256 keys
+	"crypto/sha256"   // The hash behind HS256 and RS256
+	"encoding/base64" // JWKs use unpadded base64url
+	"fmt"             // For configuration errors
+	"log/slog"        // For rotation log lines
+	"math/big"        // For the RSA exponent
+	"net/http"        // For the JWKS handler
+	"strconv"         // For Cache-Control
+	"sync"            // The ring is read by every request and rotated in the background
+	"time"            // For key ages
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For key IDs and generated HS256 secrets
+)
+
+// One signing key that never changes has two problems: rotating it logs
+// everyone out, and with HS256 anyone who can check a token can also mint
+// one, because checking needs the same secret. So tokens name their key in
+// the header ("kid"), and the server keeps a ring of keys:
+//
+//	next      published, not signing yet - verifiers can fetch it before they see it
+//	current   signs new tokens
+//	retired   stopped signing; still verifies until the last token it signed expires
+//
+// Every -jwt-key-rotation the keys move one step along. With RS256 or
+// EdDSA the public halves are served at GET /.well-known/jwks.json, so
+// other services check our tokens the way we check an OpenID provider's
+// (oidc.go) - jose's createRemoteJWKSet in Node - without holding anything
+// that could sign one.
+//
+// HS256 keys are never published. With a configured jwt_signing_key
+// secret, the secret is the key and rotating the secret rotates it; the
+// previous secret keeps verifying until its tokens expire.
+
+// Signing algorithms for -jwt-alg
+const (
+	jwtHS256 = "HS256" // HMAC-SHA256 with a shared secret (the default)
+	jwtRS256 = "RS256" // RSA PKCS#1 v1.5 with SHA-256, 2048-bit keys
+	jwtEdDSA = "EdDSA" // Ed25519: small keys, fast signatures
+)
+
+// signingKey is one key of the ring; exactly one of secret and private is set
+type signingKey struct {
+	id      string        // The "kid" in token headers
+	alg     string        // Tokens naming this key must name this algorithm too
+	secret  []byte        // HS256
+	private crypto.Signer // *rsa.PrivateKey or ed25519.PrivateKey
+	retired time.Time     // When it stopped signing; zero while next or current
+}
+
+// newSigningKey generates a key for alg
+func newSigningKey(alg string) (*signingKey, error) {
+	k := &signingKey{id: cryptoutil.RandomToken(9), alg: alg}
+	var err error
+	switch alg {
+	case jwtHS256:
+		k.secret = []byte(cryptoutil.RandomToken(32))
+	case jwtRS256:
+		k.private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwtEdDSA:
+		_, k.private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown -jwt-alg %q: want %s, %s or %s", alg, jwtHS256, jwtRS256, jwtEdDSA)
+	}
+	return k, err
+}
+
+// sign returns the base64url signature of unsigned
+func (k *signingKey) sign(unsigned string) string {
+	var sig []byte
+	switch priv := k.private.(type) {
+	case nil:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(unsigned))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(unsigned))
+		sig, _ = rsa.SignPKCS1v15(nil, priv, crypto.SHA256, digest[:]) // Only fails for keys too small for SHA-256
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(priv, []byte(unsigned)) // EdDSA hashes the message itself
+	}
+	return base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// verify checks a base64url signature of unsigned
+func (k *signingKey) verify(unsigned, signature string) bool {
+	if k.private == nil {
+		// hmac.Equal compares in constant time, so timing can't reveal the right signature
+		return hmac.Equal([]byte(signature), []byte(k.sign(unsigned)))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256([]byte(unsigned))
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, []byte(unsigned), sig)
+	}
+	return false
+}
+
+// jwk returns the public half as a JSON Web Key; false for HS256 keys
+func (k *signingKey) jwk() (jwk, bool) {
+	b64 := base64.RawURLEncoding
+	switch pub := k.private.(type) {
+	case *rsa.PrivateKey:
+		return jwk{Kty: "RSA", Kid: k.id, Use: "sig", Alg: k.alg,
+			N: b64.EncodeToString(pub.N.Bytes()), E: b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}, true
+	case ed25519.PrivateKey:
+		// RFC 8037: Ed25519 keys are "OKP" (octet key pair) with the 32-byte public key in x
+		return jwk{Kty: "OKP", Kid: k.id, Use: "sig", Alg: k.alg, Crv: "Ed25519",
+			X: b64.EncodeToString(pub.Public().(ed25519.PublicKey))}, true
+	}
+	return jwk{}, false
+}
+
+// jwtKeyRing holds the next, current and retired signing keys
+type jwtKeyRing struct {
+	alg    string
+	every  time.Duration // Rotation period; 0 rotates only via POST /admin/jwt/rotate
+	secret func() []byte // HS256: the jwt_signing_key secret; empty generates keys instead
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	next    *signingKey // nil for a configured HS256 secret: it can't be known in advance
+	current *signingKey
+	retired []*signingKey // Newest first
+}
+
+// newJWTKeyRing creates a ring for alg with a current and a next key
+func newJWTKeyRing(alg string, every time.Duration, secret func() []byte, logger *slog.Logger) (*jwtKeyRing, error) {
+	ring := &jwtKeyRing{alg: alg, every: every, secret: secret, logger: logger}
+	var err error
+	if ring.current, err = ring.newKey(); err != nil {
+		return nil, err
+	}
+	if !ring.fromSecret() {
+		if ring.next, err = ring.newKey(); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// fromSecret reports whether keys come from the jwt_signing_key secret
+func (ring *jwtKeyRing) fromSecret() bool {
+	return ring.alg == jwtHS256 && len(ring.secret()) > 0
+}
+
+// newKey returns the secret's key for a configured HS256 secret, a generated one otherwise
+// The secret's kid is derived from it, so every replica with the same secret
+// agrees on it without revealing anything about the secret
+func (ring *jwtKeyRing) newKey() (*signingKey, error) {
+	if secret := ring.secret(); ring.alg == jwtHS256 && len(secret) > 0 {
+		return &signingKey{id: cryptoutil.SHA256Hex(secret)[:12], alg: jwtHS256, secret: secret}, nil
+	}
+	return newSigningKey(ring.alg)
+}
+
+// signing returns the key new tokens are signed with
+func (ring *jwtKeyRing) signing(now time.Time) *signingKey {
+	ring.followSecret(now)
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	return ring.current
+}
+
+// lookup returns the key a token names, if it may still verify tokens
+// The next key doesn't: nothing has been signed with it yet
+func (ring *jwtKeyRing) lookup(kid string, now time.Time) (*signingKey, bool) {
+	ring.followSecret(now)
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	if ring.current.id == kid {
+		return ring.current, true
+	}
+	for _, k := range ring.retired {
+		if k.id == kid && now.Before(k.retired.Add(tokenTTL)) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// followSecret retires the current HS256 key when the jwt_signing_key secret changed
+// secrets.go reloads the secret in the background; checking on use is cheaper
+// than a callback, and costs a hash per request
+func (ring *jwtKeyRing) followSecret(now time.Time) {
+	if !ring.fromSecret() {
+		return
+	}
+	ring.mu.RLock()
+	changed := ring.current.id != cryptoutil.SHA256Hex(ring.secret())[:12]
+	ring.mu.RUnlock()
+	if changed {
+		ring.rotate(now)
+	}
+}
+
+// rotate retires the current key and starts signing with the next one
+func (ring *jwtKeyRing) rotate(now time.Time) error {
+	fresh, err := ring.newKey()
+	if err != nil {
+		return err
+	}
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if ring.fromSecret() && fresh.id == ring.current.id {
+		return nil // Another request saw the same secret change first
+	}
+	ring.current.retired = now
+	ring.retired = append([]*signingKey{ring.current}, ring.retired...)
+	switch {
+	case ring.fromSecret():
+		// Straight to current: the new secret may be signing on other replicas already
+		ring.current, ring.next = fresh, nil
+	case ring.next == nil:
+		// The secret was removed; back to generated keys
+		ring.current = fresh
+		if ring.next, err = ring.newKey(); err != nil {
+			return err
+		}
+	default:
+		ring.current, ring.next = ring.next, fresh
+	}
+	// Drop keys whose last token has expired
+	live := ring.retired[:0]
+	for _, k := range ring.retired {
+		if now.Before(k.retired.Add(tokenTTL)) {
+			live = append(live, k)
+		}
+	}
+	ring.retired = live
+	ring.logger.Info("jwt: rotated signing key", "kid", ring.current.id, "alg", ring.alg)
+	return nil
+}
+
+// watch rotates every ring.every until ctx is cancelled
+// With a configured HS256 secret there is nothing to generate: rotate the secret instead
+func (ring *jwtKeyRing) watch(ctx context.Context) {
+	if ring.every <= 0 || ring.fromSecret() {
+		return
+	}
+	ticker := time.NewTicker(ring.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := ring.rotate(now); err != nil {
+				ring.logger.Error("jwt: rotation failed", "err", err)
+			}
+		}
+	}
+}
+
+// jwks returns the public keys: next, current and retired; empty for HS256
+func (ring *jwtKeyRing) jwks(now time.Time) []jwk {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	keys := []jwk{}
+	for _, k := range append([]*signingKey{ring.next, ring.current}, ring.retired...) {
+		if k == nil || (!k.retired.IsZero() && !now.Before(k.retired.Add(tokenTTL))) {
+			continue
+		}
+		if j, ok := k.jwk(); ok {
+			keys = append(keys, j)
+		}
+	}
+	return keys
+}
+
+// jwksHandler publishes the public signing keys (GET /.well-known/jwks.json)
+// Verifiers may cache the set for half a rotation period: the next key is
+// published a whole period before it signs, so a cached set always has it
+//
+//	curl localhost:8080/.well-known/jwks.json
+func (a *api) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	maxAge := time.Hour
+	if every := a.tokens.keys.every; every > 0 {
+		maxAge = min(maxAge, every/2)
+	}
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	respondJSON(w, http.StatusOK, map[string][]jwk{"keys": a.tokens.keys.jwks(time.Now())})
+}
+
+// rotateJWTKeyHandler rotates the signing keys now (POST /admin/jwt/rotate)
+// Tokens signed with the old key keep working until they expire; for a
+// leaked key, also revoke the refresh tokens (restart, for now)
+func (a *api) rotateJWTKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if a.tokens.keys.fromSecret() {
+		writeJSONError(w, http.StatusConflict, "HS256 keys come from the jwt_signing_key secret; rotate the secret instead")
+		return
+	}
+	if err := a.tokens.keys.rotate(time.Now()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"kid": a.tokens.keys.signing(time.Now()).id, "alg": a.tokens.keys.alg})
+}
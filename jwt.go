@@ -0,0 +1,134 @@
+// Package main - JSON Web Tokens (HS256, RS256, EdDSA) with nothing but the standard library
+package main
+
+import (
+	"encoding/base64" // JWTs use unpadded base64url
+	"encoding/json"   // For header and claims
+	"errors"          // For the verification errors
+	"strconv"         // For the subject (a user ID)
+	"strings"         // For splitting the token
+	"time"            // For iat/exp
+)
+
+// A JWT is three base64url parts joined by dots:
+//
+//	eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCIsImtpZCI6... . eyJzdWIiOiI0MiIsInRpZCI6ImRlZmF1bHQiLCJleHAiOjE3Njc... . 3q2-7w...
+//	header {"alg":"HS256","typ":"JWT","kid":...}      claims {"sub":"42","tid":"default","exp":...}       signature of the first two
+//
+// Anyone can read the claims - only the signature is secret - so a token
+// holds IDs, never passwords or personal data. In Node this is
+// jsonwebtoken's jwt.sign(payload, secret) / jwt.verify(token, secret);
+// it's simple enough to write out, which also shows what those calls check.
+// The keys, and what "kid" is for, are in jwks.go.
+
+// tokenTTL is how long an issued token is valid; short, because it can't be
+// revoked - clients get a new one with their refresh token (see refreshtoken.go)
+const tokenTTL = 15 * time.Minute
+
+// Verification errors; all are answered with 401
+var (
+	errTokenMalformed = errors.New("malformed token")
+	errTokenSignature = errors.New("invalid token signature")
+	errTokenExpired   = errors.New("token expired")
+)
+
+// jwtHeader is the first part of a token; kid names the signing key (see jwks.go)
+// Accepting whatever "alg" a token names is the classic JWT hole: "none"
+// skips the signature, and RS256 confusion lets a public key sign tokens.
+// Here the key decides the algorithm, and a token naming another is rejected
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims are the registered claims we use plus the tenant
+type jwtClaims struct {
+	Subject  string    `json:"sub"`           // User ID, as a string like the spec says
+	Tenant   string    `json:"tid"`           // The token only works in this tenant
+	Scope    string    `json:"scope"`         // Space-separated, like OAuth 2 (see scopes.go)
+	Session  string    `json:"sid,omitempty"` // The login it belongs to; revoked sessions end their tokens (see sessions.go)
+	Actor    *jwtActor `json:"act,omitempty"` // The admin acting as the subject (see impersonate.go)
+	IssuedAt int64     `json:"iat"`           // Unix seconds
+	Expires  int64     `json:"exp"`
+}
+
+// jwtActor is the "act" claim of RFC 8693: who is really behind the token
+type jwtActor struct {
+	Subject string `json:"sub"` // The admin's user ID
+}
+
+// userID returns the subject as a user ID
+func (c jwtClaims) userID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// jwtIssuer signs and verifies tokens with the keys of a ring (see jwks.go)
+type jwtIssuer struct {
+	keys *jwtKeyRing
+}
+
+// newJWTIssuer creates an issuer that signs with the ring's current key
+func newJWTIssuer(keys *jwtKeyRing) *jwtIssuer {
+	return &jwtIssuer{keys: keys}
+}
+
+// issue returns a signed token for u in session sid with scopes, valid for tokenTTL from now
+func (j *jwtIssuer) issue(u User, sid string, scopes []string, now time.Time) (token string, expires time.Time) {
+	return j.sign(userClaims(u, sid, scopes), now, tokenTTL)
+}
+
+// userClaims are the claims of a token for u in session sid with scopes
+func userClaims(u User, sid string, scopes []string) jwtClaims {
+	return jwtClaims{Subject: strconv.Itoa(u.ID), Tenant: u.TenantID, Scope: strings.Join(scopes, " "), Session: sid}
+}
+
+// sign sets the issue and expiry times of claims, valid for ttl from now, and signs them
+func (j *jwtIssuer) sign(c jwtClaims, now time.Time, ttl time.Duration) (token string, expires time.Time) {
+	key := j.keys.signing(now)
+	expires = now.Add(ttl).Truncate(time.Second)
+	c.IssuedAt, c.Expires = now.Unix(), expires.Unix()
+	// Marshaling structs of strings and ints can't fail
+	header, _ := json.Marshal(jwtHeader{Alg: key.alg, Typ: "JWT", Kid: key.id})
+	claims, _ := json.Marshal(c)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + key.sign(unsigned), expires
+}
+
+// verify checks the header, the signature and the expiry, in that order,
+// and returns the claims
+func (j *jwtIssuer) verify(token string, now time.Time) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errTokenMalformed
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return jwtClaims{}, errTokenMalformed
+	}
+	// An unknown kid is a token from a key retired long ago, or from nobody we know
+	key, ok := j.keys.lookup(header.Kid, now)
+	if !ok || header.Alg != key.alg {
+		return jwtClaims{}, errTokenSignature
+	}
+	if !key.verify(parts[0]+"."+parts[1], parts[2]) {
+		return jwtClaims{}, errTokenSignature
+	}
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return jwtClaims{}, errTokenMalformed
+	}
+	if now.Unix() >= claims.Expires {
+		return jwtClaims{}, errTokenExpired
+	}
+	return claims, nil
+}
+
+// decodeJWTPart decodes one base64url JSON part of a token into v
+func decodeJWTPart(part string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,105 @@
+// Package main - structured logging with log/slog: JSON lines, levels, the request ID on every line
+package main
+
+import (
+	"context"  // Handlers receive the context of each log call
+	"fmt"      // For configuration errors
+	"io"       // Where log lines go
+	"log/slog" // Structured logging, standard library since Go 1.21
+)
+
+// The log package writes text lines: "2026/10/16 11:03:29 db: list users: timeout".
+// Fine to read, hard to search - which request? which user? log/slog writes
+// records with a message and key-value attributes instead, as JSON by default:
+//
+//	{"time":"...","level":"ERROR","msg":"list users failed","err":"timeout","request_id":"Xb3k..."}
+//
+// That's what pino (and winston's json format) give Node apps, and what log
+// collectors - Loki, CloudWatch, Datadog - index field by field:
+//
+//	Node (pino)                               Go (slog)
+//	const log = pino({ level: 'info' })       logger := slog.New(slog.NewJSONHandler(os.Stderr, opts))
+//	log.error({ err, to }, 'mail failed')     logger.Error("mail failed", "err", err, "to", to)
+//	const child = log.child({ reqId })        child := logger.With("request_id", id)
+//	req.log.info('done')  (pino-http)         logger.InfoContext(r.Context(), "done")
+//
+// The last row is the request-scoped part. Instead of building a child
+// logger per request and passing it around, the request ID already rides in
+// the context (requestid.go); contextHandler reads it from there on every
+// call that passes a context. So logger.InfoContext(ctx, ...) in a job, a
+// store call or a mailer - long after the handler returned - still carries
+// the ID of the request that started it.
+//
+// -log-level (LOG_LEVEL) drops records below it; -log-format (LOG_FORMAT)
+// picks json or text, the latter for reading in a terminal.
+
+// Formats for -log-format
+const (
+	logFormatJSON = "json" // One JSON object per line, for log collectors
+	logFormatText = "text" // key=value pairs, for terminals
+)
+
+// newLogger creates the app's logger writing to w
+// level is debug, info, warn or error - the names slog.Level parses
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q: want debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: durationsAsText}
+	var h slog.Handler
+	switch format {
+	case logFormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case logFormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("log format %q: want %s or %s", format, logFormatJSON, logFormatText)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// durationsAsText writes durations as "1.2ms" instead of slog's nanoseconds
+func durationsAsText(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		a.Value = slog.StringValue(a.Value.Duration().String())
+	}
+	return a
+}
+
+// contextHandler adds the request ID, tenant, guest and impersonating admin from the context to every record
+// It wraps another handler, like an Express middleware wraps the next one;
+// calls without a context (logger.Info) get neither, Context calls both
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if tenant, ok := tenantKey.from(ctx); ok {
+		r.AddAttrs(slog.String("tenant", tenant))
+	}
+	// An admin acting as a user is named on everything the token does (see impersonate.go)
+	if p, ok := principalKey.from(ctx); ok && p.Impersonator != "" {
+		r.AddAttrs(slog.String("impersonated_by", p.Impersonator))
+	}
+	// Guests have no account; their token's ID is what ties their requests together (see guest.go)
+	if p, ok := principalKey.from(ctx); ok && p.Kind == principalGuest {
+		r.AddAttrs(slog.String("guest_id", p.Subject))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler; the result must stay a contextHandler,
+// or logger.With(...) would lose the request ID
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler, for the same reason
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,69 @@
+// Package main - outgoing email behind an interface
+package main
+
+import (
+	"context"  // Sending takes the caller's context, like every I/O call
+	"fmt"      // For the console mailer's output
+	"io"       // The console mailer writes to any writer
+	"log/slog" // For the development mailer
+	"strings"  // For the console mailer's separator
+	"sync"     // So two messages don't interleave
+	"time"     // For the Date line
+)
+
+// Mailer sends email. Handlers only see this interface, so the
+// implementation can be an SMTP client, an HTTP API (SES, SendGrid) or the
+// log mailer below - like swapping nodemailer transports
+// Go interfaces are satisfied implicitly: any type with a matching Send
+// method is a Mailer, no "implements" keyword needed
+type Mailer interface {
+	Send(ctx context.Context, msg mailMessage) error
+}
+
+// mailMessage is one plain-text email
+type mailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// logMailer "sends" email by logging it - the default for development,
+// like nodemailer's jsonTransport / streamTransport
+type logMailer struct {
+	logger *slog.Logger
+}
+
+// newLogMailer creates a mailer that writes to logger
+func newLogMailer(logger *slog.Logger) *logMailer {
+	return &logMailer{logger: logger}
+}
+
+// Send logs the message instead of delivering it
+func (m *logMailer) Send(ctx context.Context, msg mailMessage) error {
+	m.logger.InfoContext(ctx, "mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body) // With the request ID (see logging.go)
+	return nil
+}
+
+// consoleMailer "sends" email by printing it the way a mail client would
+// show it, for reading at a terminal - a reset link in a JSON log line is
+// hard to click. What -standalone uses (see standalone.go); like
+// nodemailer's streamTransport piped to stdout
+type consoleMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newConsoleMailer creates a mailer that prints to w
+func newConsoleMailer(w io.Writer) *consoleMailer {
+	return &consoleMailer{w: w}
+}
+
+// Send prints the message between two rules
+func (m *consoleMailer) Send(_ context.Context, msg mailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rule := strings.Repeat("─", 60)
+	_, err := fmt.Fprintf(m.w, "%s\nDate:    %s\nTo:      %s\nSubject: %s\n\n%s\n%s\n",
+		rule, time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body, rule)
+	return err
+}
@@ -0,0 +1,109 @@
+// Package main - maintenance mode: 503 for user-facing routes, toggled at runtime
+package main
+
+import (
+	"net/http" // For the middleware and handlers
+	"strconv"  // For the Retry-After header
+	"sync"     // For the mutex around the current state
+	"time"     // For Retry-After and the "since" timestamp
+)
+
+// During a migration or a data fix the API should stop taking writes without
+// the process going away: clients get a 503 with Retry-After (which
+// well-behaved clients and CDNs honour), load balancers see /readyz fail,
+// while probes, metrics and the admin endpoints that turn it off again keep working.
+
+// defaultMaintenanceRetry is the Retry-After used when the toggle doesn't set one
+const defaultMaintenanceRetry = 5 * time.Minute
+
+// maintenanceState is the current mode; it is also the admin endpoint's body
+type maintenanceState struct {
+	Enabled    bool      `json:"enabled"`
+	Message    string    `json:"message,omitempty"`
+	RetryAfter int       `json:"retry_after,omitempty"` // Seconds
+	Since      time.Time `json:"since,omitzero"`
+}
+
+// maintenanceMode holds the state shared by the middleware, /readyz and the admin endpoint
+type maintenanceMode struct {
+	mu    sync.RWMutex
+	state maintenanceState
+}
+
+// newMaintenanceMode starts in or out of maintenance (-maintenance flag)
+func newMaintenanceMode(enabled bool) *maintenanceMode {
+	m := &maintenanceMode{}
+	m.set(maintenanceState{Enabled: enabled})
+	return m
+}
+
+// current returns a copy of the state
+func (m *maintenanceMode) current() maintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// set switches the mode, filling in the defaults and the start time
+func (m *maintenanceMode) set(s maintenanceState) maintenanceState {
+	if s.Enabled {
+		if s.Message == "" {
+			s.Message = "The service is down for maintenance. Please try again later."
+		}
+		if s.RetryAfter <= 0 {
+			s.RetryAfter = int(defaultMaintenanceRetry.Seconds())
+		}
+		s.Since = time.Now().UTC()
+	} else {
+		s = maintenanceState{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = s
+	return s
+}
+
+// maintenanceError is the 503 body: the usual error (see errors.go) plus when to retry
+type maintenanceError struct {
+	errorBody
+	RetryAfter int `json:"retry_after"`
+}
+
+// maintenance answers 503 while maintenance mode is on
+// It is group middleware (see router.go): main() puts the user-facing routes
+// in a group with it, and registers probes, metrics and /admin outside that
+// group, so they are never blocked
+func maintenance(m *maintenanceMode) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := m.current()
+			if !s.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+			respondJSON(w, http.StatusServiceUnavailable, maintenanceError{
+				errorBody:  newErrorBody("maintenance", s.Message),
+				RetryAfter: s.RetryAfter,
+			})
+		})
+	}
+}
+
+// getMaintenanceHandler shows the current mode (GET /admin/maintenance)
+func (a *api) getMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, a.maintenance.current())
+}
+
+// setMaintenanceHandler turns maintenance mode on or off (PUT /admin/maintenance)
+// curl -X PUT -d '{"enabled":true,"message":"Migrating","retry_after":600}' .../admin/maintenance
+func (a *api) setMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := decode[maintenanceState](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s = a.maintenance.set(s)
+	a.logger.InfoContext(r.Context(), "maintenance mode changed", "enabled", s.Enabled)
+	respondJSON(w, http.StatusOK, s)
+}
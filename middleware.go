@@ -0,0 +1,72 @@
+// Package main - the middleware building blocks shared by every middleware
+package main
+
+import (
+	"net/http" // For the http.Handler interface and ResponseWriter
+)
+
+// Middleware wraps an http.Handler with extra behavior and returns a new handler
+// This is Go's version of Express middleware:
+//
+//	Express: app.use((req, res, next) => { ...; next() })
+//	Go:      func(next http.Handler) http.Handler {
+//	             return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	                 ...; next.ServeHTTP(w, r)
+//	             })
+//	         }
+//
+// Instead of calling next(), a Go middleware calls next.ServeHTTP(w, r).
+// Code before that line runs on the way in, code after it on the way out.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h in middlewares, the first one outermost - the order of
+// app.use() calls in Express:
+//
+//	Chain(mux, accessLog(os.Stdout), recoverPanics(logger), cors(origins))
+//	// same as accessLog(os.Stdout)(recoverPanics(logger)(cors(origins)(mux)))
+//
+// A request passes through them left to right, the response right to left
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	// Wrap from the inside out: the last middleware goes around h first
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// statusRecorder wraps http.ResponseWriter to remember the status code and
+// number of bytes written, which the standard ResponseWriter doesn't expose
+// (Express gives you res.statusCode; in Go you capture it yourself)
+type statusRecorder struct {
+	http.ResponseWriter // Embedded: all methods we don't override are passed through
+	status              int
+	bytes               int
+	wrote               bool // The status line has gone out; it can't change anymore
+}
+
+// newStatusRecorder wraps w; the status defaults to 200 because handlers
+// that never call WriteHeader implicitly send 200 OK
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status code before passing it on
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.wrote = true
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write counts the bytes sent in the response body
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	rec.wrote = true // The first Write sends an implicit 200
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+// (needed for Flush, deadlines, etc. through our wrapper)
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,149 @@
+// Package main - URL normalization: trailing slashes, duplicate slashes, letter case
+package main
+
+import (
+	"fmt"      // For rejecting unknown policies
+	"net/http" // For the mux, redirects and status codes
+	"net/url"  // For building the redirect target and reading RequestURI
+	"path"     // For path.Clean
+	"strings"  // For splitting paths and patterns into segments
+)
+
+// Express routes are forgiving by default: /users/ matches app.get('/users')
+// unless `strict routing` is on, and /Users matches unless `case sensitive
+// routing` is on. http.ServeMux is strict about both, so /users/ and /Users
+// are 404s, and //users gets a 301 (which turns a POST into a GET in most clients).
+//
+// normalizeURL sits in front of the mux and maps such paths onto the route
+// they were meant for, either by redirecting the client or by quietly
+// rewriting the request.
+
+// urlPolicy decides what happens to a non-canonical path
+type urlPolicy string
+
+const (
+	urlRedirect urlPolicy = "redirect" // 308 to the canonical URL; method and body are kept
+	urlRewrite  urlPolicy = "rewrite"  // Serve it as if the canonical path had been requested
+	urlStrict   urlPolicy = "off"      // Leave paths alone (plain ServeMux behaviour)
+)
+
+// parseURLPolicy checks the -url-policy flag value
+func parseURLPolicy(s string) (urlPolicy, error) {
+	switch p := urlPolicy(s); p {
+	case urlRedirect, urlRewrite, urlStrict:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown URL policy %q (want redirect, rewrite or off)", s)
+}
+
+// normalizeURL applies policy to requests whose path doesn't match a route as
+// sent but does once cleaned up:
+//
+//	/users/        → /users          trailing slash
+//	//users//1     → /users/1        duplicate slashes (and . / .. segments)
+//	/Users/1/Row   → /users/1/row    letter case of the fixed route segments
+//
+// Only the literal parts of the route are case-folded: in /Binary/AbC the
+// blob ID stays "AbC", because IDs and file names are case-sensitive
+func normalizeURL(mux *http.ServeMux, policy urlPolicy) Middleware {
+	return func(next http.Handler) http.Handler {
+		if policy == urlStrict {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target, ok := canonicalPath(mux, r)
+			if !ok {
+				next.ServeHTTP(w, r) // Already canonical, or no route would match anyway
+				return
+			}
+
+			if policy == urlRedirect {
+				// 308 Permanent Redirect, not 301: clients must repeat the same
+				// method with the same body (res.redirect(308, url) in Express)
+				loc := url.URL{Path: mountPrefix(r) + target, RawQuery: r.URL.RawQuery}
+				http.Redirect(w, r, loc.String(), http.StatusPermanentRedirect)
+				return
+			}
+
+			// Rewrite: a shallow copy of the request with the new path, like
+			// req.url = '/users' in an Express middleware
+			r2 := r.Clone(r.Context())
+			r2.URL.Path, r2.URL.RawPath = target, ""
+			// apiBaseURL compares RequestURI with the path to find the /api
+			// mount point, so keep the two consistent for link building
+			r2.RequestURI = (&url.URL{Path: mountPrefix(r) + target, RawQuery: r.URL.RawQuery}).RequestURI()
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// canonicalPath returns the path r should have been sent to, and false when
+// r is fine as it is or when no cleaned-up version matches a route either
+// Each candidate is checked with mux.Handler, which runs the mux's matching
+// without calling the handler - a second lookup per request, which is cheap
+func canonicalPath(mux *http.ServeMux, r *http.Request) (string, bool) {
+	matches := func(p string) string {
+		probe := r.Clone(r.Context())
+		probe.URL.Path, probe.URL.RawPath = p, ""
+		_, pattern := mux.Handler(probe) // "" when nothing matches (404 or 405)
+		return pattern
+	}
+
+	// path.Clean collapses //, resolves . and .. and drops the trailing slash
+	clean := path.Clean("/" + r.URL.Path)
+	if clean == r.URL.Path && matches(clean) != "" {
+		return "", false
+	}
+	if clean != r.URL.Path && matches(clean) != "" {
+		return clean, true
+	}
+
+	// Case: match the lower-cased path, then take the literal segments from
+	// the route's pattern and the wildcard segments from the request
+	pattern := matches(strings.ToLower(clean))
+	if pattern == "" {
+		return "", false
+	}
+	target := applyPatternCase(pattern, clean)
+	if target == r.URL.Path || matches(target) == "" {
+		return "", false
+	}
+	return target, true
+}
+
+// applyPatternCase copies the case of pattern's literal segments onto p
+//
+//	applyPatternCase("GET /users/{id}/row", "/Users/AbC/ROW") == "/users/AbC/row"
+func applyPatternCase(pattern, p string) string {
+	// Patterns may start with a method ("GET /users"); the path follows the space
+	if _, rest, found := strings.Cut(pattern, " "); found {
+		pattern = rest
+	}
+	patSegs := strings.Split(pattern, "/")
+	segs := strings.Split(p, "/")
+	for i, ps := range patSegs {
+		if i >= len(segs) {
+			break
+		}
+		switch {
+		case strings.HasSuffix(ps, "...}"):
+			return strings.Join(segs, "/") // {file...}: the rest of the path is data
+		case strings.HasPrefix(ps, "{"):
+			// {id}: keep the request's segment
+		default:
+			segs[i] = ps
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// mountPrefix is the part of the original URL that a router in front of us
+// stripped, e.g. "/api" in SPA mode (http.StripPrefix changes URL.Path but
+// leaves RequestURI as the client sent it)
+func mountPrefix(r *http.Request) string {
+	full := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		full = u.Path
+	}
+	return strings.TrimSuffix(full, r.URL.Path)
+}
@@ -0,0 +1,296 @@
+// Package main - OpenID Connect: provider discovery, JWKS and ID token validation
+package main
+
+import (
+	"context"         // Outbound calls take the caller's context
+	"crypto"          // For the hash identifier of RS256
+	"crypto/ecdsa"    // ES256 signatures
+	"crypto/elliptic" // The P-256 curve
+	"crypto/rsa"      // RS256 signatures
+	"crypto/sha256"   // The hash behind RS256 and ES256
+	"encoding/base64" // JWTs and JWKs use unpadded base64url
+	"encoding/json"   // For metadata, keys and claims
+	"errors"          // For the validation errors
+	"fmt"             // For error details
+	"math/big"        // RSA moduli and ECDSA signature halves
+	"slices"          // For the audience check
+	"strings"         // For splitting tokens and trimming the issuer
+	"sync"            // For the key cache
+	"time"            // For expiry and cache ages
+)
+
+// OAuth 2 lets a user grant this app access at another service; OpenID
+// Connect adds who the user is: next to the access token, the provider
+// returns an ID token - a JWT signed with the provider's private key, whose
+// claims say who logged in (sub, email, name), for which app (aud), and
+// for which login attempt (nonce). In Node, openid-client does all of this;
+// here it's written out in two parts:
+//
+//	oidc.go       discovery, signing keys (JWKS), ID token validation
+//	oidclogin.go  the login redirect, the callback, and claims → local user
+//
+// Discovery: every provider publishes its endpoints and key URL at
+// <issuer>/.well-known/openid-configuration, so configuring one takes only
+// the issuer URL and a client ID.
+//
+// Keys: providers rotate signing keys. A token names its key ("kid"); the
+// key set is cached for an hour, and a kid we haven't seen triggers one
+// refetch - at most once a minute, so tokens with made-up kids can't turn
+// us into a load generator against the provider.
+
+// OIDC cache settings
+const (
+	oidcMetadataTTL = 24 * time.Hour   // Discovery documents change rarely
+	jwksTTL         = time.Hour        // How long fetched keys are trusted without a refetch
+	jwksMinRefresh  = time.Minute      // Least time between refetches for unknown kids
+	idTokenLeeway   = 30 * time.Second // Allowed clock difference to the provider
+)
+
+// ID token validation errors; the callback answers all of them with 401
+var (
+	errIDTokenMalformed = errors.New("malformed ID token")
+	errIDTokenAlg       = errors.New("ID token signed with an unsupported algorithm")
+	errIDTokenKey       = errors.New("ID token signed with an unknown key")
+	errIDTokenSignature = errors.New("invalid ID token signature")
+	errIDTokenIssuer    = errors.New("ID token from another issuer")
+	errIDTokenAudience  = errors.New("ID token issued for another client")
+	errIDTokenExpired   = errors.New("ID token expired")
+	errIDTokenNonce     = errors.New("ID token nonce mismatch")
+)
+
+// oidcMetadata is the part of the discovery document we use
+type oidcMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// oidcProvider talks to one OpenID provider for one client
+type oidcProvider struct {
+	issuer   string
+	clientID string
+	secret   func() string // The client secret (oidc_client_secret); "" for public clients
+	client   *httpClient
+	metadata *ttlCache[string, oidcMetadata]
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey // By kid
+	keysFetched time.Time
+}
+
+// newOIDCProvider creates a provider; nothing is fetched until the first login,
+// so an unreachable provider doesn't stop the server from starting
+func newOIDCProvider(issuer, clientID string, secret func() string, client *httpClient) *oidcProvider {
+	return &oidcProvider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		clientID: clientID,
+		secret:   secret,
+		client:   client,
+		metadata: newTTLCache[string, oidcMetadata](oidcMetadataTTL),
+	}
+}
+
+// discover returns the provider's metadata, fetching it when not cached
+// The document must name the issuer we were configured with (OIDC Discovery
+// section 4.3), or a compromised document could point us at other keys
+func (p *oidcProvider) discover(ctx context.Context) (oidcMetadata, error) {
+	if m, ok := p.metadata.get(p.issuer); ok {
+		return m, nil
+	}
+	m, err := getJSON[oidcMetadata](ctx, p.client, p.issuer+"/.well-known/openid-configuration")
+	if err != nil {
+		return oidcMetadata{}, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.issuer {
+		return oidcMetadata{}, fmt.Errorf("oidc discovery: document is for issuer %q", m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return oidcMetadata{}, errors.New("oidc discovery: document lacks an endpoint")
+	}
+	p.metadata.set(p.issuer, m)
+	return m, nil
+}
+
+// jwk is one key of a JSON Web Key Set (RFC 7517); only the fields of RSA, EC and OKP keys
+// The same type describes the provider's keys here and ours in jwks.go
+type jwk struct {
+	Kty string `json:"kty"`           // "RSA" or "EC"
+	Kid string `json:"kid"`           // Key ID, matched against the token header
+	Use string `json:"use,omitempty"` // "sig"; "enc" keys are skipped
+	Alg string `json:"alg,omitempty"` // The one algorithm the key is for, when the set says
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // EC curve; only P-256
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// publicKey converts a JWK into a Go public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(k.N)
+		e, err2 := b64.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil, errors.New("bad RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		x, err1 := b64.DecodeString(k.X)
+		y, err2 := b64.DecodeString(k.Y)
+		if k.Crv != "P-256" || err1 != nil || err2 != nil || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("bad EC key")
+		}
+		// Uncompressed point: 0x04 || X || Y; parsing also checks it's on the curve
+		return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// key returns the signing key with the given kid
+// Keys are refetched when they're older than jwksTTL, or when kid is
+// unknown and the last fetch is at least jwksMinRefresh ago (rotation)
+func (p *oidcProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock() // Held across the fetch: concurrent logins wait for one refetch instead of each starting one
+	age := time.Since(p.keysFetched)
+	k, ok := p.keys[kid]
+	if ok && age < jwksTTL {
+		return k, nil
+	}
+	if !ok && p.keys != nil && age < jwksMinRefresh {
+		return nil, errIDTokenKey
+	}
+
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set, err := getJSON[struct {
+		Keys []jwk `json:"keys"`
+	}](ctx, p.client, m.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jk := range set.Keys {
+		if jk.Use != "" && jk.Use != "sig" {
+			continue
+		}
+		if pub, err := jk.publicKey(); err == nil {
+			keys[jk.Kid] = pub
+		}
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, errIDTokenKey
+}
+
+// idTokenClaims are the claims of a validated ID token; everything the
+// provider sent, so claim rules can use any of them (see oidclogin.go)
+type idTokenClaims map[string]any
+
+// str returns a string claim, or "" when it's missing or not a string
+func (c idTokenClaims) str(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// verifyIDToken checks an ID token as OpenID Connect Core section 3.1.3.7
+// says: signature with the provider's key, issuer, audience, expiry and
+// the nonce of this login attempt. It returns the claims
+func (p *oidcProvider) verifyIDToken(ctx context.Context, token, nonce string, now time.Time) (idTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errIDTokenMalformed
+	}
+	b64 := base64.RawURLEncoding
+	rawHeader, err1 := b64.DecodeString(parts[0])
+	rawClaims, err2 := b64.DecodeString(parts[1])
+	sig, err3 := b64.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, errIDTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, errIDTokenMalformed
+	}
+	// Only asymmetric algorithms: with HS256 the "key" would be our client
+	// secret, and "none" has no signature at all
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, errIDTokenAlg
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], sig) {
+		return nil, errIDTokenSignature
+	}
+
+	var claims idTokenClaims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, errIDTokenMalformed
+	}
+	if strings.TrimSuffix(claims.str("iss"), "/") != p.issuer {
+		return nil, errIDTokenIssuer
+	}
+	// aud is a string or a list; with several audiences, azp must be us
+	var aud []string
+	switch v := claims["aud"].(type) {
+	case string:
+		aud = []string{v}
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	if !slices.Contains(aud, p.clientID) || (len(aud) > 1 && claims.str("azp") != p.clientID) {
+		return nil, errIDTokenAudience
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.Add(-idTokenLeeway).Unix() >= int64(exp) {
+		return nil, errIDTokenExpired
+	}
+	if iat, ok := claims["iat"].(float64); ok && int64(iat) > now.Add(idTokenLeeway).Unix() {
+		return nil, errIDTokenMalformed // Issued in the future
+	}
+	// The nonce ties the token to the login this browser started; without
+	// the check, a token captured elsewhere could be replayed
+	if claims.str("nonce") != nonce {
+		return nil, errIDTokenNonce
+	}
+	if claims.str("sub") == "" {
+		return nil, errIDTokenMalformed
+	}
+	return claims, nil
+}
+
+// verifySignature checks an RS256 or ES256 signature over digest
+func verifySignature(alg string, key crypto.PublicKey, digest, sig []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig) == nil
+	case "ES256":
+		// JWS puts r and s side by side (32 bytes each), not in ASN.1
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+// Package main - "Log in with <provider>": the OpenID Connect login flow and claim mapping
+package main
+
+import (
+	"crypto/hmac"     // Constant-time state comparison
+	"crypto/sha256"   // For the PKCE challenge
+	"encoding/base64" // For the PKCE challenge and the return path in the cookie
+	"errors"          // For the claim rule errors
+	"fmt"             // For rule errors
+	"net/http"        // For the handlers
+	"net/url"         // For the authorization URL
+	"slices"          // For list claims
+	"strconv"         // For the cookie's expiry
+	"strings"         // For parsing rules and the cookie
+	"time"            // For the login attempt's lifetime
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For state, nonce and PKCE verifier
+)
+
+// The authorization code flow, as openid-client or passport-openidconnect run it:
+//
+//  1. GET /auth/oidc/login redirects the browser to the provider, with a
+//     random state (against CSRF), nonce (against replay) and PKCE
+//     challenge (against stolen codes). The three are kept in a signed,
+//     short-lived cookie - no server-side session needed.
+//  2. The user logs in there; the provider redirects to
+//     GET /auth/oidc/callback?code=...&state=...
+//  3. We check state against the cookie, trade the code for tokens at the
+//     provider's token endpoint, validate the ID token (oidc.go), and map its
+//     claims to a local user with the -oidc-claims rules.
+//  4. The user gets our own tokens, like after POST /auth/login - or, when
+//     the login started with ?return_to=/ui, a session cookie and a redirect.
+
+// oidcLoginCookie holds state, nonce, PKCE verifier, return path and expiry
+const oidcLoginCookie = "oidc_login"
+
+// oidcLoginTTL is how long a started login may take at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcClaimRules decide which ID tokens become which local users
+//
+//	-oidc-claims "email=email,name=name|preferred_username,require=email_verified:true,domains=example.com,create=on"
+//
+// The defaults are those values without domains: any verified email may
+// log in, and gets an account on first login
+type oidcClaimRules struct {
+	EmailClaim string              // Claim holding the email, which links to the local user
+	NameClaims []string            // Claims tried in order for the user's name
+	Require    map[string][]string // Claim → accepted values; a list claim (groups) needs one of them
+	Domains    []string            // Allowed email domains; empty allows all
+	Create     bool                // Create a local user on first login
+}
+
+// Claim rule errors; the callback answers them with 403
+var (
+	errOIDCNoEmail     = errors.New("the provider sent no email")
+	errOIDCNoAccount   = errors.New("no account for this email")
+	errOIDCDomain      = errors.New("email domain not allowed")
+	errOIDCRequirement = errors.New("login not allowed by the claim rules")
+)
+
+// parseOIDCClaimRules reads an -oidc-claims spec on top of the defaults
+// Lists are separated by |; require takes claim:value pairs
+func parseOIDCClaimRules(spec string) (oidcClaimRules, error) {
+	rules := oidcClaimRules{
+		EmailClaim: "email",
+		NameClaims: []string{"name", "preferred_username"},
+		Require:    map[string][]string{"email_verified": {"true"}},
+		Create:     true,
+	}
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return rules, fmt.Errorf("oidc claim rule %q: want key=value", item)
+		}
+		list := strings.Split(value, "|")
+		switch key {
+		case "email":
+			rules.EmailClaim = value
+		case "name":
+			rules.NameClaims = list
+		case "require":
+			rules.Require = map[string][]string{} // Replaces the default, so email_verified can be dropped
+			for _, pair := range list {
+				claim, want, ok := strings.Cut(pair, ":")
+				if !ok {
+					return rules, fmt.Errorf("oidc claim rule require=%s: want claim:value", pair)
+				}
+				rules.Require[claim] = append(rules.Require[claim], want)
+			}
+		case "domains":
+			rules.Domains = list
+		case "create":
+			rules.Create = value == "on" || value == "true"
+		default:
+			return rules, fmt.Errorf("unknown oidc claim rule %q", key)
+		}
+	}
+	return rules, nil
+}
+
+// apply checks claims against the rules and returns the email and name for the local user
+// Requirements compare the claim's JSON value as text, so email_verified:true
+// matches the boolean true; for list claims, any element may match
+func (rules oidcClaimRules) apply(claims idTokenClaims) (email, name string, err error) {
+	for claim, accepted := range rules.Require {
+		var values []string
+		switch v := claims[claim].(type) {
+		case []any:
+			for _, e := range v {
+				values = append(values, fmt.Sprint(e))
+			}
+		case nil:
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		if !slices.ContainsFunc(values, func(v string) bool { return slices.Contains(accepted, v) }) {
+			return "", "", fmt.Errorf("%w: %s", errOIDCRequirement, claim)
+		}
+	}
+	email = normalizeEmail(claims.str(rules.EmailClaim))
+	if email == "" {
+		return "", "", errOIDCNoEmail
+	}
+	if len(rules.Domains) > 0 {
+		_, domain, _ := strings.Cut(email, "@")
+		if !slices.Contains(rules.Domains, domain) {
+			return "", "", errOIDCDomain
+		}
+	}
+	for _, c := range rules.NameClaims {
+		if name = claims.str(c); name != "" {
+			break
+		}
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@") // Required locally; better than failing the login
+	}
+	return email, name, nil
+}
+
+// oidcLogin is the configured login: provider, redirect URL and claim rules
+type oidcLogin struct {
+	provider    *oidcProvider
+	redirectURL string // Registered at the provider; "" derives it from the request
+	rules       oidcClaimRules
+}
+
+// oidcTokenResponse is the part of the token endpoint's answer we use
+type oidcTokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// oidcRedirectURL is where the provider sends the browser back to
+func (a *api) oidcRedirectURL(r *http.Request) string {
+	if a.oidc.redirectURL != "" {
+		return a.oidc.redirectURL
+	}
+	return apiBaseURL(r).withPath("auth", "oidc", "callback").String()
+}
+
+// localPath reports whether p is a path on this site: "/ui", not
+// "https://evil.example" or "//evil.example" - an open redirect otherwise
+func localPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, `/\`)
+}
+
+// oidcLoginHandler starts a login at the provider (GET /auth/oidc/login)
+// ?return_to=/ui makes the callback set a session cookie and redirect there
+//
+//	open http://localhost:8080/auth/oidc/login?return_to=/ui
+func (a *api) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.URL.Query().Get("return_to")
+	if returnTo != "" && !localPath(returnTo) {
+		writeJSONError(w, http.StatusBadRequest, "return_to must be a path on this site")
+		return
+	}
+	m, err := a.oidc.provider.discover(r.Context())
+	if err != nil {
+		a.logger.ErrorContext(r.Context(), "oidc: discovery failed", "err", err)
+		writeJSONError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	state, nonce, verifier := cryptoutil.RandomToken(24), cryptoutil.RandomToken(24), cryptoutil.RandomToken(32)
+	// PKCE (RFC 7636): the provider only hands out tokens to whoever knows
+	// the verifier behind this challenge, so an intercepted code is useless
+	challenge := sha256.Sum256([]byte(verifier))
+	expires := time.Now().Add(oidcLoginTTL).Unix()
+	// base64url parts joined by dots; the signature keeps the browser from editing them
+	setSignedCookie(w, a.signer.key(), oidcLoginCookie, strings.Join([]string{
+		state, nonce, verifier, base64.RawURLEncoding.EncodeToString([]byte(returnTo)), strconv.FormatInt(expires, 10),
+	}, "."))
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {a.oidc.provider.clientID},
+		"redirect_uri":          {a.oidcRedirectURL(r)},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, m.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// oidcCallbackHandler finishes a login (GET /auth/oidc/callback)
+func (a *api) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	// The attempt is over either way; the cookie can't be used twice
+	http.SetCookie(w, &http.Cookie{Name: oidcLoginCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	if e := q.Get("error"); e != "" {
+		// The user cancelled, or the provider refused: access_denied, login_required, ...
+		writeJSONError(w, http.StatusUnauthorized, "login failed at the identity provider: "+e)
+		return
+	}
+
+	var state, nonce, verifier, returnTo string
+	c, err := r.Cookie(oidcLoginCookie)
+	if err == nil {
+		value, ok := unsignCookie(a.signer.key(), c.Value)
+		parts := strings.Split(value, ".")
+		if ok && len(parts) == 5 {
+			expires, _ := strconv.ParseInt(parts[4], 10, 64)
+			rt, _ := base64.RawURLEncoding.DecodeString(parts[3])
+			if time.Now().Unix() < expires {
+				state, nonce, verifier, returnTo = parts[0], parts[1], parts[2], string(rt)
+			}
+		}
+	}
+	if state == "" || !hmac.Equal([]byte(state), []byte(q.Get("state"))) {
+		writeJSONError(w, http.StatusBadRequest, "login expired or started in another browser; start again at /auth/oidc/login")
+		return
+	}
+
+	m, err := a.oidc.provider.discover(r.Context())
+	if err != nil {
+		a.logger.ErrorContext(r.Context(), "oidc: discovery failed", "err", err)
+		writeJSONError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {q.Get("code")},
+		"redirect_uri":  {a.oidcRedirectURL(r)},
+		"client_id":     {a.oidc.provider.clientID},
+		"code_verifier": {verifier},
+	}
+	if secret := a.oidc.provider.secret(); secret != "" {
+		form.Set("client_secret", secret) // client_secret_post; public clients rely on PKCE alone
+	}
+	tokens, err := postFormJSON[oidcTokenResponse](r.Context(), a.oidc.provider.client, m.TokenEndpoint, form)
+	if err != nil {
+		a.logger.ErrorContext(r.Context(), "oidc: token exchange failed", "err", err)
+		writeJSONError(w, http.StatusBadGateway, "could not redeem the login code")
+		return
+	}
+	claims, err := a.oidc.provider.verifyIDToken(r.Context(), tokens.IDToken, nonce, time.Now())
+	if err != nil {
+		a.logger.WarnContext(r.Context(), "oidc: ID token rejected", "err", err)
+		writeJSONError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	u, err := a.oidcUser(r, claims)
+	if err != nil {
+		a.logger.WarnContext(r.Context(), "oidc: login refused", "sub", claims.str("sub"), "err", err)
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if returnTo != "" {
+		a.startCookieSession(w, r, u, nil)
+		http.Redirect(w, r, returnTo, http.StatusSeeOther)
+		return
+	}
+	a.respondTokens(w, r, http.StatusOK, u, "", nil)
+}
+
+// oidcUser finds the local user for validated claims, creating one if the rules allow
+// Users are linked by email, which is why email_verified is required by
+// default: an unverified email would let anyone claim anyone's account
+func (a *api) oidcUser(r *http.Request, claims idTokenClaims) (User, error) {
+	email, name, err := a.oidc.rules.apply(claims)
+	if err != nil {
+		return User{}, err
+	}
+	tenant := tenantFromContext(r.Context())
+	u, err := a.users.GetByEmail(r.Context(), tenant, email)
+	if !errors.Is(err, errUserNotFound) {
+		return u, err
+	}
+	if !a.oidc.rules.Create {
+		return User{}, errOIDCNoAccount
+	}
+	return a.users.Create(r.Context(), User{Name: name, Email: email, TenantID: tenant})
+}
@@ -0,0 +1,285 @@
+// Package main - long-running operations: 202 Accepted now, poll for the result
+package main
+
+import (
+	"bytes"         // For building the export in memory
+	"context"       // For running the import after the request ends
+	"encoding/json" // For encoding the export
+	"errors"        // For the queue-full check
+	"fmt"           // For the export file name
+	"net/http"      // For the handlers
+	"sync"          // For the mutex; workers update operations while handlers read them
+	"time"          // For timestamps and expiry
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For operation IDs
+)
+
+// An export of every user, or an import of thousands, can take longer than
+// a client (or a proxy in front of us) is willing to wait for one response.
+// The async-REST pattern splits it in two:
+//
+//	POST /users/export      → 202 Accepted, Location: /operations/{id}
+//	GET  /operations/{id}   → {"status":"running","progress":{...}} ... {"status":"succeeded","result":{...}}
+//
+// The work runs on the same worker pool as avatar processing (see jobs.go),
+// so a burst of exports queues up instead of all running at once. In Node
+// this is usually a BullMQ queue plus a status endpoint reading the job.
+
+// operationTTL is how long a finished operation can still be polled
+const operationTTL = time.Hour
+
+// operationStatus is where an operation is in its life
+type operationStatus string
+
+const (
+	operationPending   operationStatus = "pending" // Queued, waiting for a worker
+	operationRunning   operationStatus = "running"
+	operationSucceeded operationStatus = "succeeded"
+	operationFailed    operationStatus = "failed"
+)
+
+// operationProgress counts the items an operation has handled so far
+type operationProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// operation is what GET /operations/{id} returns
+type operation struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"` // "users.export" or "users.import"
+	Status     operationStatus   `json:"status"`
+	Progress   operationProgress `json:"progress"`
+	Result     any               `json:"result,omitempty"` // Set once it succeeded; the shape depends on Kind
+	Error      string            `json:"error,omitempty"`  // Set once it failed
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt time.Time         `json:"finished_at,omitzero"`
+	RequestID  string            `json:"request_id,omitempty"` // Of the request that started it; its log lines carry the same ID
+	tenantID   string            // Operations are only visible inside their tenant
+	owner      string            // ... and only to the principal that started them (Principal.key)
+}
+
+// finished reports whether the operation has stopped, successfully or not
+func (o operation) finished() bool {
+	return o.Status == operationSucceeded || o.Status == operationFailed
+}
+
+// operationStore keeps operations in memory until operationTTL after they finish
+type operationStore struct {
+	mu  sync.Mutex
+	ops map[string]*operation
+}
+
+// newOperationStore creates an empty store
+func newOperationStore() *operationStore {
+	return &operationStore{ops: make(map[string]*operation)}
+}
+
+// create registers a pending operation and returns a copy of it
+// Expired operations are swept here, so the map can't grow forever
+func (s *operationStore) create(tenantID, owner, kind, requestID string) operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, op := range s.ops {
+		if op.finished() && time.Since(op.FinishedAt) > operationTTL {
+			delete(s.ops, id)
+		}
+	}
+	op := &operation{
+		ID:        cryptoutil.RandomToken(16), // Unguessable, like blob IDs (see cryptoutil/)
+		Kind:      kind,
+		Status:    operationPending,
+		CreatedAt: time.Now().UTC(),
+		RequestID: requestID,
+		tenantID:  tenantID,
+		owner:     owner,
+	}
+	s.ops[op.ID] = op
+	return *op
+}
+
+// update changes an operation under the lock
+func (s *operationStore) update(id string, fn func(op *operation)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if op, ok := s.ops[id]; ok {
+		fn(op)
+	}
+}
+
+// get returns a copy of an operation of the given tenant and owner
+// Returning a copy (not the pointer) means callers can read it without the lock
+// Someone else's operation is missing rather than forbidden: its ID says nothing
+func (s *operationStore) get(tenantID, owner, id string) (operation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[id]
+	if !ok || op.tenantID != tenantID || op.owner != owner {
+		return operation{}, false
+	}
+	return *op, true
+}
+
+// operationFunc does the work of an operation; it calls progress as it goes
+// and returns the result shown to pollers
+type operationFunc func(progress func(done, total int)) (any, error)
+
+// startOperation queues fn and answers 202 with the new operation
+// The handler returns right away; the worker updates the stored operation
+// Operation routes are behind requireAuth, so there is always a principal
+func (a *api) startOperation(w http.ResponseWriter, r *http.Request, kind string, fn operationFunc) {
+	ctx := r.Context()
+	p, _ := principalFromContext(ctx)
+	op := a.operations.create(tenantFromContext(ctx), p.key(), kind, requestIDFromContext(ctx))
+	id := op.ID
+
+	err := a.jobs.submit(ctx, func() {
+		a.operations.update(id, func(op *operation) { op.Status = operationRunning })
+		progress := func(done, total int) {
+			a.operations.update(id, func(op *operation) { op.Progress = operationProgress{Done: done, Total: total} })
+		}
+		var result any
+		opErr := errors.New("operation did not complete") // Stays set if fn panics
+		// Deferred, so a panic (recovered by the pool) still ends as "failed"
+		// instead of leaving pollers waiting on "running" forever
+		defer a.operations.update(id, func(op *operation) {
+			op.FinishedAt = time.Now().UTC()
+			if opErr != nil {
+				op.Status, op.Error = operationFailed, opErr.Error()
+				a.logger.ErrorContext(ctx, "operation failed", "operation", id, "kind", kind, "err", opErr)
+				return
+			}
+			op.Status, op.Result = operationSucceeded, result
+		})
+		result, opErr = fn(progress)
+	})
+	if errors.Is(err, errQueueFull) {
+		a.operations.update(id, func(op *operation) {
+			op.Status, op.Error, op.FinishedAt = operationFailed, err.Error(), time.Now().UTC()
+		})
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	// 202 Accepted: "I've taken this on, it isn't done yet" - the Location
+	// header tells the client where to poll
+	w.Header().Set("Location", apiBaseURL(r).withPath("operations", id).String())
+	respondJSON(w, http.StatusAccepted, op)
+}
+
+// getOperationHandler reports an operation's status, and its result once done (GET /operations/{id})
+func (a *api) getOperationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathToken(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	p, _ := principalFromContext(r.Context())
+	op, ok := a.operations.get(tenantFromContext(r.Context()), p.key(), id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "operation not found")
+		return
+	}
+	if !op.finished() {
+		w.Header().Set("Retry-After", "1") // A hint for how long to wait before polling again
+	}
+	respondJSON(w, http.StatusOK, op)
+}
+
+// exportResult is the result of users.export
+type exportResult struct {
+	Users    int    `json:"users"`
+	Download string `json:"download"` // Signed link for the starter only, valid as long as the operation (see signedurl.go)
+}
+
+// exportUsersHandler exports every user of the tenant as a JSON file (POST /users/export)
+// Every user's email in one file: an admin route
+// curl -X POST -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/users/export, then poll the Location header
+func (a *api) exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithoutCancel(r.Context()) // Keeps the tenant, drops the cancellation
+	tenantID := tenantFromContext(ctx)
+	p, _ := principalFromContext(ctx)
+	base := apiBaseURL(r) // Built now: the request is gone by the time the job finishes
+
+	a.startOperation(w, r, "users.export", func(progress func(done, total int)) (any, error) {
+		users := a.users.List(ctx, tenantID)
+		var buf bytes.Buffer
+		buf.WriteString("[\n")
+		for i, u := range users {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			line, err := json.Marshal(u)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(line)
+			progress(i+1, len(users))
+		}
+		buf.WriteString("\n]\n")
+
+		name := fmt.Sprintf("users-%s-%s.json", tenantID, time.Now().UTC().Format("20060102-150405"))
+		// Every user of the tenant: private, so knowing the blob ID isn't enough
+		b, err := a.blobs.putPrivate("application/json", name, buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		// The link expires with the operation and only works with the starter's
+		// credentials; without ?inline=1, so browsers save it under name (see files.go)
+		download := a.signer.signFor(base, time.Now().Add(operationTTL), p.key(), "shared", "exports", b.ID, "download")
+		return exportResult{Users: len(users), Download: download}, nil
+	})
+}
+
+// exportDownloadHandler serves an export to whoever started it (GET /shared/exports/{id}/download)
+// Behind requireAuth and requireSignature: the signed "for" must be the caller,
+// so a link that leaks through a log or a chat is useless to anyone else
+func (a *api) exportDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	p, _ := principalFromContext(r.Context())
+	if r.URL.Query().Get("for") != p.key() {
+		writeJSONError(w, http.StatusForbidden, "this download belongs to whoever started the export")
+		return
+	}
+	a.sharedFileHandler(w, r)
+}
+
+// importFailure is one user that couldn't be imported
+type importFailure struct {
+	Index int    `json:"index"` // Position in the request array
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+// importResult is the result of users.import
+type importResult struct {
+	Created int             `json:"created"`
+	Failed  []importFailure `json:"failed"`
+}
+
+// importUsersHandler creates users from a JSON array (POST /users/import)
+// The body is read before answering 202; only the creating happens later
+// Each user goes through UserService, so welcome mails and activity follow
+func (a *api) importUsersHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[[]User](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	tenantID := tenantFromContext(ctx)
+
+	a.startOperation(w, r, "users.import", func(progress func(done, total int)) (any, error) {
+		result := importResult{Failed: []importFailure{}}
+		for i, p := range payload {
+			_, err := a.users.Create(ctx, User{Name: p.Name, Email: p.Email, TenantID: tenantID})
+			if err != nil {
+				result.Failed = append(result.Failed, importFailure{Index: i, Email: p.Email, Error: err.Error()})
+			} else {
+				result.Created++
+			}
+			progress(i+1, len(payload))
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,171 @@
+// Package main - page or limit/offset pagination with RFC 8288 Link headers
+package main
+
+import (
+	"fmt"      // For building the Link header
+	"net/http" // For reading the request and setting headers
+	"strconv"  // For parsing ?page= and ?per_page=
+	"strings"  // For joining the Link header entries
+)
+
+// Pagination parameters, GitHub-style: ?page=2&per_page=50
+// Or the limit/offset pair knex and Sequelize use: ?limit=50&offset=100
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// pageParams is the page a client asked for
+type pageParams struct {
+	Page     int  // 1-based; with ?offset=, the page the offset falls in
+	PerPage  int  // ?per_page= or ?limit=
+	Offset   int  // Items to skip: (Page-1)*PerPage, or ?offset= as given
+	After    int  // ?cursor=: the ID the page starts after (see cursor.go)
+	byOffset bool // The client used ?limit=/?offset=, so the links do too
+	byCursor bool // The client sent ?cursor=
+}
+
+// pageMeta describes the page that was returned; it goes into the body and
+// is the input for the Link header
+type pageMeta struct {
+	Page       int    `json:"page"`
+	PerPage    int    `json:"per_page"`
+	Offset     int    `json:"offset"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	NextCursor string `json:"next_cursor,omitempty"` // Continues after this page; only for lists ordered by id (see cursor.go)
+	Stale      bool   `json:"stale,omitempty"`       // Remembered while the store is down (see resilience.go)
+	byOffset   bool   // Unexported, so not in the JSON
+	byCursor   bool
+}
+
+// meta describes the page p of a collection of total items
+func (p pageParams) meta(total int) pageMeta {
+	return pageMeta{
+		Page:       p.Page,
+		PerPage:    p.PerPage,
+		Offset:     p.Offset,
+		Total:      total,
+		TotalPages: (total + p.PerPage - 1) / p.PerPage, // Integer ceiling division
+		byOffset:   p.byOffset,
+		byCursor:   p.byCursor,
+	}
+}
+
+// pageBody is the envelope of every paginated collection: {"data": [...], "meta": {...}}
+type pageBody struct {
+	Data any      `json:"data"`
+	Meta pageMeta `json:"meta"`
+}
+
+// parsePage reads ?page= and ?per_page=, or ?limit= and ?offset=; missing
+// values use the defaults. The two styles can't be mixed: ?page=2&offset=40
+// has no single meaning
+func parsePage(r *http.Request) (pageParams, error) {
+	p := pageParams{Page: 1, PerPage: defaultPerPage}
+	q := r.URL.Query()
+	if q.Has("limit") || q.Has("offset") {
+		if q.Has("page") || q.Has("per_page") {
+			return p, &requestError{Status: http.StatusBadRequest, Message: "use page/per_page or limit/offset, not both"}
+		}
+		p.byOffset = true
+	}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, &requestError{Status: http.StatusBadRequest, Message: "page must be a positive integer"}
+		}
+		p.Page = n
+	}
+	for _, name := range []string{"per_page", "limit"} { // limit is per_page by another name
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxPerPage {
+				return p, &requestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("%s must be between 1 and %d", name, maxPerPage)}
+			}
+			p.PerPage = n
+		}
+	}
+	p.Offset = (p.Page - 1) * p.PerPage
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return p, &requestError{Status: http.StatusBadRequest, Message: "offset must be 0 or a positive integer"}
+		}
+		p.Offset, p.Page = n, n/p.PerPage+1
+	}
+	return p, nil
+}
+
+// paginate cuts one page out of items - items.slice(start, end) in JS
+// Works for any element type; a page past the end is empty, not an error
+func paginate[T any](items []T, p pageParams) ([]T, pageMeta) {
+	start := min(p.Offset, len(items)) // min/max are built in since Go 1.21
+	end := min(start+p.PerPage, len(items))
+	return items[start:end], p.meta(len(items))
+}
+
+// setLinkHeader emits RFC 8288 pagination links, the format GitHub's API uses:
+//
+//	Link: <http://host/users?page=3&per_page=20>; rel="next", <...>; rel="last", ...
+//
+// Generic clients (and libraries like parse-link-header on npm) can walk the
+// pages without knowing our envelope. Every link is the current URL - same
+// path, same filters and sorting - with only ?page= changed, ?offset= for a
+// client that paged with ?limit=/?offset=, or ?cursor= (see cursor.go)
+func setLinkHeader(w http.ResponseWriter, r *http.Request, meta pageMeta) {
+	if meta.byCursor {
+		setCursorLinkHeader(w, r, meta)
+		return
+	}
+	if meta.byOffset {
+		setOffsetLinkHeader(w, r, meta)
+		return
+	}
+	// One segment per path element - withPath escapes "/" inside a segment
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	base := apiBaseURL(r).withPath(segments...).withQueries(r.URL.Query())
+	pageURL := func(n int) string {
+		return base.withQuery("page", strconv.Itoa(n)).withQuery("per_page", strconv.Itoa(meta.PerPage)).String()
+	}
+
+	last := max(meta.TotalPages, 1) // An empty collection still has one (empty) page
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(1))}
+	if meta.Page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(min(meta.Page-1, last))))
+	}
+	if meta.Page < last {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(meta.Page+1)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(last)))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// setOffsetLinkHeader is setLinkHeader for ?limit=/?offset=: the links step
+// the offset by the limit, so an offset of 5 with a limit of 20 is followed
+// by 25, not by page 2's 20
+func setOffsetLinkHeader(w http.ResponseWriter, r *http.Request, meta pageMeta) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	base := apiBaseURL(r).withPath(segments...).withQueries(r.URL.Query())
+	offsetURL := func(n int) string {
+		return base.withQuery("offset", strconv.Itoa(n)).withQuery("limit", strconv.Itoa(meta.PerPage)).String()
+	}
+
+	last := max(meta.TotalPages-1, 0) * meta.PerPage
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, offsetURL(0))}
+	if meta.Offset > 0 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, offsetURL(min(max(meta.Offset-meta.PerPage, 0), last))))
+	}
+	if meta.Offset+meta.PerPage < meta.Total {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, offsetURL(meta.Offset+meta.PerPage)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, offsetURL(last)))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// respondPage writes one page of items with its Link header and envelope
+func respondPage[T any](w http.ResponseWriter, r *http.Request, items []T, p pageParams) {
+	data, meta := paginate(items, p)
+	setLinkHeader(w, r, meta)
+	respondJSON(w, http.StatusOK, pageBody{Data: data, Meta: meta})
+}
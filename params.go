@@ -0,0 +1,78 @@
+// Package main - typed path parameters: pathInt and pathToken, with a 400 for malformed values
+package main
+
+import (
+	"net/http" // For the request
+	"strconv"  // For integer IDs
+)
+
+// Path values are strings, like req.params. Every handler with an {id} used
+// to call strconv.Atoi itself and pick its own message ("invalid user id",
+// "invalid post id") - or, for string IDs, pass whatever came to a map
+// lookup. The helpers here parse once and fail the same way everywhere:
+//
+//	id, err := pathInt(r, "id")
+//	if err != nil {
+//		a.respondError(w, r, err) // 400 {"error":{"code":"invalid_path_param","message":"invalid id \"abc\": must be a positive integer"}}
+//		return
+//	}
+//
+// In Express, router.param('id', ...) or a zod schema for req.params does
+// this job. Opaque IDs here are cryptoutil.RandomToken strings (blobs,
+// operations, sessions) rather than UUIDs, so pathToken checks their
+// alphabet and length the way a UUID parser would check its format.
+
+// maxTokenParam is the longest opaque ID pathToken accepts; cryptoutil.RandomToken(32) is 43 characters
+const maxTokenParam = 64
+
+// paramError is a path parameter that doesn't parse; describeError answers 400
+type paramError struct {
+	Name  string // The wildcard: "id"
+	Value string // What the path had
+	want  string // What it should be, a catalog key: "a positive integer"
+}
+
+// Error implements error
+func (e *paramError) Error() string {
+	return e.text(english)
+}
+
+// text formats the message with t, which may translate it (see i18n.go)
+func (e *paramError) text(t translator) string {
+	return t("invalid %s %q: must be %s", e.Name, e.Value, t(e.want))
+}
+
+// pathInt returns the path parameter name as a positive integer
+// strconv.Atoi is parseInt, except "12abc" is an error instead of 12;
+// IDs start at 1, so 0 and "-3" are malformed rather than missing
+func pathInt(r *http.Request, name string) (int, error) {
+	raw := r.PathValue(name)
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, &paramError{Name: name, Value: raw, want: "a positive integer"}
+	}
+	return n, nil
+}
+
+// pathToken returns the path parameter name as an opaque ID: URL-safe base64
+// characters (A-Z, a-z, 0-9, - and _), at most maxTokenParam of them
+// A well-formed ID that doesn't exist is still the handler's 404
+func pathToken(r *http.Request, name string) (string, error) {
+	raw := r.PathValue(name)
+	if raw == "" || len(raw) > maxTokenParam || !isTokenString(raw) {
+		return "", &paramError{Name: name, Value: raw, want: "an ID of letters, digits, - and _"}
+	}
+	return raw, nil
+}
+
+// isTokenString reports whether s only has characters cryptoutil.RandomToken produces
+func isTokenString(s string) bool {
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
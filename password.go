@@ -0,0 +1,113 @@
+// Package main - password hashing: bcrypt from golang.org/x/crypto
+package main
+
+import (
+	"crypto/pbkdf2"   // For verifying hashes stored before the switch to bcrypt
+	"crypto/sha256"   // The hash behind PBKDF2
+	"crypto/subtle"   // Constant-time hash comparison
+	"encoding/base64" // For decoding old PBKDF2 salts and keys
+	"errors"          // For the password errors
+	"fmt"             // For the length error
+	"strconv"         // For the iteration count of old hashes
+	"strings"         // For splitting old hashes
+	"sync"            // For computing the dummy hash once
+
+	"golang.org/x/crypto/bcrypt" // bcryptjs's Go counterpart
+)
+
+// Passwords are never stored, only a slow, salted hash of them. In Node:
+//
+//	const hash = await bcrypt.hash(password, 12)   // bcryptjs
+//	const ok = await bcrypt.compare(password, hash)
+//
+// and in Go, with golang.org/x/crypto/bcrypt - part of the Go project but a
+// module of its own, like the rest of x/crypto (argon2, scrypt, ssh):
+//
+//	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+//	err = bcrypt.CompareHashAndPassword(hash, []byte(password)) // nil = match
+//
+// Unlike bcryptjs, there's no async variant to await: the call blocks its
+// goroutine only, and the other requests keep running on the others.
+//
+// A bcrypt hash carries its own salt and cost ("$2a$12$<salt><hash>"), so
+// raising bcryptCost later still verifies old hashes. Hashes stored before
+// bcrypt ("pbkdf2-sha256$600000$<salt>$<key>", stdlib crypto/pbkdf2) still
+// verify too; the login that proves one replaces it with bcrypt.
+
+// bcryptCost is the work factor: each step doubles the time (12 ≈ 250ms)
+const bcryptCost = 12
+
+// Password length limits, in bytes
+// bcrypt only reads the first 72 bytes, and GenerateFromPassword refuses
+// longer passwords rather than silently ignoring the rest
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 72
+)
+
+// Password errors; the messages are translated (see locales/)
+var (
+	errPasswordLength     = fmt.Errorf("password must be %d to %d characters", minPasswordLen, maxPasswordLen)
+	errInvalidCredentials = errors.New("invalid email or password")
+	errWrongPassword      = errors.New("current password is incorrect")
+)
+
+// validatePassword checks the rules a new password must meet
+// Length only: NIST SP 800-63B advises against composition rules
+// ("one digit, one symbol"), which make passwords harder to remember, not to guess
+func validatePassword(password string) error {
+	if n := len(password); n < minPasswordLen || n > maxPasswordLen {
+		return errPasswordLength
+	}
+	return nil
+}
+
+// hashPassword returns a bcrypt hash of password at bcryptCost
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return string(hash), err
+}
+
+// checkPassword reports whether password matches hash, bcrypt or old PBKDF2
+func checkPassword(hash, password string) bool {
+	if iterations, salt, want, ok := parsePBKDF2Hash(hash); ok {
+		got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+		return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// passwordNeedsRehash reports whether hash isn't bcrypt at today's cost;
+// the login that just proved the password replaces it
+func passwordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash)) // Fails for PBKDF2 hashes
+	return err != nil || cost < bcryptCost
+}
+
+// parsePBKDF2Hash splits a hash stored before bcrypt into its parts
+func parsePBKDF2Hash(hash string) (iterations int, salt, key []byte, ok bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return 0, nil, nil, false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, nil, nil, false
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	key, err2 := enc.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return 0, nil, nil, false
+	}
+	return iterations, salt, key, true
+}
+
+// dummyPasswordHash is checked when the email is unknown, so a login for a
+// missing account takes as long as one with a wrong password - otherwise
+// response times would reveal which emails are registered
+// sync.OnceValue computes it on first use, not at every startup
+var dummyPasswordHash = sync.OnceValue(func() string {
+	h, _ := hashPassword("not a real password")
+	return h
+})
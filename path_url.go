@@ -0,0 +1,163 @@
+// Package main - Node's path/url modules mapped to Go's path/filepath and net/url
+package main
+
+import (
+	"fmt"           // For printing example output
+	"io"            // For the io.Writer the examples print to
+	"net/http"      // For reading scheme/host from incoming requests
+	"net/url"       // Go's equivalent of Node's url module and WHATWG URL class
+	"path"          // Slash-separated paths (URLs) - like path.posix in Node
+	"path/filepath" // OS-specific file paths - like Node's path module
+	"strings"       // For trimming slashes while joining segments
+)
+
+// Node.js → Go cheat sheet for paths and URLs
+//
+//	path.join('a', 'b')          → filepath.Join("a", "b")   (file paths)
+//	path.posix.join('a', 'b')    → path.Join("a", "b")       (URL paths, always "/")
+//	path.resolve('a')            → filepath.Abs("a")
+//	path.relative(from, to)      → filepath.Rel(from, to)
+//	path.dirname(p)              → filepath.Dir(p)
+//	path.basename(p)             → filepath.Base(p)
+//	path.extname(p)              → filepath.Ext(p)
+//	path.normalize(p)            → filepath.Clean(p)
+//	new URL(str)                 → url.Parse(str)
+//	new URL(rel, base)           → base.ResolveReference(rel)
+//	url.searchParams.get('q')    → u.Query().Get("q")
+//	new URLSearchParams(obj)     → url.Values{...}.Encode()
+//	encodeURIComponent(s)        → url.QueryEscape(s) / url.PathEscape(s)
+
+// init() runs before main() and registers the "path" example
+func init() {
+	registerExample("path", pathURLExamples)
+}
+
+// pathURLExamples prints each Node path/url call next to its Go equivalent
+func pathURLExamples(w io.Writer) {
+	// File paths: filepath uses the OS separator ("\" on Windows, "/" elsewhere)
+	p := filepath.Join("uploads", "avatars", "..", "images", "me.png")
+	fmt.Fprintln(w, "filepath.Join:", p)                // uploads/images/me.png
+	fmt.Fprintln(w, "filepath.Dir:", filepath.Dir(p))   // uploads/images
+	fmt.Fprintln(w, "filepath.Base:", filepath.Base(p)) // me.png
+	fmt.Fprintln(w, "filepath.Ext:", filepath.Ext(p))   // .png
+
+	// filepath.Abs returns an error because it needs the current working directory
+	if abs, err := filepath.Abs(p); err == nil {
+		fmt.Fprintln(w, "filepath.Abs:", abs)
+	}
+
+	// filepath.Rel works out how to get from one path to another
+	if rel, err := filepath.Rel("uploads/avatars", p); err == nil {
+		fmt.Fprintln(w, "filepath.Rel:", rel) // ../images/me.png
+	}
+
+	// URL paths: the path package always uses "/" regardless of OS
+	fmt.Fprintln(w, "path.Join:", path.Join("/api", "users", "42")) // /api/users/42
+
+	// url.Parse is like new URL() but returns an error instead of throwing
+	u, err := url.Parse("https://example.com/users?page=2&sort=name#top")
+	if err != nil {
+		fmt.Fprintln(w, "url.Parse error:", err)
+		return
+	}
+	fmt.Fprintln(w, "Scheme/Host/Path:", u.Scheme, u.Host, u.Path)
+	fmt.Fprintln(w, "Query page:", u.Query().Get("page")) // like url.searchParams.get('page')
+	fmt.Fprintln(w, "Fragment:", u.Fragment)
+
+	// Resolving a relative URL against a base (new URL('../x', base))
+	ref, _ := url.Parse("../posts/7")
+	fmt.Fprintln(w, "ResolveReference:", u.ResolveReference(ref))
+
+	// url.Values is a map[string][]string - Encode() sorts keys and escapes values
+	q := url.Values{}
+	q.Set("name", "Jane Doe & Co")
+	q.Add("tag", "go")
+	q.Add("tag", "node")
+	fmt.Fprintln(w, "Values.Encode:", q.Encode())
+
+	// Escaping: PathEscape for a single path segment, QueryEscape for query values
+	fmt.Fprintln(w, "PathEscape:", url.PathEscape("a b/c"))   // a%20b%2Fc
+	fmt.Fprintln(w, "QueryEscape:", url.QueryEscape("a b/c")) // a+b%2Fc
+
+	// Our helper builds URLs safely without string concatenation
+	link := newURLBuilder("https://example.com/api").
+		withPath("users", "jane doe").
+		withQuery("page", "2").
+		String()
+	fmt.Fprintln(w, "urlBuilder:", link) // https://example.com/api/users/jane%20doe?page=2
+}
+
+// urlBuilder constructs URLs from escaped path segments and query parameters
+// Use it for every link the API emits (resource links, pagination headers)
+// instead of fmt.Sprintf("/users/%d?page=%d", ...) which forgets to escape values
+//
+// Methods use value receivers and return a modified copy, so a base builder
+// can be shared and extended without one caller affecting another
+// (similar to immutable builders in JS: const next = base.withQuery(...))
+type urlBuilder struct {
+	u url.URL // url.URL is a plain struct, so copying the builder copies the URL
+}
+
+// newURLBuilder starts a builder from a base URL such as "https://host/api" or "/api"
+// An unparsable base falls back to an empty (relative) URL rather than failing,
+// since the base normally comes from our own configuration or the request
+func newURLBuilder(base string) urlBuilder {
+	u, err := url.Parse(base)
+	if err != nil {
+		return urlBuilder{}
+	}
+	return urlBuilder{u: *u} // *u dereferences the pointer to copy the struct
+}
+
+// requestBaseURL returns "scheme://host" for the incoming request
+// r.TLS is non-nil when the request arrived over HTTPS
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// withPath appends path segments, escaping each one individually
+// so a segment like "a/b" stays a single segment ("a%2Fb")
+func (b urlBuilder) withPath(segments ...string) urlBuilder {
+	// Start from the existing path without a trailing slash
+	p := strings.TrimSuffix(b.u.Path, "/")
+	rawp := strings.TrimSuffix(b.u.EscapedPath(), "/")
+
+	for _, s := range segments {
+		p += "/" + s
+		rawp += "/" + url.PathEscape(s)
+	}
+
+	// Path holds the decoded form, RawPath the escaped form we want in output
+	b.u.Path = p
+	b.u.RawPath = rawp
+	return b
+}
+
+// withQuery sets a single query parameter, replacing any previous value
+func (b urlBuilder) withQuery(key, value string) urlBuilder {
+	q := b.u.Query() // Query() parses RawQuery into a fresh url.Values
+	q.Set(key, value)
+	b.u.RawQuery = q.Encode()
+	return b
+}
+
+// withQueries merges a set of query parameters (e.g. copied from the current request)
+func (b urlBuilder) withQueries(values url.Values) urlBuilder {
+	q := b.u.Query()
+	for key, vals := range values {
+		// Replace rather than append so repeated calls are predictable
+		q[key] = append([]string(nil), vals...)
+	}
+	b.u.RawQuery = q.Encode()
+	return b
+}
+
+// String renders the final URL - implementing fmt.Stringer
+// means fmt.Println(builder) prints the URL too
+func (b urlBuilder) String() string {
+	return b.u.String()
+}
@@ -0,0 +1,179 @@
+// Package main - posts and tags: two more entities on the generic Repository
+package main
+
+import (
+	"cmp"      // For three-way comparisons in the sort keys
+	"errors"   // For validation errors
+	"net/http" // For handler types and status codes
+	"strconv"  // For IDs in the path
+	"strings"  // For case-insensitive title sorting
+	"time"     // For creation timestamps
+)
+
+// Post is an article written by a user, optionally tagged
+type Post struct {
+	ID        int       `json:"id"`
+	AuthorID  int       `json:"author_id"` // A user in the same tenant
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	TagIDs    []int     `json:"tag_ids"`
+	CreatedAt time.Time `json:"created_at"` // UTC, rendered in the request's zone
+	TenantID  string    `json:"-"`
+}
+
+// EntityID returns the post's ID (see Entity in repository.go)
+func (p Post) EntityID() int { return p.ID }
+
+// WithID returns a copy of the post with a new ID
+func (p Post) WithID(id int) Post {
+	p.ID = id
+	return p
+}
+
+// Tag is a label posts can carry; names are unique within a tenant
+type Tag struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	TenantID string `json:"-"`
+}
+
+// EntityID returns the tag's ID (see Entity in repository.go)
+func (t Tag) EntityID() int { return t.ID }
+
+// WithID returns a copy of the tag with a new ID
+func (t Tag) WithID(id int) Tag {
+	t.ID = id
+	return t
+}
+
+// inTenant returns a filter for Repository.List - one generic function serves
+// every entity type, as long as it can report its tenant
+// The constraint is an interface listing the methods T must have
+func inTenant[T interface{ tenant() string }](tenantID string) func(T) bool {
+	return func(item T) bool { return item.tenant() == tenantID }
+}
+
+// tenant lets inTenant filter posts and tags
+func (p Post) tenant() string { return p.TenantID }
+func (t Tag) tenant() string  { return t.TenantID }
+
+// postSortKeys are the keys GET /posts accepts in ?sort= (see sort.go)
+var postSortKeys = sortKeys[Post]{
+	"id":         {Column: "id", Compare: func(a, b Post) int { return cmp.Compare(a.ID, b.ID) }},
+	"title":      {Column: "title", Compare: func(a, b Post) int { return cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)) }},
+	"author_id":  {Column: "author_id", Compare: func(a, b Post) int { return cmp.Compare(a.AuthorID, b.AuthorID) }},
+	"created_at": {Column: "created_at", Compare: func(a, b Post) int { return a.CreatedAt.Compare(b.CreatedAt) }},
+}
+
+// postListSpec is what GET /posts accepts: ?author_id=3&title[contains]=go&sort=title (see query.go)
+var postListSpec = listSpec[Post]{
+	Filters: filterFields[Post]{
+		"id":         intField("id", func(p Post) int { return p.ID }),
+		"author_id":  intField("author_id", func(p Post) int { return p.AuthorID }),
+		"title":      stringField("title", func(p Post) string { return p.Title }),
+		"created_at": timeField("created_at", func(p Post) time.Time { return p.CreatedAt }),
+	},
+	Sort:        postSortKeys,
+	DefaultSort: "-created_at", // Newest first unless asked otherwise
+}
+
+// listPostsHandler returns a page of the tenant's posts (GET /posts?page=2)
+func (a *api) listPostsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r, postListSpec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	posts, meta := postListSpec.apply(a.posts.List(inTenant[Post](tenantFromContext(r.Context()))), q)
+	for i := range posts {
+		posts[i].CreatedAt = posts[i].CreatedAt.In(locationFromContext(r.Context()))
+	}
+	setLinkHeader(w, r, meta)
+	respondJSON(w, http.StatusOK, pageBody{Data: posts, Meta: meta})
+}
+
+// getPostHandler returns one post (GET /posts/{id})
+func (a *api) getPostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathInt(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	p, err := a.posts.Get(id)
+	if err != nil || p.TenantID != tenantFromContext(r.Context()) {
+		writeJSONError(w, http.StatusNotFound, "post not found")
+		return
+	}
+	p.CreatedAt = p.CreatedAt.In(locationFromContext(r.Context()))
+	respondJSON(w, http.StatusOK, p)
+}
+
+// createPostHandler stores a post (POST /posts)
+func (a *api) createPostHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[Post](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	p := Post{
+		AuthorID:  payload.AuthorID,
+		Title:     payload.Title,
+		Body:      payload.Body,
+		TagIDs:    payload.TagIDs,
+		CreatedAt: time.Now().UTC(),
+		TenantID:  tenantFromContext(r.Context()), // Never trust a tenant from the body
+	}
+	if p.TagIDs == nil {
+		p.TagIDs = []int{} // [] instead of null in the response
+	}
+	if err := a.validatePost(r, p); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p = a.posts.Create(p)
+	respondJSON(w, http.StatusCreated, p)
+}
+
+// validatePost checks the title and that author and tags exist in p's tenant
+func (a *api) validatePost(r *http.Request, p Post) error {
+	if p.Title == "" {
+		return errors.New("title is required")
+	}
+	if _, err := a.users.Get(r.Context(), p.TenantID, p.AuthorID); err != nil {
+		return errors.New("author_id must be an existing user")
+	}
+	for _, id := range p.TagIDs {
+		if t, err := a.tags.Get(id); err != nil || t.TenantID != p.TenantID {
+			return errors.New("tag " + strconv.Itoa(id) + " does not exist")
+		}
+	}
+	return nil
+}
+
+// listTagsHandler returns the tenant's tags (GET /tags)
+func (a *api) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, a.tags.List(inTenant[Tag](tenantFromContext(r.Context()))))
+}
+
+// createTagHandler stores a tag (POST /tags)
+func (a *api) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[Tag](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t := Tag{Name: payload.Name, TenantID: tenantFromContext(r.Context())}
+	if t.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	sameName := func(other Tag) bool { return other.TenantID == t.TenantID && other.Name == t.Name }
+	if len(a.tags.List(sameName)) > 0 {
+		writeJSONError(w, http.StatusConflict, "tag already exists")
+		return
+	}
+
+	t = a.tags.Create(t)
+	respondJSON(w, http.StatusCreated, t)
+}
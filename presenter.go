@@ -0,0 +1,183 @@
+// Package main - presenters: turning stored entities into API responses
+package main
+
+import (
+	"cmp"           // cmp.Or picks the UUID for links when there is one
+	"encoding/json" // For field selection
+	"errors"        // For the unknown-field error
+	"fmt"           // For wrapping errUnknownField with details
+	"net/http"      // For reading the request and writing responses
+	"slices"        // For checking ?fields= against the allowlist
+	"strconv"       // For IDs in URLs
+	"strings"       // For parsing ?fields=
+	"time"          // For the timestamp fields
+)
+
+// Handlers used to json.Encode the User struct straight from the store, so
+// every storage detail was one missing `json:"-"` away from leaking and
+// every response-only field (URLs, links) had nowhere to live. A presenter
+// maps entity → DTO ("data transfer object") in one place, like a
+// serializer / toJSON() / class-transformer in Node:
+//
+//	store (User) ──presentUser──► userResponse ──?fields=──► JSON
+
+// link is one HATEOAS link: where a related action or resource lives
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"` // Omitted for GET
+}
+
+// userResponse is the public shape of a user
+type userResponse struct {
+	ID             int             `json:"id"`
+	UUID           string          `json:"uuid,omitempty"` // With -user-ids=uuid; links use it instead of the number
+	Name           string          `json:"name"`
+	Email          string          `json:"email"`
+	Role           string          `json:"role"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	AvatarURL      string          `json:"avatar_url,omitempty"`       // Computed from the avatar blob ID
+	AvatarThumbURL string          `json:"avatar_thumb_url,omitempty"` // Computed from the thumbnail blob ID
+	Links          map[string]link `json:"_links"`
+}
+
+// userFields are the names ?fields= accepts for users
+var userFields = []string{"id", "uuid", "name", "email", "role", "created_at", "updated_at", "avatar_url", "avatar_thumb_url", "_links"}
+
+// errUnknownField is returned for ?fields= entries that don't exist
+var errUnknownField = errors.New("unknown field")
+
+// apiBaseURL is where this API is mounted, e.g. "http://localhost:8080" or,
+// in SPA mode, "http://localhost:8080/api" - http.StripPrefix removes /api
+// from r.URL.Path but leaves r.RequestURI alone, so the difference is the prefix
+func apiBaseURL(r *http.Request) urlBuilder {
+	return newURLBuilder(requestBaseURL(r) + mountPrefix(r)) // "/api" in SPA mode (see normalize.go)
+}
+
+// presentUser converts a stored user into its response form:
+// timestamps in the request's zone, blob IDs as URLs, links for what comes next
+func presentUser(r *http.Request, u User) userResponse {
+	u = localUser(r, u) // ?tz= / X-Timezone (see timezone.go)
+	base := apiBaseURL(r)
+	self := base.withPath("users", cmp.Or(u.UUID, strconv.Itoa(u.ID))) // Either works in the path (see ids.go)
+
+	resp := userResponse{
+		ID:        u.ID,
+		UUID:      u.UUID,
+		Name:      u.Name,
+		Email:     u.Email,
+		Role:      roleOf(u), // Users from before roles existed have none stored
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Links: map[string]link{
+			"self":     {Href: self.String()},
+			"avatar":   {Href: self.withPath("avatar").String(), Method: http.MethodPut},
+			"settings": {Href: self.withPath("settings").String()},
+			"activity": {Href: self.withPath("activity").String()},
+		},
+	}
+	if u.AvatarID != "" {
+		resp.AvatarURL = fileURL(base, u.AvatarID)
+		resp.AvatarThumbURL = fileURL(base, u.AvatarThumbID)
+	}
+	return resp
+}
+
+// presentUsers converts a list; the result is never nil, so JSON shows [] not null
+func presentUsers(r *http.Request, users []User) []userResponse {
+	out := make([]userResponse, 0, len(users))
+	for _, u := range users {
+		out = append(out, presentUser(r, u))
+	}
+	return out
+}
+
+// fileURL is the inline download URL of a blob (see files.go)
+func fileURL(base urlBuilder, blobID string) string {
+	return base.withPath("files", blobID, "download").withQuery("inline", "1").String()
+}
+
+// parseFields reads ?fields=id,name and checks every name against allowed
+// No parameter means "all fields" (nil)
+func parseFields(r *http.Request, allowed []string) ([]string, error) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if !slices.Contains(allowed, f) {
+			// %w wraps the sentinel so callers can still errors.Is(err, errUnknownField)
+			return nil, fmt.Errorf("%w %q (allowed: %s)", errUnknownField, f, strings.Join(allowed, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// selectFields keeps only the named JSON fields of v, an object or a list of
+// objects (everything when fields is nil)
+// Going through JSON means the field names are exactly the ones clients see
+func selectFields(v any, fields []string) (any, error) {
+	if fields == nil {
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// RawMessage keeps each value as encoded JSON, so nothing is decoded twice
+	if len(data) > 0 && data[0] == '[' {
+		var items []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		out := make([]map[string]json.RawMessage, len(items))
+		for i, item := range items {
+			out[i] = pickFields(item, fields)
+		}
+		return out, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return pickFields(obj, fields), nil
+}
+
+// pickFields copies the named keys of one object
+func pickFields(obj map[string]json.RawMessage, fields []string) map[string]json.RawMessage {
+	picked := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if val, ok := obj[f]; ok {
+			picked[f] = val
+		}
+	}
+	return picked
+}
+
+// respondPresented writes a presented body (one DTO, a list or a page of
+// them, see pagination.go), applying ?fields=
+func respondPresented(w http.ResponseWriter, r *http.Request, status int, allowed []string, body any) {
+	fields, err := parseFields(r, allowed)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var out any
+	// A type assertion with ", ok": is body a pageBody? Then select inside
+	// "data" and leave the pagination metadata alone
+	if page, ok := body.(pageBody); ok {
+		page.Data, err = selectFields(page.Data, fields)
+		out = page
+	} else {
+		out, err = selectFields(body, fields)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, status, out)
+}
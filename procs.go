@@ -0,0 +1,161 @@
+// Package main - GOMAXPROCS tuning and a Node cluster vs Go scheduler comparison
+package main
+
+import (
+	"crypto/sha256" // CPU-bound work for the scaling benchmark
+	"fmt"           // For printing benchmark output
+	"io"            // For the io.Writer the examples print to
+	"math"          // For rounding CPU quotas up
+	"net/http"      // For the handler signature
+	"os"            // For reading cgroup files and the GOMAXPROCS env var
+	"runtime"       // GOMAXPROCS, NumCPU, NumGoroutine
+	"strconv"       // For parsing cgroup numbers
+	"strings"       // For splitting cgroup file contents
+	"sync"          // WaitGroup to wait for benchmark workers
+	"time"          // For timing benchmark runs
+)
+
+// Node cluster vs the Go scheduler
+//
+// Node runs your JavaScript on ONE thread. To use 8 cores you start 8
+// processes with the cluster module (or pm2), each with its own memory,
+// and the primary process hands incoming connections to the workers:
+//
+//	if (cluster.isPrimary) { for (let i = 0; i < os.cpus().length; i++) cluster.fork() }
+//	else { http.createServer(app).listen(8080) }
+//
+// Go needs none of that. net/http starts a goroutine per connection and the
+// runtime scheduler multiplexes goroutines onto GOMAXPROCS OS threads
+// (default: the number of CPUs). One process, shared memory, all cores.
+// The trade-off: shared memory means shared state needs locks (see blobStore).
+//
+// In containers the CPU *quota* (docker --cpus=2) is often far lower than the
+// number of CPUs the kernel reports. Running 64 threads against a 2-CPU quota
+// causes throttling, so we cap GOMAXPROCS to the cgroup limit at startup -
+// the same idea as the uber-go/automaxprocs package.
+
+// procsReport describes how GOMAXPROCS was chosen
+type procsReport struct {
+	GOMAXPROCS int    `json:"gomaxprocs"` // Threads executing Go code simultaneously
+	NumCPU     int    `json:"num_cpu"`    // CPUs visible to the process
+	Source     string `json:"source"`     // "env", "cgroup" or "default"
+}
+
+// init() registers the "scaling" benchmark with the -example flag runner
+func init() {
+	registerExample("scaling", scalingBenchmark)
+}
+
+// applyCPUQuota caps GOMAXPROCS to the container CPU quota when one is set
+// An explicit GOMAXPROCS environment variable always wins
+func applyCPUQuota() procsReport {
+	report := procsReport{NumCPU: runtime.NumCPU(), Source: "default"}
+
+	if os.Getenv("GOMAXPROCS") != "" {
+		// The runtime already applied the env var before main() ran
+		report.Source = "env"
+	} else if quota, ok := cgroupCPUQuota(); ok {
+		// Round up: a 1.5 CPU quota still benefits from 2 threads
+		procs := int(math.Ceil(quota))
+		if procs < 1 {
+			procs = 1
+		}
+		// runtime.GOMAXPROCS(n) sets the value and returns the previous one
+		if procs < runtime.GOMAXPROCS(0) {
+			runtime.GOMAXPROCS(procs)
+		}
+		report.Source = "cgroup"
+	}
+
+	// Passing 0 reads the current value without changing it
+	report.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	return report
+}
+
+// cgroupCPUQuota returns the CPU limit in cores, checking cgroup v2 then v1
+// ok is false when no limit is configured (or we're not in a cgroup)
+func cgroupCPUQuota() (float64, bool) {
+	// cgroup v2: a single file containing "<quota> <period>" or "max <period>"
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 && fields[0] != "max" {
+			return parseQuota(fields[0], fields[1])
+		}
+		return 0, false
+	}
+
+	// cgroup v1: quota and period live in separate files; -1 means unlimited
+	quota, err1 := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	period, err2 := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// parseQuota divides a cgroup quota by its period to get a number of cores
+func parseQuota(quotaStr, periodStr string) (float64, bool) {
+	quota, err := strconv.ParseFloat(quotaStr, 64)
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(periodStr, 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return quota / period, true
+}
+
+// runtimeHandler exposes scheduler settings - useful when checking a deployment
+func (a *api) runtimeHandler(w http.ResponseWriter, r *http.Request) {
+	// An anonymous struct is handy for one-off JSON shapes
+	resp := struct {
+		procsReport         // Embedded struct: its fields appear at the top level in JSON
+		NumGoroutine int    `json:"num_goroutine"`
+		GoVersion    string `json:"go_version"`
+	}{
+		procsReport:  a.procs,
+		NumGoroutine: runtime.NumGoroutine(),
+		GoVersion:    runtime.Version(),
+	}
+	// GOMAXPROCS can be changed at runtime, so report the live value
+	resp.GOMAXPROCS = runtime.GOMAXPROCS(0)
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// scalingBenchmark runs the same CPU-bound workload with GOMAXPROCS = 1..N
+// go run . -example=scaling
+// With Node you'd have to fork N cluster workers to see the same speedup
+func scalingBenchmark(w io.Writer) {
+	const jobs = 64       // Total independent pieces of work
+	const rounds = 20_000 // SHA-256 rounds per job (underscores aid readability)
+	original := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(original) // Restore the setting when we're done
+
+	var baseline time.Duration
+	for procs := 1; procs <= runtime.NumCPU(); procs *= 2 {
+		runtime.GOMAXPROCS(procs)
+
+		start := time.Now()
+		var wg sync.WaitGroup // WaitGroup is like Promise.all for goroutines
+		for i := 0; i < jobs; i++ {
+			wg.Add(1)
+			go func(seed int) { // The go keyword starts a goroutine
+				defer wg.Done()
+				sum := sha256.Sum256([]byte(strconv.Itoa(seed)))
+				for j := 0; j < rounds; j++ {
+					sum = sha256.Sum256(sum[:])
+				}
+			}(i)
+		}
+		wg.Wait()
+		elapsed := time.Since(start)
+
+		if procs == 1 {
+			baseline = elapsed
+		}
+		fmt.Fprintf(w, "GOMAXPROCS=%-3d %10v  speedup x%.2f\n",
+			procs, elapsed.Round(time.Millisecond), float64(baseline)/float64(elapsed))
+	}
+}
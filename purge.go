@@ -0,0 +1,88 @@
+// Package main - permanently removing soft-deleted users after a retention period
+package main
+
+import (
+	"context"  // For the scheduling loop and service calls
+	"expvar"   // For purge metrics on /debug/vars
+	"log/slog" // For the audit records
+	"net/http" // For the admin handler
+	"sync"     // For running one purge at a time
+	"time"     // For the retention period and schedule
+)
+
+// DELETE /users/{id} only marks a user as deleted (see store.go): the record
+// stays for the retention period, so support can still answer "what happened
+// to this account?" and an accidental delete can be investigated. After that
+// the data has to go for real - privacy rules like the GDPR don't accept
+// "deleted" data kept forever. The purger does that on a schedule
+// (-purge-interval), and POST /admin/purge runs it on demand, e.g. right
+// after shortening the retention. In Node this would be a node-cron job.
+
+// purgeMetrics are published on /debug/vars under "purge"
+var purgeMetrics = expvar.NewMap("purge")
+
+// purgeReport is the result of one run, returned by POST /admin/purge
+type purgeReport struct {
+	Trigger       string    `json:"trigger"`        // "schedule" or "admin"
+	DeletedBefore time.Time `json:"deleted_before"` // Users deleted before this were purged
+	Purged        int       `json:"purged"`
+	Retention     string    `json:"retention"`
+}
+
+// purger removes soft-deleted users once they are older than retention
+type purger struct {
+	users     UserService
+	retention time.Duration
+	logger    *slog.Logger
+	mu        sync.Mutex // A scheduled run and an admin run never overlap
+}
+
+// newPurger creates a purger; nothing runs until watch or run is called
+func newPurger(users UserService, retention time.Duration, logger *slog.Logger) *purger {
+	return &purger{users: users, retention: retention, logger: logger}
+}
+
+// run purges once and writes one audit record per removed user
+// The audit line keeps what an auditor needs (who, which tenant, when it was
+// deleted and purged) and nothing personal - no name, no email
+func (p *purger) run(ctx context.Context, trigger string) purgeReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now().UTC()
+	report := purgeReport{Trigger: trigger, DeletedBefore: now.Add(-p.retention), Retention: p.retention.String()}
+	purged := p.users.Purge(ctx, report.DeletedBefore)
+	for _, u := range purged {
+		p.logger.InfoContext(ctx, "audit: purged user",
+			"user_id", u.ID, "user_tenant", u.TenantID, "deleted_at", u.DeletedAt.Format(time.RFC3339), "trigger", trigger)
+	}
+	report.Purged = len(purged)
+
+	purgeMetrics.Add("runs", 1)
+	purgeMetrics.Add("users_purged", int64(len(purged)))
+	last := new(expvar.String)
+	last.Set(now.Format(time.RFC3339))
+	purgeMetrics.Set("last_run", last)
+	return report
+}
+
+// watch runs the purge every interval until ctx is cancelled
+func (p *purger) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if report := p.run(ctx, "schedule"); report.Purged > 0 {
+				p.logger.Info("purge", "removed", report.Purged, "deleted_before", report.DeletedBefore.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// purgeHandler runs a purge now and reports what it removed (POST /admin/purge)
+func (a *api) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, a.purger.run(r.Context(), "admin"))
+}
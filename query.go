@@ -0,0 +1,344 @@
+// Package main - ?name[contains]=ada&created_at[gte]=2024-01-01: one list query spec for every store
+package main
+
+import (
+	"cmp"      // For comparing ints and strings
+	"fmt"      // For error messages and the example
+	"io"       // For the example's output
+	"maps"     // For iterating query keys in order
+	"net/http" // For the request and status codes
+	"slices"   // For filtering and sorted keys
+	"strconv"  // For int fields
+	"strings"  // For parsing keys and building SQL
+	"time"     // For time fields
+)
+
+// Every list endpoint used to read ?page= and ?sort= itself, then filter,
+// sort and paginate a slice in its own way. A listQuery is parsed from the
+// URL once, checked against the resource's listSpec, and then handed to the
+// store, which interprets it however it stores data: apply filters a slice
+// in memory, sql turns the same query into WHERE / ORDER BY / LIMIT for a
+// database. Handlers no longer care which one runs.
+//
+// Filters use the bracket syntax Express's qs parser made familiar:
+//
+//	?name=Ada                 name equals "Ada"
+//	?email[contains]=example  case-insensitive substring
+//	?created_at[gte]=2024-03-01&created_at[lt]=2024-04-01  a range
+//
+// Several filters are combined with AND. Keys that aren't filters of the
+// resource (page, fields, tz...) are left to the rest of the handler.
+
+// init() registers the "query" example
+func init() {
+	registerExample("query", queryExamples)
+}
+
+// filterOp is a comparison in a filter
+type filterOp string
+
+const (
+	opEq       filterOp = "eq" // The default: ?name=Ada is name[eq]=Ada
+	opNe       filterOp = "ne"
+	opLt       filterOp = "lt"
+	opLte      filterOp = "lte"
+	opGt       filterOp = "gt"
+	opGte      filterOp = "gte"
+	opContains filterOp = "contains"
+)
+
+// sqlOperators maps the ordering operators to SQL
+var sqlOperators = map[filterOp]string{opEq: "=", opNe: "<>", opLt: "<", opLte: "<=", opGt: ">", opGte: ">="}
+
+// Which operators each kind of field accepts
+var (
+	orderedOps = []filterOp{opEq, opNe, opLt, opLte, opGt, opGte}
+	stringOps  = []filterOp{opEq, opNe, opContains}
+)
+
+// filterField is one filterable field of a resource
+// Build it with stringField, intField or timeField - they fill in the
+// unexported funcs, so a field can only be compared as the type it really has
+type filterField[T any] struct {
+	Column string     // Column name for SQL backends
+	ops    []filterOp // Operators the field accepts
+	// parse turns the query string value into the field's type; loc is the
+	// request's time zone, for dates without an offset
+	parse func(raw string, loc *time.Location) (any, error)
+	test  func(item T, op filterOp, v any) bool // In-memory comparison
+}
+
+// filterFields is a resource's allowlist of filters: query name → field
+type filterFields[T any] map[string]filterField[T]
+
+// stringField filters on a string; contains ignores case
+func stringField[T any](column string, get func(T) string) filterField[T] {
+	return filterField[T]{
+		Column: column,
+		ops:    stringOps,
+		parse:  func(raw string, _ *time.Location) (any, error) { return raw, nil },
+		test: func(item T, op filterOp, v any) bool {
+			if op == opContains {
+				return strings.Contains(strings.ToLower(get(item)), strings.ToLower(v.(string)))
+			}
+			return opHolds(op, cmp.Compare(get(item), v.(string)))
+		},
+	}
+}
+
+// normalizedField filters on a string that is stored normalized, like
+// emails (see normalizeEmail): the value from the URL goes through the same
+// normalize first, so ?email=Ada@Example.com finds ada@example.com in every store
+func normalizedField[T any](column string, get func(T) string, normalize func(string) string) filterField[T] {
+	f := stringField(column, get)
+	f.parse = func(raw string, _ *time.Location) (any, error) { return normalize(raw), nil }
+	return f
+}
+
+// intField filters on an integer
+func intField[T any](column string, get func(T) int) filterField[T] {
+	return filterField[T]{
+		Column: column,
+		ops:    orderedOps,
+		parse: func(raw string, _ *time.Location) (any, error) {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number", raw)
+			}
+			return n, nil
+		},
+		test: func(item T, op filterOp, v any) bool { return opHolds(op, cmp.Compare(get(item), v.(int))) },
+	}
+}
+
+// timeField filters on a timestamp; values are RFC 3339 or a plain date
+// (2024-03-31), which means midnight in the request's zone (see timezone.go)
+func timeField[T any](column string, get func(T) time.Time) filterField[T] {
+	return filterField[T]{
+		Column: column,
+		ops:    orderedOps,
+		parse: func(raw string, loc *time.Location) (any, error) {
+			if t, err := time.Parse(time.RFC3339, raw); err == nil {
+				return t, nil
+			}
+			if t, err := time.ParseInLocation(time.DateOnly, raw, loc); err == nil {
+				return t, nil
+			}
+			return nil, fmt.Errorf("%q is not a date (use 2024-03-31 or RFC 3339)", raw)
+		},
+		test: func(item T, op filterOp, v any) bool { return opHolds(op, get(item).Compare(v.(time.Time))) },
+	}
+}
+
+// opHolds applies an ordering operator to the result of a three-way comparison
+func opHolds(op filterOp, c int) bool {
+	switch op {
+	case opEq:
+		return c == 0
+	case opNe:
+		return c != 0
+	case opLt:
+		return c < 0
+	case opLte:
+		return c <= 0
+	case opGt:
+		return c > 0
+	case opGte:
+		return c >= 0
+	}
+	return false
+}
+
+// listSpec describes how a resource's list endpoint can be queried
+type listSpec[T any] struct {
+	Filters     filterFields[T]
+	Sort        sortKeys[T] // See sort.go
+	DefaultSort string      // Used when ?sort= is missing
+	ID          func(T) int // What a ?cursor= points past; nil = no cursors (see cursor.go)
+}
+
+// filterCond is one parsed filter; Value already has the field's type
+type filterCond struct {
+	Field string
+	Op    filterOp
+	Value any
+}
+
+// listQuery is a parsed, validated list request - the store-agnostic part
+// of GET /users?... that every backend can interpret
+type listQuery struct {
+	Filters []filterCond
+	Sort    []sortField
+	Page    pageParams
+}
+
+// parseListQuery reads filters, ?sort= and ?page=/?per_page= from r and
+// checks them against spec; every mistake is a 400 requestError
+func parseListQuery[T any](r *http.Request, spec listSpec[T]) (listQuery, error) {
+	var q listQuery
+	var err error
+	if q.Page, err = parsePage(r); err != nil {
+		return q, err
+	}
+	if q.Sort, err = parseSort(r, spec.Sort, spec.DefaultSort); err != nil {
+		return q, err
+	}
+	if err = parseCursor(r, spec, &q); err != nil {
+		return q, err
+	}
+
+	loc := locationFromContext(r.Context())
+	values := r.URL.Query()
+	// Sorted, so the conditions (and the generated SQL) don't change order between runs
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		name, op := key, opEq
+		if before, after, ok := strings.Cut(key, "["); ok && strings.HasSuffix(after, "]") {
+			name, op = before, filterOp(strings.TrimSuffix(after, "]"))
+		}
+		field, ok := spec.Filters[name]
+		if !ok {
+			if name != key {
+				// created_at[gte] is clearly meant as a filter, so don't ignore it silently
+				return q, badQuery("cannot filter by %q (allowed: %s)", name, strings.Join(slices.Sorted(maps.Keys(spec.Filters)), ", "))
+			}
+			continue // Some other parameter (page, fields, tz...)
+		}
+		if !slices.Contains(field.ops, op) {
+			return q, badQuery("%s does not support [%s] (allowed: %s)", name, op, joinOps(field.ops))
+		}
+		for _, raw := range values[key] { // ?name[ne]=a&name[ne]=b - both must hold
+			v, err := field.parse(raw, loc)
+			if err != nil {
+				return q, badQuery("%s: %v", key, err)
+			}
+			q.Filters = append(q.Filters, filterCond{Field: name, Op: op, Value: v})
+		}
+	}
+	return q, nil
+}
+
+// badQuery builds the 400 for a malformed list query
+func badQuery(format string, args ...any) error {
+	return &requestError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// joinOps lists operators for error messages
+func joinOps(ops []filterOp) string {
+	names := make([]string, len(ops))
+	for i, op := range ops {
+		names[i] = string(op)
+	}
+	return strings.Join(names, ", ")
+}
+
+// apply is the in-memory interpretation: filter, sort, then cut out the page
+// items is modified in place - pass a slice the caller owns (Repository.List
+// and UserService.List return fresh ones)
+func (s listSpec[T]) apply(items []T, q listQuery) ([]T, pageMeta) {
+	items = slices.DeleteFunc(items, func(item T) bool { return !s.matches(item, q.Filters) })
+	total := len(items) // Every match, the ones before a cursor included
+	if q.Page.byCursor {
+		items = slices.DeleteFunc(items, func(item T) bool { return !s.pastCursor(item, q) })
+	}
+	sortItems(items, q.Sort, s.Sort) // Sort before paginating, or pages overlap
+	page, _ := paginate(items, q.Page)
+	meta := q.Page.meta(total)
+	meta.NextCursor = s.nextCursor(page, q.Page.Offset+len(page) < len(items), q)
+	return page, meta
+}
+
+// matches reports whether item passes every filter
+func (s listSpec[T]) matches(item T, filters []filterCond) bool {
+	for _, f := range filters {
+		if !s.Filters[f.Field].test(item, f.Op, f.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sqlCond is a condition a store adds on its own, e.g. {"tenant_id = ?", tenantID}
+type sqlCond struct {
+	Expr string
+	Arg  any
+}
+
+// sql is the database interpretation of the same query:
+//
+//	SELECT * FROM users WHERE tenant_id = ? AND LOWER(email) LIKE ? ESCAPE '\' ORDER BY name ASC, id ASC LIMIT ? OFFSET ?
+//
+// Values are always ? placeholders in args (Postgres drivers want $1, $2...);
+// only Column names from the allowlists are written into the statement, so
+// nothing the client sends ends up in the SQL text. scope comes first, so a
+// tenant condition can't be bypassed. The total for pageMeta is a second
+// query with the same WHERE: SELECT COUNT(*) (see sqlStore.Query)
+func (s listSpec[T]) sql(table string, q listQuery, scope ...sqlCond) (string, []any) {
+	if c, ok := s.cursorCond(q); ok {
+		scope = append(scope, c)
+	}
+	where, args := s.where(q, scope...)
+	stmt := "SELECT * FROM " + table + where + " " + orderByClause(q.Sort, s.Sort) + " LIMIT ? OFFSET ?"
+	return stmt, append(args, q.Page.PerPage, q.Page.Offset)
+}
+
+// where is the WHERE clause of sql, with a leading space, and its args;
+// empty without filters or scope
+func (s listSpec[T]) where(q listQuery, scope ...sqlCond) (string, []any) {
+	var conds []string
+	var args []any
+	for _, c := range scope {
+		conds = append(conds, c.Expr)
+		args = append(args, c.Arg)
+	}
+	for _, f := range q.Filters {
+		column := s.Filters[f.Field].Column
+		if f.Op == opContains {
+			// LIKE treats % and _ as wildcards; escape them in the user's text
+			escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(f.Value.(string)))
+			conds = append(conds, "LOWER("+column+`) LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escaped+"%")
+			continue
+		}
+		conds = append(conds, column+" "+sqlOperators[f.Op]+" ?")
+		args = append(args, f.Value)
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// queryExamples parses one URL and runs it against a slice and as SQL
+func queryExamples(w io.Writer) {
+	day := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	users := []User{
+		{ID: 1, Name: "Ada", Email: "ada@example.com", CreatedAt: day},
+		{ID: 2, Name: "Grace", Email: "grace@example.org", CreatedAt: day.AddDate(0, 0, 1)},
+		{ID: 3, Name: "Linus", Email: "linus@example.com", CreatedAt: day.AddDate(0, 0, 2)},
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/users?email[contains]=.COM&created_at[gte]=2024-04-01&sort=-name", nil)
+	q, err := parseListQuery(r, userListSpec)
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+		return
+	}
+	fmt.Fprintf(w, "filters: %+v\n", q.Filters)
+
+	page, meta := userListSpec.apply(users, q)
+	for _, u := range page {
+		fmt.Fprintf(w, "  in memory: %d %s\n", u.ID, u.Email) // 3 linus@example.com
+	}
+	fmt.Fprintf(w, "  meta: %+v\n", meta)
+
+	stmt, args := userListSpec.sql("users", q, sqlCond{"tenant_id = ?", defaultTenantID})
+	fmt.Fprintln(w, "SQL: ", stmt)
+	fmt.Fprintln(w, "args:", args)
+
+	for _, bad := range []string{"/users?password[eq]=x", "/users?name[gt]=A", "/users?id=one"} {
+		r, _ = http.NewRequest(http.MethodGet, bad, nil)
+		_, err = parseListQuery(r, userListSpec)
+		fmt.Fprintf(w, "%s → %v\n", bad, err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package main - quotas: users per tenant and requests per day per API key
+package main
+
+import (
+	"context"  // Counters and the store take the request's context
+	"log/slog" // For counters that fail
+	"net/http" // For the middleware
+	"strconv"  // For the quota headers
+	"sync"     // For the in-memory counter's mutex
+	"time"     // For days and resets
+)
+
+// Rate limits (see rateLimit in express_middleware.go) protect the server
+// from bursts; quotas are what a plan includes. Two of them:
+//
+//   - Users per tenant (-max-users-per-tenant, or "max_users" on the
+//     tenant): creating one more is 402 Payment Required - it's the plan,
+//     not the moment, that has to change
+//   - Requests per UTC day per API key (-api-key-daily-quota): the
+//     request after the last one is 429 until midnight UTC, with Retry-After
+//
+// Both answer with the usual error body plus what ran out:
+//
+//	{"error": {"code": "quota_exceeded", "message": "quota users_per_tenant exceeded: the limit is 50"},
+//	 "quota": {"name": "users_per_tenant", "limit": 50, "used": 50}}
+//
+// Every API key response also carries X-Quota-Limit, X-Quota-Remaining and
+// X-Quota-Reset, like the X-RateLimit-* headers. The daily counts live
+// where the users do: in memory, or in the quota_usage table of a SQL store,
+// so a restart or a second replica doesn't hand out a fresh day's worth.
+// In Node this is usually an INCR on a Redis key that expires at midnight.
+
+// Quota names, in errors and in the "quota" field
+const (
+	quotaUsersPerTenant = "users_per_tenant"
+	quotaRequestsPerDay = "requests_per_day"
+)
+
+// quotaError is a quota that ran out; describeError answers 402 for a
+// quota without a reset and 429 for one that resets (see errors.go)
+type quotaError struct {
+	Name  string    `json:"name"`
+	Limit int       `json:"limit"`
+	Used  int       `json:"used"`
+	Reset time.Time `json:"reset,omitzero"` // Zero: only a bigger plan helps
+}
+
+// Error implements error
+func (e *quotaError) Error() string {
+	return e.text(english)
+}
+
+// text formats the message with t, which may translate it (see i18n.go)
+func (e *quotaError) text(t translator) string {
+	return t("quota %s exceeded: the limit is %d", e.Name, e.Limit)
+}
+
+// status is 402 for a plan limit, 429 for usage that resets
+func (e *quotaError) status() int {
+	if e.Reset.IsZero() {
+		return http.StatusPaymentRequired
+	}
+	return http.StatusTooManyRequests
+}
+
+// quotaBody is an error response for a quota: errorBody plus the quota
+type quotaBody struct {
+	errorBody
+	Quota *quotaError `json:"quota"`
+}
+
+// quotaStore decorates a UserStore with the users-per-tenant quota (see storemetrics.go for decorators)
+// The count and the insert aren't one transaction, so two creates at the
+// same moment can both pass at limit-1; a quota may be off by the odd user,
+// which is why it isn't a unique index
+type quotaStore struct {
+	UserStore
+	limit func(tenantID string) int // 0 = no limit
+}
+
+// newQuotaStore wraps next with the users-per-tenant quota
+func newQuotaStore(next UserStore, limit func(tenantID string) int) *quotaStore {
+	return &quotaStore{UserStore: next, limit: limit}
+}
+
+// countQuery asks for one user, for the total that comes with it: a
+// COUNT(*) in SQL instead of loading every user of the tenant
+var countQuery = listQuery{Sort: []sortField{{Key: tiebreakerKey}}, Page: pageParams{Page: 1, PerPage: 1}}
+
+// Create refuses a user the tenant's quota has no room for
+// Soft-deleted users don't count: they are on their way out (see purge.go)
+func (s *quotaStore) Create(ctx context.Context, u User) (User, error) {
+	if limit := s.limit(u.TenantID); limit > 0 {
+		_, meta, err := s.UserStore.Query(ctx, u.TenantID, countQuery)
+		if err != nil {
+			return User{}, err
+		}
+		if meta.Total >= limit {
+			return User{}, &quotaError{Name: quotaUsersPerTenant, Limit: limit, Used: meta.Total}
+		}
+	}
+	return s.UserStore.Create(ctx, u)
+}
+
+// usageCounter adds one to key's count for day and returns the new count
+type usageCounter func(ctx context.Context, key, day string) (int, error)
+
+// memoryUsage counts in a map that only ever holds one day
+type memoryUsage struct {
+	mu     sync.Mutex
+	day    string
+	counts map[string]int
+}
+
+// newMemoryUsage creates an empty counter
+func newMemoryUsage() *memoryUsage {
+	return &memoryUsage{counts: map[string]int{}}
+}
+
+// count implements usageCounter; a new day starts every count over
+func (m *memoryUsage) count(ctx context.Context, key, day string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if day != m.day {
+		m.day, m.counts = day, map[string]int{}
+	}
+	m.counts[key]++
+	return m.counts[key], nil
+}
+
+// countUsage implements usageCounter on the quota_usage table (migration 8)
+// One statement adds the row or bumps it and returns the count, so two
+// replicas counting at once can't both read the same number (ON CONFLICT
+// works in SQLite 3.24+ and PostgreSQL). Yesterday's rows are dropped as
+// today's first count comes in
+func (s *sqlStore) countUsage(ctx context.Context, key, day string) (int, error) {
+	ctx, cancel := withDeadlineMargin(ctx, deadlineMargin) // End before the request does (see deadline.go)
+	defer cancel()
+	var n int
+	err := s.db.QueryRowContext(ctx, s.q(`INSERT INTO quota_usage (subject, day, count) VALUES (?, ?, 1)
+		ON CONFLICT (subject, day) DO UPDATE SET count = quota_usage.count + 1 RETURNING count`), key, day).Scan(&n)
+	if err == nil && n == 1 {
+		_, err = s.db.ExecContext(ctx, s.q(`DELETE FROM quota_usage WHERE day < ?`), day)
+	}
+	return n, err
+}
+
+// enforceRequestQuota allows each API key limit requests per UTC day;
+// other principals pass untouched. It runs on every user-facing route,
+// after identify put the principal in the context (see authprovider.go),
+// so public routes count too. A counter that fails lets the request
+// through: a quota isn't worth an outage
+func enforceRequestQuota(count usageCounter, limit int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principalFromContext(r.Context())
+			if limit <= 0 || !ok || p.Scheme != "api_key" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			now := time.Now().UTC()
+			day := now.Format(time.DateOnly)
+			used, err := count(r.Context(), "api_key:"+p.Subject, day)
+			if err != nil {
+				slog.WarnContext(r.Context(), "quota count failed, request allowed", "key", p.Subject, "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			reset := now.Truncate(24 * time.Hour).Add(24 * time.Hour) // Midnight UTC
+			h := w.Header()
+			h.Set("X-Quota-Limit", strconv.Itoa(limit))
+			h.Set("X-Quota-Remaining", strconv.Itoa(max(limit-used, 0)))
+			h.Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+			if used > limit {
+				h.Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+				writeError(w, &quotaError{Name: quotaRequestsPerDay, Limit: limit, Used: used - 1, Reset: reset})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Package main - the real client IP behind load balancers and reverse proxies
+package main
+
+import (
+	"fmt"       // For flag parsing errors
+	"net"       // For splitting host:port
+	"net/http"  // For the middleware and headers
+	"net/netip" // For parsing addresses and CIDR ranges
+	"strings"   // For splitting header lists
+)
+
+// Behind a proxy every request comes from the proxy's address, and the real
+// client is in a header the proxy adds. Those headers are plain text any
+// client can send, so they're only believed when the connection comes from a
+// proxy we know - Express's app.set('trust proxy', ['10.0.0.0/8']) + req.ip.
+//
+// Headers, most specific first:
+//
+//	Forwarded: for=203.0.113.7;proto=https, for="[2001:db8::1]"   (RFC 7239)
+//	X-Forwarded-For: 203.0.113.7, 10.0.0.2                         (de facto standard)
+//	X-Real-IP: 203.0.113.7                                         (nginx)
+
+// parseTrustedProxies reads the -trusted-proxies flag: comma-separated CIDR
+// ranges or single addresses ("10.0.0.0/8,127.0.0.1"); empty trusts nobody
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen())) // A single address is a /32 (or /128)
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
+
+// clientIPKey is the context key for the resolved client IP
+var clientIPKey = newCtxKey[string]("client_ip")
+
+// realIP resolves the client IP once per request and stores it in the
+// context, where clientIP finds it for rate limiting, the access log and
+// anything else that records who made a request
+func realIP(trusted []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trusted)
+			next.ServeHTTP(w, r.WithContext(clientIPKey.with(r.Context(), ip)))
+		})
+	}
+}
+
+// resolveClientIP walks the proxy chain from the nearest hop backwards and
+// returns the first address that isn't a trusted proxy
+// Walking from the right matters: the leftmost X-Forwarded-For entry is
+// whatever the client claimed, only the entries our own proxies appended
+// can be believed
+func resolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer := remoteIP(r)
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || !isTrusted(addr, trusted) {
+		return peer // Direct connection from a client (or unparseable): headers are ignored
+	}
+
+	hops := forwardedHops(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break // "unknown", an obfuscated name, garbage: stop at the last hop we could read
+		}
+		addr = hop.Unmap() // ::ffff:203.0.113.7 → 203.0.113.7
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// forwardedHops lists the addresses from the first header present, client first
+func forwardedHops(h http.Header) []string {
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		var hops []string
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hops = append(hops, forwardedNode(value))
+				}
+			}
+		}
+		return hops
+	}
+	if values := h.Values("X-Forwarded-For"); len(values) > 0 {
+		// A header repeated on several lines is the same list split up
+		var hops []string
+		for _, hop := range strings.Split(strings.Join(values, ","), ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+		return hops
+	}
+	if v := strings.TrimSpace(h.Get("X-Real-IP")); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+// forwardedNode strips quotes, IPv6 brackets and the port from a Forwarded
+// "for" value: "[2001:db8::1]:4711" → 2001:db8::1
+func forwardedNode(v string) string {
+	v = strings.Trim(v, `"`)
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		return host
+	}
+	return strings.Trim(v, "[]")
+}
+
+// isTrusted reports whether addr is inside one of the trusted ranges
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the client's IP: the one realIP resolved, or the
+// connection's address when realIP isn't in the chain (req.ip in Express)
+func clientIP(r *http.Request) string {
+	if ip, ok := clientIPKey.from(r.Context()); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns the IP part of the connection's remote address
+// r.RemoteAddr looks like "203.0.113.7:52341" (or "[::1]:52341" for IPv6)
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
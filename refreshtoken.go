@@ -0,0 +1,196 @@
+// Package main - refresh tokens: long-lived, stored server-side, rotated on every use
+package main
+
+import (
+	"context"  // For the event subscriptions
+	"errors"   // For the refresh errors
+	"maps"     // For removing sessions
+	"net/http" // For the handlers
+	"sync"     // For the mutex; refreshes arrive concurrently
+	"time"     // For expiry
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For refresh tokens and their stored hashes
+)
+
+// Access tokens (jwt.go) are checked without a database, which is why they
+// can't be revoked - so they only live for minutes. Login also returns a
+// refresh token: a random string that lives for weeks and can be traded for
+// a new pair at POST /auth/refresh. In Node you'd keep these in Redis or a
+// refresh_tokens table; here they're a map, like the other in-memory stores.
+//
+// Rotation: every refresh token works once. Using it returns a new one and
+// marks the old one as used. If a used token comes back, two parties hold
+// copies - the user and a thief - and we can't tell which is which, so the
+// whole family (every token descended from that login) is revoked and both
+// have to log in again. This is OAuth 2's "refresh token reuse detection".
+//
+// Only a SHA-256 of each token is stored: a leaked map can't be replayed.
+//
+// A family is also a session: the login it started from, with the device
+// it came from (see sessions.go).
+
+// refreshTokenTTL is how long a refresh token is valid if unused
+// Each rotation starts a new period, so an active client stays logged in
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// Refresh errors; both are answered with 401 and the same message
+var (
+	errRefreshInvalid = errors.New("invalid or expired refresh token")
+	errRefreshReused  = errors.New("refresh token reused; all sessions from that login were revoked")
+)
+
+// refreshToken is what the store knows about one issued token
+type refreshToken struct {
+	userID   int
+	tenantID string
+	family   string   // Shared by every token rotated from the same login
+	scopes   []string // As the login asked for them; nil for all (see scopes.go)
+	expires  time.Time
+	used     bool // Rotated; kept until it expires, to notice reuse
+}
+
+// refreshStore holds refresh tokens by the hash of their value, and the
+// sessions they belong to by ID
+type refreshStore struct {
+	mu       sync.Mutex
+	tokens   map[string]*refreshToken
+	sessions map[string]*session // By ID, which is the family of its tokens
+}
+
+// newRefreshStore creates an empty store
+func newRefreshStore() *refreshStore {
+	return &refreshStore{tokens: make(map[string]*refreshToken), sessions: make(map[string]*session)}
+}
+
+// issue creates a refresh token for u in family, the session from startSession
+// Its successors keep the scopes, so refreshing never widens a narrowed login
+func (s *refreshStore) issue(u User, family string, scopes []string, now time.Time) (token string, expires time.Time) {
+	token = cryptoutil.RandomToken(32)
+	expires = now.Add(refreshTokenTTL).Truncate(time.Second)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpired(now)
+	s.tokens[cryptoutil.SHA256Hex([]byte(token))] = &refreshToken{userID: u.ID, tenantID: u.TenantID, family: family, scopes: scopes, expires: expires}
+	if sess, ok := s.sessions[family]; ok {
+		sess.expires = expires // The session lasts as long as its newest token
+	}
+	return token, expires
+}
+
+// use marks token as used and returns it, so the caller can issue its successor
+// A token that was already used revokes its family and returns errRefreshReused
+func (s *refreshStore) use(token, tenantID string, now time.Time) (refreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt, ok := s.tokens[cryptoutil.SHA256Hex([]byte(token))]
+	if !ok || rt.tenantID != tenantID || !now.Before(rt.expires) {
+		return refreshToken{}, errRefreshInvalid
+	}
+	if rt.used {
+		s.revokeFamily(rt.family)
+		return *rt, errRefreshReused // Who it was, for the log
+	}
+	rt.used = true
+	return *rt, nil
+}
+
+// revoke ends the family token belongs to (logout); unknown tokens are ignored
+func (s *refreshStore) revoke(token, tenantID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rt, ok := s.tokens[cryptoutil.SHA256Hex([]byte(token))]; ok && rt.tenantID == tenantID {
+		s.revokeFamily(rt.family)
+	}
+}
+
+// revokeUser ends every session and refresh token of a user
+func (s *refreshStore) revokeUser(tenantID string, userID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeWhere(func(t *refreshToken) bool { return t.tenantID == tenantID && t.userID == userID })
+	maps.DeleteFunc(s.sessions, func(_ string, sess *session) bool { return sess.tenantID == tenantID && sess.userID == userID })
+}
+
+// revokeFamily ends a session and its refresh tokens; s.mu must be held
+func (s *refreshStore) revokeFamily(family string) {
+	s.revokeWhere(func(t *refreshToken) bool { return t.family == family })
+	delete(s.sessions, family)
+}
+
+// revokeWhere deletes the tokens match selects; s.mu must be held
+func (s *refreshStore) revokeWhere(match func(*refreshToken) bool) {
+	for hash, t := range s.tokens {
+		if match(t) {
+			delete(s.tokens, hash)
+		}
+	}
+}
+
+// removeExpired drops tokens and sessions nobody can use anymore; s.mu must be held
+// Done on every issue, so the maps stay as large as the set of live logins
+func (s *refreshStore) removeExpired(now time.Time) {
+	s.revokeWhere(func(t *refreshToken) bool { return !now.Before(t.expires) })
+	maps.DeleteFunc(s.sessions, func(_ string, sess *session) bool { return !now.Before(sess.expires) })
+}
+
+// subscribe logs users out everywhere when their password changes or their
+// account goes away; access tokens still run out on their own within minutes
+func (s *refreshStore) subscribe(bus *eventBus) {
+	revoke := func(ctx context.Context, payload any) {
+		if u, ok := payload.(User); ok {
+			s.revokeUser(u.TenantID, u.ID)
+		}
+	}
+	bus.subscribe(eventPasswordChanged, revoke)
+	bus.subscribe(eventUserDeleted, revoke)
+	bus.subscribe(eventUserErased, revoke)
+}
+
+// refreshRequest is the body of POST /auth/refresh and POST /auth/logout
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshHandler trades a refresh token for a new access and refresh token (POST /auth/refresh)
+// The old refresh token stops working; keep the new one
+//
+//	curl -X POST localhost:8080/auth/refresh -d '{"refresh_token":"'$REFRESH'"}'
+func (a *api) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[refreshRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	tenant := tenantFromContext(r.Context())
+	rt, err := a.refresh.use(payload.RefreshToken, tenant, time.Now())
+	if errors.Is(err, errRefreshReused) {
+		a.logger.WarnContext(r.Context(), "auth: refresh token reused", "user_id", rt.userID)
+	}
+	if err != nil {
+		a.respondError(w, r, errRefreshInvalid)
+		return
+	}
+	// Load the user again: a deleted user's refresh token is already gone,
+	// but their name or email may have changed since the last refresh
+	u, err := a.users.Get(r.Context(), tenant, rt.userID)
+	if err != nil {
+		a.respondError(w, r, errRefreshInvalid)
+		return
+	}
+	a.respondTokens(w, r, http.StatusOK, u, rt.family, rt.scopes)
+}
+
+// logoutHandler revokes a refresh token and every token rotated from the same login (POST /auth/logout)
+// It answers 204 for unknown tokens too: logging out twice isn't an error
+// The access token stops working too: it belongs to the same session (see sessions.go)
+//
+//	curl -X POST localhost:8080/auth/logout -d '{"refresh_token":"'$REFRESH'"}'
+func (a *api) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[refreshRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	a.refresh.revoke(payload.RefreshToken, tenantFromContext(r.Context()))
+	w.WriteHeader(http.StatusNoContent)
+}
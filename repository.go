@@ -0,0 +1,138 @@
+// Package main - a generic in-memory repository shared by users, posts and tags
+package main
+
+import (
+	"errors"      // For the not-found error
+	"iter"        // For iterating without copying (iter.Seq)
+	"slices"      // For slices.DeleteFunc
+	"sync/atomic" // For the ID counter
+)
+
+// Without generics every entity would need its own copy of the same CRUD
+// code (or an interface{}-based store with casts everywhere). Repository[T]
+// is written once and checked by the compiler for each T - the TypeScript
+// equivalent is class Repository<T extends { id: number }>.
+//
+// This is the in-memory implementation; a SQL one would keep the same method
+// set and build its queries from the entity's table and columns. It has no
+// lock of its own: a check and the write it guards (a unique email, then the
+// insert) must happen under one lock, so the store using it holds that lock
+// (see memoryUserStore in store.go). Posts and tags don't have one yet.
+
+// errNotFound is returned when no entity has the requested ID
+var errNotFound = errors.New("not found")
+
+// errDuplicateID is returned by Insert when the ID is already taken
+var errDuplicateID = errors.New("id already exists")
+
+// Entity is the constraint on what a Repository can store: it must expose
+// its ID and be able to return a copy of itself with a new ID
+// The type parameter refers back to the entity itself (User's WithID returns
+// a User), so Create can assign IDs without knowing the concrete type
+type Entity[T any] interface {
+	EntityID() int
+	WithID(id int) T
+}
+
+// Repository stores entities of one type
+// [T Entity[T]] reads "any T that is an Entity of T"
+type Repository[T Entity[T]] struct {
+	items []T
+	last  atomic.Int64 // The highest ID handed out; IDs are never reused
+}
+
+// newRepository creates an empty repository
+// Type arguments are explicit here because nothing in the call mentions T:
+// newRepository[User]()
+func newRepository[T Entity[T]]() *Repository[T] {
+	return &Repository[T]{items: []T{}}
+}
+
+// Get returns the entity with the given ID
+func (r *Repository[T]) Get(id int) (T, error) {
+	for _, item := range r.items {
+		if item.EntityID() == id {
+			return item, nil
+		}
+	}
+	var zero T
+	return zero, errNotFound
+}
+
+// List returns the entities keep accepts (all of them when keep is nil)
+// Starting from []T{} (not nil) makes the JSON output [] instead of null
+func (r *Repository[T]) List(keep func(T) bool) []T {
+	result := []T{}
+	for _, item := range r.items {
+		if keep == nil || keep(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// All iterates over every entity without copying the slice
+// for item := range repo.All() { ... } - like iterating a JS generator
+func (r *Repository[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range r.items {
+			if !yield(item) {
+				return // The loop body hit break
+			}
+		}
+	}
+}
+
+// Create stores item under a new ID and returns the stored copy
+// len(r.items)+1 would hand out the ID of the last item again after a
+// delete, so a counter remembers the highest one - like AUTOINCREMENT.
+// Add is atomic: two goroutines calling it at once get different numbers
+// even without a lock around it (posts and tags have none)
+func (r *Repository[T]) Create(item T) T {
+	item = item.WithID(int(r.last.Add(1)))
+	r.items = append(r.items, item)
+	return item
+}
+
+// Insert stores item under the ID it already has, made elsewhere (a
+// snowflake, see ids.go); an ID that is taken is errDuplicateID
+// The counter moves past it, so Create never hands it out later
+func (r *Repository[T]) Insert(item T) (T, error) {
+	id := item.EntityID()
+	if _, err := r.Get(id); err == nil {
+		var zero T
+		return zero, errDuplicateID
+	}
+	for last := r.last.Load(); int64(id) > last && !r.last.CompareAndSwap(last, int64(id)); last = r.last.Load() {
+		// Another goroutine moved the counter in between: try again with its value
+	}
+	r.items = append(r.items, item)
+	return item, nil
+}
+
+// Update replaces the entity with the same ID
+func (r *Repository[T]) Update(item T) error {
+	for i := range r.items {
+		if r.items[i].EntityID() == item.EntityID() {
+			r.items[i] = item
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// Delete removes the entity with the given ID
+func (r *Repository[T]) Delete(id int) error {
+	if r.DeleteFunc(func(item T) bool { return item.EntityID() == id }) == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// DeleteFunc removes every entity match accepts and returns how many were removed
+func (r *Repository[T]) DeleteFunc(match func(T) bool) int {
+	before := len(r.items)
+	// slices.DeleteFunc filters in place - Array.prototype.filter without the new array
+	r.items = slices.DeleteFunc(r.items, match)
+	return before - len(r.items)
+}
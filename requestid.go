@@ -0,0 +1,110 @@
+// Package main - one request ID that follows a request into jobs, emails and outbound calls
+package main
+
+import (
+	"context"  // For carrying the ID
+	"net/http" // For the middleware and the outbound transport
+	"strings"  // For parsing traceparent
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For generated request IDs
+)
+
+// POST /users returns quickly, but its effects happen elsewhere: a welcome
+// email from an event subscriber, an import on the worker pool, a call to a
+// third-party API. When one of them fails, the log line has to say which
+// request caused it. The request ID does that: taken from the caller (or
+// made up here), sent back as X-Request-ID, stored in the context - and the
+// context travels with everything the request starts. Every log line that
+// has a context writes it as request_id=..., so one grep shows the whole story.
+// In Express this is express-request-id plus AsyncLocalStorage; in Go the
+// context is passed explicitly, so nothing is lost across goroutines.
+
+// requestIDHeader is read from requests, set on responses and on outbound calls
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key for the request ID
+var requestIDKey = newCtxKey[string]("request_id")
+
+// requestID gives every request an ID: the caller's X-Request-ID, else the
+// trace ID of a W3C traceparent header (so IDs match the tracing system),
+// else a new random one
+func requestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID(id) {
+				id = traceID(r.Header.Get("traceparent"))
+			}
+			if id == "" {
+				id = cryptoutil.RandomToken(12)
+			}
+			w.Header().Set(requestIDHeader, id) // Clients can quote it in bug reports
+			next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+		})
+	}
+}
+
+// validRequestID accepts IDs that are safe to write into logs and headers:
+// short, and only letters, digits and - _ . : - no spaces or newlines that
+// could forge a log line
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// traceID returns the trace-id of a traceparent header
+// ("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"), or ""
+func traceID(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || !validRequestID(parts[1]) {
+		return ""
+	}
+	return parts[1]
+}
+
+// withRequestID returns a copy of ctx carrying id
+func withRequestID(ctx context.Context, id string) context.Context {
+	return requestIDKey.with(ctx, id)
+}
+
+// requestIDFromContext returns the request ID, or "" outside a request
+// (scheduled jobs, startup)
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := requestIDKey.from(ctx)
+	return id
+}
+
+// propagateRequestID sends the request ID along on outbound calls, so a
+// downstream service (or a webhook receiver) can log the same ID
+// Wraps a transport like the breaker transport does (see breaker.go)
+func propagateRequestID(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		id := requestIDFromContext(req.Context())
+		if id == "" || req.Header.Get(requestIDHeader) != "" {
+			return next.RoundTrip(req)
+		}
+		// A RoundTripper must not modify the caller's request - clone it
+		req = req.Clone(req.Context())
+		req.Header.Set(requestIDHeader, id)
+		return next.RoundTrip(req)
+	})
+}
+
+// roundTripperFunc lets a plain function be an http.RoundTripper,
+// like http.HandlerFunc does for handlers
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
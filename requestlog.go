@@ -0,0 +1,94 @@
+// Package main - the last N requests in memory, with a JSON and an HTML admin view
+package main
+
+import (
+	"net/http" // For the middleware and handlers
+	"strings"  // For skipping the viewer's own requests
+	"time"     // For timestamps and latency
+)
+
+// The access log scrolls by and the debug dump (debugdump.go) is too heavy to
+// leave on. The request log is the middle ground: one short record per
+// request - no headers, bodies cut to requestLogBodyLimit - kept in a ring
+// buffer so "what just happened?" can be answered from the admin API
+// without grepping logs or running a proxy like mitmproxy.
+
+// requestLogBodyLimit is how much of each body a record keeps
+const requestLogBodyLimit = 256
+
+// requestRecord is one request in the log
+type requestRecord struct {
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id"` // X-Request-ID, the key to the log lines of this request (see requestid.go)
+	ClientIP     string    `json:"client_ip"`  // Resolved by realIP (see realip.go)
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Status       int       `json:"status"`
+	Latency      string    `json:"latency"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+}
+
+// recordRequests adds a requestRecord to log for every request
+// A nil log (-request-log=0) turns it off
+func recordRequests(log *ringBuffer[requestRecord]) Middleware {
+	return func(next http.Handler) http.Handler {
+		if log == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Refreshing the viewer shouldn't push real traffic out of the buffer
+			if strings.HasPrefix(r.URL.Path, "/admin/requests") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			// The same capturing wrappers as debugDump, with a smaller limit
+			reqBody := &capturingReader{ReadCloser: r.Body, limit: requestLogBodyLimit}
+			r.Body = reqBody
+			rec := &capturingWriter{statusRecorder: newStatusRecorder(w), limit: requestLogBodyLimit}
+
+			next.ServeHTTP(rec, r)
+
+			log.add(requestRecord{
+				Time:         start.UTC(),
+				RequestID:    requestIDFromContext(r.Context()),
+				ClientIP:     clientIP(r),
+				Method:       r.Method,
+				Path:         r.URL.RequestURI(),
+				Status:       rec.status,
+				Latency:      time.Since(start).Round(time.Microsecond).String(),
+				RequestBody:  dumpBody(r.Header.Get("Content-Type"), reqBody.buf, reqBody.total),
+				ResponseBody: dumpBody(rec.Header().Get("Content-Type"), rec.buf, rec.bytes),
+			})
+		})
+	}
+}
+
+// requestsPage is the data for templates/pages/requests.html
+type requestsPage struct {
+	Records []requestRecord
+	Size    int // Capacity of the buffer, shown as "last N requests"
+}
+
+// listRequestsHandler returns the recorded requests, newest first (GET /admin/requests)
+func (a *api) listRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if a.requestLog == nil {
+		writeJSONError(w, http.StatusNotFound, "request log is off (-request-log=0)")
+		return
+	}
+	respondJSON(w, http.StatusOK, a.requestLog.list())
+}
+
+// requestsPageHandler renders the same records as an HTML table (GET /admin/requests/view)
+func (a *api) requestsPageHandler(w http.ResponseWriter, r *http.Request) {
+	if a.requestLog == nil {
+		writeJSONError(w, http.StatusNotFound, "request log is off (-request-log=0)")
+		return
+	}
+	a.render(w, r, http.StatusOK, "requests", requestsPage{
+		Records: a.requestLog.list(),
+		Size:    a.requestLog.size(),
+	})
+}
@@ -0,0 +1,323 @@
+// Package main - degraded mode: stale reads and 503 writes while the user store is down
+package main
+
+import (
+	"context"  // Passed through to the wrapped store; carries the stale marker
+	"errors"   // For errStoreUnavailable
+	"expvar"   // For counting stale reads and rejected writes
+	"fmt"      // For cache keys
+	"log/slog" // For logging the failures behind a stale answer
+	"net/http" // For the marker middleware
+	"strconv"  // For the Age header
+	"sync"     // For the marker's mutex; a request may read the store concurrently
+	"time"     // For ages
+)
+
+// When the database goes away, every request used to fail: a 500 for
+// GET /users as much as for POST /users. Most traffic is reads, and most
+// readers would rather see a list from a minute ago than an error page - what
+// a CDN's stale-if-error does, or a Node service that keeps the last good
+// answer of each query in an lru-cache for when the pool can't connect.
+//
+// With -degraded-reads, degradedStore wraps the store and remembers the last
+// good answer of every read (GetByID, GetAll, Query) for -stale-for. While the
+// store is down - the health checker says so, or a read just failed - reads
+// are answered from those answers and writes are refused:
+//
+//	GET /users/1        → 200, Warning: 110 - "Response is Stale", Age: 42
+//	GET /users          → 200, the same headers and "stale": true in meta
+//	GET /users/999      → 503 store_unavailable (never read before the outage)
+//	PUT /users/1        → 503 store_unavailable: nothing is queued to replay later
+//
+// The store only knows the request's context, not its response, so
+// markStaleReads puts a staleMark in the context for the store to fill in
+// and adds the headers when the response starts - the one place in this
+// project where a value flows back out through a context (see ctxvalue.go).
+
+// errStoreUnavailable is returned while the store is down and the answer
+// can't come from the remembered ones: 503, so clients retry later (see errors.go)
+var errStoreUnavailable = errors.New("the user store is unavailable, try again later")
+
+// resilienceConfig is what -degraded-reads and -stale-for set; shown under
+// "resilience" in GET /admin/config
+type resilienceConfig struct {
+	DegradedReads bool   `json:"degraded_reads"` // Serve remembered reads while the store is down
+	StaleFor      string `json:"stale_for"`      // The oldest answer served, e.g. "15m0s"
+}
+
+// degradedMetrics count what degraded mode did, under "degraded" on /debug/vars
+var degradedMetrics = expvar.NewMap("degraded")
+
+// remembered is a read's answer and when the store gave it
+type remembered[V any] struct {
+	value V
+	at    time.Time
+}
+
+// listAnswer is what Query returns, remembered as one value
+type listAnswer struct {
+	users []User
+	meta  pageMeta
+}
+
+// degradedStore decorates a UserStore with degraded mode (see storemetrics.go for decorators)
+// Ping and the methods that aren't plain reads of users go straight through
+type degradedStore struct {
+	UserStore             // Embedded: Purge, DeleteTenant, Stats and Ping are forwarded as they are
+	up        func() bool // The health checker's view of the store (see health.go)
+	logger    *slog.Logger
+	users     *ttlCache[string, remembered[User]] // tenant + ID → the user
+	lists     *ttlCache[string, remembered[[]User]]
+	queries   *ttlCache[string, remembered[listAnswer]]
+}
+
+// newDegradedStore wraps next; answers older than staleFor are never served
+func newDegradedStore(next UserStore, staleFor time.Duration, up func() bool, logger *slog.Logger) *degradedStore {
+	return &degradedStore{
+		UserStore: next,
+		up:        up,
+		logger:    logger,
+		users:     newTTLCache[string, remembered[User]](staleFor),
+		lists:     newTTLCache[string, remembered[[]User]](staleFor),
+		queries:   newTTLCache[string, remembered[listAnswer]](staleFor),
+	}
+}
+
+// storeFailed reports whether err means the store couldn't answer, as
+// opposed to an answer like "not found" or "invalid": the errors that would be a 500
+func storeFailed(err error) bool {
+	status, _, _ := describeError(err)
+	return status == http.StatusInternalServerError
+}
+
+// stale returns a remembered answer after a failed (or skipped) read, and
+// marks the response stale; without one, the read fails with errStoreUnavailable
+func stale[V any](ctx context.Context, s *degradedStore, cache *ttlCache[string, remembered[V]], key string, err error) (V, error) {
+	if err != nil {
+		s.logger.WarnContext(ctx, "store read failed, answering from remembered data", "err", err)
+	}
+	r, ok := cache.get(key)
+	if !ok {
+		degradedMetrics.Add("unavailable_reads", 1)
+		var zero V
+		return zero, errStoreUnavailable
+	}
+	degradedMetrics.Add("stale_reads", 1)
+	markStale(ctx, r.at)
+	return r.value, nil
+}
+
+// GetByID answers from the store, or with the user as last read while it's down
+func (s *degradedStore) GetByID(ctx context.Context, tenantID string, id int) (User, error) {
+	key := tenantID + "\x00" + strconv.Itoa(id)
+	if !s.up() {
+		return stale(ctx, s, s.users, key, nil)
+	}
+	u, err := s.UserStore.GetByID(ctx, tenantID, id)
+	switch {
+	case err == nil:
+		s.users.set(key, remembered[User]{u, time.Now()})
+	case storeFailed(err):
+		return stale(ctx, s, s.users, key, err)
+	}
+	return u, err // Not found is an answer, not an outage
+}
+
+// GetAll answers from the store, or with the list as last read while it's down
+// GetAll has no error: a failing store answers an empty list, so an empty
+// list is checked with Ping before it replaces a remembered one
+func (s *degradedStore) GetAll(ctx context.Context, tenantID string) []User {
+	if s.up() {
+		users := s.UserStore.GetAll(ctx, tenantID)
+		if len(users) > 0 || s.UserStore.Ping(ctx) == nil {
+			s.lists.set(tenantID, remembered[[]User]{users, time.Now()})
+			return users
+		}
+	}
+	users, err := stale(ctx, s, s.lists, tenantID, nil)
+	if err != nil {
+		return []User{} // What the store answers when it fails
+	}
+	return users
+}
+
+// Query answers from the store, or with the same page as last read while it's
+// down; meta.stale tells clients that read the body but not the headers
+func (s *degradedStore) Query(ctx context.Context, tenantID string, q listQuery) ([]User, pageMeta, error) {
+	// %+v spells out every filter, sort field and page parameter: equal queries, equal keys
+	key := fmt.Sprintf("%s\x00%+v", tenantID, q)
+	var failed error
+	if s.up() {
+		users, meta, err := s.UserStore.Query(ctx, tenantID, q)
+		switch {
+		case err == nil:
+			s.queries.set(key, remembered[listAnswer]{listAnswer{users, meta}, time.Now()})
+			return users, meta, nil
+		case !storeFailed(err):
+			return users, meta, err // A bad query is the client's mistake, not an outage
+		}
+		failed = err
+	}
+	answer, err := stale(ctx, s, s.queries, key, failed)
+	if err != nil {
+		return nil, pageMeta{}, err
+	}
+	answer.meta.Stale = true
+	return answer.users, answer.meta, nil
+}
+
+// refuse rejects a write while the store is down, so a client sees a clear
+// 503 right away instead of a 500 after the driver's timeout
+func (s *degradedStore) refuse() error {
+	if s.up() {
+		return nil
+	}
+	degradedMetrics.Add("rejected_writes", 1)
+	return errStoreUnavailable
+}
+
+// forget drops a user whose remembered copy a write just made wrong
+func (s *degradedStore) forget(tenantID string, id int) {
+	s.users.delete(tenantID + "\x00" + strconv.Itoa(id))
+}
+
+// Create refuses while the store is down
+func (s *degradedStore) Create(ctx context.Context, u User) (User, error) {
+	if err := s.refuse(); err != nil {
+		return User{}, err
+	}
+	return s.UserStore.Create(ctx, u)
+}
+
+// GetByEmail refuses while the store is down: it's how logins find the
+// password hash, and a remembered one may be the hash before a password change
+func (s *degradedStore) GetByEmail(ctx context.Context, tenantID, email string) (User, error) {
+	if err := s.refuse(); err != nil {
+		return User{}, err
+	}
+	return s.UserStore.GetByEmail(ctx, tenantID, email)
+}
+
+// GetByUUID refuses while the store is down: remembering users under a
+// second key would give forget two copies to find (see ids.go)
+func (s *degradedStore) GetByUUID(ctx context.Context, tenantID, uuid string) (User, error) {
+	if err := s.refuse(); err != nil {
+		return User{}, err
+	}
+	return s.UserStore.GetByUUID(ctx, tenantID, uuid)
+}
+
+// Update refuses while the store is down
+func (s *degradedStore) Update(ctx context.Context, u User) (User, error) {
+	if err := s.refuse(); err != nil {
+		return User{}, err
+	}
+	s.forget(u.TenantID, u.ID)
+	return s.UserStore.Update(ctx, u)
+}
+
+// SetPasswordHash refuses while the store is down
+func (s *degradedStore) SetPasswordHash(ctx context.Context, tenantID string, id int, hash string) error {
+	if err := s.refuse(); err != nil {
+		return err
+	}
+	s.forget(tenantID, id)
+	return s.UserStore.SetPasswordHash(ctx, tenantID, id, hash)
+}
+
+// Delete refuses while the store is down
+func (s *degradedStore) Delete(ctx context.Context, tenantID string, id int) error {
+	if err := s.refuse(); err != nil {
+		return err
+	}
+	s.forget(tenantID, id)
+	return s.UserStore.Delete(ctx, tenantID, id)
+}
+
+// Erase refuses while the store is down; an erased user must not live on
+// in the remembered answers either (see gdpr.go)
+func (s *degradedStore) Erase(ctx context.Context, tenantID string, id int) (User, error) {
+	if err := s.refuse(); err != nil {
+		return User{}, err
+	}
+	s.forget(tenantID, id)
+	return s.UserStore.Erase(ctx, tenantID, id)
+}
+
+// staleMark records the oldest remembered answer a request was given
+type staleMark struct {
+	mu sync.Mutex
+	at time.Time // Zero while every answer was fresh
+}
+
+// staleKey holds the request's *staleMark; the pointer is how the store reports back
+var staleKey = newCtxKey[*staleMark]("stale")
+
+// markStale notes that a request was answered with data from at
+// Requests without a mark (background jobs, the seed loader) are ignored
+func markStale(ctx context.Context, at time.Time) {
+	m, ok := staleKey.from(ctx)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.at.IsZero() || at.Before(m.at) {
+		m.at = at
+	}
+}
+
+// markStaleReads adds Warning and Age headers to responses built from
+// remembered data. The headers have to go out with the status line, so
+// staleWriter adds them on the first WriteHeader or Write, after the
+// handler has read the store. Every route has it, innermost (see router.go):
+// without -degraded-reads no mark is ever set, and it costs one allocation
+func markStaleReads() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mark := &staleMark{}
+			next.ServeHTTP(&staleWriter{ResponseWriter: w, mark: mark}, r.WithContext(staleKey.with(r.Context(), mark)))
+		})
+	}
+}
+
+// staleWriter adds the stale headers just before the response starts
+type staleWriter struct {
+	http.ResponseWriter
+	mark    *staleMark
+	started bool
+}
+
+// start adds the headers once, if the mark was set
+func (sw *staleWriter) start() {
+	if sw.started {
+		return
+	}
+	sw.started = true
+	sw.mark.mu.Lock()
+	at := sw.mark.at
+	sw.mark.mu.Unlock()
+	if at.IsZero() {
+		return
+	}
+	// 110 is "Response is Stale" (RFC 7234, section 5.5); Age is its age in seconds
+	sw.Header().Set("Warning", `110 - "Response is Stale"`)
+	sw.Header().Set("Age", strconv.Itoa(int(time.Since(at).Seconds())))
+}
+
+// WriteHeader adds the stale headers, then passes the status on
+func (sw *staleWriter) WriteHeader(code int) {
+	sw.start()
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Write adds the stale headers before an implicit 200
+func (sw *staleWriter) Write(b []byte) (int, error) {
+	sw.start()
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the original writer (see statusRecorder)
+func (sw *staleWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,90 @@
+// Package main - one retry helper with exponential backoff, jitter and context support
+package main
+
+import (
+	"context"   // For stopping retries when the caller gives up
+	"errors"    // For recognising cancellation and open circuits
+	"math/rand" // For jitter (not crypto/rand - unpredictability isn't the point here)
+	"time"      // For delays
+)
+
+// The Node equivalent is p-retry / async-retry. Keeping one implementation
+// means every caller gets the same behavior: bounded attempts, growing
+// delays, jitter, and an immediate stop when the context is cancelled.
+
+// retryPolicy configures retryDo
+type retryPolicy struct {
+	MaxAttempts int           // Total tries including the first; 0 = until ctx is done
+	BaseDelay   time.Duration // Delay before the second attempt; doubles every time
+	MaxDelay    time.Duration // Upper bound for a single delay
+
+	// Retryable decides whether an error is worth another attempt
+	// nil means "retry everything except cancellation and open circuits" (isRetryable)
+	Retryable func(err error) bool
+
+	// OnRetry is called before each wait, e.g. for logging (optional)
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// defaultRetryPolicy suits calls made while serving a request: a few quick tries
+var defaultRetryPolicy = retryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// retryDo calls fn until it succeeds, returns a non-retryable error, runs out
+// of attempts or ctx is done; it returns fn's last error
+func retryDo(ctx context.Context, policy retryPolicy, fn func(ctx context.Context) error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = isRetryable
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !retryable(err) || (policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts) {
+			return err
+		}
+
+		delay := backoffDelay(policy, attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+
+		// time.NewTimer + Stop instead of time.After so the timer is freed
+		// right away when ctx wins the race
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err // The last real error says more than "context canceled"
+		}
+	}
+}
+
+// backoffDelay returns the wait before attempt+1: exponential with "full jitter"
+// base*2^(attempt-1), capped at MaxDelay, then a random point between 0 and that
+// Jitter spreads retries out so clients that failed together don't retry together
+func backoffDelay(policy retryPolicy, attempt int) time.Duration {
+	ceiling := policy.BaseDelay << (attempt - 1) // << doubles per attempt
+	if ceiling <= 0 || ceiling > policy.MaxDelay {
+		ceiling = policy.MaxDelay // <= 0 catches overflow after many attempts
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// isRetryable is the default predicate: don't retry when the caller gave up,
+// a circuit breaker is already failing fast (see breaker.go) or the request
+// has no time left for another attempt (see deadline.go)
+// Timeouts of a single attempt are retried; the overall deadline is ctx's job
+func isRetryable(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, errCircuitOpen) && !errors.Is(err, errNoTimeLeft)
+}
@@ -0,0 +1,52 @@
+// Package main - a fixed-size ring buffer for "the last N of something"
+package main
+
+import "sync" // For the mutex; the middleware adds from many goroutines at once
+
+// ringBuffer keeps the last len(items) values: once full, each add
+// overwrites the oldest, so memory use stays bounded however long the
+// server runs. JS would use an array with push() and shift(), which moves
+// every element on each shift; the ring only moves an index
+type ringBuffer[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int // Where the next value goes
+	full  bool
+}
+
+// newRingBuffer creates a buffer holding size values
+func newRingBuffer[T any](size int) *ringBuffer[T] {
+	return &ringBuffer[T]{items: make([]T, size)}
+}
+
+// add stores v, overwriting the oldest value when the buffer is full
+func (b *ringBuffer[T]) add(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items[b.next] = v
+	b.next = (b.next + 1) % len(b.items)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// list returns a copy of the values, newest first
+func (b *ringBuffer[T]) list() []T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.next
+	if b.full {
+		n = len(b.items)
+	}
+	out := make([]T, 0, n)
+	for i := 1; i <= n; i++ {
+		// Walk backwards from the last written slot, wrapping around
+		out = append(out, b.items[(b.next-i+len(b.items))%len(b.items)])
+	}
+	return out
+}
+
+// size is how many values the buffer holds when full
+func (b *ringBuffer[T]) size() int {
+	return len(b.items)
+}
@@ -0,0 +1,100 @@
+// Package main - roles and the requireRole middleware factory
+package main
+
+import (
+	"cmp"      // cmp.Or for the default role
+	"errors"   // For errInvalidRole
+	"net/http" // For middleware and the handler
+	"slices"   // For checking the principal's role
+	"strings"  // For the 403 message
+)
+
+// Authentication says who made a request (authprovider.go); authorization
+// says what they may do. Every user has a role, and routes name the roles
+// they accept:
+//
+//	staff := public.group("", requireAuth(chain), requireRole(roleAdmin, roleService))
+//
+// requireRole is a middleware factory: a function that takes settings and
+// returns a Middleware (func(http.Handler) http.Handler) closing over them.
+// Express does the same with a higher-order function:
+//
+//	const requireRole = (...roles) => (req, res, next) =>
+//	  roles.includes(req.user?.role) ? next() : res.status(403).json({ error: 'forbidden' })
+//
+// The Go version has one more layer - it wraps a handler instead of calling
+// next() - but the closure is the same idea: roles is captured when the
+// route is set up and read on every request. rateLimit, withTimeout and
+// requireAuth are built the same way.
+
+// Roles a user can have; stored with the user, "" means roleUser
+const (
+	roleUser  = "user"  // The default: their own account only
+	roleAdmin = "admin" // Any account, and the staff routes
+)
+
+// roleService is the role of service principals (API keys, client
+// certificates); it can't be given to a user
+const roleService = "service"
+
+// errInvalidRole is returned for a role users can't have; translated (see locales/)
+var errInvalidRole = errors.New("role must be user or admin")
+
+// validRole reports whether a user may have role; "" is the default
+func validRole(role string) bool {
+	return role == "" || role == roleUser || role == roleAdmin
+}
+
+// roleOf returns u's role; users stored before roles existed have none
+func roleOf(u User) string {
+	return cmp.Or(u.Role, roleUser)
+}
+
+// requireRole only lets principals through whose role is one of roles
+// It runs after requireAuth, which puts the principal on the request; 403
+// means "we know who you are, and you may not", unlike 401's "who are you?"
+func requireRole(roles ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principalFromContext(r.Context())
+			if !ok || !slices.Contains(roles, p.Role) {
+				writeJSONError(w, http.StatusForbidden, "this route needs the role "+strings.Join(roles, " or "))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// roleRequest is the body of PUT /users/{id}/role
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// updateRoleHandler gives a user a role (PUT /users/{id}/role)
+// Only admins get here (see main.go). The change applies at once - even to
+// tokens already issued, because requireAuth loads the user on every request
+//
+//	curl -X PUT -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/users/9/role -d '{"role":"admin"}'
+func (a *api) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.userFromPath(w, r) // 400 for a non-numeric id, 404 if missing (see htmx.go)
+	if !ok {
+		return
+	}
+	payload, err := decode[roleRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if payload.Role == "" || !validRole(payload.Role) {
+		a.respondError(w, r, errInvalidRole)
+		return
+	}
+	u.Role = payload.Role
+	updated, err := a.users.Update(r.Context(), u)
+	if err != nil {
+		a.respondError(w, r, err) // 404 if deleted since the lookup
+		return
+	}
+	respondPresented(w, r, http.StatusOK, userFields, presentUser(r, updated))
+}
@@ -0,0 +1,142 @@
+// Package main - route groups with per-route timeout, body size and rate limit
+package main
+
+import (
+	"net/http" // For the mux and handler types
+	"strings"  // For splitting "METHOD /path" patterns
+	"time"     // For timeouts and rate limit windows
+)
+
+// Express has express.Router(): a mini app with its own prefix and
+// middleware, mounted with app.use('/admin', adminRouter). routeGroup is the
+// same idea on top of http.ServeMux, plus per-route limits:
+//
+//	api := newRouteGroup(mux, defaults, key)
+//	admin := api.group("/admin", requireAdmin(auth))
+//	admin.handleFunc("GET /stats", a.statsHandler)                           // GET /admin/stats
+//	api.handleFunc("POST /binary", a.upload, withBodyLimit(10<<20), withTimeout(time.Minute))
+
+// routeOptions are the limits a route runs with
+type routeOptions struct {
+	Timeout    time.Duration // Deadline for the whole request; 0 = none
+	MaxBody    int64         // Request body limit in bytes; 0 = none
+	RateLimit  int           // Requests per RateWindow per client; 0 = none
+	RateWindow time.Duration
+	Coalesce   bool // Share one handler run between identical concurrent GETs (see coalesce.go)
+	// Reject byte-identical repeats from the same caller within this window with 409; 0 = off (see dedupe.go)
+	DuplicateWindow time.Duration
+}
+
+// routeOption changes one limit for one route - the "functional options"
+// pattern, Go's answer to an options object: handle(p, h, withTimeout(time.Minute))
+type routeOption func(*routeOptions)
+
+// withTimeout gives the route its own deadline (e.g. longer for a CSV import)
+func withTimeout(d time.Duration) routeOption {
+	return func(o *routeOptions) { o.Timeout = d }
+}
+
+// withBodyLimit gives the route its own body size limit (e.g. tiny for login, large for uploads)
+func withBodyLimit(n int64) routeOption {
+	return func(o *routeOptions) { o.MaxBody = n }
+}
+
+// withRateLimit gives the route its own quota, counted separately from the default one
+func withRateLimit(limit int, window time.Duration) routeOption {
+	return func(o *routeOptions) { o.RateLimit, o.RateWindow = limit, window }
+}
+
+// withCoalescing lets identical concurrent GETs share one handler run - for
+// expensive read-only endpoints like GET /admin/stats
+func withCoalescing() routeOption {
+	return func(o *routeOptions) { o.Coalesce = true }
+}
+
+// withDuplicateWindow rejects an identical repeat of a submission within d -
+// for creating endpoints where a double-click would create two records
+func withDuplicateWindow(d time.Duration) routeOption {
+	return func(o *routeOptions) { o.DuplicateWindow = d }
+}
+
+// routeGroup registers routes under a prefix with shared middleware and default limits
+type routeGroup struct {
+	mux        *http.ServeMux
+	prefix     string
+	middleware []Middleware
+	defaults   routeOptions
+	rateKey    func(*http.Request) string
+	limiter    Middleware       // The default rate limiter, shared so all default routes share one quota
+	writes     *writeTracker    // Who wrote recently, so coalescing doesn't hide their own changes (see consistency.go)
+	submitted  *submissionGuard // Recent submissions, for withDuplicateWindow (see dedupe.go)
+}
+
+// newRouteGroup creates the root group; rateKey identifies clients for rate limiting
+func newRouteGroup(mux *http.ServeMux, defaults routeOptions, rateKey func(*http.Request) string) *routeGroup {
+	g := &routeGroup{mux: mux, defaults: defaults, rateKey: rateKey, writes: newWriteTracker(), submitted: newSubmissionGuard()}
+	if defaults.RateLimit > 0 {
+		g.limiter = rateLimit(defaults.RateLimit, defaults.RateWindow, rateKey)
+	}
+	return g
+}
+
+// group returns a child group: its prefix is appended and its middleware runs
+// after the parent's; limits, the shared limiter, the write tracker and the
+// submission guard are inherited
+func (g *routeGroup) group(prefix string, mw ...Middleware) *routeGroup {
+	child := *g // Copy the struct, then extend the copy
+	child.prefix = g.prefix + prefix
+	// A fresh slice, so appending for one child can't leak into a sibling
+	child.middleware = append(append([]Middleware{}, g.middleware...), mw...)
+	return &child
+}
+
+// handle registers h for pattern ("GET /users") under the group's prefix
+func (g *routeGroup) handle(pattern string, h http.Handler, opts ...routeOption) {
+	o := g.defaults
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Innermost first: stale-data headers, write tracking, coalescing, duplicate rejection, the body
+	// limit and timeout sit right around the handler, the group middleware (e.g. auth) and rate
+	// limit run before them - so every coalesced request is still
+	// authenticated and counted, and a shared stale answer carries its headers
+	h = markStaleReads()(h)
+	h = trackWrites(g.writes)(h)
+	if o.Coalesce {
+		h = coalesce(g.writes)(h)
+	}
+	if o.DuplicateWindow > 0 {
+		h = rejectDuplicates(g.submitted, o.DuplicateWindow)(h)
+	}
+	if o.MaxBody > 0 {
+		h = bodyLimit(o.MaxBody)(h)
+	}
+	if o.Timeout > 0 {
+		h = timeout(o.Timeout)(h)
+	}
+	h = Chain(h, g.middleware...)
+	switch {
+	case o.RateLimit == g.defaults.RateLimit && o.RateWindow == g.defaults.RateWindow:
+		if g.limiter != nil {
+			h = g.limiter(h)
+		}
+	case o.RateLimit > 0:
+		h = rateLimit(o.RateLimit, o.RateWindow, g.rateKey)(h) // A quota of its own
+	}
+
+	// "GET /tenants" in the "/admin" group becomes "GET /admin/tenants"
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	if method != "" {
+		method += " "
+	}
+	g.mux.Handle(method+g.prefix+path, h)
+}
+
+// handleFunc is handle for plain functions and methods like api.getUsersHandler
+func (g *routeGroup) handleFunc(pattern string, fn http.HandlerFunc, opts ...routeOption) {
+	g.handle(pattern, fn, opts...)
+}
@@ -0,0 +1,181 @@
+// Package main - schema-versioned JSON records: old shapes are upgraded when they are read
+package main
+
+import (
+	"encoding/json" // Records are JSON objects
+	"fmt"           // For the example's output and errors
+	"io"            // For the example's writer
+	"maps"          // For the registered kinds
+	"slices"        // For sorting them
+	"strings"       // For the example's name split
+)
+
+// A JSON column or document keeps whatever shape it had when it was written.
+// Rename "dark_mode" to "theme" in the struct and every row written before
+// the change quietly decodes to the zero value - the data isn't gone, it's
+// orphaned. A SQL column gets an ALTER TABLE (see migrations in sqlstore.go);
+// a JSON payload has no schema to alter, so each record says which shape it
+// has and is brought up to date when it's read:
+//
+//	{"schema_version": 1, "dark_mode": true}
+//	  → step 1→2: dark_mode becomes theme
+//	{"schema_version": 2, "theme": "dark"}
+//
+// That's what mongoose-migrate-on-read plugins or a "version" field with a
+// switch in a DynamoDB mapper do in Node. Each step only knows two adjacent
+// versions, so a record from any old version reaches the current one by
+// running the steps in turn. Nothing is rewritten in bulk: the next write
+// stores the new shape, and a record that is never written again keeps being
+// upgraded on read, which costs a map or two.
+//
+// The JSON this project stores is a user's settings (the settings column,
+// see settings.go); a file, bbolt or MongoDB backend would register its
+// record kinds the same way. Records written before schema_version existed
+// have none and count as version 1.
+
+// init() registers the "schema" example
+func init() {
+	registerExample("schema", schemaExamples)
+}
+
+// schemaVersionField is the key every versioned record carries
+const schemaVersionField = "schema_version"
+
+// schemaStep upgrades a record from one version to the next, in place
+// The record is the decoded JSON object, so a step can rename, move or
+// compute fields the current struct no longer has
+type schemaStep func(record map[string]any) error
+
+// recordSchema is the history of one kind of record: step i upgrades version i to i+1
+type recordSchema struct {
+	kind  string
+	steps map[int]schemaStep
+}
+
+// recordSchemas are the kinds of stored JSON, by name, for the startup check
+var recordSchemas = map[string]*recordSchema{}
+
+// newRecordSchema registers a kind of record; steps are added with step
+func newRecordSchema(kind string) *recordSchema {
+	s := &recordSchema{kind: kind, steps: map[int]schemaStep{}}
+	recordSchemas[kind] = s
+	return s
+}
+
+// step registers the upgrade from version from to from+1 and returns s, so
+// steps can be chained where the schema is declared
+func (s *recordSchema) step(from int, fn schemaStep) *recordSchema {
+	if _, ok := s.steps[from]; ok {
+		panic(fmt.Sprintf("schema %s: step %d→%d registered twice", s.kind, from, from+1))
+	}
+	s.steps[from] = fn
+	return s
+}
+
+// current is the version new records are written with: one past the last step
+func (s *recordSchema) current() int {
+	return len(s.steps) + 1
+}
+
+// check reports a gap in the steps: 1→2 and 3→4 without 2→3 can't upgrade anything from version 1
+func (s *recordSchema) check() error {
+	for v := 1; v < s.current(); v++ {
+		if s.steps[v] == nil {
+			return fmt.Errorf("schema %s: no step %d→%d", s.kind, v, v+1)
+		}
+	}
+	return nil
+}
+
+// stamp adds the current schema_version to a record about to be stored
+func (s *recordSchema) stamp(data []byte) ([]byte, error) {
+	var record map[string]any
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	record[schemaVersionField] = s.current()
+	return json.Marshal(record) // Map keys come out sorted, so equal records are equal bytes
+}
+
+// upgrade brings a stored record to the current version and returns it
+// without schema_version, ready to unmarshal into today's struct
+// A record from a newer version than this binary knows is an error: after
+// a rollback, guessing its shape could lose what the newer version wrote
+func (s *recordSchema) upgrade(data []byte) ([]byte, error) {
+	var record map[string]any
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	version := 1
+	if raw, ok := record[schemaVersionField]; ok {
+		n, ok := raw.(float64) // encoding/json decodes every number in a map[string]any as float64
+		if !ok || n != float64(int(n)) || n < 1 {
+			return nil, fmt.Errorf("%s record: invalid %s %v", s.kind, schemaVersionField, raw)
+		}
+		version = int(n)
+	}
+	if version > s.current() {
+		return nil, fmt.Errorf("%s record: version %d is newer than this server's %d", s.kind, version, s.current())
+	}
+	delete(record, schemaVersionField)
+	for ; version < s.current(); version++ {
+		if err := s.steps[version](record); err != nil {
+			return nil, fmt.Errorf("%s record: upgrading from version %d: %w", s.kind, version, err)
+		}
+	}
+	return json.Marshal(record)
+}
+
+// checkRecordSchemas checks every registered kind, for startup (see main.go)
+func checkRecordSchemas() error {
+	for _, kind := range slices.Sorted(maps.Keys(recordSchemas)) {
+		if err := recordSchemas[kind].check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaExamples upgrades records of a made-up "profile" kind through three versions
+func schemaExamples(w io.Writer) {
+	profile := &recordSchema{kind: "profile", steps: map[int]schemaStep{}} // Not registered: just for the demo
+	profile.
+		// 1→2: "name" was split into first and last name
+		step(1, func(r map[string]any) error {
+			name, _ := r["name"].(string)
+			first, last := name, ""
+			if i := strings.LastIndex(name, " "); i >= 0 {
+				first, last = name[:i], name[i+1:]
+			}
+			r["first_name"], r["last_name"] = first, last
+			delete(r, "name")
+			return nil
+		}).
+		// 2→3: the boolean dark_mode became a theme with more than two values
+		step(2, func(r map[string]any) error {
+			r["theme"] = "light"
+			if dark, _ := r["dark_mode"].(bool); dark {
+				r["theme"] = "dark"
+			}
+			delete(r, "dark_mode")
+			return nil
+		})
+
+	fmt.Fprintf(w, "profile records are at version %d\n\n", profile.current())
+	for _, stored := range []string{
+		`{"name": "Ada Lovelace", "dark_mode": true}`,                                            // Written before versioning: version 1
+		`{"schema_version": 2, "first_name": "Alan", "last_name": "Turing", "dark_mode": false}`, // One step behind
+		`{"schema_version": 3, "first_name": "Grace", "last_name": "Hopper", "theme": "dark"}`,   // Current: no step runs
+		`{"schema_version": 4, "first_name": "Future"}`,                                          // From a newer server
+	} {
+		fmt.Fprintf(w, "stored:   %s\n", stored)
+		upgraded, err := profile.upgrade([]byte(stored))
+		if err != nil {
+			fmt.Fprintf(w, "error:    %v\n\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "upgraded: %s\n", upgraded)
+		again, _ := profile.stamp(upgraded)
+		fmt.Fprintf(w, "written:  %s\n\n", again)
+	}
+}
@@ -0,0 +1,638 @@
+// Package main - SCIM 2.0 user provisioning for identity providers (Okta, Entra ID, ...)
+package main
+
+import (
+	"encoding/json" // For SCIM bodies and PATCH values
+	"errors"        // For telling store errors apart
+	"fmt"           // For error details
+	"net/http"      // For the handlers
+	"slices"        // For sorting the list
+	"strconv"       // For IDs and paging parameters
+	"strings"       // For filters and attribute paths
+	"time"          // For meta timestamps
+)
+
+// SCIM (RFC 7643/7644) is how a company's identity provider creates,
+// updates and removes accounts in the apps it manages: add someone to the
+// "Users API" app in Okta and Okta POSTs them to /scim/v2/Users; remove them
+// and it PATCHes active to false. In Node you'd reach for scimmy or
+// scim-node; the part IdPs actually use is small enough to map by hand onto
+// the UserService:
+//
+//	SCIM                           here
+//	id                             User.ID
+//	userName                       User.Email (our unique key per tenant)
+//	displayName / name.formatted   User.Name
+//	emails[primary]                User.Email
+//	active: false                  DELETE /users/{id} (soft delete, purged later)
+//	password                       hashed like POST /users (see password.go)
+//
+// Supported: GET/POST /Users, GET/PUT/PATCH/DELETE /Users/{id}, filters
+// with eq, ne, co, sw, ew and pr joined by "and", startIndex/count paging,
+// and the discovery endpoints. Not supported (and declared so in
+// /ServiceProviderConfig): Groups, /Bulk, sorting, ETags, or. There's no
+// "disabled" user here, so a deactivated user is soft-deleted: it disappears
+// from /Users, and reactivating it in the IdP creates it again.
+
+// SCIM schema URNs
+const (
+	scimUserSchema      = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema      = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchSchema     = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema     = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSPConfigSchema  = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimResTypeSchema   = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	scimSchemaSchema    = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	scimContentType     = "application/scim+json"
+	scimMaxResults      = 200 // Largest ?count= honoured; also the page size without one
+	scimDefaultStartIdx = 1   // SCIM pages count from 1
+)
+
+// scimError is the SCIM error body (RFC 7644 section 3.12)
+// status is a string there, unlike everywhere else
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"` // invalidFilter, uniqueness, invalidPath, ...
+	Detail   string   `json:"detail"`
+}
+
+// respondSCIM writes v with SCIM's media type
+func respondSCIM[T any](w http.ResponseWriter, status int, v T) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// respondSCIMError writes a SCIM error; scimType may be empty
+func respondSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	respondSCIM(w, status, scimError{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// decodeSCIM decodes a request body like decode, answering failures as SCIM errors
+func decodeSCIM[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
+	v, err := decode[T](r)
+	if err != nil {
+		status, detail := http.StatusBadRequest, err.Error()
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			status, detail = reqErr.Status, reqErr.Message
+		}
+		respondSCIMError(w, status, "invalidSyntax", detail)
+		return v, false
+	}
+	return v, true
+}
+
+// scimName is the complex "name" attribute; only formatted is kept
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// scimEmail is one entry of "emails"
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// scimMeta describes the resource (RFC 7643 section 3.1)
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// scimUser is the SCIM representation of a User, in and out
+// Active is a pointer so a PUT without it can be told from "active": false
+type scimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"` // Accepted, not stored
+	UserName    string      `json:"userName"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Name        *scimName   `json:"name,omitempty"`
+	Emails      []scimEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Password    string      `json:"password,omitempty"` // Write-only: never in responses
+	Meta        *scimMeta   `json:"meta,omitempty"`
+}
+
+// scimListResponse is the body of GET /Users
+type scimListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []scimUser `json:"Resources"` // Capitalized, as the RFC spells it
+}
+
+// toSCIM converts a stored user for a response
+func toSCIM(r *http.Request, u User) scimUser {
+	active := true // Deactivated users are soft-deleted, so every user we can see is active
+	return scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          strconv.Itoa(u.ID),
+		UserName:    u.Email,
+		DisplayName: u.Name,
+		Name:        &scimName{Formatted: u.Name},
+		Emails:      []scimEmail{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     apiBaseURL(r).withPath("scim", "v2", "Users", strconv.Itoa(u.ID)).String(),
+		},
+	}
+}
+
+// apply copies the attributes of s onto u: the user's name and email
+// IdPs differ in what they fill in, so the name is displayName, else
+// name.formatted, else given and family name; the email is the primary
+// email, else userName
+func (s scimUser) apply(u User) User {
+	switch {
+	case s.DisplayName != "":
+		u.Name = s.DisplayName
+	case s.Name != nil && s.Name.Formatted != "":
+		u.Name = s.Name.Formatted
+	case s.Name != nil && (s.Name.GivenName != "" || s.Name.FamilyName != ""):
+		u.Name = strings.TrimSpace(s.Name.GivenName + " " + s.Name.FamilyName)
+	}
+	u.Email = s.UserName
+	for _, e := range s.Emails {
+		if e.Primary && e.Value != "" {
+			u.Email = e.Value
+		}
+	}
+	return u
+}
+
+// scimStoreError answers an error from the UserService
+func (a *api) scimStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		respondSCIMError(w, http.StatusNotFound, "", err.Error())
+	case errors.Is(err, errDuplicateEmail):
+		respondSCIMError(w, http.StatusConflict, "uniqueness", "userName "+err.Error())
+	default:
+		// Validation: "name is required" and the like (see validate.go)
+		respondSCIMError(w, http.StatusBadRequest, "invalidValue", a.errorText(r, err))
+	}
+}
+
+// scimUserFromPath loads the user named by {id}; on failure it has answered
+func (a *api) scimUserFromPath(w http.ResponseWriter, r *http.Request) (User, bool) {
+	id, err := pathInt(r, "id") // SCIM clients expect 404 for any unknown id, malformed or not
+	if err == nil {
+		var u User
+		if u, err = a.users.Get(r.Context(), tenantFromContext(r.Context()), id); err == nil {
+			return u, true
+		}
+	}
+	respondSCIMError(w, http.StatusNotFound, "", fmt.Sprintf("User %s not found", r.PathValue("id")))
+	return User{}, false
+}
+
+// scimListUsersHandler lists users (GET /scim/v2/Users)
+// IdPs mostly call it with a filter to find an existing account before creating one:
+//
+//	curl -H "X-API-Key: $KEY" 'localhost:8080/scim/v2/Users?filter=userName eq "ada@example.com"'
+func (a *api) scimListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := parseSCIMFilter(q.Get("filter"))
+	if err != nil {
+		respondSCIMError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	start, count := scimDefaultStartIdx, scimMaxResults
+	if v := q.Get("startIndex"); v != "" {
+		// Values below 1 are read as 1 (RFC 7644 section 3.4.2.4)
+		if start, err = strconv.Atoi(v); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", "startIndex must be a number")
+			return
+		}
+		start = max(start, 1)
+	}
+	if v := q.Get("count"); v != "" {
+		if count, err = strconv.Atoi(v); err != nil {
+			respondSCIMError(w, http.StatusBadRequest, "invalidValue", "count must be a number")
+			return
+		}
+		count = min(max(count, 0), scimMaxResults)
+	}
+
+	var matched []User
+	for _, u := range a.users.List(r.Context(), tenantFromContext(r.Context())) {
+		if filter.matches(u) {
+			matched = append(matched, u)
+		}
+	}
+	// Stable paging needs a stable order
+	slices.SortFunc(matched, func(x, y User) int { return x.ID - y.ID })
+
+	page := []scimUser{}
+	for i := start - 1; i < len(matched) && len(page) < count; i++ {
+		page = append(page, toSCIM(r, matched[i]))
+	}
+	respondSCIM(w, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(matched),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// scimGetUserHandler returns one user (GET /scim/v2/Users/{id})
+func (a *api) scimGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.scimUserFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondSCIM(w, http.StatusOK, toSCIM(r, u))
+}
+
+// scimCreateUserHandler provisions a user (POST /scim/v2/Users)
+// A duplicate userName is 409 with scimType "uniqueness"; IdPs then look
+// the user up with a filter and link to it
+//
+//	curl -X POST -H "X-API-Key: $KEY" localhost:8080/scim/v2/Users -d '{
+//	  "schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],
+//	  "userName":"katherine@example.com","name":{"givenName":"Katherine","familyName":"Johnson"}}'
+func (a *api) scimCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := decodeSCIM[scimUser](w, r)
+	if !ok {
+		return
+	}
+	if payload.Active != nil && !*payload.Active {
+		respondSCIMError(w, http.StatusBadRequest, "invalidValue", "can't create an inactive user")
+		return
+	}
+	u := payload.apply(User{TenantID: tenantFromContext(r.Context())})
+	u.Password = payload.Password
+	created, err := a.users.Create(r.Context(), u)
+	if err != nil {
+		a.scimStoreError(w, r, err)
+		return
+	}
+	body := toSCIM(r, created)
+	w.Header().Set("Location", body.Meta.Location)
+	respondSCIM(w, http.StatusCreated, body)
+}
+
+// scimReplaceUserHandler replaces a user (PUT /scim/v2/Users/{id})
+// "active": false deprovisions, like PATCH
+func (a *api) scimReplaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.scimUserFromPath(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := decodeSCIM[scimUser](w, r)
+	if !ok {
+		return
+	}
+	if payload.Active != nil && !*payload.Active {
+		a.scimDeactivate(w, r, u)
+		return
+	}
+	a.scimSave(w, r, payload.apply(u))
+}
+
+// scimPatchOp is one operation of a PatchOp request
+type scimPatchOp struct {
+	Op    string          `json:"op"`              // add, replace or remove; IdPs differ in case
+	Path  string          `json:"path,omitempty"`  // Empty: value is an object of attributes
+	Value json.RawMessage `json:"value,omitempty"` // A string, a bool (or "True"/"False"), or an object
+}
+
+// scimPatchRequest is the body of PATCH /scim/v2/Users/{id}
+type scimPatchRequest struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+// scimPatchUserHandler changes some attributes (PATCH /scim/v2/Users/{id})
+// The two shapes IdPs send:
+//
+//	{"op":"replace","value":{"active":false}}                  (Okta)
+//	{"op":"Replace","path":"active","value":"False"}           (Entra ID)
+//	{"op":"replace","path":"emails[type eq \"work\"].value","value":"new@example.com"}
+func (a *api) scimPatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.scimUserFromPath(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := decodeSCIM[scimPatchRequest](w, r)
+	if !ok {
+		return
+	}
+	if !slices.Contains(payload.Schemas, scimPatchSchema) {
+		respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "schemas must contain "+scimPatchSchema)
+		return
+	}
+
+	active := true
+	for _, op := range payload.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		case "remove":
+			// Every attribute we map is required, so there's nothing to remove
+			respondSCIMError(w, http.StatusBadRequest, "mutability", "attribute "+op.Path+" can't be removed")
+			return
+		default:
+			respondSCIMError(w, http.StatusBadRequest, "invalidSyntax", "unknown op "+op.Op)
+			return
+		}
+		// Without a path, value is an object: apply each of its attributes
+		attrs := map[string]json.RawMessage{op.Path: op.Value}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				respondSCIMError(w, http.StatusBadRequest, "invalidValue", "value must be an object when path is empty")
+				return
+			}
+		}
+		for path, value := range attrs {
+			if err := scimPatchAttr(&u, &active, path, value); err != nil {
+				respondSCIMError(w, http.StatusBadRequest, "invalidPath", err.Error())
+				return
+			}
+		}
+	}
+	if !active {
+		a.scimDeactivate(w, r, u)
+		return
+	}
+	a.scimSave(w, r, u)
+}
+
+// scimPatchAttr applies one attribute of a PATCH to u
+func scimPatchAttr(u *User, active *bool, path string, value json.RawMessage) error {
+	switch strings.ToLower(path) {
+	case "active":
+		b, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		*active = b
+	case "username", "emails", `emails[type eq "work"].value`, "emails.value":
+		if strings.ToLower(path) == "emails" {
+			var emails []scimEmail
+			if err := json.Unmarshal(value, &emails); err != nil || len(emails) == 0 {
+				return errors.New("emails must be a non-empty list")
+			}
+			u.Email = emails[0].Value
+			for _, e := range emails {
+				if e.Primary {
+					u.Email = e.Value
+				}
+			}
+			return nil
+		}
+		return json.Unmarshal(value, &u.Email)
+	case "displayname", "name.formatted":
+		return json.Unmarshal(value, &u.Name)
+	case "name":
+		var n scimName
+		if err := json.Unmarshal(value, &n); err != nil {
+			return err
+		}
+		*u = scimUser{UserName: u.Email, Name: &n}.apply(*u)
+	case "externalid", "password", "schemas", "id", "meta":
+		// externalId isn't stored; password changes go through PUT /users/{id}/password,
+		// which asks for the current one; the rest are read-only - ignored, not errors,
+		// because IdPs send whole objects back
+	default:
+		return fmt.Errorf("unsupported attribute %q", path)
+	}
+	return nil
+}
+
+// scimBool reads a boolean that some IdPs send as a string ("False")
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, errors.New("active must be true or false")
+}
+
+// scimSave stores the changed user and answers with it
+func (a *api) scimSave(w http.ResponseWriter, r *http.Request, u User) {
+	updated, err := a.users.Update(r.Context(), u)
+	if err != nil {
+		a.scimStoreError(w, r, err)
+		return
+	}
+	respondSCIM(w, http.StatusOK, toSCIM(r, updated))
+}
+
+// scimDeactivate deprovisions u: soft delete, so it's purged after the
+// retention period (see purge.go); the response shows it inactive
+func (a *api) scimDeactivate(w http.ResponseWriter, r *http.Request, u User) {
+	if err := a.users.Delete(r.Context(), u.TenantID, u.ID); err != nil {
+		a.scimStoreError(w, r, err)
+		return
+	}
+	body := toSCIM(r, u)
+	inactive := false
+	body.Active = &inactive
+	respondSCIM(w, http.StatusOK, body)
+}
+
+// scimDeleteUserHandler deprovisions a user (DELETE /scim/v2/Users/{id})
+func (a *api) scimDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.scimUserFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := a.users.Delete(r.Context(), u.TenantID, u.ID); err != nil {
+		a.scimStoreError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimFilterCond is one "attribute op value" comparison
+type scimFilterCond struct {
+	attr  string // Lower case
+	op    string // eq, ne, co, sw, ew, pr
+	value string
+}
+
+// scimFilter is a list of conditions that must all hold
+type scimFilter []scimFilterCond
+
+// scimFilterAttrs are the attributes a filter may use
+var scimFilterAttrs = []string{"id", "username", "displayname", "name.formatted", "emails", "emails.value", "active"}
+
+// parseSCIMFilter parses the supported subset of SCIM filters:
+// conditions like userName eq "ada@example.com" or displayName pr, joined
+// by "and". Attribute and operator names are case-insensitive
+func parseSCIMFilter(s string) (scimFilter, error) {
+	var f scimFilter
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		attr, after, _ := strings.Cut(rest, " ")
+		op, after, _ := strings.Cut(strings.TrimLeft(after, " "), " ")
+		c := scimFilterCond{attr: strings.ToLower(attr), op: strings.ToLower(op)}
+		if !slices.Contains(scimFilterAttrs, c.attr) {
+			return nil, fmt.Errorf("unsupported filter attribute %q", attr)
+		}
+		after = strings.TrimLeft(after, " ")
+		switch c.op {
+		case "pr":
+		case "eq", "ne", "co", "sw", "ew":
+			// The value is a JSON string, or true/false for active
+			if strings.HasPrefix(after, `"`) {
+				end := strings.Index(after[1:], `"`)
+				if end < 0 {
+					return nil, errors.New("unterminated string in filter")
+				}
+				c.value, after = after[1:end+1], after[end+2:]
+			} else {
+				c.value, after, _ = strings.Cut(after, " ")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported filter operator %q", op)
+		}
+		f = append(f, c)
+
+		rest = strings.TrimSpace(after)
+		if rest == "" {
+			break
+		}
+		and, next, _ := strings.Cut(rest, " ")
+		if !strings.EqualFold(and, "and") {
+			return nil, fmt.Errorf("expected \"and\" in filter, got %q (or, not and grouping aren't supported)", and)
+		}
+		rest = strings.TrimSpace(next)
+		if rest == "" {
+			return nil, errors.New("filter ends with \"and\"")
+		}
+	}
+	return f, nil
+}
+
+// matches reports whether u passes every condition
+// Comparisons ignore case: userName and emails are caseExact=false in RFC 7643
+func (f scimFilter) matches(u User) bool {
+	for _, c := range f {
+		var got string
+		switch c.attr {
+		case "id":
+			got = strconv.Itoa(u.ID)
+		case "username", "emails", "emails.value":
+			got = u.Email
+		case "displayname", "name.formatted":
+			got = u.Name
+		case "active":
+			got = "true"
+		}
+		got, want := strings.ToLower(got), strings.ToLower(c.value)
+		var ok bool
+		switch c.op {
+		case "pr":
+			ok = got != ""
+		case "eq":
+			ok = got == want
+		case "ne":
+			ok = got != want
+		case "co":
+			ok = strings.Contains(got, want)
+		case "sw":
+			ok = strings.HasPrefix(got, want)
+		case "ew":
+			ok = strings.HasSuffix(got, want)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// scimServiceProviderConfigHandler tells IdPs what this server supports
+// (GET /scim/v2/ServiceProviderConfig)
+func (a *api) scimServiceProviderConfigHandler(w http.ResponseWriter, r *http.Request) {
+	supported := func(b bool) map[string]bool { return map[string]bool{"supported": b} }
+	respondSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimSPConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{
+			{"type": "oauthbearertoken", "name": "Bearer token", "description": "The admin token in Authorization: Bearer"},
+			{"type": "httpheader", "name": "API key", "description": "A key from the api_keys secret in X-API-Key"},
+		},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": apiBaseURL(r).withPath("scim", "v2", "ServiceProviderConfig").String()},
+	})
+}
+
+// scimResourceTypesHandler lists the resource types (GET /scim/v2/ResourceTypes): only User
+func (a *api) scimResourceTypesHandler(w http.ResponseWriter, r *http.Request) {
+	respondSCIM(w, http.StatusOK, scimListResponseOf([]map[string]any{{
+		"schemas":  []string{scimResTypeSchema},
+		"id":       "User",
+		"name":     "User",
+		"endpoint": "/Users",
+		"schema":   scimUserSchema,
+		"meta":     map[string]string{"resourceType": "ResourceType", "location": apiBaseURL(r).withPath("scim", "v2", "ResourceTypes", "User").String()},
+	}}))
+}
+
+// scimSchemasHandler describes the User attributes we support (GET /scim/v2/Schemas)
+func (a *api) scimSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	attr := func(name, typ string, required bool, mutability, uniqueness string) map[string]any {
+		return map[string]any{
+			"name": name, "type": typ, "multiValued": name == "emails", "required": required,
+			"caseExact": false, "mutability": mutability, "returned": "default", "uniqueness": uniqueness,
+		}
+	}
+	password := attr("password", "string", false, "writeOnly", "none")
+	password["returned"] = "never"
+	respondSCIM(w, http.StatusOK, scimListResponseOf([]map[string]any{{
+		"schemas":     []string{scimSchemaSchema},
+		"id":          scimUserSchema,
+		"name":        "User",
+		"description": "User account",
+		"attributes": []map[string]any{
+			attr("userName", "string", true, "readWrite", "server"),
+			attr("displayName", "string", true, "readWrite", "none"),
+			attr("name", "complex", false, "readWrite", "none"),
+			attr("emails", "complex", false, "readWrite", "none"),
+			attr("active", "boolean", false, "readWrite", "none"),
+			password,
+		},
+		"meta": map[string]string{"resourceType": "Schema", "location": apiBaseURL(r).withPath("scim", "v2", "Schemas", scimUserSchema).String()},
+	}}))
+}
+
+// scimListResponseOf wraps discovery resources in a ListResponse
+func scimListResponseOf(resources []map[string]any) map[string]any {
+	return map[string]any{
+		"schemas":      []string{scimListSchema},
+		"totalResults": len(resources),
+		"startIndex":   1,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	}
+}
@@ -0,0 +1,113 @@
+// Package main - scopes: what a token or API key may be used for, and the requireScope middleware
+package main
+
+import (
+	"errors"   // For errInvalidScope
+	"fmt"      // For naming the bad scope
+	"net/http" // For the middleware
+	"slices"   // For scope lists
+	"strings"  // Scope strings are space-separated
+)
+
+// A role (roles.go) says what a user may do; a scope says what one
+// credential may be used for. An admin's everyday token doesn't need to be
+// able to hand out roles, and a reporting job's API key only needs to read -
+// if either leaks, the damage stops at its scopes. It's OAuth 2's "scope":
+//
+//	POST /auth/login {"email":...,"password":...,"scope":"users:read"}
+//	→ {"token":...,"scope":"users:read"}      a token that can't write
+//
+// Routes name the scope they need, like express-oauth2-jwt-bearer's
+// requiredScopes('users:write'):
+//
+//	authed := public.group("", requireAuth(chain), requireScope(scopeUsersWrite))
+//
+// A credential never holds more than its role allows: the scopes in an old
+// token are checked against the role the user has now, so demoting an
+// admin takes their "admin" scope away at once.
+
+// Scopes routes can require
+const (
+	scopeUsersRead  = "users:read"  // Read users where reading needs credentials (SCIM)
+	scopeUsersWrite = "users:write" // Create, change and delete users
+	scopeAdmin      = "admin"       // Hand out roles
+)
+
+// roleScopes are the scopes each role can hold; credentials carry a subset
+var roleScopes = map[string][]string{
+	roleUser:    {scopeUsersRead, scopeUsersWrite},
+	roleAdmin:   {scopeUsersRead, scopeUsersWrite, scopeAdmin},
+	roleService: {scopeUsersRead, scopeUsersWrite},
+	roleGuest:   {scopeUsersRead}, // Anonymous tokens only read (see guest.go)
+}
+
+// errInvalidScope is returned for a requested scope the role can't hold
+var errInvalidScope = errors.New("invalid scope")
+
+// parseScopes splits a space-separated scope string
+// The result is never nil: "" is a credential with no scopes, not one with all
+func parseScopes(s string) []string {
+	if scopes := strings.Fields(s); scopes != nil {
+		return scopes
+	}
+	return []string{}
+}
+
+// narrowScopes checks the scopes a login asks for against what role can hold
+// Nothing requested returns nil: everything the role allows, now and after a promotion
+func narrowScopes(role string, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	allowed := roleScopes[role]
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("%w: %s", errInvalidScope, s)
+		}
+	}
+	scopes := slices.Clone(requested)
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+// effectiveScopes are the scopes a credential has right now: those it was
+// granted that its role still allows; nil granted means the role's full set
+// (tokens from before scopes, keys configured without any)
+func effectiveScopes(role string, granted []string) []string {
+	allowed := roleScopes[role]
+	if granted == nil {
+		return slices.Clone(allowed)
+	}
+	scopes := []string{}
+	for _, s := range allowed {
+		if slices.Contains(granted, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// scopeErrorResponse is the body of a 403 for a missing scope
+type scopeErrorResponse struct {
+	errorBody        // {"code":"insufficient_scope", ...}
+	Scope     string `json:"scope"` // The missing scope, for clients to ask for
+}
+
+// requireScope only lets principals through that hold every one of scopes
+// It runs after requireAuth. The 403 names the first missing scope in the
+// body and, as RFC 6750 says, in WWW-Authenticate
+func requireScope(scopes ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := principalFromContext(r.Context())
+			for _, s := range scopes {
+				if !slices.Contains(p.Scopes, s) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="users", error="insufficient_scope", scope=%q`, s))
+					respondJSON(w, http.StatusForbidden, scopeErrorResponse{newErrorBody("insufficient_scope", "missing scope "+s), s})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,375 @@
+// Package main - pluggable secret providers (env, HashiCorp Vault, AWS SSM Parameter Store)
+package main
+
+import (
+	"bytes"         // For the SSM request body
+	"cmp"           // For the env secrets' alias names
+	"context"       // For cancelling provider calls and the refresh loop
+	"crypto/hmac"   // AWS Signature V4 uses HMAC-SHA256 chains
+	"crypto/sha256" // For SigV4 signing keys
+	"encoding/hex"  // For SigV4 hex digests
+	"encoding/json" // Vault and SSM both speak JSON
+	"errors"        // For sentinel errors
+	"fmt"           // For building error messages and URLs
+	"log/slog"      // For logging rotation events
+	"net/http"      // For calling Vault and AWS
+	"os"            // For environment variables
+	"strings"       // For upper-casing env names and splitting paths
+	"sync"          // For the cache mutex
+	"time"          // For TTLs, refresh intervals and SigV4 timestamps
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For SigV4 payload hashes
+)
+
+// errSecretNotFound is returned when a provider has no value for a name
+var errSecretNotFound = errors.New("secret not found")
+
+// SecretProvider fetches secret values by logical name ("admin_token", "db_password")
+// In Node you'd reach for dotenv, node-vault or @aws-sdk/client-ssm; here each
+// backend is a small type implementing this one-method interface, and the
+// server only ever talks to the interface
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// newSecretProvider picks a backend from SECRETS_PROVIDER (env, vault or ssm)
+// transport carries the HTTP calls of the remote backends (see breaker.go)
+func newSecretProvider(transport http.RoundTripper) (SecretProvider, error) {
+	switch p := os.Getenv("SECRETS_PROVIDER"); p {
+	case "", "env":
+		return envSecrets{}, nil
+	case "vault":
+		return newVaultSecrets(transport)
+	case "ssm":
+		return newSSMSecrets(transport)
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (want env, vault or ssm)", p)
+	}
+}
+
+// envSecrets reads secrets from environment variables: "admin_token" → $ADMIN_TOKEN
+// An empty struct is fine as a receiver when there's no state to hold
+type envSecrets struct{}
+
+// envSecretAliases are other variable names a secret is read from when its
+// own isn't set - the names Node projects usually give them (see envconfig.go)
+var envSecretAliases = map[string]string{
+	"jwt_signing_key": "JWT_SECRET",
+}
+
+// GetSecret implements SecretProvider
+func (envSecrets) GetSecret(_ context.Context, name string) (string, error) {
+	if v := cmp.Or(os.Getenv(strings.ToUpper(name)), os.Getenv(envSecretAliases[name])); v != "" {
+		return v, nil
+	}
+	return "", errSecretNotFound
+}
+
+// vaultSecrets reads a HashiCorp Vault KV v2 secret: every logical name is a
+// key inside one secret at <mount>/data/<path>
+type vaultSecrets struct {
+	addr   string // VAULT_ADDR, e.g. https://vault.internal:8200
+	token  string // VAULT_TOKEN
+	mount  string // VAULT_MOUNT (default "secret")
+	path   string // VAULT_SECRET_PATH (default "go-user-api")
+	client *http.Client
+}
+
+// newVaultSecrets configures the Vault provider from the environment
+func newVaultSecrets(transport http.RoundTripper) (*vaultSecrets, error) {
+	v := &vaultSecrets{
+		addr:   strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		token:  os.Getenv("VAULT_TOKEN"),
+		mount:  envOr("VAULT_MOUNT", "secret"),
+		path:   envOr("VAULT_SECRET_PATH", "go-user-api"),
+		client: &http.Client{Timeout: 5 * time.Second, Transport: transport}, // Never wait forever on a dependency
+	}
+	if v.addr == "" || v.token == "" {
+		return nil, errors.New("vault secrets need VAULT_ADDR and VAULT_TOKEN")
+	}
+	return v, nil
+}
+
+// GetSecret implements SecretProvider
+func (v *vaultSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", v.addr, v.mount, v.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() // Always close response bodies or connections leak
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: unexpected status %s", resp.Status)
+	}
+
+	// KV v2 nests the values twice: {"data": {"data": {"admin_token": "..."}}}
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	value, ok := body.Data.Data[name]
+	if !ok {
+		return "", errSecretNotFound
+	}
+	return value, nil
+}
+
+// ssmSecrets reads AWS Systems Manager Parameter Store values: "admin_token" →
+// parameter "<SSM_PREFIX>/admin_token" (SecureString values are decrypted)
+// Requests are signed with AWS Signature V4 by hand so no SDK is needed
+type ssmSecrets struct {
+	region       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// newSSMSecrets configures the SSM provider from the standard AWS env vars
+func newSSMSecrets(transport http.RoundTripper) (*ssmSecrets, error) {
+	s := &ssmSecrets{
+		region:       os.Getenv("AWS_REGION"),
+		prefix:       strings.TrimSuffix(envOr("SSM_PREFIX", "/go-user-api"), "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 5 * time.Second, Transport: transport},
+	}
+	if s.region == "" || s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("ssm secrets need AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+// GetSecret implements SecretProvider using the SSM GetParameter JSON API
+func (s *ssmSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	payload, err := json.Marshal(map[string]any{
+		"Name":           s.prefix + "/" + name,
+		"WithDecryption": true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	host := "ssm." + s.region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonSSM.GetParameter")
+	s.sign(req, host, payload, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		// SSM reports missing parameters as 400 ParameterNotFound
+		return "", errSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ssm: unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.Parameter.Value, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+// Steps: canonical request → string to sign → derived key → signature
+func (s *ssmSecrets) sign(req *http.Request, host string, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z") // Go formats dates with a reference time, not YYYY
+	day := now.Format("20060102")
+	payloadHash := cryptoutil.SHA256Hex(payload)
+
+	req.Header.Set("Host", host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	signed := "content-type;host;x-amz-date;x-amz-target"
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+		signed = "content-type;host;x-amz-date;x-amz-security-token;x-amz-target"
+	}
+
+	// Canonical headers must be lowercase, sorted and newline-terminated
+	var canonicalHeaders strings.Builder
+	for _, h := range strings.Split(signed, ";") {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signed, payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/ssm/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, cryptoutil.SHA256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	// The signing key is derived by chaining HMACs over date, region and service
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "ssm")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signed, signature))
+}
+
+// hmacSHA256 returns the raw HMAC-SHA256 bytes (SigV4 chains raw digests)
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// envOr returns the environment variable or a fallback when it's unset
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// cachedSecret is one value held by secretCache
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+// secretCache sits in front of a SecretProvider so request handlers never
+// wait on Vault/AWS, and refreshes values in the background so rotated
+// secrets are picked up without a restart
+type secretCache struct {
+	provider SecretProvider
+	ttl      time.Duration
+
+	mu     sync.RWMutex
+	values map[string]cachedSecret
+	hooks  map[string][]func(string) // name → callbacks run when the value changes
+}
+
+// newSecretCache wraps a provider; values older than ttl are re-fetched
+func newSecretCache(provider SecretProvider, ttl time.Duration) *secretCache {
+	return &secretCache{
+		provider: provider,
+		ttl:      ttl,
+		values:   make(map[string]cachedSecret),
+		hooks:    make(map[string][]func(string)),
+	}
+}
+
+// load fetches a secret from the provider and caches it (used at startup)
+func (c *secretCache) load(ctx context.Context, name string) (string, error) {
+	value, err := c.provider.GetSecret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err) // %w wraps err so errors.Is still works
+	}
+	c.store(name, value)
+	return value, nil
+}
+
+// current returns the cached value without calling the provider
+func (c *secretCache) current(name string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[name].value
+}
+
+// onRotate registers a callback run whenever a refresh sees a new value
+// e.g. swap the admin token or re-open a DB pool with a new password
+func (c *secretCache) onRotate(name string, fn func(newValue string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks[name] = append(c.hooks[name], fn)
+}
+
+// store saves a value and runs rotation hooks if it changed
+func (c *secretCache) store(name, value string) {
+	c.mu.Lock()
+	old, existed := c.values[name]
+	c.values[name] = cachedSecret{value: value, fetched: time.Now()}
+	hooks := c.hooks[name]
+	c.mu.Unlock() // Unlock before running hooks so they can call current()
+
+	if existed && old.value != value {
+		slog.Info("secret rotated", "secret", name)
+		for _, fn := range hooks {
+			fn(value)
+		}
+	}
+}
+
+// refresh re-fetches every cached secret older than the TTL
+// Errors keep the old value: a flaky Vault shouldn't log everyone out
+func (c *secretCache) refresh(ctx context.Context) {
+	c.mu.RLock()
+	var stale []string
+	for name, s := range c.values {
+		if time.Since(s.fetched) >= c.ttl {
+			stale = append(stale, name)
+		}
+	}
+	c.mu.RUnlock()
+
+	// A few quick retries ride out a blip; a missing secret won't appear by retrying
+	policy := defaultRetryPolicy
+	policy.Retryable = func(err error) bool {
+		return isRetryable(err) && !errors.Is(err, errSecretNotFound)
+	}
+	for _, name := range stale {
+		err := retryDo(ctx, policy, func(ctx context.Context) error {
+			_, err := c.load(ctx, name)
+			return err
+		})
+		if err != nil {
+			slog.Warn("secret refresh failed, keeping cached value", "err", err)
+		}
+	}
+}
+
+// watch refreshes secrets every interval until ctx is cancelled
+// Run it in a goroutine: go cache.watch(ctx, time.Minute)
+func (c *secretCache) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval) // Like setInterval
+	defer ticker.Stop()
+	for {
+		// select waits on several channels at once, like Promise.race
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refresh(ctx)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package main - an embedded demo dataset loaded with -seed-on-start
+package main
+
+import (
+	"context"       // For the store calls
+	_ "embed"       // Blank import: needed for //go:embed into a plain []byte
+	"encoding/json" // The seed file is JSON
+	"fmt"           // For wrapping errors with the failing record
+)
+
+// seedJSON is seed/seed.json, compiled into the binary
+// Embedding into a []byte (instead of embed.FS) is the one-file shortcut
+//
+//go:embed seed/seed.json
+var seedJSON []byte
+
+// seedData mirrors the layout of seed/seed.json
+type seedData struct {
+	Tenants []Tenant `json:"tenants"`
+	Users   []struct {
+		Tenant string `json:"tenant"`
+		Name   string `json:"name"`
+		Email  string `json:"email"`
+		Role   string `json:"role,omitempty"` // "" = roleUser
+	} `json:"users"`
+}
+
+// seedStore loads the embedded dataset into an empty store
+// It is idempotent: when any user already exists nothing is touched, so
+// restarting with -seed-on-start never duplicates data - the same guard a
+// knex/sequelize seed script needs so it can run on every boot
+// Returns the number of users created
+// Any UserStore works; seeding talks to the store directly, so no events fire
+func seedStore(ctx context.Context, store UserStore, tenants *tenantStore) (int, error) {
+	if store.Stats(ctx).Total > 0 {
+		return 0, nil
+	}
+
+	var data seedData
+	if err := json.Unmarshal(seedJSON, &data); err != nil {
+		return 0, fmt.Errorf("seed: %w", err)
+	}
+
+	for _, t := range data.Tenants {
+		if tenants.exists(t.ID) {
+			continue // Tenants may have been created before the first user
+		}
+		if _, err := tenants.create(t); err != nil {
+			return 0, fmt.Errorf("seed tenant %s: %w", t.ID, err)
+		}
+	}
+	for _, u := range data.Users {
+		// Through Create, so seed data passes the same validation as API input
+		if _, err := store.Create(ctx, User{Name: u.Name, Email: u.Email, Role: u.Role, TenantID: u.Tenant}); err != nil {
+			return 0, fmt.Errorf("seed user %s: %w", u.Email, err)
+		}
+	}
+	return len(data.Users), nil
+}
@@ -0,0 +1,66 @@
+// Package main - the http.Server's own timeouts and header limit, against slow and oversized clients
+package main
+
+import (
+	"net/http" // For the server
+	"time"     // For the timeouts
+)
+
+// A zero http.Server waits forever: for the headers, for the body, for the
+// client to read the response, for the next request on a keep-alive
+// connection. A slowloris client sends one header byte every few seconds
+// and holds a connection - and a goroutine, and a file descriptor - as long
+// as it likes; a few thousand of them and the server runs out. Node has had
+// defaults for this since v18 (server.headersTimeout = 60s,
+// server.requestTimeout = 300s, server.keepAliveTimeout = 5s); Go leaves
+// them to you:
+//
+//	-read-header-timeout  5s    request line and headers      (headersTimeout)
+//	-read-timeout         30s   headers and body              (requestTimeout)
+//	-write-timeout        60s   from the end of the headers to the end of the response
+//	-idle-timeout         2m    a keep-alive connection between requests (keepAliveTimeout)
+//	-max-header-bytes     64KiB request line and headers       (--max-http-header-size, 16KiB in Node)
+//
+// They cover a request until a route picks it up. A route's timeout (see
+// withTimeout in router.go and timeout in express_middleware.go) then
+// moves both deadlines for its handler, so a 2-minute upload isn't cut off
+// at -read-timeout and a 10-minute download at -write-timeout; the
+// WebSocket route, with no timeout, sets deadlines per frame (see
+// websocket.go). 0 turns a timeout off, as in net/http.
+//
+// Bodies are limited per route instead (-max-body by default, withBodyLimit
+// to change it, see bodyLimit): a body that declares a larger Content-Length
+// is 413 before the handler runs, one that turns out larger while it's read
+// is 413 from the handler that reads it (see decode in jsonio.go).
+
+// serverLimits are the timeouts and header limit main() gives the http.Server
+type serverLimits struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+}
+
+// check records limits that can't work (see configcheck.go)
+// A header timeout longer than the read timeout would never fire, and
+// headers smaller than 1 KiB don't fit a JWT
+func (l serverLimits) check(c *configCheck) {
+	c.checkDuration("-read-header-timeout", l.ReadHeaderTimeout, 0, 0)
+	c.checkDuration("-read-timeout", l.ReadTimeout, 0, 0)
+	c.checkDuration("-write-timeout", l.WriteTimeout, 0, 0)
+	c.checkDuration("-idle-timeout", l.IdleTimeout, 0, 0)
+	c.checkInt("-max-header-bytes", l.MaxHeaderBytes, 1<<10, 1<<20)
+	if l.ReadTimeout > 0 && l.ReadHeaderTimeout > l.ReadTimeout {
+		c.addf("-read-header-timeout, -read-timeout", "%s is longer than -read-timeout %s", l.ReadHeaderTimeout, l.ReadTimeout)
+	}
+}
+
+// apply sets the limits on srv
+func (l serverLimits) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = l.ReadHeaderTimeout
+	srv.ReadTimeout = l.ReadTimeout
+	srv.WriteTimeout = l.WriteTimeout
+	srv.IdleTimeout = l.IdleTimeout
+	srv.MaxHeaderBytes = l.MaxHeaderBytes
+}
@@ -0,0 +1,195 @@
+// Package main - the user service: what handlers are allowed to do with users
+package main
+
+import (
+	"context" // Every service call takes the request's context
+	"time"    // For the purge cutoff
+)
+
+// UserService is the seam between HTTP and business logic. Handlers depend on
+// this interface, not on a UserStore, so a test can hand NewAPI a stub:
+//
+//	type stubUsers struct{ UserService } // Embed the interface, override what the test needs
+//	func (stubUsers) List(context.Context, string) []User { return []User{{ID: 1, Name: "Ada"}} }
+//
+// Nothing declares that userService "implements" UserService - having the
+// methods is enough (implicit interfaces), so stubs need no mocking library,
+// unlike jest.mock() patching a module
+type UserService interface {
+	List(ctx context.Context, tenantID string) []User
+	Query(ctx context.Context, tenantID string, q listQuery) ([]User, pageMeta, error) // One page for GET /users
+	Get(ctx context.Context, tenantID string, id int) (User, error)                    // errUserNotFound if missing
+	GetByUUID(ctx context.Context, tenantID, uuid string) (User, error)                // For {id} paths holding a UUID (see ids.go)
+	GetByEmail(ctx context.Context, tenantID, email string) (User, error)
+	Create(ctx context.Context, u User) (User, error) // Hashes u.Password if set (see password.go)
+	Update(ctx context.Context, u User) (User, error)
+	Authenticate(ctx context.Context, tenantID, email, password string) (User, error) // errInvalidCredentials on any mismatch
+	ChangePassword(ctx context.Context, tenantID string, id int, current, next string) error
+	Delete(ctx context.Context, tenantID string, id int) error        // Soft delete; Purge removes the record later
+	Purge(ctx context.Context, deletedBefore time.Time) []User        // Returns the purged users
+	Erase(ctx context.Context, tenantID string, id int) (User, error) // Hard delete at the user's request; returns the erased user
+	DeleteTenant(ctx context.Context, tenantID string)                // When the tenant itself is deleted
+	Stats(ctx context.Context) userStats
+}
+
+// userService is the real UserService: storage plus the events that follow changes
+// It works with any UserStore (see store.go); main() decides which one
+type userService struct {
+	store UserStore
+	bus   *eventBus
+}
+
+// newUserService creates the service on top of a store
+func newUserService(store UserStore, bus *eventBus) *userService {
+	return &userService{store: store, bus: bus}
+}
+
+// List returns the users of one tenant
+func (s *userService) List(ctx context.Context, tenantID string) []User {
+	return s.store.GetAll(ctx, tenantID)
+}
+
+// Query returns one page of a tenant's users, filtered and sorted by q
+func (s *userService) Query(ctx context.Context, tenantID string, q listQuery) ([]User, pageMeta, error) {
+	return s.store.Query(ctx, tenantID, q)
+}
+
+// Get returns one user of a tenant
+func (s *userService) Get(ctx context.Context, tenantID string, id int) (User, error) {
+	return s.store.GetByID(ctx, tenantID, id)
+}
+
+// GetByUUID returns one user of a tenant by UUID
+func (s *userService) GetByUUID(ctx context.Context, tenantID, uuid string) (User, error) {
+	return s.store.GetByUUID(ctx, tenantID, uuid)
+}
+
+// GetByEmail returns the user of a tenant with the given email (see userauth.go)
+func (s *userService) GetByEmail(ctx context.Context, tenantID, email string) (User, error) {
+	return s.store.GetByEmail(ctx, tenantID, email)
+}
+
+// Create validates and stores a user, then publishes user.created
+// Every way of creating a user (JSON API, HTML form) gets the welcome email
+// A plain u.Password is hashed here, so no caller can store one by accident
+func (s *userService) Create(ctx context.Context, u User) (User, error) {
+	if u.Password != "" {
+		if err := validatePassword(u.Password); err != nil {
+			return User{}, err
+		}
+		hash, err := hashPassword(u.Password)
+		if err != nil {
+			return User{}, err
+		}
+		u.PasswordHash, u.Password = hash, ""
+	}
+	created, err := s.store.Create(ctx, u)
+	if err != nil {
+		return User{}, err
+	}
+	s.bus.publish(ctx, eventUserCreated, created)
+	return created, nil
+}
+
+// Update changes an existing user, then publishes user.updated
+func (s *userService) Update(ctx context.Context, u User) (User, error) {
+	before, err := s.store.GetByID(ctx, u.TenantID, u.ID)
+	if err != nil {
+		return User{}, err
+	}
+	updated, err := s.store.Update(ctx, u)
+	if err != nil {
+		return User{}, err
+	}
+	s.bus.publish(ctx, eventUserUpdated, userChange{Before: before, After: updated})
+	return updated, nil
+}
+
+// Authenticate checks an email and password, then publishes user.logged_in
+// Unknown emails, users without a password and wrong passwords all return
+// errInvalidCredentials after the same amount of hashing work. A hash made
+// with older, weaker parameters is replaced while the password is at hand
+func (s *userService) Authenticate(ctx context.Context, tenantID, email, password string) (User, error) {
+	u, err := s.store.GetByEmail(ctx, tenantID, email)
+	known := err == nil && u.PasswordHash != ""
+	hash := u.PasswordHash
+	if !known {
+		hash = dummyPasswordHash() // Spend the same time as a real check, then fail
+	}
+	if !checkPassword(hash, password) || !known {
+		return User{}, errInvalidCredentials
+	}
+	if passwordNeedsRehash(u.PasswordHash) {
+		if newHash, err := hashPassword(password); err == nil {
+			// Best effort: the login succeeds either way, the next one retries
+			if s.store.SetPasswordHash(ctx, tenantID, u.ID, newHash) == nil {
+				u.PasswordHash = newHash
+			}
+		}
+	}
+	s.bus.publish(ctx, eventUserLoggedIn, u)
+	return u, nil
+}
+
+// ChangePassword replaces a user's password, then publishes user.password_changed
+// current must match the old password; a user created without one (by an
+// admin, via POST /users) gets their first password without it
+func (s *userService) ChangePassword(ctx context.Context, tenantID string, id int, current, next string) error {
+	u, err := s.store.GetByID(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if u.PasswordHash != "" && !checkPassword(u.PasswordHash, current) {
+		return errWrongPassword
+	}
+	if err := validatePassword(next); err != nil {
+		return err
+	}
+	hash, err := hashPassword(next)
+	if err != nil {
+		return err
+	}
+	if err := s.store.SetPasswordHash(ctx, tenantID, id, hash); err != nil {
+		return err
+	}
+	s.bus.publish(ctx, eventPasswordChanged, u)
+	return nil
+}
+
+// Delete removes a user from a tenant, then publishes user.deleted
+func (s *userService) Delete(ctx context.Context, tenantID string, id int) error {
+	u, err := s.store.GetByID(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, tenantID, id); err != nil {
+		return err
+	}
+	s.bus.publish(ctx, eventUserDeleted, u)
+	return nil
+}
+
+// Purge permanently removes users soft-deleted before deletedBefore
+func (s *userService) Purge(ctx context.Context, deletedBefore time.Time) []User {
+	return s.store.Purge(ctx, deletedBefore)
+}
+
+// Erase removes a user permanently right away, then publishes user.erased
+func (s *userService) Erase(ctx context.Context, tenantID string, id int) (User, error) {
+	u, err := s.store.Erase(ctx, tenantID, id)
+	if err != nil {
+		return User{}, err
+	}
+	s.bus.publish(ctx, eventUserErased, u)
+	return u, nil
+}
+
+// DeleteTenant removes every user of a tenant
+func (s *userService) DeleteTenant(ctx context.Context, tenantID string) {
+	s.store.DeleteTenant(ctx, tenantID)
+}
+
+// Stats returns aggregate numbers about all users
+func (s *userService) Stats(ctx context.Context) userStats {
+	return s.store.Stats(ctx)
+}
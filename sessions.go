@@ -0,0 +1,176 @@
+// Package main - sessions: one per login, with the device it came from; GET /me/sessions and DELETE /me/sessions/{id}
+package main
+
+import (
+	"fmt"      // For errSessionNotFound
+	"net/http" // For the handlers
+	"slices"   // For sorting the list
+	"time"     // For last-seen times
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For session IDs
+)
+
+// Every login starts a session: POST /auth/login, /auth/register, the
+// session cookie and "Log in with <provider>" alike. A session is what
+// GitHub or Google list under "Where you're signed in":
+//
+//	GET /me/sessions
+//	→ {"sessions":[{"id":"k3J...","user_agent":"Firefox/131","ip":"203.0.113.7",
+//	                "created_at":...,"last_seen":...,"current":true}, ...]}
+//	DELETE /me/sessions/k3J...   → 204, that device is logged out
+//
+// A session's ID is the family of its refresh tokens (refreshtoken.go), and
+// login tokens carry it in their "sid" claim. requireAuth looks the session
+// up on every request, so revoking one ends its access token at once - not
+// minutes later when it expires - and refreshes last_seen. express-session
+// keeps the same per-login record in its store; connect-redis with a
+// "sessions of user X" index is the usual way to list them.
+//
+// Sessions live in memory with the refresh tokens: a restart logs everybody out.
+
+// maxUserAgent caps the stored User-Agent; browsers send ~150 bytes, anything can send more
+const maxUserAgent = 256
+
+// errSessionNotFound is returned for a session that isn't the user's or is gone
+var errSessionNotFound = fmt.Errorf("session %w", errNotFound)
+
+// session is one login
+type session struct {
+	id           string
+	userID       int
+	tenantID     string
+	userAgent    string // Of the latest request
+	ip           string // Of the latest request
+	created      time.Time
+	lastSeen     time.Time
+	expires      time.Time // Of its newest refresh token, or of a cookie login's token
+	impersonator string    // The admin's user ID for an impersonation (see impersonate.go)
+}
+
+// sessionResponse is one entry of GET /me/sessions
+type sessionResponse struct {
+	ID             string    `json:"id"`
+	UserAgent      string    `json:"user_agent"`
+	IP             string    `json:"ip"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastSeen       time.Time `json:"last_seen"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	Current        bool      `json:"current"`                   // The session of the credentials making this request
+	ImpersonatedBy string    `json:"impersonated_by,omitempty"` // Set while an admin acts as this user (see impersonate.go)
+}
+
+// deviceOf returns the User-Agent and IP a request came from
+func deviceOf(r *http.Request) (userAgent, ip string) {
+	userAgent = r.UserAgent()
+	if len(userAgent) > maxUserAgent {
+		userAgent = userAgent[:maxUserAgent]
+	}
+	return userAgent, clientIP(r)
+}
+
+// startSession records a login of u from r's device and returns its ID
+// expires is when its first credential runs out; issue moves it along
+func (s *refreshStore) startSession(u User, r *http.Request, expires, now time.Time) string {
+	ua, ip := deviceOf(r)
+	sess := &session{
+		id: cryptoutil.RandomToken(12), userID: u.ID, tenantID: u.TenantID,
+		userAgent: ua, ip: ip, created: now, lastSeen: now, expires: expires,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpired(now)
+	s.sessions[sess.id] = sess
+	return sess.id
+}
+
+// touch marks a session as seen from r; false when it was revoked or has expired
+// The user and tenant must match too, so a sid can't be lifted into another token
+func (s *refreshStore) touch(id, tenantID string, userID int, r *http.Request, now time.Time) bool {
+	ua, ip := deviceOf(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || sess.tenantID != tenantID || sess.userID != userID || !now.Before(sess.expires) {
+		return false
+	}
+	sess.lastSeen, sess.userAgent, sess.ip = now, ua, ip
+	return true
+}
+
+// sessionsOf returns a user's live sessions, most recently seen first
+func (s *refreshStore) sessionsOf(tenantID string, userID int, now time.Time) []session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []session
+	for _, sess := range s.sessions {
+		if sess.tenantID == tenantID && sess.userID == userID && now.Before(sess.expires) {
+			list = append(list, *sess)
+		}
+	}
+	slices.SortFunc(list, func(a, b session) int { return b.lastSeen.Compare(a.lastSeen) })
+	return list
+}
+
+// endSession revokes one of a user's sessions and its refresh tokens
+func (s *refreshStore) endSession(tenantID string, userID int, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || sess.tenantID != tenantID || sess.userID != userID {
+		return errSessionNotFound // Someone else's looks exactly like a missing one
+	}
+	s.revokeFamily(id)
+	return nil
+}
+
+// listSessionsHandler lists the caller's logins (GET /me/sessions)
+//
+//	curl -H "Authorization: Bearer $TOKEN" localhost:8080/me/sessions
+func (a *api) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusForbidden, "only user logins have sessions")
+		return
+	}
+	p, _ := principalFromContext(r.Context())
+	loc := locationFromContext(r.Context()) // ?tz= or the user's settings (see timezone.go)
+	list := []sessionResponse{}
+	for _, sess := range a.refresh.sessionsOf(u.TenantID, u.ID, time.Now()) {
+		list = append(list, sessionResponse{
+			ID:             sess.id,
+			UserAgent:      sess.userAgent,
+			IP:             sess.ip,
+			CreatedAt:      sess.created.In(loc),
+			LastSeen:       sess.lastSeen.In(loc),
+			ExpiresAt:      sess.expires.In(loc),
+			Current:        sess.id == p.Session,
+			ImpersonatedBy: sess.impersonator,
+		})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, map[string][]sessionResponse{"sessions": list})
+}
+
+// deleteSessionHandler logs one of the caller's devices out (DELETE /me/sessions/{id})
+// Its refresh tokens stop working, and so does its access token or cookie,
+// at the next request. Deleting the current session is a logout
+//
+//	curl -X DELETE -H "Authorization: Bearer $TOKEN" localhost:8080/me/sessions/k3J...
+func (a *api) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := userFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusForbidden, "only user logins have sessions")
+		return
+	}
+	id, err := pathToken(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	if err := a.refresh.endSession(u.TenantID, u.ID, id); err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	a.logger.InfoContext(r.Context(), "auth: session revoked", "user_id", u.ID, "session", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,171 @@
+// Package main - per-user preferences with defaults, validation and partial updates
+package main
+
+import (
+	"database/sql/driver" // For storing settings as a JSON column
+	"encoding/json"       // For the JSON column format
+	"errors"              // For validation and scan errors
+	"fmt"                 // For validation messages
+	"net/http"            // For the handlers
+	"slices"              // For checking allowed values
+	"strings"             // For listing allowed values
+)
+
+// userSettings are a user's effective preferences - what GET returns
+// A struct instead of a map[string]any means every setting has a type:
+// "newsletter": "yes" is rejected by the decoder, not discovered later
+type userSettings struct {
+	Newsletter bool   `json:"newsletter"`
+	Theme      string `json:"theme"`  // One of settingsThemes
+	Locale     string `json:"locale"` // One of the catalog's locales (see i18n.go)
+}
+
+// settingsThemes are the allowed themes
+var settingsThemes = []string{"system", "light", "dark"}
+
+// defaultSettings apply to everything a user hasn't chosen
+var defaultSettings = userSettings{Newsletter: false, Theme: "system", Locale: defaultLocale}
+
+// settingsPatch is what a user has actually chosen: nil means "not set"
+// Pointers are how Go tells a missing field from a zero value -
+// {"newsletter": false} gives a non-nil pointer to false, {} leaves it nil
+// (in JS you'd check `'newsletter' in body` or `body.newsletter !== undefined`)
+//
+// The stored value is a patch too, so users who never touched a setting
+// follow the default when it changes
+type settingsPatch struct {
+	Newsletter *bool   `json:"newsletter,omitempty"`
+	Theme      *string `json:"theme,omitempty"`
+	Locale     *string `json:"locale,omitempty"`
+}
+
+// apply returns s with every field set in p replaced - Object.assign({}, s, p)
+func (s userSettings) apply(p settingsPatch) userSettings {
+	if p.Newsletter != nil {
+		s.Newsletter = *p.Newsletter
+	}
+	if p.Theme != nil {
+		s.Theme = *p.Theme
+	}
+	if p.Locale != nil {
+		s.Locale = *p.Locale
+	}
+	return s
+}
+
+// merge returns p with the fields set in next layered on top
+func (p settingsPatch) merge(next settingsPatch) settingsPatch {
+	if next.Newsletter != nil {
+		p.Newsletter = next.Newsletter
+	}
+	if next.Theme != nil {
+		p.Theme = next.Theme
+	}
+	if next.Locale != nil {
+		p.Locale = next.Locale
+	}
+	return p
+}
+
+// validateSettings checks the enumerated values; locales are the ones the
+// catalog has translations for
+func validateSettings(s userSettings, locales []string) error {
+	if !slices.Contains(settingsThemes, s.Theme) {
+		return fmt.Errorf("theme must be one of %s", strings.Join(settingsThemes, ", "))
+	}
+	if !slices.Contains(locales, s.Locale) {
+		return fmt.Errorf("locale must be one of %s", strings.Join(locales, ", "))
+	}
+	return nil
+}
+
+// Value and Scan make settingsPatch storable in a JSON column of a SQL
+// backend (settings JSONB NOT NULL DEFAULT '{}' in Postgres): database/sql
+// calls Value when writing and Scan when reading, like a custom type in an ORM
+
+// settingsSchema versions the stored JSON (see schema.go): a change to
+// settingsPatch's shape adds a step here, and rows written before it are
+// upgraded as they are read
+var settingsSchema = newRecordSchema("settings")
+
+// Value encodes the patch as JSON with its schema_version for database/sql (driver.Valuer)
+func (p settingsPatch) Value() (driver.Value, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return settingsSchema.stamp(data)
+}
+
+// Scan decodes the JSON column back into the patch (sql.Scanner), upgrading an older shape first
+func (p *settingsPatch) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*p = settingsPatch{} // NULL: nothing chosen
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("settings: unsupported column type")
+	}
+	data, err := settingsSchema.upgrade(data)
+	if err != nil {
+		return err
+	}
+	*p = settingsPatch{} // The driver may reuse p; fields the row doesn't set stay unset
+	return json.Unmarshal(data, p)
+}
+
+// getUserSettingsHandler returns a user's settings with defaults filled in (GET /users/{id}/settings)
+func (a *api) getUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.userIDFromPath(r)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	u, err := a.users.Get(r.Context(), tenantFromContext(r.Context()), id)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, defaultSettings.apply(u.Settings))
+}
+
+// updateUserSettingsHandler changes some settings and keeps the rest (PUT /users/{id}/settings)
+// curl -X PUT -d '{"theme":"dark"}' .../users/1/settings leaves newsletter and locale as they were
+func (a *api) updateUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.userIDFromPath(r)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	patch, err := decode[settingsPatch](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tenantID := tenantFromContext(r.Context())
+	u, err := a.users.Get(r.Context(), tenantID, id)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	// Validate the result of the merge, not the patch alone: the patch is
+	// fine as long as what the user ends up with is
+	u.Settings = u.Settings.merge(patch)
+	settings := defaultSettings.apply(u.Settings)
+	if err := validateSettings(settings, a.messages.locales()); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := a.users.Update(r.Context(), u); err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, settings)
+}
@@ -0,0 +1,100 @@
+// Package main - graceful shutdown: finish in-flight requests on SIGTERM
+package main
+
+import (
+	"context"   // For the signal and deadline contexts
+	"errors"    // For recognizing http.ErrServerClosed
+	"fmt"       // For wrapping the shutdown error
+	"log/slog"  // For shutdown progress
+	"net"       // For the UDP socket of the HTTP/3 server
+	"net/http"  // For the server
+	"os"        // For os.Interrupt
+	"os/signal" // For catching SIGINT/SIGTERM
+	"syscall"   // For SIGTERM
+	"time"      // For the drain deadline
+
+	"github.com/quic-go/quic-go/http3" // For the optional HTTP/3 server (see http3.go)
+)
+
+// Deploys, autoscaling and Ctrl+C all stop the process with a signal:
+// Kubernetes and docker stop send SIGTERM, a terminal sends SIGINT. Exiting
+// right away would cut off every request still running - a half-written
+// response, a lost upload. The Node pattern is
+//
+//	process.on('SIGTERM', () => server.close(() => process.exit(0)))
+//
+// and Go's is srv.Shutdown: close the listener (no new connections), close
+// idle keep-alive connections, then wait until every active request has
+// finished - or until the deadline, after which the rest are cut off.
+
+// shutdownSignals stop the server gracefully
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// notifyShutdown returns a context that is cancelled on SIGINT or SIGTERM
+// main() passes it to the background loops too, so they stop with the server
+// After the first signal the default behavior comes back: a second Ctrl+C
+// kills the process right away instead of waiting for the drain
+func notifyShutdown() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	context.AfterFunc(ctx, stop) // stop() unregisters the handler
+	return ctx, stop
+}
+
+// serve runs srv, and h3 on the same port over UDP unless it's nil, until
+// ctx is cancelled, then drains both: requests in flight get up to timeout
+// to finish
+// It returns nil after a clean shutdown, or the error that stopped it -
+// the port is taken, or requests were still running at the deadline
+func serve(ctx context.Context, srv *http.Server, h3 *http3.Server, timeout time.Duration) error {
+	// ListenAndServe blocks, so it runs in its own goroutine; the buffered
+	// channel lets it finish even if nobody receives anymore
+	// With a TLSConfig (see mtls.go) the certificates are already in it
+	errc := make(chan error, 2)
+	go func() {
+		if srv.TLSConfig != nil {
+			errc <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+	servers := 1
+	if h3 != nil {
+		// The UDP socket is opened here rather than by ListenAndServe, so
+		// Shutdown can't race with its creation
+		udp, err := net.ListenPacket("udp", srv.Addr)
+		if err != nil {
+			srv.Close()
+			return fmt.Errorf("http3: %w", err)
+		}
+		defer udp.Close() // h3.Shutdown leaves a socket it was given open
+		servers++
+		go func() { errc <- h3.Serve(udp) }()
+	}
+
+	select {
+	case err := <-errc:
+		return err // Never started (address in use) or crashed
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", timeout)
+	// A fresh context: ctx is already cancelled, the deadline starts now
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if h3 != nil {
+		// Sends GOAWAY and waits for its requests, alongside srv's; past the deadline it closes them
+		go h3.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close() // Deadline passed: cut the connections that are left
+		return fmt.Errorf("graceful shutdown: %w", err)
+	}
+	// After Shutdown, ListenAndServe (and h3.Serve) return http.ErrServerClosed - that's the normal case
+	for range servers {
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	slog.Info("server stopped")
+	return nil
+}
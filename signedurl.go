@@ -0,0 +1,167 @@
+// Package main - HMAC-signed, expiring URLs: share a resource without auth headers
+package main
+
+import (
+	"errors"   // For the verification errors
+	"net/http" // For the middleware and handlers
+	"net/url"  // For reading the signed query
+	"strconv"  // For the expiry timestamp
+	"time"     // For expiry
+
+	"github.com/kenzot25/golang-cheat-sheet-for-nodejs-dev/cryptoutil" // For URL signatures
+)
+
+// A signed URL carries its own permission: the server signs the path and an
+// expiry time with a key only it knows, and anyone holding the link can use
+// it until then - no Authorization header, so it works in an <img src>, an
+// email or a curl one-liner. S3 presigned URLs and CloudFront signed URLs
+// work the same way (in Node you'd reach for @aws-sdk/s3-request-presigner,
+// or crypto.createHmac for your own).
+//
+//	/shared/files/<id>/download?expires=1767225600&signature=9f2c...
+//
+// Changing the path, the expiry or any other query parameter breaks the
+// signature. Rotating the url_signing_key secret revokes every link at once.
+
+// Limits for links minted on request (POST /admin/files/{id}/share)
+const (
+	defaultShareTTL = time.Hour
+	maxShareTTL     = 7 * 24 * time.Hour // Like S3's limit for presigned URLs
+)
+
+// Verification errors; all are answered with 403
+var (
+	errSignatureMissing = errors.New("missing signature or expiry")
+	errSignatureInvalid = errors.New("invalid signature")
+	errSignatureExpired = errors.New("link expired")
+)
+
+// urlSigner signs and verifies URLs with HMAC-SHA256 (see cryptoutil/)
+// key is a func so a rotated secret applies without a restart (see secrets.go)
+type urlSigner struct {
+	key func() []byte
+}
+
+// newURLSigner creates a signer that reads its key from key on every call
+func newURLSigner(key func() []byte) *urlSigner {
+	return &urlSigner{key: key}
+}
+
+// sign returns base + segments with an expiry and a signature added
+// Only the part below base is signed, so the same link verifies behind the
+// SPA's /api prefix or another host name
+func (s *urlSigner) sign(base urlBuilder, expires time.Time, segments ...string) string {
+	return s.signFor(base, expires, "", segments...)
+}
+
+// signFor is sign for a link only one principal may use: "for" is signed
+// along with the path, and the route checks it against the caller (see
+// exportDownloadHandler) - the link alone is no longer enough
+func (s *urlSigner) signFor(base urlBuilder, expires time.Time, owner string, segments ...string) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	signed := newURLBuilder("/").withPath(segments...).withQuery("expires", exp)
+	link := base.withPath(segments...).withQuery("expires", exp)
+	if owner != "" {
+		signed, link = signed.withQuery("for", owner), link.withQuery("for", owner)
+	}
+	signature := cryptoutil.HMACSign(s.key(), []byte(signingMessage(&signed.u)))
+	return link.withQuery("signature", signature).String()
+}
+
+// verify checks the signature of u, then its expiry
+// The signature comes first: an unsigned expires value means nothing
+func (s *urlSigner) verify(u *url.URL, now time.Time) error {
+	q := u.Query()
+	signature, exp := q.Get("signature"), q.Get("expires")
+	if signature == "" || exp == "" {
+		return errSignatureMissing
+	}
+	if !cryptoutil.HMACVerify(s.key(), []byte(signingMessage(u)), signature) {
+		return errSignatureInvalid
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errSignatureInvalid // Can't happen with a valid signature, but don't panic on it
+	}
+	if now.After(time.Unix(unix, 0)) {
+		return errSignatureExpired
+	}
+	return nil
+}
+
+// signingMessage is what the HMAC covers: the escaped path and every query
+// parameter except the signature itself, in Encode's sorted order
+func signingMessage(u *url.URL) string {
+	q := u.Query()
+	q.Del("signature")
+	return u.EscapedPath() + "?" + q.Encode()
+}
+
+// requireSignature only lets requests through whose URL s signed and that
+// haven't expired - the signed-URL counterpart of requireAdmin (see auth.go)
+func requireSignature(s *urlSigner) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := s.verify(r.URL, time.Now()); err != nil {
+				// 403, not 401: no credentials would help, the link itself is bad
+				writeJSONError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			// The link is a secret; don't let it leak to other sites through Referer
+			w.Header().Set("Referrer-Policy", "no-referrer")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sharedFileHandler serves any blob, private ones included (GET /shared/files/{id}/download)
+// Only reachable through requireSignature, so the signature is the permission
+func (a *api) sharedFileHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathToken(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	b, ok := a.blobs.get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	serveFile(w, r, b)
+}
+
+// shareLink is the response of POST /admin/files/{id}/share
+type shareLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// shareFileHandler mints a signed download link for a blob (POST /admin/files/{id}/share)
+// ?expires_in=15m sets the lifetime (default 1h, at most 7 days)
+// An admin route: otherwise anyone holding an expired link could mint a fresh one
+//
+//	curl -X POST -H "Authorization: Bearer $ADMIN_TOKEN" 'localhost:8080/admin/files/<id>/share?expires_in=15m'
+func (a *api) shareFileHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathToken(r, "id")
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	if _, ok := a.blobs.get(id); !ok {
+		writeJSONError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	ttl := defaultShareTTL
+	if v := r.URL.Query().Get("expires_in"); v != "" {
+		d, err := time.ParseDuration(v) // "15m", "24h" - like the ms package's ms('15m')
+		if err != nil || d <= 0 || d > maxShareTTL {
+			writeJSONError(w, http.StatusBadRequest, "expires_in must be a duration between 1s and "+maxShareTTL.String())
+			return
+		}
+		ttl = d
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second).UTC() // The URL carries whole seconds
+	link := a.signer.sign(apiBaseURL(r), expires, "shared", "files", id, "download")
+	respondJSON(w, http.StatusCreated, shareLink{URL: link, ExpiresAt: expires})
+}
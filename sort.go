@@ -0,0 +1,148 @@
+// Package main - ?sort=-created_at,name: parsing, allowlists and stable ordering
+package main
+
+import (
+	"fmt"      // For error messages
+	"io"       // For the example's output
+	"net/http" // For the request and status codes
+	"slices"   // For slices.SortStableFunc
+	"sort"     // For listing the allowed keys in order
+	"strings"  // For splitting the expression
+	"time"     // For the example's timestamps
+)
+
+// The sort expression follows the JSON:API convention: comma-separated keys,
+// a leading "-" for descending. Only keys from the resource's allowlist are
+// accepted, which matters twice: clients can't sort by internal fields, and a
+// SQL backend never puts user input into ORDER BY (see orderByClause).
+
+// init() registers the "sort" example
+func init() {
+	registerExample("sort", sortExamples)
+}
+
+// sortKey is one allowed sort key of a resource
+type sortKey[T any] struct {
+	Column  string           // Column name for SQL backends
+	Compare func(a, b T) int // In-memory comparison: negative, zero or positive like cmp.Compare
+}
+
+// sortKeys is a resource's allowlist: query name → how to sort by it
+type sortKeys[T any] map[string]sortKey[T]
+
+// sortField is one parsed entry of ?sort=
+type sortField struct {
+	Key  string
+	Desc bool
+}
+
+// tiebreakerKey is appended when missing, so equal names or timestamps always
+// come out in the same order - otherwise an item could appear on two pages
+// (or none) while paging through the results
+const tiebreakerKey = "id"
+
+// parseSort reads ?sort= (fallback when it is missing) and checks every key
+// against keys; "id" is added as the last key unless the client named it
+func parseSort[T any](r *http.Request, keys sortKeys[T], fallback string) ([]sortField, error) {
+	raw := r.URL.Query().Get("sort")
+	if raw == "" {
+		raw = fallback
+	}
+
+	var fields []sortField
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		// CutPrefix returns the rest and whether the prefix was there
+		key, desc := strings.CutPrefix(part, "-")
+		if _, ok := keys[key]; !ok {
+			return nil, &requestError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("cannot sort by %q (allowed: %s)", key, strings.Join(allowedSortKeys(keys), ", ")),
+			}
+		}
+		if seen[key] {
+			return nil, &requestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("sort key %q given twice", key)}
+		}
+		seen[key] = true
+		fields = append(fields, sortField{Key: key, Desc: desc})
+	}
+
+	if _, ok := keys[tiebreakerKey]; ok && !seen[tiebreakerKey] {
+		fields = append(fields, sortField{Key: tiebreakerKey})
+	}
+	return fields, nil
+}
+
+// allowedSortKeys lists the keys in alphabetical order for error messages
+// (map iteration order is random in Go, on purpose)
+func allowedSortKeys[T any](keys sortKeys[T]) []string {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortItems orders items in place by fields: the first key decides, later
+// keys only break ties - like .sort((a, b) => a.x - b.x || a.y - b.y)
+func sortItems[T any](items []T, fields []sortField, keys sortKeys[T]) {
+	slices.SortStableFunc(items, func(a, b T) int {
+		for _, f := range fields {
+			c := keys[f.Key].Compare(a, b)
+			if f.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+}
+
+// orderByClause translates parsed fields into SQL for a database-backed
+// store: [-created_at name id] → "ORDER BY created_at DESC, name ASC, id ASC"
+// Only Column values from the allowlist are used, so this is safe to
+// concatenate into a query (identifiers can't be bound as ? parameters)
+func orderByClause[T any](fields []sortField, keys sortKeys[T]) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		dir := "ASC"
+		if f.Desc {
+			dir = "DESC"
+		}
+		parts[i] = keys[f.Key].Column + " " + dir
+	}
+	return "ORDER BY " + strings.Join(parts, ", ")
+}
+
+// sortExamples shows ?sort= turning into an in-memory sort and an ORDER BY clause
+func sortExamples(w io.Writer) {
+	day := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	users := []User{
+		{ID: 1, Name: "Grace", CreatedAt: day},
+		{ID: 2, Name: "Ada", CreatedAt: day.Add(time.Hour)},
+		{ID: 3, Name: "Ada", CreatedAt: day},
+	}
+
+	// Array.prototype.sort((a, b) => b.createdAt - a.createdAt || a.name.localeCompare(b.name))
+	r, _ := http.NewRequest(http.MethodGet, "/users?sort=-created_at,name", nil)
+	fields, err := parseSort(r, userSortKeys, "id")
+	if err != nil {
+		fmt.Fprintln(w, "error:", err)
+		return
+	}
+	fmt.Fprintf(w, "parsed: %+v\n", fields) // [{Key:created_at Desc:true} {Key:name Desc:false} {Key:id Desc:false}]
+	fmt.Fprintln(w, "SQL:", orderByClause(fields, userSortKeys))
+
+	sortItems(users, fields, userSortKeys)
+	for _, u := range users {
+		fmt.Fprintf(w, "  %d %-5s %s\n", u.ID, u.Name, u.CreatedAt.Format(time.TimeOnly))
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/users?sort=password", nil)
+	_, err = parseSort(r, userSortKeys, "id")
+	fmt.Fprintln(w, "error:", err) // cannot sort by "password" (allowed: ...)
+}
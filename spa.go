@@ -0,0 +1,91 @@
+// Package main - hosting a single-page app (React/Vue build) with history-API fallback
+package main
+
+import (
+	"embed"    // For the bundled demo app
+	"errors"   // For the invalid -spa value error
+	"io/fs"    // For the filesystem abstraction shared by os.DirFS and embed.FS
+	"net/http" // For handlers and the file server
+	"os"       // For serving a build directory from disk
+	"path"     // For cleaning request paths and checking extensions
+	"strings"  // For trimming the leading slash
+)
+
+// spaFS holds a tiny demo frontend used when -spa=embedded
+//
+//go:embed spa
+var spaFS embed.FS
+
+// The typical Node deployment of a React app looks like:
+//
+//	app.use('/api', apiRouter)
+//	app.use(express.static('dist'))
+//	app.get('*', (req, res) => res.sendFile('dist/index.html'))
+//
+// newSPAHandler is the same idea: serve real files from the bundle, and
+// answer every other (non-API) path with index.html so client-side routes
+// like /users/42 survive a browser refresh.
+
+// loadSPA returns the frontend filesystem for the -spa flag value:
+// "embedded" for the bundled demo, otherwise a build directory on disk
+func loadSPA(source string) (fs.FS, error) {
+	if source == "embedded" {
+		return fs.Sub(spaFS, "spa")
+	}
+	// os.DirFS exposes a directory through the same fs.FS interface as embed.FS
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("-spa must be a directory or \"embedded\"")
+	}
+	return os.DirFS(source), nil
+}
+
+// newSPAHandler serves files from fsys, falling back to index.html
+func newSPAHandler(fsys fs.FS) http.Handler {
+	files := http.FileServerFS(fsys)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fs.FS paths have no leading slash: "/assets/app.js" → "assets/app.js"
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+
+		if name != "" && name != "." {
+			// Serve the file if it exists in the bundle
+			if info, err := fs.Stat(fsys, name); err == nil && !info.IsDir() {
+				files.ServeHTTP(w, r)
+				return
+			}
+
+			// A missing file with an extension (/logo.png, /chunk-abc.js) is a
+			// real 404 - returning index.html would hand the browser HTML
+			// where it expected an image or script
+			if path.Ext(name) != "" {
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		// Everything else is a client-side route: send the app shell
+		// index.html must never be cached, or users get stale bundle references
+		index, err := fs.ReadFile(fsys, "index.html")
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "index.html not found in SPA bundle")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(index)
+	})
+}
+
+// spaRouter mounts the API under /api/ and the frontend everywhere else
+// The API mux keeps its own routes ("GET /users"); StripPrefix removes
+// "/api" so /api/users reaches the same handler as /users does normally
+func spaRouter(apiMux http.Handler, frontend fs.FS) http.Handler {
+	root := http.NewServeMux()
+	root.Handle("/api/", http.StripPrefix("/api", apiMux))
+	root.Handle("/", newSPAHandler(frontend))
+	return root
+}
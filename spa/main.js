@@ -0,0 +1,33 @@
+// main.js - a tiny client-side router, standing in for React Router
+// Deep links like /users work on refresh because the Go server falls back
+// to index.html for unknown non-API paths (see spa.go)
+const app = document.getElementById("app");
+
+async function render() {
+  if (window.location.pathname === "/users") {
+    // API routes live under /api in SPA mode
+    const res = await fetch("/api/users");
+    const { data: users } = await res.json(); // Paginated: { data, meta }
+    app.innerHTML = "<h1>Users</h1><ul></ul>";
+    const list = app.querySelector("ul");
+    for (const u of users) {
+      const li = document.createElement("li");
+      li.textContent = `${u.name} <${u.email}>`; // textContent avoids XSS
+      list.appendChild(li);
+    }
+    return;
+  }
+  app.innerHTML = "<h1>Home</h1><p>Served by Go with a history-API fallback.</p>";
+}
+
+// Intercept link clicks and use pushState instead of full page loads
+document.addEventListener("click", (event) => {
+  const link = event.target.closest("a[data-link]");
+  if (!link) return;
+  event.preventDefault();
+  history.pushState(null, "", link.getAttribute("href"));
+  render();
+});
+
+window.addEventListener("popstate", render);
+render();
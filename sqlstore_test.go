@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"       // Every store call takes one
+	"errors"        // For errors.Is on the store's sentinel errors
+	"fmt"           // For the test schema's name
+	"log/slog"      // The store logs; the tests don't need to see it
+	"net/url"       // For adding search_path to TEST_DATABASE_URL
+	"os"            // For TEST_DATABASE_URL
+	"path/filepath" // For the database file in the test's temp dir
+	"testing"       // Go's built-in test runner: go test ./... instead of Jest
+	"time"          // For a schema name that doesn't clash with another run
+
+	"github.com/jackc/pgx/v5" // One plain connection for creating the schema
+)
+
+// openTestSQLite opens a SQLite store in a fresh file that is deleted after
+// the test - t.TempDir() is Jest's tmp-promise plus an afterEach cleanup
+func openTestSQLite(t *testing.T, path string, ids idStrategy) *sqlStore {
+	t.Helper() // Failures point at the caller's line, not this one
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "users.db")
+	}
+	s, err := openSQLStore(context.Background(), sqliteDialect, path, ids, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+// TestSQLiteStore runs the UserStore calls against a real SQLite database:
+// migrations, the duplicate-email check and soft deletes
+func TestSQLiteStore(t *testing.T) {
+	checkSQLStore(t, openTestSQLite(t, "", counterIDs{}))
+}
+
+// TestPostgresStore runs the same calls against PostgreSQL, through the
+// pgxpool. It needs a server, so it's skipped unless TEST_DATABASE_URL
+// points at one (like Jest tests behind an env check):
+//
+//	docker run -d -p 5432:5432 -e POSTGRES_PASSWORD=pw postgres:17
+//	TEST_DATABASE_URL=postgres://postgres:pw@localhost:5432/postgres go test -run Postgres
+//
+// The tables go in a schema of their own, dropped afterwards
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	// Cleanups run last-in first-out: the schema is dropped, then conn closed
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	if _, err := conn.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema) // pgx sends unknown parameters to the server as settings
+	u.RawQuery = q.Encode()
+	s, err := openSQLStore(ctx, postgresDialect, u.String(), counterIDs{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	checkSQLStore(t, s)
+}
+
+// checkSQLStore is the body of TestSQLiteStore and TestPostgresStore
+func checkSQLStore(t *testing.T, s *sqlStore) {
+	t.Helper()
+	ctx := context.Background()
+	ada, err := s.Create(ctx, User{TenantID: "acme", Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if ada.ID == 0 || ada.Role != roleUser {
+		t.Errorf("create = %+v, want an ID and the user role", ada)
+	}
+	// Emails are normalized before the check (see validateUserFields)
+	if _, err := s.Create(ctx, User{TenantID: "acme", Name: "Ada 2", Email: " ADA@example.com"}); !errors.Is(err, errDuplicateEmail) {
+		t.Errorf("duplicate email: err = %v, want errDuplicateEmail", err)
+	}
+	// Another tenant may use the same email
+	if _, err := s.Create(ctx, User{TenantID: "globex", Name: "Ada", Email: "ada@example.com"}); err != nil {
+		t.Errorf("same email in another tenant: %v", err)
+	}
+
+	got, err := s.GetByEmail(ctx, "acme", "ada@example.com")
+	if err != nil || got.ID != ada.ID || !got.CreatedAt.Equal(ada.CreatedAt) {
+		t.Errorf("get by email = %+v, %v; want %+v", got, err, ada)
+	}
+	got.Name = "Ada Lovelace"
+	if _, err := s.Update(ctx, got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got, _ := s.GetByID(ctx, "acme", ada.ID); got.Name != "Ada Lovelace" {
+		t.Errorf("after update name = %q", got.Name)
+	}
+
+	if err := s.Delete(ctx, "acme", ada.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.GetByID(ctx, "acme", ada.ID); !errors.Is(err, errUserNotFound) {
+		t.Errorf("get after delete: err = %v, want errUserNotFound", err)
+	}
+	// The partial unique index only covers live users, so the email is free again
+	if _, err := s.Create(ctx, User{TenantID: "acme", Name: "Ada", Email: "ada@example.com"}); err != nil {
+		t.Errorf("re-create after delete: %v", err)
+	}
+}
+
+// TestSQLiteStoreReopen checks that migrations run once and data survives a restart
+func TestSQLiteStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.db")
+	first := openTestSQLite(t, path, counterIDs{})
+	u, err := first.Create(ctx, User{TenantID: "acme", Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	first.db.Close()
+
+	second := openTestSQLite(t, path, counterIDs{})
+	var applied int
+	if err := second.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(sqliteDialect.migrations) {
+		t.Errorf("schema_migrations has %d rows, want %d", applied, len(sqliteDialect.migrations))
+	}
+	if _, err := second.GetByID(ctx, "acme", u.ID); err != nil {
+		t.Errorf("user after reopening: %v", err)
+	}
+}
+
+// TestSQLiteSnowflakeIDs checks that an ID made by the strategy is stored as given
+func TestSQLiteSnowflakeIDs(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, "", newIDStrategy(idsSnowflake, 3))
+	u, err := s.Create(ctx, User{TenantID: "acme", Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, node, _ := snowflakeParts(u.ID); node != 3 {
+		t.Errorf("id %d has node %d, want 3", u.ID, node)
+	}
+	if _, err := s.GetByID(ctx, "acme", u.ID); err != nil {
+		t.Errorf("get by snowflake: %v", err)
+	}
+}
+
+// sameIDs gives every user the same ID and UUID, so a second Create breaks
+// the primary key or users_uuid instead of the email index
+type sameIDs struct{ id int }
+
+func (g sameIDs) assign(u *User) { u.ID, u.UUID = g.id, "00000000-0000-4000-8000-000000000000" }
+
+// TestSQLiteConstraintErrors checks that only the email index answers
+// errDuplicateEmail; the primary key and users_uuid are internal errors
+func TestSQLiteConstraintErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		ids  idStrategy
+	}{
+		{"primary key", sameIDs{id: 7}},
+		{"users_uuid", sameIDs{}}, // ID 0: the database counts, the UUIDs clash
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestSQLite(t, "", tt.ids)
+			if _, err := s.Create(ctx, User{TenantID: "acme", Name: "Ada", Email: "ada@example.com"}); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			_, err := s.Create(ctx, User{TenantID: "acme", Name: "Bob", Email: "bob@example.com"})
+			if err == nil || errors.Is(err, errDuplicateEmail) {
+				t.Fatalf("err = %v, want an error other than errDuplicateEmail", err)
+			}
+			if status, _, _ := describeError(err); status != 500 {
+				t.Errorf("status = %d, want 500", status)
+			}
+		})
+	}
+}
+
+// TestSQLiteCountUsage runs the quota_usage upsert (see quota.go): counts go
+// up within a day, and the first count of a new day drops the old rows
+func TestSQLiteCountUsage(t *testing.T) {
+	ctx := context.Background()
+	s := openTestSQLite(t, "", counterIDs{})
+	for want := 1; want <= 3; want++ {
+		n, err := s.countUsage(ctx, "api_key:crm", "2026-03-01")
+		if err != nil || n != want {
+			t.Fatalf("count %d = %d, %v", want, n, err)
+		}
+	}
+	if n, _ := s.countUsage(ctx, "api_key:reports", "2026-03-01"); n != 1 {
+		t.Errorf("another key's count = %d, want 1", n)
+	}
+	if n, _ := s.countUsage(ctx, "api_key:crm", "2026-03-02"); n != 1 {
+		t.Errorf("next day's count = %d, want 1", n)
+	}
+	var old int
+	s.db.QueryRow(`SELECT COUNT(*) FROM quota_usage WHERE day < '2026-03-02'`).Scan(&old)
+	if old != 0 {
+		t.Errorf("%d rows of the previous day left", old)
+	}
+}
@@ -0,0 +1,53 @@
+// Package main - -standalone: every feature from one binary and one directory, no other services
+package main
+
+import (
+	"errors"        // For the problems
+	"os"            // For creating the data directory
+	"path/filepath" // For the paths inside it
+)
+
+// Trying the whole API - sign-up with its email, avatar uploads, export
+// jobs - used to mean picking a flag for each backend, and the defaults keep
+// everything in memory, so a restart lost it all. -standalone picks the
+// backends that need nothing but a directory, like a Node app whose dev
+// profile swaps Postgres for better-sqlite3, S3 for multer's diskStorage
+// and SES for a console transport:
+//
+//	users                   → SQLite at <data-dir>/users.db (-db, see sqlstore.go)
+//	uploads and exports     → files in <data-dir>/blobs (see binary.go)
+//	jobs                    → the in-process worker pool, as always (see jobs.go)
+//	email                   → printed to stdout (consoleMailer, see mailer.go)
+//
+//	go run . -standalone                  # ./data
+//	go run . -standalone -data-dir /tmp/x
+//
+// An explicit -db still wins; -database-url contradicts the point and is a
+// startup problem. The SQLite driver is pure Go (modernc.org/sqlite, see
+// sqlstore.go), so -standalone needs no C compiler and no system library.
+
+// standaloneSetup is where -standalone keeps its data
+type standaloneSetup struct {
+	dataDir string
+}
+
+// dbPath is the SQLite file for users, unless -db names another
+func (s standaloneSetup) dbPath() string {
+	return filepath.Join(s.dataDir, "users.db")
+}
+
+// blobDir is the directory for uploaded files (see openBlobDir)
+func (s standaloneSetup) blobDir() string {
+	return filepath.Join(s.dataDir, "blobs")
+}
+
+// check records what keeps -standalone from working and creates the data
+// directory, so -db's own check finds it (see configcheck.go)
+func (s standaloneSetup) check(c *configCheck, databaseURL string) {
+	if databaseURL != "" {
+		c.add("-standalone, -database-url", errors.New("-standalone keeps users in SQLite: drop -database-url"))
+	}
+	if err := os.MkdirAll(s.dataDir, 0o700); err != nil {
+		c.add("-data-dir", err)
+	}
+}
@@ -0,0 +1,25 @@
+// app.js - served from the embedded filesystem with a content-hashed URL
+// Marks the nav link for the current page so CSS can highlight it
+document.querySelectorAll("nav a").forEach((link) => {
+  if (link.getAttribute("href") === window.location.pathname) {
+    link.setAttribute("aria-current", "page");
+  }
+});
+
+// Keep ?tz= sticky: htmx requests (edit, save, create) send it as X-Timezone
+// so fragments render times in the same zone as the page around them
+const tz = new URLSearchParams(window.location.search).get("tz");
+document.addEventListener("htmx:configRequest", (event) => {
+  if (tz) {
+    event.detail.headers["X-Timezone"] = tz;
+  }
+});
+
+// Clear forms marked with data-reset after htmx submits them successfully
+// (listening here instead of hx-on keeps inline scripts out, so the CSP stays strict)
+document.addEventListener("htmx:afterRequest", (event) => {
+  const form = event.detail.elt;
+  if (event.detail.successful && form.matches("form[data-reset]")) {
+    form.reset();
+  }
+});
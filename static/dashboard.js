@@ -0,0 +1,78 @@
+// dashboard.js - the live admin dashboard (templates/pages/dashboard.html)
+// Opens the WebSocket linked in data-live and renders what the server pushes:
+// "metrics" messages every second, a "request" message per finished request
+const root = document.getElementById("dashboard");
+const statusLine = root.querySelector("[data-status]");
+const chart = root.querySelector("[data-chart]");
+const rows = root.querySelector("[data-requests]");
+const maxRows = 50;
+
+// The page is served over http(s); the socket is the same URL with ws(s)
+const liveURL = root.dataset.live.replace(/^http/, "ws");
+
+function showMetrics(m) {
+  root.querySelectorAll("[data-metric]").forEach((el) => {
+    const value = m[el.dataset.metric];
+    el.textContent = typeof value === "number" && !Number.isInteger(value) ? value.toFixed(1) : value;
+  });
+  drawChart(m.series);
+}
+
+// One bar per second: successful requests in grey, errors stacked in red
+function drawChart(series) {
+  const ctx = chart.getContext("2d");
+  const max = Math.max(1, ...series.map((s) => s.requests));
+  const width = chart.width / series.length;
+  ctx.clearRect(0, 0, chart.width, chart.height);
+  series.forEach((s, i) => {
+    const errors = s.client_errors + s.server_errors;
+    const total = (s.requests / max) * chart.height;
+    const failed = (errors / max) * chart.height;
+    ctx.fillStyle = "#9ca3af";
+    ctx.fillRect(i * width, chart.height - total, width - 1, total - failed);
+    ctx.fillStyle = "#b91c1c";
+    ctx.fillRect(i * width, chart.height - failed, width - 1, failed);
+  });
+}
+
+// textContent, never innerHTML: paths come from whoever sent the request
+function addRequest(req) {
+  const tr = document.createElement("tr");
+  const cells = [new Date(req.time).toLocaleTimeString(), req.method, req.path, req.status, `${req.latency_ms.toFixed(1)} ms`];
+  cells.forEach((text, i) => {
+    const td = document.createElement("td");
+    td.textContent = text;
+    if (i === 3 && req.status >= 400) {
+      td.className = "error";
+    }
+    tr.appendChild(td);
+  });
+  rows.prepend(tr);
+  while (rows.children.length > maxRows) {
+    rows.lastChild.remove();
+  }
+}
+
+// Reconnect with a growing delay, like socket.io does; reloading the page
+// gets a fresh link once the signed one has expired
+function connect(delay) {
+  const ws = new WebSocket(liveURL);
+  ws.onopen = () => {
+    statusLine.textContent = "Live";
+    delay = 1000;
+  };
+  ws.onmessage = (event) => {
+    const msg = JSON.parse(event.data);
+    if (msg.type === "metrics") {
+      showMetrics(msg.metrics);
+    } else if (msg.type === "request") {
+      addRequest(msg.request);
+    }
+  };
+  ws.onclose = () => {
+    statusLine.textContent = `Disconnected, retrying in ${delay / 1000}s…`;
+    setTimeout(() => connect(Math.min(delay * 2, 30000)), delay);
+  };
+}
+
+connect(1000);
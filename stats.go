@@ -0,0 +1,51 @@
+// Package main - GET /admin/stats: aggregate numbers for operators
+package main
+
+import (
+	"net/http" // For the handler signature
+	"time"     // For uptime
+)
+
+// storeInfo describes where data lives, so operators can tell a dev
+// instance (memory, lost on restart) from a real deployment at a glance
+type storeInfo struct {
+	Backend    string `json:"backend"`
+	Persistent bool   `json:"persistent"`
+}
+
+// adminStats is the body of GET /admin/stats
+// Embedding userStats inlines its fields in the JSON, like spreading {...stats}
+type adminStats struct {
+	userStats
+	Store         storeInfo   `json:"store"`
+	StartedAt     time.Time   `json:"started_at"`
+	UptimeSeconds int64       `json:"uptime_seconds"`
+	Uptime        string      `json:"uptime"` // Human readable, e.g. "3h2m10s"
+	Tenants       int         `json:"tenants"`
+	Posts         int         `json:"posts"`
+	PostsPerUser  map[int]int `json:"posts_per_user"` // User ID → number of posts written
+	Tags          int         `json:"tags"`
+	Blobs         int         `json:"blobs"`
+}
+
+// statsHandler reports aggregate numbers across all tenants (GET /admin/stats)
+func (a *api) statsHandler(w http.ResponseWriter, r *http.Request) {
+	// time.Since is time.Now().Sub(start) - Date.now() - start in JS
+	uptime := time.Since(a.started)
+	stats := adminStats{
+		userStats:     a.users.Stats(r.Context()),
+		Store:         a.store,
+		StartedAt:     a.started.UTC(), // a.started keeps the local zone for its monotonic clock reading
+		UptimeSeconds: int64(uptime.Seconds()),
+		Uptime:        uptime.Round(time.Second).String(), // Duration's String() gives "1h2m3s"
+		Tenants:       len(a.tenants.list()),
+		PostsPerUser:  map[int]int{},
+		Tags:          len(a.tags.List(nil)),
+		Blobs:         a.blobs.count(),
+	}
+	for p := range a.posts.All() {
+		stats.Posts++
+		stats.PostsPerUser[p.AuthorID]++
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,403 @@
+// Package main - the user store: the UserStore interface and its in-memory implementation
+package main
+
+import (
+	"cmp"     // cmp.Or for the default role
+	"context" // Store methods take the request's context, for backends that do I/O
+	"errors"  // For errDuplicateEmail
+	"fmt"     // For wrapping errNotFound
+	"io"      // For the race example's output
+	"sort"    // For ordering the per-day statistics
+	"strings" // For normalizing emails
+	"sync"    // For the store's RWMutex
+	"time"    // For the UTC timestamps set on insert/update
+)
+
+// The users used to live in a package-level `var users = []User{}` that every
+// file reached into directly - like a module-level array in Node that any
+// require() can mutate. A store value is created once in main() and
+// handed to NewAPI, so two servers (or two tests) never share users by accident.
+//
+// userService (see service.go) only knows the UserStore interface, so where
+// users are kept is decided in main() alone: memoryUserStore today, a
+// database-backed store implementing the same methods later - like swapping
+// a knex config without touching the routes. In memory, the generic
+// Repository (see repository.go) does the storing; memoryUserStore adds what
+// is specific to users: validation, tenant scoping and timestamps.
+
+// errUserNotFound is returned when no user has the requested ID
+// A package-level error value lets callers check for it with errors.Is; it
+// wraps errNotFound, so errors.Is(err, errNotFound) is true as well and
+// writeError answers 404 (see errors.go)
+var errUserNotFound = fmt.Errorf("user %w", errNotFound)
+
+// errDuplicateEmail is returned by every UserStore for a duplicate email in a tenant
+// Handlers answer it with 409 (see errors.go)
+var errDuplicateEmail = errors.New("email already exists")
+
+// UserStore is where users are kept. Every method takes or checks a tenant
+// ID, so no query can ever return or modify another tenant's users.
+// Implementations validate what they store (required fields, unique email per
+// tenant) and set the timestamps; events and other side effects are the
+// service's job, not the store's
+type UserStore interface {
+	Create(ctx context.Context, u User) (User, error)                                  // Assigns the ID; u.TenantID is set by the caller
+	GetAll(ctx context.Context, tenantID string) []User                                // Soft-deleted users are left out
+	Query(ctx context.Context, tenantID string, q listQuery) ([]User, pageMeta, error) // One page of GetAll, filtered and sorted
+	GetByID(ctx context.Context, tenantID string, id int) (User, error)                // errUserNotFound if missing or deleted
+	GetByUUID(ctx context.Context, tenantID, uuid string) (User, error)                // Users created with -user-ids=uuid (see ids.go)
+	GetByEmail(ctx context.Context, tenantID, email string) (User, error)              // For logging in; errUserNotFound if missing or deleted
+	Update(ctx context.Context, u User) (User, error)                                  // Name, email, avatar and settings; never the password
+	SetPasswordHash(ctx context.Context, tenantID string, id int, hash string) error
+	Delete(ctx context.Context, tenantID string, id int) error        // Soft delete: sets DeletedAt
+	Erase(ctx context.Context, tenantID string, id int) (User, error) // Hard delete; returns the user as it was
+	Purge(ctx context.Context, cutoff time.Time) []User               // Removes users soft-deleted before cutoff
+	DeleteTenant(ctx context.Context, tenantID string)
+	Stats(ctx context.Context) userStats
+	Ping(ctx context.Context) error // nil when the store can answer; probed by healthChecker (see health.go)
+}
+
+// Every request runs in its own goroutine, so two POST /users can reach
+// Create at the same moment. Node never has that problem - one thread runs
+// one callback at a time - but here, without a lock, both could pass the
+// duplicate-email check before either inserts, or append to the slice at
+// once and lose a user. `go run -race . -example=race` shows the race
+// detector catching it when the lock is taken out.
+//
+// sync.RWMutex lets any number of readers in at once, or one writer alone.
+// Every exported method takes the lock once; under it they call get, not
+// GetByID: Go's mutexes aren't reentrant, so Update calling GetByID under
+// the write lock would wait for itself forever.
+
+func init() {
+	registerExample("race", storeRaceExample)
+}
+
+// memoryUserStore is the in-memory UserStore, safe for concurrent use
+type memoryUserStore struct {
+	mu    sync.RWMutex // RLock for reads, Lock for writes; guards users
+	users *Repository[User]
+	ids   idStrategy // A UUID too, or a snowflake instead of the counter (see ids.go)
+}
+
+// newMemoryUserStore creates an empty store
+func newMemoryUserStore(ids idStrategy) *memoryUserStore {
+	return &memoryUserStore{users: newRepository[User](), ids: ids}
+}
+
+// normalizeEmail trims and lowercases an email, so "A@B.com " and "a@b.com"
+// are one address. Strictly, the part before the @ may be case-sensitive
+// (RFC 5321), but no mail provider treats it so, and users don't expect it
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateUserFields normalizes u's email, then checks the rules in User's
+// validate tags (see validate.go) and the role; every UserStore calls it
+// before storing, so the duplicate check compares normalized emails
+func validateUserFields(u *User) error {
+	u.Email = normalizeEmail(u.Email)
+	if err := validateStruct(u); err != nil {
+		return err // A validationError listing every field that failed: 422
+	}
+	if !validRole(u.Role) {
+		return errInvalidRole
+	}
+	return nil
+}
+
+// validate normalizes and checks the fields, and email uniqueness within u's tenant
+// Users with the same ID are skipped so an update can keep its own email
+// (sqlStore leaves uniqueness to a unique index, see sqlstore.go)
+// The caller holds the write lock, so no other user can take the email
+// between this check and the write
+func (s *memoryUserStore) validate(u *User) error {
+	if err := validateUserFields(u); err != nil {
+		return err
+	}
+
+	// Check for duplicate emails; a deleted user's email is free again
+	// for range over an iterator works like over a slice (see Repository.All)
+	for user := range s.users.All() {
+		if user.TenantID == u.TenantID && user.Email == u.Email && user.ID != u.ID && !user.deleted() {
+			return errDuplicateEmail
+		}
+	}
+	return nil
+}
+
+// Create validates and adds a user to the store
+// The caller sets u.TenantID from the request context
+// Returns the stored user (with its new ID) and an error if validation fails
+// This demonstrates Go's error handling pattern: return error as last value
+// Both the JSON API and the HTML form (web.go) go through this method
+func (s *memoryUserStore) Create(ctx context.Context, u User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock() // Released on every return, like a finally block
+	if err := s.validate(&u); err != nil {
+		return User{}, err
+	}
+
+	// Always UTC: time.Now() carries the server's local zone, which would
+	// leak into the stored data and change with the machine it runs on
+	u.CreatedAt = time.Now().UTC()
+	u.UpdatedAt = u.CreatedAt
+	u.Role = cmp.Or(u.Role, roleUser)
+	s.ids.assign(&u)
+	if u.ID != 0 { // A snowflake (see ids.go)
+		return s.users.Insert(u)
+	}
+
+	// The repository assigns the ID
+	// Return nil (no error) to indicate success
+	// nil is Go's equivalent to null/undefined for pointers, slices, maps, channels, interfaces
+	return s.users.Create(u), nil
+}
+
+// GetAll returns the users belonging to one tenant
+// It stops early when ctx is cancelled (the client hung up, see cancel.go);
+// the caller checks ctx and discards the partial result
+func (s *memoryUserStore) GetAll(ctx context.Context, tenantID string) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := []User{} // A copy: it stays valid after the lock is released
+	for u := range s.users.All() {
+		if ctx.Err() != nil {
+			break
+		}
+		if u.TenantID == tenantID && !u.deleted() {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// Query returns one page of a tenant's users, with the total and next cursor
+// In memory there's nothing to push the query into: it's applied to a copy
+// of the slice, the same as the handler used to do (see query.go)
+func (s *memoryUserStore) Query(ctx context.Context, tenantID string, q listQuery) ([]User, pageMeta, error) {
+	// Filtering and sorting work on the copy, so writers only wait for the copying
+	users, meta := userListSpec.apply(s.GetAll(ctx, tenantID), q)
+	return users, meta, ctx.Err()
+}
+
+// GetByID returns the user with the given ID in the given tenant
+func (s *memoryUserStore) GetByID(ctx context.Context, tenantID string, id int) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.get(tenantID, id)
+}
+
+// get is GetByID for callers that hold the lock
+func (s *memoryUserStore) get(tenantID string, id int) (User, error) {
+	u, err := s.users.Get(id)
+	if err != nil || u.TenantID != tenantID || u.deleted() {
+		return User{}, errUserNotFound // Another tenant's (or a deleted) user looks exactly like a missing one
+	}
+	return u, nil
+}
+
+// GetByUUID returns the user with the given UUID in the given tenant
+func (s *memoryUserStore) GetByUUID(ctx context.Context, tenantID, uuid string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for u := range s.users.All() {
+		if u.TenantID == tenantID && u.UUID == uuid && uuid != "" && !u.deleted() {
+			return u, nil
+		}
+	}
+	return User{}, errUserNotFound
+}
+
+// GetByEmail returns the user with the given email in the given tenant
+// Like every store, it normalizes the email first: "Ada@Example.com" logs in as ada@example.com
+func (s *memoryUserStore) GetByEmail(ctx context.Context, tenantID, email string) (User, error) {
+	email = normalizeEmail(email)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for u := range s.users.All() {
+		if u.TenantID == tenantID && u.Email == email && !u.deleted() {
+			return u, nil
+		}
+	}
+	return User{}, errUserNotFound
+}
+
+// Update replaces the name and email of an existing user in u's tenant
+func (s *memoryUserStore) Update(ctx context.Context, u User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.get(u.TenantID, u.ID)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.validate(&u); err != nil {
+		return User{}, err
+	}
+	u.CreatedAt = existing.CreatedAt       // Callers can't change when a user was created
+	u.UUID = existing.UUID                 // ...or its IDs
+	u.PasswordHash = existing.PasswordHash // ...or the password - a bulk upsert sends users without one
+	u.UpdatedAt = time.Now().UTC()
+	if err := s.users.Update(u); err != nil {
+		return User{}, errUserNotFound
+	}
+	return u, nil
+}
+
+// SetPasswordHash replaces a user's password hash; UpdatedAt stays, since
+// rehashing on login isn't a change the user made
+func (s *memoryUserStore) SetPasswordHash(ctx context.Context, tenantID string, id int, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.get(tenantID, id)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	if err := s.users.Update(u); err != nil {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// Delete soft-deletes a user by ID from the given tenant: the record stays,
+// marked with DeletedAt, until Purge removes it after the retention period
+// (see purge.go) - so an accidental delete can still be investigated
+func (s *memoryUserStore) Delete(ctx context.Context, tenantID string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.get(tenantID, id)
+	if err != nil {
+		return err
+	}
+	u.DeletedAt = time.Now().UTC()
+	return s.users.Update(u)
+}
+
+// Erase removes a user at once, skipping the soft-delete period (see gdpr.go)
+// It returns the user as it was, so the caller can clean up what it referenced
+func (s *memoryUserStore) Erase(ctx context.Context, tenantID string, id int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.get(tenantID, id)
+	if err != nil {
+		return User{}, err
+	}
+	return u, s.users.Delete(id)
+}
+
+// Purge permanently removes users soft-deleted before cutoff and returns them
+func (s *memoryUserStore) Purge(ctx context.Context, cutoff time.Time) []User {
+	expired := func(u User) bool { return u.deleted() && u.DeletedAt.Before(cutoff) }
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := s.users.List(expired)
+	s.users.DeleteFunc(expired)
+	return purged
+}
+
+// DeleteTenant removes every user of a tenant (used when the tenant is deleted)
+func (s *memoryUserStore) DeleteTenant(ctx context.Context, tenantID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users.DeleteFunc(func(u User) bool { return u.TenantID == tenantID })
+}
+
+// userStats are aggregate numbers about the user store (see stats.go)
+type userStats struct {
+	Total         int            `json:"total_users"`
+	Deleted       int            `json:"deleted_users"` // Soft-deleted, waiting to be purged (not in Total)
+	PerTenant     map[string]int `json:"users_per_tenant"`
+	SignupsPerDay []dayCount     `json:"signups_per_day"` // Oldest first, UTC days
+}
+
+// dayCount is the number of signups on one UTC day
+type dayCount struct {
+	Day   string `json:"day"` // "2024-03-31"
+	Count int    `json:"count"`
+}
+
+// Ping always succeeds: a map in this process is up as long as the process is
+// It's there so /readyz treats every store the same way
+func (s *memoryUserStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Stats aggregates in a single pass over the store, keeping only
+// counters - no copy of the users is made, the same way a database would
+// answer with SELECT count(*) ... GROUP BY instead of returning every row
+func (s *memoryUserStore) Stats(ctx context.Context) userStats {
+	stats := userStats{PerTenant: map[string]int{}, SignupsPerDay: []dayCount{}}
+	perDay := map[string]int{}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for user := range s.users.All() {
+		if user.deleted() {
+			stats.Deleted++
+			continue
+		}
+		stats.Total++
+		stats.PerTenant[user.TenantID]++
+		perDay[user.CreatedAt.UTC().Format(time.DateOnly)]++ // time.DateOnly = "2006-01-02"
+	}
+	for day, n := range perDay {
+		stats.SignupsPerDay = append(stats.SignupsPerDay, dayCount{Day: day, Count: n})
+	}
+	// ISO dates sort correctly as strings
+	sort.Slice(stats.SignupsPerDay, func(i, j int) bool {
+		return stats.SignupsPerDay[i].Day < stats.SignupsPerDay[j].Day
+	})
+	return stats
+}
+
+// storeRaceExample runs creates, reads and erases on one store from many
+// goroutines at once, then checks what a lost update or a double ID would
+// break. Run it with the race detector, which reports any unguarded access:
+//
+//	go run -race . -example=race
+func storeRaceExample(w io.Writer) {
+	const workers, perWorker = 16, 50
+	s := newMemoryUserStore(counterIDs{})
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	var mu sync.Mutex // Guards erased, which every goroutine adds to
+	erased := 0
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perWorker {
+				u, err := s.Create(ctx, User{TenantID: "race", Name: "Racer", Email: fmt.Sprintf("racer%d-%d@example.com", i, j)})
+				if err == nil && j%5 == 0 {
+					if _, err := s.Erase(ctx, "race", u.ID); err == nil {
+						mu.Lock()
+						erased++
+						mu.Unlock()
+					}
+				}
+				s.GetAll(ctx, "race")
+				// Every goroutine wants this address; exactly one may get it
+				s.Create(ctx, User{TenantID: "race", Name: "Winner", Email: "same@example.com"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	users := s.GetAll(ctx, "race")
+	ids := map[int]bool{}
+	winners := 0
+	for _, u := range users {
+		ids[u.ID] = true
+		if u.Email == "same@example.com" {
+			winners++
+		}
+	}
+	want := workers*perWorker - erased + 1
+	fmt.Fprintf(w, "%d goroutines, %d users expected, %d stored\n", workers, want, len(users))
+	fmt.Fprintf(w, "distinct IDs: %d, users with the contested email: %d\n", len(ids), winners)
+	if len(users) == want && len(ids) == want && winners == 1 {
+		fmt.Fprintln(w, "ok: no lost writes, no reused IDs, one duplicate check won")
+	} else {
+		fmt.Fprintln(w, "FAIL: the store lost or duplicated users")
+	}
+}
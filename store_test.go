@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"  // Every store call takes one
+	"errors"   // For errors.Is on the store's sentinel errors
+	"fmt"      // For distinct names and emails
+	"net/http" // For building list queries from a URL
+	"sync"     // For the WaitGroup
+	"testing"  // Go's built-in test runner: go test ./... instead of Jest
+)
+
+// TestMemoryStoreConcurrent hammers the in-memory store from many goroutines
+// at once - what concurrent requests do to it. Run it under the race
+// detector, which only sees races that actually happen:
+//
+//	go test -race -run MemoryStoreConcurrent
+//
+// Without the RWMutex it reports a data race (and can lose users or hand out
+// an ID twice); with it, every created user is accounted for
+func TestMemoryStoreConcurrent(t *testing.T) {
+	const workers, perWorker = 8, 50
+	ctx := context.Background()
+	s := newMemoryUserStore(counterIDs{})
+	r, _ := http.NewRequest(http.MethodGet, "/users?sort=-id&per_page=10", nil)
+	q, err := parseListQuery(r, userListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	ids := make(chan int, workers*perWorker)
+	for w := range workers {
+		wg.Go(func() {
+			for i := range perWorker {
+				u, err := s.Create(ctx, User{TenantID: "acme", Name: "User", Email: fmt.Sprintf("u%d-%d@example.com", w, i)})
+				if err != nil {
+					t.Errorf("create: %v", err)
+					return
+				}
+				ids <- u.ID
+				u.Name = "Renamed"
+				if _, err := s.Update(ctx, u); err != nil {
+					t.Errorf("update %d: %v", u.ID, err)
+				}
+				if _, _, err := s.Query(ctx, "acme", q); err != nil {
+					t.Errorf("query: %v", err)
+				}
+				// Every other user is deleted again, so deletes run alongside everything else
+				if i%2 == 1 {
+					if err := s.Delete(ctx, "acme", u.ID); err != nil {
+						t.Errorf("delete %d: %v", u.ID, err)
+					}
+				}
+			}
+		})
+	}
+	// The same email from every worker at once: exactly one may win
+	dupes := make(chan error, workers)
+	for range workers {
+		wg.Go(func() {
+			_, err := s.Create(ctx, User{TenantID: "acme", Name: "Dupe", Email: "same@example.com"})
+			dupes <- err
+		})
+	}
+	wg.Wait()
+	close(ids)
+	close(dupes)
+
+	seen := map[int]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("ID %d handed out twice", id)
+		}
+		seen[id] = true
+	}
+	won := 0
+	for err := range dupes {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, errDuplicateEmail):
+			t.Errorf("duplicate create: err = %v", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d creates of the same email succeeded, want 1", won)
+	}
+	// Half of each worker's users are left, plus the one duplicate that won
+	if got, want := len(s.GetAll(ctx, "acme")), workers*perWorker/2+1; got != want {
+		t.Errorf("%d users left, want %d", got, want)
+	}
+}
@@ -0,0 +1,193 @@
+// Package main - a UserStore decorator that times every call
+package main
+
+import (
+	"context"  // Passed through to the wrapped store
+	"errors"   // For telling misses from failures
+	"expvar"   // For publishing the metrics
+	"log/slog" // For slow call warnings
+	"time"     // For latency
+)
+
+// A decorator implements an interface by wrapping another implementation of
+// it: instrumentedStore is a UserStore that forwards every call to the real
+// store and measures it on the way. Nothing else changes - userService, the
+// seed loader and the handlers still just see a UserStore. main() decides
+// whether it's there:
+//
+//	store = instrumentStore(store, *slowStoreCall, logger)
+//
+// Decorators stack, so a caching layer would wrap the same way
+// (instrumentStore(newCachedStore(sql)) times cache hits, the other order only
+// the database). In Node you'd write a Proxy or wrap each method of the
+// repository object; Go's interfaces make the wrapper a plain struct.
+
+// storeMetrics holds one expvar map per UserStore method under "user_store"
+// {"GetAll": {"calls": 120, "errors": 0, "slow": 2, "latency_us": 48210, "avg_latency_ms": 0.4}}
+var storeMetrics = expvar.NewMap("user_store")
+
+// storeMethodMetrics are the counters of one method
+type storeMethodMetrics struct {
+	calls, errors, slow expvar.Int
+	latency             expvar.Int // Total microseconds; divide by calls for the average
+}
+
+// instrumentedStore decorates a UserStore with latency, error and slow-call metrics
+// Methods without an error result (GetAll, Purge, DeleteTenant, Stats) only
+// report calls and latency - the store logs their failures itself
+type instrumentedStore struct {
+	next    UserStore
+	slow    time.Duration // Calls taking longer are logged; 0 = never
+	logger  *slog.Logger
+	methods map[string]*storeMethodMetrics // Filled in once, read-only afterwards - no lock needed
+}
+
+// instrumentStore wraps next and publishes its metrics on /debug/vars
+func instrumentStore(next UserStore, slow time.Duration, logger *slog.Logger) *instrumentedStore {
+	s := &instrumentedStore{next: next, slow: slow, logger: logger, methods: map[string]*storeMethodMetrics{}}
+	for _, name := range []string{"Create", "GetAll", "Query", "GetByID", "GetByUUID", "GetByEmail", "Update", "SetPasswordHash", "Delete", "Erase", "Purge", "DeleteTenant", "Stats"} {
+		mm := &storeMethodMetrics{}
+		m := new(expvar.Map).Init()
+		m.Set("calls", &mm.calls)
+		m.Set("errors", &mm.errors)
+		m.Set("slow", &mm.slow)
+		m.Set("latency_us", &mm.latency)
+		// expvar.Func is computed each time /debug/vars is read
+		m.Set("avg_latency_ms", expvar.Func(func() any {
+			if n := mm.calls.Value(); n > 0 {
+				return float64(mm.latency.Value()) / float64(n) / 1000
+			}
+			return 0.0
+		}))
+		storeMetrics.Set(name, m)
+		s.methods[name] = mm
+	}
+	return s
+}
+
+// observe records one call that started at start and ended with err
+// errUserNotFound is an answer ("no such user"), not a store failure, so it
+// isn't counted as an error; everything else is, validation errors included
+func (s *instrumentedStore) observe(ctx context.Context, method string, start time.Time, err error) {
+	took := time.Since(start)
+	mm := s.methods[method]
+	mm.calls.Add(1)
+	mm.latency.Add(took.Microseconds())
+	if err != nil && !errors.Is(err, errUserNotFound) {
+		mm.errors.Add(1)
+	}
+	if s.slow > 0 && took > s.slow {
+		mm.slow.Add(1)
+		// WarnContext adds the request ID, so the slow call can be matched to its request (see logging.go)
+		s.logger.WarnContext(ctx, "slow store call", "method", method, "took", took.Round(time.Microsecond), "threshold", s.slow)
+	}
+}
+
+// Create forwards to the wrapped store and times the call
+func (s *instrumentedStore) Create(ctx context.Context, u User) (User, error) {
+	start := time.Now()
+	created, err := s.next.Create(ctx, u)
+	s.observe(ctx, "Create", start, err)
+	return created, err
+}
+
+// GetAll forwards to the wrapped store and times the call
+func (s *instrumentedStore) GetAll(ctx context.Context, tenantID string) []User {
+	start := time.Now()
+	users := s.next.GetAll(ctx, tenantID)
+	s.observe(ctx, "GetAll", start, nil)
+	return users
+}
+
+// Query forwards to the wrapped store and times the call
+func (s *instrumentedStore) Query(ctx context.Context, tenantID string, q listQuery) ([]User, pageMeta, error) {
+	start := time.Now()
+	users, meta, err := s.next.Query(ctx, tenantID, q)
+	s.observe(ctx, "Query", start, err)
+	return users, meta, err
+}
+
+// GetByID forwards to the wrapped store and times the call
+func (s *instrumentedStore) GetByID(ctx context.Context, tenantID string, id int) (User, error) {
+	start := time.Now()
+	u, err := s.next.GetByID(ctx, tenantID, id)
+	s.observe(ctx, "GetByID", start, err)
+	return u, err
+}
+
+// GetByUUID forwards to the wrapped store and times the call
+func (s *instrumentedStore) GetByUUID(ctx context.Context, tenantID, uuid string) (User, error) {
+	start := time.Now()
+	u, err := s.next.GetByUUID(ctx, tenantID, uuid)
+	s.observe(ctx, "GetByUUID", start, err)
+	return u, err
+}
+
+// GetByEmail forwards to the wrapped store and times the call
+func (s *instrumentedStore) GetByEmail(ctx context.Context, tenantID, email string) (User, error) {
+	start := time.Now()
+	u, err := s.next.GetByEmail(ctx, tenantID, email)
+	s.observe(ctx, "GetByEmail", start, err)
+	return u, err
+}
+
+// Update forwards to the wrapped store and times the call
+func (s *instrumentedStore) Update(ctx context.Context, u User) (User, error) {
+	start := time.Now()
+	updated, err := s.next.Update(ctx, u)
+	s.observe(ctx, "Update", start, err)
+	return updated, err
+}
+
+// SetPasswordHash forwards to the wrapped store and times the call
+func (s *instrumentedStore) SetPasswordHash(ctx context.Context, tenantID string, id int, hash string) error {
+	start := time.Now()
+	err := s.next.SetPasswordHash(ctx, tenantID, id, hash)
+	s.observe(ctx, "SetPasswordHash", start, err)
+	return err
+}
+
+// Delete forwards to the wrapped store and times the call
+func (s *instrumentedStore) Delete(ctx context.Context, tenantID string, id int) error {
+	start := time.Now()
+	err := s.next.Delete(ctx, tenantID, id)
+	s.observe(ctx, "Delete", start, err)
+	return err
+}
+
+// Erase forwards to the wrapped store and times the call
+func (s *instrumentedStore) Erase(ctx context.Context, tenantID string, id int) (User, error) {
+	start := time.Now()
+	u, err := s.next.Erase(ctx, tenantID, id)
+	s.observe(ctx, "Erase", start, err)
+	return u, err
+}
+
+// Purge forwards to the wrapped store and times the call
+func (s *instrumentedStore) Purge(ctx context.Context, cutoff time.Time) []User {
+	start := time.Now()
+	purged := s.next.Purge(ctx, cutoff)
+	s.observe(ctx, "Purge", start, nil)
+	return purged
+}
+
+// DeleteTenant forwards to the wrapped store and times the call
+func (s *instrumentedStore) DeleteTenant(ctx context.Context, tenantID string) {
+	start := time.Now()
+	s.next.DeleteTenant(ctx, tenantID)
+	s.observe(ctx, "DeleteTenant", start, nil)
+}
+
+// Stats forwards to the wrapped store and times the call
+func (s *instrumentedStore) Stats(ctx context.Context) userStats {
+	start := time.Now()
+	stats := s.next.Stats(ctx)
+	s.observe(ctx, "Stats", start, nil)
+	return stats
+}
+
+// Ping forwards without timing: the health checker calls it every few
+// seconds, which would drown the request-driven numbers
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
@@ -0,0 +1,215 @@
+// Package main - multi-tenancy: resolving, carrying and managing tenants
+package main
+
+import (
+	"context"  // For carrying the tenant ID through the request
+	"errors"   // For tenant validation errors
+	"net"      // For stripping the port from the Host header
+	"net/http" // For handlers and middleware
+	"regexp"   // For validating tenant IDs
+	"sort"     // For listing tenants in a stable order
+	"strings"  // For subdomain and header parsing
+	"sync"     // For the mutex protecting the tenant map
+	"time"     // For tenant creation timestamps
+)
+
+// defaultTenantID is used when a request names no tenant at all,
+// so the single-tenant quick start (curl localhost:8080/users) keeps working
+const defaultTenantID = "default"
+
+// Sentinel errors for tenant management, checked with errors.Is in handlers
+var (
+	errTenantNotFound = errors.New("tenant not found")
+	errDefaultTenant  = errors.New("the default tenant cannot be deleted")
+)
+
+// tenantIDPattern restricts IDs to what is safe in a subdomain
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Tenant is an isolated customer space - users in one tenant are invisible to others
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	MaxUsers  int       `json:"max_users,omitempty"` // Its users quota; 0 = -max-users-per-tenant (see quota.go)
+}
+
+// tenantStore keeps the known tenants in memory
+type tenantStore struct {
+	mu      sync.RWMutex
+	tenants map[string]Tenant
+}
+
+// newTenantStore creates a store that already contains the default tenant
+func newTenantStore() *tenantStore {
+	return &tenantStore{tenants: map[string]Tenant{
+		defaultTenantID: {ID: defaultTenantID, Name: "Default", CreatedAt: time.Now().UTC()},
+	}}
+}
+
+// exists reports whether a tenant ID is registered
+func (s *tenantStore) exists(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.tenants[id]
+	return ok
+}
+
+// list returns all tenants sorted by ID
+func (s *tenantStore) list() []Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		out = append(out, t)
+	}
+	// sort.Slice takes a "less" function, like Array.prototype.sort's comparator
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// create registers a new tenant
+func (s *tenantStore) create(t Tenant) (Tenant, error) {
+	if !tenantIDPattern.MatchString(t.ID) {
+		return Tenant{}, errors.New("tenant id must be lowercase letters, digits and dashes")
+	}
+	if t.Name == "" {
+		t.Name = t.ID
+	}
+	if t.MaxUsers < 0 {
+		return Tenant{}, errors.New("max_users must not be negative")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[t.ID]; ok {
+		return Tenant{}, errors.New("tenant already exists")
+	}
+	t.CreatedAt = time.Now().UTC()
+	s.tenants[t.ID] = t
+	return t, nil
+}
+
+// maxUsers returns a tenant's own users quota, 0 when it has none
+func (s *tenantStore) maxUsers(id string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tenants[id].MaxUsers
+}
+
+// remove deletes a tenant; the default tenant can't be removed
+func (s *tenantStore) remove(id string) error {
+	if id == defaultTenantID {
+		return errDefaultTenant
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[id]; !ok {
+		return errTenantNotFound
+	}
+	delete(s.tenants, id)
+	return nil
+}
+
+// tenantKey is the context key for the resolved tenant ID
+// No other package can read or overwrite it by accident (see ctxvalue.go)
+var tenantKey = newCtxKey[string]("tenant")
+
+// withTenant returns a copy of ctx carrying the tenant ID
+func withTenant(ctx context.Context, tenantID string) context.Context {
+	return tenantKey.with(ctx, tenantID)
+}
+
+// tenantFromContext returns the tenant resolved for this request
+// Falls back to the default tenant for code paths outside the middleware
+func tenantFromContext(ctx context.Context) string {
+	if id, ok := tenantKey.from(ctx); ok {
+		return id
+	}
+	return defaultTenantID
+}
+
+// resolveTenant works out which tenant a request belongs to and stores it in the context
+// Order: X-Tenant-ID header, then the subdomain of baseDomain
+// (acme.localhost:8080 → "acme"), then the default tenant
+// Express equivalent: app.use((req, res, next) => { req.tenant = ...; next() })
+func resolveTenant(tenants *tenantStore, baseDomain string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Tenant-ID")))
+			if id == "" {
+				id = subdomainTenant(r.Host, baseDomain)
+			}
+			if id == "" {
+				id = defaultTenantID
+			}
+
+			// Unknown tenants are rejected instead of silently falling back,
+			// otherwise a typo would show (and write to) the default tenant's data
+			if !tenants.exists(id) {
+				writeJSONError(w, http.StatusNotFound, "unknown tenant: "+id)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withTenant(r.Context(), id)))
+		})
+	}
+}
+
+// subdomainTenant extracts the label directly left of baseDomain from a Host header
+// "acme.example.com:8080" with base "example.com" → "acme"
+func subdomainTenant(host, baseDomain string) string {
+	// SplitHostPort fails when there is no port - then the host is used as-is
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	suffix := "." + baseDomain
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	sub := strings.TrimSuffix(host, suffix)
+	// For "www.acme.example.com" use the label closest to the base domain
+	if i := strings.LastIndex(sub, "."); i >= 0 {
+		sub = sub[i+1:]
+	}
+	return sub
+}
+
+// listTenantsHandler returns all tenants (GET /admin/tenants)
+func (a *api) listTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, a.tenants.list())
+}
+
+// createTenantHandler registers a tenant (POST /admin/tenants)
+func (a *api) createTenantHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[Tenant](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t, err := a.tenants.create(Tenant{ID: payload.ID, Name: payload.Name, MaxUsers: payload.MaxUsers})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusCreated, t)
+}
+
+// deleteTenantHandler removes a tenant and all of its users (DELETE /admin/tenants/{id})
+func (a *api) deleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := a.tenants.remove(id); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errTenantNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	a.users.DeleteTenant(r.Context(), id)
+	a.posts.DeleteFunc(inTenant[Post](id))
+	a.tags.DeleteFunc(inTenant[Tag](id))
+	w.WriteHeader(http.StatusNoContent)
+}
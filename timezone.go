@@ -0,0 +1,114 @@
+// Package main - UTC storage and per-request time zones for rendering timestamps
+package main
+
+import (
+	"context"  // For carrying the requested zone through the request
+	"fmt"      // For printing example output
+	"io"       // For the io.Writer the examples print to
+	"net/http" // For the middleware
+	"time"     // Go's time package: instants, durations and zones
+
+	// The blank import embeds the IANA zone database (~450KB) in the binary,
+	// so time.LoadLocation("Europe/Berlin") works even in scratch/distroless
+	// images that have no /usr/share/zoneinfo - Node bundles ICU data for the same reason
+	_ "time/tzdata"
+)
+
+// Node.js → Go cheat sheet for dates and times
+//
+//	new Date()                           → time.Now()
+//	Date.now()                           → time.Now().UnixMilli()
+//	d.toISOString()                      → t.UTC().Format(time.RFC3339)
+//	new Date('2024-03-01T10:00:00Z')     → time.Parse(time.RFC3339, "2024-03-01T10:00:00Z")
+//	d.toLocaleString('en', {timeZone})   → t.In(loc).Format("2006-01-02 15:04 MST")
+//	new Date(2024, 0, 31)  (month 0!)    → time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)
+//	d2 - d1  (milliseconds)              → t2.Sub(t1)  (a time.Duration)
+//
+// The rules this server follows:
+//   - Store and compare instants in UTC (time.Now().UTC()); never store local time
+//   - Convert to a zone only at the edge, when rendering a response
+//   - Zone names are IANA names ("America/New_York"), validated with time.LoadLocation
+
+// init() registers the "time" example
+func init() {
+	registerExample("time", timeExamples)
+}
+
+// timeExamples prints the JS Date pitfalls next to Go's behavior
+func timeExamples(w io.Writer) {
+	// Go formats with a reference time (Mon Jan 2 15:04:05 MST 2006) instead of YYYY-MM-DD
+	instant := time.Date(2024, time.March, 31, 0, 30, 0, 0, time.UTC)
+	fmt.Fprintln(w, "RFC3339 (UTC):", instant.Format(time.RFC3339)) // 2024-03-31T00:30:00Z
+
+	// The same instant in several zones - only the presentation changes
+	for _, name := range []string{"Europe/Berlin", "America/New_York", "Asia/Kolkata"} {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			fmt.Fprintln(w, "LoadLocation error:", err)
+			continue
+		}
+		fmt.Fprintf(w, "%-17s %s\n", name+":", instant.In(loc).Format("2006-01-02 15:04 MST (-07:00)"))
+	}
+
+	// JS: new Date('2024-03-31') is UTC but new Date('2024-03-31T00:30') is local time!
+	// Go: time.Parse without an offset always means UTC; ParseInLocation is explicit
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	local, _ := time.ParseInLocation("2006-01-02T15:04", "2024-03-31T00:30", berlin)
+	fmt.Fprintln(w, "ParseInLocation:", local.UTC().Format(time.RFC3339)) // 2024-03-30T23:30:00Z
+
+	// == compares the zone too; Equal compares the instant
+	fmt.Fprintln(w, "== :", instant == instant.In(berlin))       // false
+	fmt.Fprintln(w, "Equal:", instant.Equal(instant.In(berlin))) // true
+
+	// DST: adding 24h is not always "tomorrow at the same time"
+	before := time.Date(2024, time.March, 30, 12, 0, 0, 0, berlin)
+	fmt.Fprintln(w, "+24h:", before.Add(24*time.Hour).Format("Jan 2 15:04 MST"))   // Mar 31 13:00 CEST
+	fmt.Fprintln(w, "AddDate:", before.AddDate(0, 0, 1).Format("Jan 2 15:04 MST")) // Mar 31 12:00 CEST
+}
+
+// tzKey is the context key for the requested *time.Location
+var tzKey = newCtxKey[*time.Location]("time_zone")
+
+// locationFromContext returns the zone to render times in (UTC by default)
+func locationFromContext(ctx context.Context) *time.Location {
+	if loc, ok := tzKey.from(ctx); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// resolveTimezone reads ?tz= (or the X-Timezone header) and stores the zone in the context
+// Unknown zone names are rejected with 400 rather than silently shown as UTC
+func resolveTimezone() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := r.URL.Query().Get("tz")
+			if name == "" {
+				name = r.Header.Get("X-Timezone")
+			}
+			if name == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// LoadLocation also accepts "" and "Local" (the server's zone), which
+			// would make the output depend on where the binary runs - refuse it
+			loc, err := time.LoadLocation(name)
+			if err != nil || name == "Local" {
+				writeJSONError(w, http.StatusBadRequest, "unknown time zone: "+name)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(tzKey.with(r.Context(), loc)))
+		})
+	}
+}
+
+// localUser returns a copy of u with its timestamps in the request's zone
+// The stored user keeps UTC - this only changes how the times are rendered
+// (JSON shows the offset, e.g. "2024-03-31T02:30:00+02:00")
+func localUser(r *http.Request, u User) User {
+	loc := locationFromContext(r.Context())
+	u.CreatedAt = u.CreatedAt.In(loc)
+	u.UpdatedAt = u.UpdatedAt.In(loc)
+	return u
+}
@@ -0,0 +1,104 @@
+// Package main - upload validation: sniff the real content type, check it against an allowlist
+package main
+
+import (
+	"mime"     // For stripping parameters like "; charset=utf-8"
+	"net/http" // For DetectContentType and the response
+	"path"     // For the file extension
+	"slices"   // For slices.Contains on the extension list
+	"sort"     // For listing allowed types in a stable order
+	"strings"  // For case-insensitive extensions
+)
+
+// The client's Content-Type header is just a claim - anyone can upload an
+// HTML page labelled image/png and have it served back to other users.
+// http.DetectContentType looks at the first 512 bytes instead (the WHATWG
+// "MIME sniffing" algorithm browsers use), like the file-type package in Node.
+
+// uploadTypes maps each allowed sniffed type to the file extensions that may carry it
+var uploadTypes = map[string][]string{
+	"image/png":       {".png"},
+	"image/jpeg":      {".jpg", ".jpeg"},
+	"image/gif":       {".gif"},
+	"image/webp":      {".webp"},
+	"application/pdf": {".pdf"},
+	"text/plain":      {".txt", ".csv", ".md"},
+}
+
+// avatarTypes is the stricter allowlist for avatars: only what image.Decode can read
+var avatarTypes = map[string][]string{
+	"image/png":  uploadTypes["image/png"],
+	"image/jpeg": uploadTypes["image/jpeg"],
+	"image/gif":  uploadTypes["image/gif"],
+}
+
+// uploadTypeError describes a rejected upload; its fields go into the 415 response body
+// Implementing Error() makes it usable anywhere an error is expected
+type uploadTypeError struct {
+	Message   string   `json:"-"` // In the body's "error" object
+	Detected  string   `json:"detected_type"`
+	Declared  string   `json:"declared_type,omitempty"`
+	Extension string   `json:"extension,omitempty"`
+	Allowed   []string `json:"allowed_types"`
+}
+
+// Error implements the error interface
+func (e *uploadTypeError) Error() string {
+	return e.Message
+}
+
+// sniffUpload returns the detected media type of data (without parameters)
+// It fails when the type isn't in allowed, or when filename has an extension
+// that doesn't belong to the detected type ("cat.png" that is really a PDF)
+func sniffUpload(data []byte, declared, filename string, allowed map[string][]string) (string, error) {
+	// DetectContentType never looks past 512 bytes and always returns something,
+	// "application/octet-stream" when nothing matches
+	sniffed := http.DetectContentType(data[:min(len(data), 512)])
+	detected, _, err := mime.ParseMediaType(sniffed) // "text/plain; charset=utf-8" → "text/plain"
+	if err != nil {
+		detected = sniffed
+	}
+
+	reject := func(msg string) (string, error) {
+		return "", &uploadTypeError{
+			Message:   msg,
+			Detected:  detected,
+			Declared:  declared,
+			Extension: strings.ToLower(path.Ext(filename)),
+			Allowed:   allowedTypes(allowed),
+		}
+	}
+
+	exts, ok := allowed[detected]
+	if !ok {
+		return reject("content type " + detected + " is not allowed")
+	}
+	if ext := strings.ToLower(path.Ext(filename)); ext != "" {
+		if !slices.Contains(exts, ext) {
+			return reject("file extension " + ext + " does not match the content (" + detected + ")")
+		}
+	}
+	return detected, nil
+}
+
+// allowedTypes lists the keys of an allowlist, sorted for stable output
+func allowedTypes(allowed map[string][]string) []string {
+	types := make([]string, 0, len(allowed))
+	for t := range allowed {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// uploadTypeBody is the 415 body: the usual error (see errors.go) plus the details
+type uploadTypeBody struct {
+	errorBody
+	*uploadTypeError
+}
+
+// writeUploadTypeError sends a 415 Unsupported Media Type with a JSON body
+// clients can act on (show the allowed types, point out the wrong extension)
+func writeUploadTypeError(w http.ResponseWriter, err *uploadTypeError) {
+	respondJSON(w, http.StatusUnsupportedMediaType, uploadTypeBody{newErrorBody("unsupported_media_type", err.Message), err})
+}
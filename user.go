@@ -2,13 +2,66 @@
 // 'main' package indicates this is an executable program
 package main
 
+import "time" // For the created/updated timestamps
+
 // User represents a user in our system
 // This is a struct - Go's way of defining custom data types (like classes in other languages)
 type User struct {
 	// Field declarations: FieldName Type `json:"tag"`
 	// The `json:"..."` tags tell Go how to marshal/unmarshal this struct to/from JSON
 	// These tags are used by json.Marshal() and json.Unmarshal() functions
-	ID    int    `json:"id"`    // Auto-generated unique identifier
-	Name  string `json:"name"`  // User's display name
-	Email string `json:"email"` // User's email address (must be unique)
+	// validate:"..." tags are rules validateStruct checks before a user is stored (see validate.go)
+	ID    int    `json:"id"`                                      // Auto-generated unique identifier
+	UUID  string `json:"uuid,omitempty"`                          // Random public ID with -user-ids=uuid (see ids.go)
+	Name  string `json:"name" validate:"required,max=100"`        // User's display name
+	Email string `json:"email" validate:"required,email,max=254"` // User's email address (unique within a tenant); 254 is the SMTP limit
+
+	// Timestamps are always stored in UTC and converted per request (see timezone.go)
+	// time.Time marshals to RFC 3339, like Date.prototype.toJSON()
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Blob IDs of the processed avatar (see avatar.go); omitempty drops them until one is uploaded
+	// Download with GET /files/{id}/download?inline=1
+	AvatarID      string `json:"avatar_id,omitempty"`
+	AvatarThumbID string `json:"avatar_thumb_id,omitempty"`
+
+	// Preferences the user has chosen; GET /users/{id}/settings fills in the defaults (see settings.go)
+	Settings settingsPatch `json:"-"`
+
+	// Password is the plain password on its way in: userService.Create hashes it
+	// into PasswordHash and clears it, so it is never stored (see password.go)
+	// json:"-" means it is never read from or written to JSON with the rest of
+	// the user - handlers that accept a password decode it explicitly
+	Password string `json:"-"`
+
+	// bcrypt hash of the password (see password.go); "" for users created without one,
+	// who can't log in. Never sent to clients
+	PasswordHash string `json:"-"`
+
+	// What the user may do: roleUser or roleAdmin (see roles.go)
+	// Shown to clients, but only PUT /users/{id}/role changes it - every other
+	// handler copies the fields it accepts, so a client can't send "role":"admin"
+	Role string `json:"role"`
+
+	// Set by DELETE /users/{id}; the store hides the user until purge removes it (see purge.go)
+	DeletedAt time.Time `json:"-"`
+
+	// json:"-" keeps a field out of JSON entirely - tenants are an internal detail
+	TenantID string `json:"-"` // Tenant the user belongs to (see tenant.go)
+}
+
+// deleted reports whether the user has been soft-deleted
+func (u User) deleted() bool { return !u.DeletedAt.IsZero() }
+
+// EntityID and WithID make User an Entity, so it can live in a Repository (see repository.go)
+// Value receivers: WithID changes a copy and returns it, the original stays as it was
+
+// EntityID returns the user's ID
+func (u User) EntityID() int { return u.ID }
+
+// WithID returns a copy of the user with a new ID
+func (u User) WithID(id int) User {
+	u.ID = id
+	return u
 }
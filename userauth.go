@@ -0,0 +1,224 @@
+// Package main - user accounts: register, log in, and the middleware that checks tokens
+package main
+
+import (
+	"net/http" // For handlers
+	"strings"  // For the scope string
+	"time"     // For token expiry
+)
+
+// POST /auth/register creates a user with a password, POST /auth/login
+// checks it; both return a JWT (see jwt.go). Routes wrapped in requireAuth
+// (see authprovider.go) then need "Authorization: Bearer <token>" - what
+// passport-jwt or an express-jwt middleware does in Express. The token lasts
+// minutes; the refresh token returned with it gets a new pair from
+// POST /auth/refresh (see refreshtoken.go). Browsers can keep the login in a
+// cookie instead (POST /auth/session).
+
+// registerRequest is the body of POST /auth/register
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// loginRequest is the body of POST /auth/login and POST /auth/session
+// scope is optional and space-separated: "users:read" asks for a token that
+// can read but not write (see scopes.go); without it, the token gets every
+// scope the user's role allows. captcha_token is the widget's answer, needed
+// after too many failed logins from the client's IP (see captcha.go)
+type loginRequest struct {
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	Scope        string `json:"scope"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// changePasswordRequest is the body of PUT /users/{id}/password
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// authResponse is returned by register, login and refresh
+// token_type, expires_in and refresh_token follow OAuth 2's token response, which clients know
+type authResponse struct {
+	Token            string       `json:"token"`
+	TokenType        string       `json:"token_type"`
+	ExpiresIn        int          `json:"expires_in"` // Seconds
+	ExpiresAt        time.Time    `json:"expires_at"`
+	RefreshToken     string       `json:"refresh_token"`
+	RefreshExpiresAt time.Time    `json:"refresh_expires_at"`
+	Scope            string       `json:"scope"` // What the token may be used for, space-separated
+	User             userResponse `json:"user"`
+}
+
+// respondTokens issues an access and a refresh token for u and writes them with the user
+// family is empty for a login, or the family of the refresh token being
+// rotated; granted are the scopes the login asked for, nil for all
+func (a *api) respondTokens(w http.ResponseWriter, r *http.Request, status int, u User, family string, granted []string) {
+	now := time.Now()
+	if family == "" {
+		// A login starts a session (see sessions.go); refreshes continue it
+		family = a.refresh.startSession(u, r, now.Add(refreshTokenTTL), now)
+	}
+	scopes := effectiveScopes(roleOf(u), granted)
+	token, expires := a.tokens.issue(u, family, scopes, now)
+	// The refresh token keeps what was asked for, not what the role allows
+	// today: after a promotion, a full login's next token has the new scopes
+	refresh, refreshExpires := a.refresh.issue(u, family, granted, now)
+	w.Header().Set("Cache-Control", "no-store") // Tokens must not end up in a cache
+	respondJSON(w, status, authResponse{
+		Token:            token,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(tokenTTL.Seconds()),
+		ExpiresAt:        expires.UTC(),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpires.UTC(),
+		Scope:            strings.Join(scopes, " "),
+		User:             presentUser(r, u),
+	})
+}
+
+// registerHandler creates a user with a password and logs them in (POST /auth/register)
+//
+//	curl -X POST localhost:8080/auth/register -d '{"name":"Ada","email":"ada@example.com","password":"correct horse"}'
+func (a *api) registerHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := decode[registerRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if payload.Password == "" {
+		a.respondError(w, r, errPasswordLength)
+		return
+	}
+	// The same path as POST /users: validation, password hashing, unique
+	// email, user.created (welcome mail)
+	created, err := a.users.Create(r.Context(), User{
+		Name:     payload.Name,
+		Email:    payload.Email,
+		Password: payload.Password,
+		TenantID: tenantFromContext(r.Context()),
+	})
+	if err != nil {
+		a.respondError(w, r, err) // 400 for validation, 409 for a taken email (see errors.go)
+		return
+	}
+	a.respondTokens(w, r, http.StatusCreated, created, "", nil)
+}
+
+// loginHandler exchanges email and password for a token (POST /auth/login)
+// Every failure gets the same message: "wrong password" vs "no such user"
+// would tell an attacker which emails have accounts
+//
+//	curl -X POST localhost:8080/auth/login -d '{"email":"ada@example.com","password":"correct horse"}'
+//	curl -X POST localhost:8080/auth/login -d '{"email":"ada@example.com","password":"correct horse","scope":"users:read"}'
+func (a *api) loginHandler(w http.ResponseWriter, r *http.Request) {
+	u, granted, ok := a.login(w, r)
+	if !ok {
+		return
+	}
+	a.respondTokens(w, r, http.StatusOK, u, "", granted)
+}
+
+// login checks a loginRequest and the scopes it asks for, writing the error
+// response when either fails; shared by POST /auth/login and /auth/session
+func (a *api) login(w http.ResponseWriter, r *http.Request) (User, []string, bool) {
+	payload, err := decode[loginRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return User{}, nil, false
+	}
+	// Before the password: every guess past the threshold costs a solved challenge
+	if !a.checkChallenge(w, r, payload.CaptchaToken) {
+		return User{}, nil, false
+	}
+	u, err := a.users.Authenticate(r.Context(), tenantFromContext(r.Context()), payload.Email, payload.Password)
+	if err != nil {
+		a.logger.WarnContext(r.Context(), "auth: failed login")
+		a.loginFailed(r)
+		a.respondError(w, r, errInvalidCredentials) // Whatever went wrong, see above
+		return User{}, nil, false
+	}
+	// Checked after the password, so the answer can't reveal an account's role
+	granted, err := narrowScopes(roleOf(u), parseScopes(payload.Scope))
+	if err != nil {
+		a.respondError(w, r, err)
+		return User{}, nil, false
+	}
+	return u, granted, true
+}
+
+// changePasswordHandler sets a new password (PUT /users/{id}/password)
+// Behind requireAuth, so it's the user's own token or the admin token; the
+// current password is asked for anyway, so a token copied from an unlocked
+// laptop can't lock the owner out. Tokens issued before stay valid until
+// they expire - there's no revocation list
+//
+//	curl -X PUT -H "Authorization: Bearer $TOKEN" localhost:8080/users/9/password \
+//	  -d '{"current_password":"correct horse","new_password":"battery staple"}'
+func (a *api) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.userIDFromPath(r)
+	if err != nil {
+		a.respondError(w, r, err)
+		return
+	}
+	// Support may look around as a user, not take their account over
+	if p, _ := principalFromContext(r.Context()); p.Impersonator != "" {
+		a.respondError(w, r, errImpersonating)
+		return
+	}
+	payload, err := decode[changePasswordRequest](r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	err = a.users.ChangePassword(r.Context(), tenantFromContext(r.Context()), id, payload.CurrentPassword, payload.NewPassword)
+	if err != nil {
+		// 404, 403 for errWrongPassword, 400 for errPasswordLength, 500 logged (see errors.go)
+		a.respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionLoginHandler logs in and sets the session cookie (POST /auth/session)
+// The body is the same as POST /auth/login; the token goes into an HttpOnly
+// cookie instead of the response, so page scripts never see it
+//
+//	curl -c jar -X POST localhost:8080/auth/session -d '{"email":"ada@example.com","password":"correct horse"}'
+//	curl -b jar localhost:8080/me
+func (a *api) sessionLoginHandler(w http.ResponseWriter, r *http.Request) {
+	u, granted, ok := a.login(w, r)
+	if !ok {
+		return
+	}
+	a.startCookieSession(w, r, u, granted)
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, presentUser(r, u))
+}
+
+// startCookieSession logs u in with the session cookie
+// The session has no refresh token: it ends when the cookie's token expires,
+// or earlier through DELETE /me/sessions/{id}
+func (a *api) startCookieSession(w http.ResponseWriter, r *http.Request, u User, granted []string) {
+	now := time.Now()
+	sid := a.refresh.startSession(u, r, now.Add(tokenTTL), now)
+	token, expires := a.tokens.issue(u, sid, effectiveScopes(roleOf(u), granted), now)
+	setSessionCookie(w, r, token, expires)
+}
+
+// sessionLogoutHandler clears the session cookie and ends its session (DELETE /auth/session)
+// A copy of the cookie's token stops working too, at its next request
+func (a *api) sessionLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if claims, err := a.tokens.verify(c.Value, time.Now()); err == nil {
+			if id, err := claims.userID(); err == nil {
+				a.refresh.endSession(claims.Tenant, id, claims.Session) // Gone already is fine
+			}
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
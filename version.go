@@ -0,0 +1,40 @@
+// Package main - build/version information endpoint
+package main
+
+import (
+	"net/http"      // For the handler signature
+	"runtime"       // For the Go version
+	"runtime/debug" // For VCS info embedded by `go build`
+)
+
+// version is overridden at build time, the Go version of reading package.json:
+// go build -ldflags "-X main.version=1.4.0" -o server *.go
+var version = "dev"
+
+// versionInfo is the body of GET /version
+type versionInfo struct {
+	Version   string              `json:"version"`
+	Commit    string              `json:"commit,omitempty"`
+	GoVersion string              `json:"go_version"`
+	Flags     map[string]flagRule `json:"flags"` // Current feature flag state
+}
+
+// versionHandler reports what is running (GET /version)
+func (a *api) versionHandler(w http.ResponseWriter, r *http.Request) {
+	info := versionInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Flags:     a.flags.snapshot(),
+	}
+
+	// `go build` inside a git checkout records the commit hash in the binary
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	respondJSON(w, http.StatusOK, info)
+}
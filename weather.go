@@ -0,0 +1,179 @@
+// Package main - GET /weather: calling a third-party API from our API
+package main
+
+import (
+	"context"  // For the outbound deadline
+	"errors"   // For telling upstream failures apart
+	"net/http" // For handler types and status codes
+	"net/url"  // For building query strings safely
+	"strconv"  // For formatting coordinates
+	"strings"  // For normalising the cache key
+	"time"     // For timeouts and cache TTL
+)
+
+// Open-Meteo needs no API key, which keeps the example runnable
+// The base URLs can be pointed at a stub with WEATHER_GEOCODING_URL / WEATHER_FORECAST_URL
+const (
+	defaultGeocodingURL = "https://geocoding-api.open-meteo.com/v1/search"
+	defaultForecastURL  = "https://api.open-meteo.com/v1/forecast"
+	weatherCacheTTL     = 10 * time.Minute // Weather doesn't change by the second
+	weatherTimeout      = 5 * time.Second  // Budget for the whole lookup (both calls)
+)
+
+// errCityNotFound is returned when geocoding has no match
+var errCityNotFound = errors.New("city not found")
+
+// Typed views of the upstream responses - only the fields we use
+// Unknown JSON fields are ignored by encoding/json, so upstream additions can't break us
+
+// geocodingResponse is the body of the Open-Meteo search endpoint
+type geocodingResponse struct {
+	Results []struct {
+		Name      string  `json:"name"`
+		Country   string  `json:"country"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Timezone  string  `json:"timezone"`
+	} `json:"results"`
+}
+
+// forecastResponse is the body of the Open-Meteo forecast endpoint
+type forecastResponse struct {
+	Current struct {
+		Time          string  `json:"time"`
+		Temperature   float64 `json:"temperature_2m"`
+		WindSpeed     float64 `json:"wind_speed_10m"`
+		WeatherCode   int     `json:"weather_code"`
+		RelativeHumid float64 `json:"relative_humidity_2m"`
+	} `json:"current"`
+}
+
+// weatherReport is our own response shape - never pass upstream JSON through
+// as-is, or their API changes become our API changes
+type weatherReport struct {
+	City        string  `json:"city"`
+	Country     string  `json:"country"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Timezone    string  `json:"timezone"`
+	ObservedAt  string  `json:"observed_at"` // Local time at the city, as Open-Meteo reports it
+	Temperature float64 `json:"temperature_c"`
+	WindSpeed   float64 `json:"wind_speed_kmh"`
+	Humidity    float64 `json:"relative_humidity"`
+	WeatherCode int     `json:"weather_code"` // WMO code: 0 clear, 61 rain, 71 snow, ...
+}
+
+// weatherService looks up current weather by city name, with a cache in front
+type weatherService struct {
+	client       *httpClient
+	geocodingURL string
+	forecastURL  string
+	cache        *ttlCache[string, weatherReport]
+}
+
+// newWeatherService creates the service; it uses the shared outbound client
+func newWeatherService(client *httpClient) *weatherService {
+	return &weatherService{
+		client:       client,
+		geocodingURL: envOr("WEATHER_GEOCODING_URL", defaultGeocodingURL),
+		forecastURL:  envOr("WEATHER_FORECAST_URL", defaultForecastURL),
+		cache:        newTTLCache[string, weatherReport](weatherCacheTTL),
+	}
+}
+
+// current returns the weather for a city; cached reports say so with the bool
+// fresh skips the cache lookup - the new report still replaces the cached one
+func (s *weatherService) current(ctx context.Context, city string, fresh bool) (weatherReport, bool, error) {
+	key := strings.ToLower(strings.TrimSpace(city)) // "Berlin " and "berlin" share an entry
+	if report, ok := s.cache.get(key); ok && !fresh {
+		return report, true, nil
+	}
+
+	// Step 1: city name → coordinates
+	// url.Values encodes the query like new URLSearchParams({...}).toString()
+	geoURL := s.geocodingURL + "?" + url.Values{"name": {city}, "count": {"1"}}.Encode()
+	geo, err := getJSON[geocodingResponse](ctx, s.client, geoURL)
+	if err != nil {
+		return weatherReport{}, false, err
+	}
+	if len(geo.Results) == 0 {
+		return weatherReport{}, false, errCityNotFound
+	}
+	place := geo.Results[0]
+
+	// Step 2: coordinates → current conditions
+	fcURL := s.forecastURL + "?" + url.Values{
+		"latitude":  {formatCoord(place.Latitude)},
+		"longitude": {formatCoord(place.Longitude)},
+		"current":   {"temperature_2m,relative_humidity_2m,wind_speed_10m,weather_code"},
+		"timezone":  {"auto"},
+	}.Encode()
+	fc, err := getJSON[forecastResponse](ctx, s.client, fcURL)
+	if err != nil {
+		return weatherReport{}, false, err
+	}
+
+	report := weatherReport{
+		City:        place.Name,
+		Country:     place.Country,
+		Latitude:    place.Latitude,
+		Longitude:   place.Longitude,
+		Timezone:    place.Timezone,
+		ObservedAt:  fc.Current.Time,
+		Temperature: fc.Current.Temperature,
+		WindSpeed:   fc.Current.WindSpeed,
+		Humidity:    fc.Current.RelativeHumid,
+		WeatherCode: fc.Current.WeatherCode,
+	}
+	s.cache.set(key, report)
+	return report, false, nil
+}
+
+// formatCoord prints a coordinate without float noise (52.52437 not 52.524370000000005)
+// -1 precision means "as few digits as needed to round-trip", like String(n) in JS
+func formatCoord(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// weatherHandler returns the current weather for ?city= (GET /weather?city=Berlin)
+func (a *api) weatherHandler(w http.ResponseWriter, r *http.Request) {
+	city := r.URL.Query().Get("city")
+	if strings.TrimSpace(city) == "" {
+		writeJSONError(w, http.StatusBadRequest, "city is required")
+		return
+	}
+
+	// Derive the deadline from the request: if the client disconnects, the
+	// upstream calls are cancelled too (AbortController in Node terms)
+	ctx, cancel := context.WithTimeout(r.Context(), weatherTimeout)
+	defer cancel()
+
+	// Cache-Control: no-cache refreshes the cached report (see consistency.go)
+	report, cached, err := a.weather.current(ctx, city, wantsFresh(r))
+	switch {
+	case errors.Is(err, errCityNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, errCircuitOpen):
+		// The breaker has given up on the upstream for now - say so quickly
+		w.Header().Set("Retry-After", "30")
+		writeJSONError(w, http.StatusServiceUnavailable, "weather service unavailable")
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		writeJSONError(w, http.StatusGatewayTimeout, "weather service timed out")
+		return
+	case err != nil:
+		a.logger.ErrorContext(r.Context(), "weather lookup failed", "city", city, "err", err)
+		// 502 Bad Gateway: we're fine, the server we depend on isn't
+		writeJSONError(w, http.StatusBadGateway, "weather service error")
+		return
+	}
+
+	// X-Cache is informational, like the header CDNs add
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	respondJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,189 @@
+// Package main - server-rendered HTML pages with html/template
+package main
+
+import (
+	"bytes"         // Render into a buffer first so errors don't send half a page
+	"embed"         // go:embed bundles the template files into the binary
+	"html/template" // Like EJS/Pug, but escapes output automatically (XSS-safe by default)
+	"io/fs"         // For walking the embedded template directory
+	"net/http"      // For handler types, forms and redirects
+	"path"          // For turning "templates/pages/users.html" into "users"
+	"strings"       // For trimming the .html extension
+)
+
+// templateFS holds every file under templates/ at compile time
+// The //go:embed comment is a compiler directive - there must be no space after //
+//
+//go:embed templates
+var templateFS embed.FS
+
+// userForm holds the submitted form values so they can be re-displayed
+type userForm struct {
+	Name  string
+	Email string
+}
+
+// usersPage is the data passed to templates/pages/users.html
+// Templates can only read exported (capitalized) fields
+type usersPage struct {
+	Rows  []userRow
+	Form  userForm
+	Error string
+}
+
+// userRow is the data for templates/partials/user_row.html
+type userRow struct {
+	User            // Embedded: the template reads .ID, .Name, .Email directly
+	InlineEdit bool // Show the htmx Edit/Delete buttons (ui_inline_edit flag)
+}
+
+// userRows wraps users for the table, evaluating the inline-edit flag once
+func (a *api) userRows(r *http.Request, users []User) []userRow {
+	inline := a.flags.isEnabled(flagUIInlineEdit, flagKey(r))
+	rows := make([]userRow, len(users))
+	for i, u := range users {
+		rows[i] = userRow{User: localUser(r, u), InlineEdit: inline}
+	}
+	return rows
+}
+
+// pageSet is every parsed template for one locale
+type pageSet struct {
+	pages     map[string]*template.Template // Full pages by name ("users")
+	fragments *template.Template            // Layout + partials on their own, for htmx (see htmx.go)
+}
+
+// loadPages parses the templates once per locale, so {{t "..."}} can be a
+// plain template function bound to that locale (template functions are fixed
+// at parse time and can't see the request)
+func loadPages(assets *assetManifest, messages *catalog) (map[string]pageSet, error) {
+	sets := make(map[string]pageSet)
+	for _, locale := range messages.locales() {
+		set, err := loadPageSet(assets, messages, locale)
+		if err != nil {
+			return nil, err
+		}
+		sets[locale] = set
+	}
+	return sets, nil
+}
+
+// loadPageSet parses the layout and partials once per page
+// Each page gets its own template set because every page defines
+// the same "title" and "content" blocks - sharing one set would let the
+// last parsed page overwrite the others
+// The base set on its own (layout + partials) is kept to render partials as
+// HTML fragments for htmx requests
+func loadPageSet(assets *assetManifest, messages *catalog, locale string) (pageSet, error) {
+	// Template functions must be registered before parsing
+	// {{asset "app.css"}} → "/static/app.1a2b3c4d5e.css"
+	// {{t "Users"}} → "Benutzer" in the de set
+	funcs := template.FuncMap{
+		"asset": assets.url,
+		"t": func(msg string, args ...any) string {
+			return messages.translate(locale, msg, args...)
+		},
+		"lang": func() string { return locale },
+	}
+
+	// The base set contains the layout and all partials
+	// Clones are taken before base is ever executed (Clone fails after Execute)
+	base, err := template.New("").Funcs(funcs).ParseFS(templateFS, "templates/layout.html", "templates/partials/*.html")
+	if err != nil {
+		return pageSet{}, err
+	}
+
+	set := pageSet{pages: make(map[string]*template.Template), fragments: base}
+	files, err := fs.Glob(templateFS, "templates/pages/*.html")
+	if err != nil {
+		return pageSet{}, err
+	}
+	for _, file := range files {
+		// Clone so each page starts from an untouched copy of the base set
+		t, err := base.Clone()
+		if err != nil {
+			return pageSet{}, err
+		}
+		if _, err := t.ParseFS(templateFS, file); err != nil {
+			return pageSet{}, err
+		}
+		name := strings.TrimSuffix(path.Base(file), ".html")
+		set.pages[name] = t
+	}
+	return set, nil
+}
+
+// templatesFor returns the template set for the request's locale
+func (a *api) templatesFor(r *http.Request) pageSet {
+	return a.templates[localeFromContext(r.Context())]
+}
+
+// render executes a page inside the layout and writes it with the given status
+// Express: res.status(status).render('users', data)
+func (a *api) render(w http.ResponseWriter, r *http.Request, status int, page string, data any) {
+	t, ok := a.templatesFor(r).pages[page]
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "page not found: "+page)
+		return
+	}
+
+	// Executing into a buffer means a template error can still become a clean 500
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "layout", data); err != nil {
+		a.logger.ErrorContext(r.Context(), "render page failed", "page", page, "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "template error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// homePageHandler renders the landing page (GET /)
+func (a *api) homePageHandler(w http.ResponseWriter, r *http.Request) {
+	// map[string]any is handy for small pages that don't need a named type
+	a.render(w, r, http.StatusOK, "home", map[string]any{
+		"UserCount": len(a.users.List(r.Context(), tenantFromContext(r.Context()))),
+	})
+}
+
+// usersPageHandler renders the user list and the create form (GET /ui/users)
+func (a *api) usersPageHandler(w http.ResponseWriter, r *http.Request) {
+	tenantUsers := a.users.List(r.Context(), tenantFromContext(r.Context()))
+	a.render(w, r, http.StatusOK, "users", usersPage{Rows: a.userRows(r, tenantUsers)})
+}
+
+// createUserFormHandler handles the HTML form submission (POST /ui/users)
+// Forms arrive as application/x-www-form-urlencoded, not JSON
+func (a *api) createUserFormHandler(w http.ResponseWriter, r *http.Request) {
+	// r.FormValue parses the body on first use - like req.body with express.urlencoded()
+	form := userForm{
+		Name:  r.FormValue("name"),
+		Email: r.FormValue("email"),
+	}
+
+	// Same validation and storage as the JSON API
+	tenantID := tenantFromContext(r.Context())
+	u, err := a.users.Create(r.Context(), User{Name: form.Name, Email: form.Email, TenantID: tenantID})
+
+	// htmx submissions get fragments back instead of a full page or redirect
+	if isHTMX(r) {
+		a.createUserFragment(w, r, u, err)
+		return
+	}
+
+	if err != nil {
+		// Re-render the page with the error and the values the user typed
+		a.render(w, r, http.StatusUnprocessableEntity, "users", usersPage{
+			Rows:  a.userRows(r, a.users.List(r.Context(), tenantID)),
+			Form:  form,
+			Error: a.errorText(r, err), // Error text doubles as the message key (see i18n.go)
+		})
+		return
+	}
+
+	// Post/Redirect/Get: a 303 makes the browser follow up with a GET,
+	// so refreshing the page doesn't resubmit the form
+	http.Redirect(w, r, "/ui/users", http.StatusSeeOther)
+}
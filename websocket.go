@@ -0,0 +1,220 @@
+// Package main - a minimal WebSocket server (RFC 6455) on top of net/http
+package main
+
+import (
+	"bufio"           // For reading frames from the hijacked connection
+	"crypto/sha1"     // The handshake hashes the client's key with SHA-1 (RFC 6455 says so)
+	"encoding/base64" // For Sec-WebSocket-Accept
+	"encoding/binary" // For frame lengths and close codes
+	"errors"          // For the protocol errors
+	"fmt"             // For the handshake response
+	"io"              // For reading payloads
+	"net"             // For the raw connection
+	"net/http"        // For the upgrade
+	"strings"         // For the Connection header tokens
+	"sync"            // For serializing writes
+	"time"            // For deadlines and pings
+)
+
+// The standard library has no WebSocket server (golang.org/x/net/websocket
+// and github.com/coder/websocket are the usual packages; in Node it's ws or
+// socket.io). The protocol is small enough to write out for a server that
+// only pushes messages:
+//
+//  1. The browser sends a normal GET with "Upgrade: websocket" and a random
+//     Sec-WebSocket-Key; we answer 101 Switching Protocols with a hash of it.
+//  2. http.ResponseController.Hijack takes the TCP connection away from
+//     net/http - from here on it's ours, and no middleware sees it anymore.
+//  3. Both sides send frames: a 2-14 byte header (opcode, length, mask)
+//     and the payload. Browsers mask what they send, servers don't.
+//
+// Not implemented, because nothing here needs it: fragmented outgoing
+// messages, compression (permessage-deflate), subprotocols, and reading
+// messages - incoming data frames are read and dropped.
+
+// websocketGUID is the fixed string RFC 6455 appends to the client's key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Connection limits
+const (
+	wsWriteTimeout = 10 * time.Second // A client that doesn't read for this long is dropped
+	wsPingInterval = 30 * time.Second // Keeps proxies from closing idle connections
+	wsMaxFrame     = 4 << 10          // Largest frame accepted from a client; we expect only control frames
+)
+
+// Opcodes (RFC 6455 section 5.2)
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// Close codes (RFC 6455 section 7.4.1)
+const (
+	wsCloseNormal        = 1000
+	wsCloseGoingAway     = 1001 // Server shutting down
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+)
+
+// errWSClosed is returned by readLoop when the client closed the connection
+var errWSClosed = errors.New("websocket closed by client")
+
+// wsConn is one upgraded connection
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex // Serializes writes: readLoop answers pings while the handler sends messages
+}
+
+// acceptWebSocket checks the upgrade request, answers 101 and takes over
+// the connection. On failure it has already written an error response
+// Express + ws: new WebSocketServer({ server }).on('connection', ws => ...)
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		writeJSONError(w, http.StatusBadRequest, "expected a WebSocket upgrade request")
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		// 426 tells the client which version we speak
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeJSONError(w, http.StatusUpgradeRequired, "unsupported WebSocket version")
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	// ResponseController reaches the connection through our wrappers (statusRecorder.Unwrap)
+	// HTTP/2 connections can't be hijacked; browsers use HTTP/1.1 for WebSockets
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "websocket upgrade not supported on this connection")
+		return nil, fmt.Errorf("hijack: %w", err)
+	}
+	// The server's read/write deadlines (and the route timeout) no longer apply
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// headerHasToken reports whether a comma-separated header contains token
+// ("Connection: keep-alive, Upgrade" from Firefox has it too)
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for part := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame sends one unfragmented, unmasked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // FIN: this frame is the whole message
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	// net.Buffers writes header and payload in one syscall (writev) where possible
+	bufs := net.Buffers{header, payload}
+	_, err := bufs.WriteTo(c.conn)
+	return err
+}
+
+// writeText sends a text message (JSON, for us)
+func (c *wsConn) writeText(p []byte) error {
+	return c.writeFrame(wsOpText, p)
+}
+
+// ping sends a ping; the browser answers with a pong, which readLoop reads
+func (c *wsConn) ping() error {
+	return c.writeFrame(wsOpPing, nil)
+}
+
+// close sends a close frame with code and reason, then closes the connection
+func (c *wsConn) close(code uint16, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	c.writeFrame(wsOpClose, append(payload, reason...)) // Best effort: the client may be gone
+	return c.conn.Close()
+}
+
+// readLoop reads frames until the connection ends and returns why
+// It answers pings and close frames and drops everything else. A client
+// that sends nothing - not even a pong - for two ping intervals is gone
+func (c *wsConn) readLoop() error {
+	header := make([]byte, 2)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+		if _, err := io.ReadFull(c.br, header); err != nil {
+			return err
+		}
+		opcode := header[0] & 0x0F
+		masked := header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		// Clients must mask every frame (it stops cache poisoning of proxies)
+		if !masked {
+			c.close(wsCloseProtocolError, "frames from the client must be masked")
+			return errors.New("unmasked client frame")
+		}
+		if length > wsMaxFrame {
+			c.close(wsCloseTooBig, "frame too large")
+			return fmt.Errorf("client frame of %d bytes", length)
+		}
+		var mask [4]byte
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return err
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return err
+			}
+		case wsOpClose:
+			// Echo the close frame, as the closing handshake requires
+			c.writeFrame(wsOpClose, payload)
+			return errWSClosed
+		}
+	}
+}